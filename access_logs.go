@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const defaultAccessLogInterval = 15 * time.Minute
+
+// accessLogFormat is the kind of access logs the importer reads.
+type accessLogFormat string
+
+const (
+	// S3 server access logs, written uncompressed by the bucket
+	accessLogS3 accessLogFormat = "s3"
+	// CloudFront standard logs, gzipped and tab separated
+	accessLogCloudFront accessLogFormat = "cloudfront"
+)
+
+// accessLogSource is where access logs are delivered to.
+type accessLogSource struct {
+	bucket string
+	prefix string
+	format accessLogFormat
+}
+
+// accessLogHit is one request for an object that served some of it.
+type accessLogHit struct {
+	key   string
+	day   time.Time
+	bytes int64
+}
+
+// startAccessLogImport periodically imports new access log files into
+// per-video egress stats. Plays straight from the CDN or bucket never reach
+// the server, the logs are the only place they show up.
+func (cfg *apiConfig) startAccessLogImport(source accessLogSource, interval time.Duration) {
+	if source.prefix == "" {
+		return
+	}
+	cfg.startScheduledTask("access_log_import", interval, func(ctx context.Context) {
+		if err := cfg.importAccessLogs(ctx, source); err != nil {
+			log.Printf("Access log import failed: %v", err)
+		}
+	})
+}
+
+// importAccessLogs imports the log files delivered since the last import.
+// Both S3 and CloudFront name them so that newer files sort after older
+// ones.
+func (cfg *apiConfig) importAccessLogs(ctx context.Context, source accessLogSource) error {
+	last, err := cfg.db.LastImportedAccessLog(source.prefix)
+	if err != nil {
+		return fmt.Errorf("couldn't get last imported access log: %w", err)
+	}
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(source.bucket),
+		Prefix: aws.String(source.prefix),
+	}
+	if last != "" {
+		input.StartAfter = aws.String(last)
+	}
+
+	// object URLs repeat a lot across files, most of them aren't videos
+	videoIDs := map[string]uuid.UUID{}
+	paginator := s3.NewListObjectsV2Paginator(cfg.s3Client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("couldn't list access logs: %w", err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if err := cfg.importAccessLog(ctx, source, key, videoIDs); err != nil {
+				// later files would be skipped for good once they're imported
+				return fmt.Errorf("couldn't import access log %s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) importAccessLog(ctx context.Context, source accessLogSource, key string, videoIDs map[string]uuid.UUID) error {
+	obj, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(source.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+
+	var hits []accessLogHit
+	var lines int
+	switch source.format {
+	case accessLogCloudFront:
+		hits, lines, err = parseCloudFrontLog(obj.Body)
+	default:
+		hits, lines, err = parseS3AccessLog(obj.Body)
+	}
+	if err != nil {
+		return err
+	}
+
+	type egressKey struct {
+		videoID uuid.UUID
+		day     time.Time
+	}
+	byVideo := map[egressKey]*database.EgressDay{}
+	for _, hit := range hits {
+		videoID, ok := videoIDs[hit.key]
+		if !ok {
+			videoID, err = cfg.db.GetVideoIDByObjectURL(cfg.getS3ObjectURL(hit.key))
+			if err != nil {
+				return err
+			}
+			videoIDs[hit.key] = videoID
+		}
+		if videoID == uuid.Nil {
+			continue
+		}
+		k := egressKey{videoID, hit.day}
+		e, ok := byVideo[k]
+		if !ok {
+			e = &database.EgressDay{VideoID: videoID, Day: hit.day}
+			byVideo[k] = e
+		}
+		e.Bytes += hit.bytes
+		e.Requests++
+	}
+	egress := make([]database.EgressDay, 0, len(byVideo))
+	for _, e := range byVideo {
+		egress = append(egress, *e)
+	}
+
+	_, err = cfg.db.RecordAccessLog(key, lines, egress)
+	return err
+}
+
+// parseS3AccessLog reads the GETs that served objects from an S3 server
+// access log, see
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/LogFormat.html.
+func parseS3AccessLog(r io.Reader) ([]accessLogHit, int, error) {
+	var hits []accessLogHit
+	lines := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		lines++
+		fields := splitS3LogLine(scanner.Text())
+		// owner, bucket, time, ip, requester, request ID, operation, key,
+		// request URI, status, error code, bytes sent, ...
+		if len(fields) < 12 || fields[6] != "REST.GET.OBJECT" || !servedStatus(fields[9]) {
+			continue
+		}
+		t, err := time.Parse("02/Jan/2006:15:04:05 -0700", fields[2])
+		if err != nil {
+			continue
+		}
+		key, err := url.PathUnescape(fields[7])
+		if err != nil {
+			continue
+		}
+		hits = append(hits, accessLogHit{key: key, day: logDay(t), bytes: logBytes(fields[11])})
+	}
+	return hits, lines, scanner.Err()
+}
+
+// splitS3LogLine splits a line at spaces, except inside "quoted" and
+// [bracketed] fields, which are returned without their delimiters.
+func splitS3LogLine(line string) []string {
+	var fields []string
+	for line != "" {
+		var field string
+		switch line[0] {
+		case '"', '[':
+			end := byte('"')
+			if line[0] == '[' {
+				end = ']'
+			}
+			i := strings.IndexByte(line[1:], end)
+			if i < 0 {
+				return append(fields, line[1:])
+			}
+			field, line = line[1:i+1], line[i+2:]
+		default:
+			field, line, _ = strings.Cut(line, " ")
+		}
+		fields = append(fields, field)
+		line = strings.TrimLeft(line, " ")
+	}
+	return fields
+}
+
+// parseCloudFrontLog reads the GETs that served objects from a gzipped
+// CloudFront standard log, whose #Fields header names the columns, see
+// https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/standard-logs-reference.html.
+func parseCloudFrontLog(r io.Reader) ([]accessLogHit, int, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer gz.Close()
+
+	var hits []accessLogHit
+	lines := 0
+	columns := map[string]int{}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if names, ok := strings.CutPrefix(line, "#Fields:"); ok {
+			for i, name := range strings.Fields(names) {
+				columns[name] = i
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines++
+		fields := strings.Split(line, "\t")
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(fields) {
+				return ""
+			}
+			return fields[i]
+		}
+		if field("cs-method") != "GET" || !servedStatus(field("sc-status")) {
+			continue
+		}
+		t, err := time.Parse(time.DateOnly, field("date"))
+		if err != nil {
+			continue
+		}
+		key, err := url.PathUnescape(strings.TrimPrefix(field("cs-uri-stem"), "/"))
+		if err != nil {
+			continue
+		}
+		hits = append(hits, accessLogHit{key: key, day: t, bytes: logBytes(field("sc-bytes"))})
+	}
+	return hits, lines, scanner.Err()
+}
+
+// servedStatus reports whether a logged status served content, whole or a
+// range of it.
+func servedStatus(status string) bool {
+	return status == "200" || status == "206"
+}
+
+// logBytes parses a logged byte count, "-" when nothing was sent.
+func logBytes(s string) int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func logDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
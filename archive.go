@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	defaultArchiveInterval = time.Hour
+	archiveBatch           = 20
+)
+
+// archiveTarget is where processed videos are mirrored for on-prem
+// archival. Paths are slash separated and relative to the target's root.
+type archiveTarget interface {
+	// Put stores r at name, replacing what was there only once it is
+	// complete.
+	Put(ctx context.Context, name string, r io.Reader) error
+	// Size returns the size of the file at name, or an error wrapping
+	// os.ErrNotExist when there is none.
+	Size(ctx context.Context, name string) (int64, error)
+	// String describes the target without credentials, for reports.
+	String() string
+}
+
+// newArchiveTarget parses ARCHIVE_TARGET, either a mounted directory given
+// as a path or file:// URL, or an sftp://user@host[:port]/path URL.
+func newArchiveTarget(rawURL, keyFile, knownHostsFile string) (archiveTarget, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "", "file":
+		dir := u.Path
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("archive directory %q must be an absolute path", dir)
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", dir)
+		}
+		return dirArchive{root: dir}, nil
+	case "sftp":
+		if u.User == nil || u.User.Username() == "" {
+			return nil, errors.New("the sftp URL must name a user")
+		}
+		if keyFile == "" || knownHostsFile == "" {
+			return nil, errors.New("ARCHIVE_SFTP_KEY_FILE and ARCHIVE_SFTP_KNOWN_HOSTS must be set for an sftp target")
+		}
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse ARCHIVE_SFTP_KEY_FILE: %w", err)
+		}
+		hostKeys, err := knownhosts.New(knownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read ARCHIVE_SFTP_KNOWN_HOSTS: %w", err)
+		}
+		addr := u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "22")
+		}
+		return &sftpArchive{
+			addr: addr,
+			root: u.Path,
+			config: &ssh.ClientConfig{
+				User:            u.User.Username(),
+				Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+				HostKeyCallback: hostKeys,
+				Timeout:         30 * time.Second,
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive target scheme %q", u.Scheme)
+	}
+}
+
+// dirArchive writes to a local directory, typically an NFS mount.
+type dirArchive struct {
+	root string
+}
+
+func (a dirArchive) Put(ctx context.Context, name string, r io.Reader) error {
+	dest := filepath.Join(a.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".partial-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return err
+	}
+	// NFS may only report write errors on sync or close
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+func (a dirArchive) Size(ctx context.Context, name string) (int64, error) {
+	info, err := os.Stat(filepath.Join(a.root, filepath.FromSlash(name)))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (a dirArchive) String() string {
+	return a.root
+}
+
+// sftpArchive writes over SFTP. The connection is opened on first use and
+// reopened after a failure.
+type sftpArchive struct {
+	addr   string
+	root   string
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+func (a *sftpArchive) session() (*sftp.Client, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.client != nil {
+		return a.client, nil
+	}
+	conn, err := ssh.Dial("tcp", a.addr, a.config)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to %s: %w", a.addr, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("couldn't start sftp session: %w", err)
+	}
+	a.conn, a.client = conn, client
+	return client, nil
+}
+
+// reset drops the connection after an error, it may be the cause.
+func (a *sftpArchive) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.client != nil {
+		a.client.Close()
+		a.conn.Close()
+		a.client, a.conn = nil, nil
+	}
+}
+
+func (a *sftpArchive) Put(ctx context.Context, name string, r io.Reader) error {
+	client, err := a.session()
+	if err != nil {
+		return err
+	}
+	err = a.put(client, path.Join(a.root, name), r)
+	if err != nil {
+		a.reset()
+	}
+	return err
+}
+
+func (a *sftpArchive) put(client *sftp.Client, dest string, r io.Reader) error {
+	if err := client.MkdirAll(path.Dir(dest)); err != nil {
+		return err
+	}
+	partial := dest + ".partial"
+	f, err := client.Create(partial)
+	if err != nil {
+		return err
+	}
+	if _, err := f.ReadFrom(r); err != nil {
+		f.Close()
+		client.Remove(partial)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		client.Remove(partial)
+		return err
+	}
+	// plain SFTP rename refuses to replace an existing file
+	return client.PosixRename(partial, dest)
+}
+
+func (a *sftpArchive) Size(ctx context.Context, name string) (int64, error) {
+	client, err := a.session()
+	if err != nil {
+		return 0, err
+	}
+	info, err := client.Stat(path.Join(a.root, name))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			a.reset()
+		}
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (a *sftpArchive) String() string {
+	return "sftp://" + a.addr + a.root
+}
+
+func (cfg *apiConfig) startArchiveMirror(interval time.Duration) {
+	if cfg.archive == nil {
+		return
+	}
+	cfg.startScheduledTask("archive_mirror", interval, cfg.mirrorToArchive)
+}
+
+// mirrorToArchive copies the current media of every video that isn't in the
+// archive yet. Replaced media gets mirrored as a new file, earlier copies
+// stay.
+func (cfg *apiConfig) mirrorToArchive(ctx context.Context) {
+	for ctx.Err() == nil {
+		videos, err := cfg.db.GetUnarchivedVideos(archiveBatch)
+		if err != nil {
+			log.Printf("Couldn't load videos to archive: %v", err)
+			return
+		}
+
+		mirrored := 0
+		for _, video := range videos {
+			if err := cfg.mirrorVideo(ctx, video); err != nil {
+				log.Printf("Couldn't archive video %s: %v", video.ID, err)
+				continue
+			}
+			mirrored++
+		}
+		// stop when done, or when every video in the batch keeps failing
+		if len(videos) < archiveBatch || mirrored == 0 {
+			return
+		}
+	}
+}
+
+func (cfg *apiConfig) mirrorVideo(ctx context.Context, video database.Video) error {
+	key, err := cfg.getS3KeyFromURL(*video.VideoURL)
+	if err != nil {
+		return fmt.Errorf("couldn't determine object key: %w", err)
+	}
+
+	obj, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't download video: %w", err)
+	}
+	defer obj.Body.Close()
+
+	counter := &countingReader{r: obj.Body}
+	if err := cfg.archive.Put(ctx, key, counter); err != nil {
+		return fmt.Errorf("couldn't write to archive: %w", err)
+	}
+
+	return cfg.db.RecordArchivedObject(database.ArchivedObject{
+		VideoID:  video.ID,
+		VideoURL: *video.VideoURL,
+		Path:     key,
+		Size:     counter.n,
+	})
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	maxVariantDimension = 2000
+	defaultImageFormats = "avif,webp"
+)
+
+// variantStore generates derived versions of assets on demand and keeps them
+// on disk. Generation runs in a bounded number of slots, and concurrent
+// requests for the same variant share one run.
+type variantStore struct {
+	dir   string
+	slots chan struct{}
+
+	mu       sync.Mutex
+	inflight map[string]*variantCall
+}
+
+type variantCall struct {
+	done chan struct{}
+	err  error
+}
+
+func newVariantStore(dir string, workers int) (*variantStore, error) {
+	err := os.MkdirAll(dir, privateDirMode)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create variant cache dir: %w", err)
+	}
+	return &variantStore{
+		dir:      dir,
+		slots:    make(chan struct{}, workers),
+		inflight: make(map[string]*variantCall),
+	}, nil
+}
+
+// get returns the path of the variant named key, calling generate to write
+// it to the given path when it isn't cached yet.
+func (vs *variantStore) get(ctx context.Context, key string, generate func(dst string) error) (string, error) {
+	path := filepath.Join(vs.dir, key)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	vs.mu.Lock()
+	if call, ok := vs.inflight[key]; ok {
+		vs.mu.Unlock()
+		select {
+		case <-call.done:
+			return path, call.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	call := &variantCall{done: make(chan struct{})}
+	vs.inflight[key] = call
+	vs.mu.Unlock()
+
+	defer func() {
+		vs.mu.Lock()
+		delete(vs.inflight, key)
+		vs.mu.Unlock()
+		close(call.done)
+	}()
+
+	select {
+	case vs.slots <- struct{}{}:
+	case <-ctx.Done():
+		call.err = ctx.Err()
+		return "", call.err
+	}
+	defer func() { <-vs.slots }()
+
+	// written under another name so readers never see a partial file, the
+	// extension stays last since ffmpeg picks the format from it
+	tmpPath := filepath.Join(vs.dir, "tmp-"+key)
+	call.err = generate(tmpPath)
+	if call.err == nil {
+		call.err = os.Rename(tmpPath, path)
+	}
+	if call.err != nil {
+		os.Remove(tmpPath)
+		return "", call.err
+	}
+	return path, nil
+}
+
+type resizeOptions struct {
+	width  int
+	height int
+	fit    string
+	// set for sizes taken from client hints, which only say how large the
+	// image is shown, not that it's worth blowing up
+	noUpscale bool
+	// Save-Data: encode at lower quality
+	lowQuality bool
+	// what cover crops keep in view, nil for the center
+	focus *database.FocusPoint
+}
+
+func parseResizeOptions(r *http.Request) (resizeOptions, error) {
+	q := r.URL.Query()
+	opts := resizeOptions{fit: q.Get("fit")}
+	if opts.fit == "" {
+		opts.fit = "contain"
+	}
+	if opts.fit != "contain" && opts.fit != "cover" && opts.fit != "fill" {
+		return resizeOptions{}, fmt.Errorf("fit must be contain, cover or fill")
+	}
+
+	for _, dim := range []struct {
+		name string
+		dest *int
+	}{{"w", &opts.width}, {"h", &opts.height}} {
+		v := q.Get(dim.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxVariantDimension {
+			return resizeOptions{}, fmt.Errorf("%s must be between 1 and %d", dim.name, maxVariantDimension)
+		}
+		*dim.dest = n
+	}
+
+	if q.Has("fx") || q.Has("fy") {
+		focus, err := parseFocusPoint(q.Get("fx"), q.Get("fy"))
+		if err != nil {
+			return resizeOptions{}, err
+		}
+		opts.focus = focus
+	}
+	return opts, nil
+}
+
+// parseFocusPoint reads a focus point given as fractions between 0 and 1,
+// rounded to hundredths so there's a bounded number of crops to cache.
+func parseFocusPoint(fx, fy string) (*database.FocusPoint, error) {
+	var coords [2]float64
+	for i, v := range []string{fx, fy} {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			return nil, fmt.Errorf("fx and fy must both be between 0 and 1")
+		}
+		coords[i] = math.Round(f*100) / 100
+	}
+	return &database.FocusPoint{X: coords[0], Y: coords[1]}, nil
+}
+
+// scaleFilter builds the ffmpeg filter for opts. With a single dimension the
+// other follows the aspect ratio and fit doesn't matter.
+func (opts resizeOptions) scaleFilter() string {
+	switch {
+	case opts.noUpscale && opts.height == 0:
+		return fmt.Sprintf("scale='min(%d,iw)':-1", opts.width)
+	case opts.width == 0:
+		return fmt.Sprintf("scale=-1:%d", opts.height)
+	case opts.height == 0:
+		return fmt.Sprintf("scale=%d:-1", opts.width)
+	case opts.fit == "cover" && opts.focus != nil:
+		// the crop moves over what the scaled image has beyond the size
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d:(iw-%d)*%g:(ih-%d)*%g",
+			opts.width, opts.height, opts.width, opts.height, opts.width, opts.focus.X, opts.height, opts.focus.Y)
+	case opts.fit == "cover":
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d", opts.width, opts.height, opts.width, opts.height)
+	case opts.fit == "fill":
+		return fmt.Sprintf("scale=%d:%d", opts.width, opts.height)
+	}
+	return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", opts.width, opts.height)
+}
+
+// imageEncoders maps negotiable formats to their extension and the ffmpeg
+// arguments used to encode them.
+var imageEncoders = map[string]struct {
+	ext     string
+	args    []string
+	lowArgs []string
+}{
+	"image/avif": {".avif", []string{"-c:v", "libaom-av1", "-still-picture", "1", "-crf", "32", "-b:v", "0"}, []string{"-crf", "45"}},
+	"image/webp": {".webp", []string{"-c:v", "libwebp", "-quality", "80"}, []string{"-quality", "50"}},
+}
+
+// lowQualityJPEGArgs re-encode JPEGs kept in their format for Save-Data.
+var lowQualityJPEGArgs = []string{"-q:v", "10"}
+
+// transformImage writes src to dst, resized when opts has dimensions and
+// re-encoded when format is set.
+func transformImage(commands commandRunner, src, dst string, opts resizeOptions, format string) error {
+	args := []string{"-y", "-v", "error", "-i", src}
+	if opts.width > 0 || opts.height > 0 {
+		args = append(args, "-vf", opts.scaleFilter())
+	}
+	if format != "" {
+		args = append(args, imageEncoders[format].args...)
+		if opts.lowQuality {
+			// later options win
+			args = append(args, imageEncoders[format].lowArgs...)
+		}
+	} else if opts.lowQuality && isJPEG(src) {
+		args = append(args, lowQualityJPEGArgs...)
+	}
+	args = append(args, "-frames:v", "1", dst)
+
+	var stderr bytes.Buffer
+	err := commands.Run(context.Background(), nil, &stderr, "ffmpeg", args...)
+	if err != nil {
+		return fmt.Errorf("failed to transform image: %w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// imageFormats holds the modern formats thumbnails may be converted to, in
+// order of preference. A format is dropped once its encoder turns out to be
+// missing from the local ffmpeg build.
+type imageFormats struct {
+	mu        sync.RWMutex
+	preferred []string
+}
+
+func parseImageFormats(s string) (*imageFormats, error) {
+	formats := &imageFormats{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "none" {
+			continue
+		}
+		format := "image/" + name
+		if _, ok := imageEncoders[format]; !ok {
+			return nil, fmt.Errorf("unsupported image format %q", name)
+		}
+		formats.preferred = append(formats.preferred, format)
+	}
+	return formats, nil
+}
+
+// negotiate picks the preferred format the client explicitly accepts, or ""
+// to keep the original format. Wildcards don't count, since browsers send
+// image/* without supporting every format.
+func (f *imageFormats) negotiate(accept string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		accepted[mediaType] = true
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, format := range f.preferred {
+		if accepted[format] {
+			return format
+		}
+	}
+	return ""
+}
+
+func (f *imageFormats) disable(format string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, preferred := range f.preferred {
+		if preferred == format {
+			f.preferred = append(f.preferred[:i:i], f.preferred[i+1:]...)
+			return
+		}
+	}
+}
+
+// assetVariantMiddleware serves resized copies of assets requested with w
+// and/or h parameters, e.g. /assets/{id}?w=320&h=180&fit=cover, where fx and
+// fy move cover crops toward a focus point, and converts
+// JPEG and PNG images to AVIF or WebP for clients that accept them. Client
+// hints adjust both, see clientHints.apply. Everything else goes to next.
+func (cfg *apiConfig) assetVariantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/assets/")
+		if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		opts, err := parseResizeOptions(r)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, codeInvalidResizeOptions, err.Error(), err)
+			return
+		}
+
+		ext := strings.ToLower(filepath.Ext(name))
+		format := ""
+		if ext == ".jpg" || ext == ".jpeg" || ext == ".png" {
+			w.Header().Add("Vary", "Accept")
+			format = cfg.imageFormats.negotiate(r.Header.Get("Accept"))
+			w.Header().Add("Vary", clientHintHeaders)
+			opts = clientHintsFromRequest(r).apply(opts)
+			// PNGs are lossless, there is no quality to give up
+			if format == "" && !isJPEG(name) {
+				opts.lowQuality = false
+			}
+		}
+
+		resize := opts.width > 0 || opts.height > 0
+		if !resize && format == "" && !opts.lowQuality {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		src := cfg.getAssetDiskPath(name)
+		info, err := os.Stat(src)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				http.NotFound(w, r)
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, codeCouldntReadAsset, "Couldn't read asset", err)
+			return
+		}
+
+		path, err := cfg.assetVariant(r.Context(), name, info, opts, format)
+		if err != nil && format != "" {
+			log.Printf("Couldn't convert %s to %s, disabling the format: %v", name, format, err)
+			cfg.imageFormats.disable(format)
+			path, err = cfg.assetVariant(r.Context(), name, info, opts, "")
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntResizeAsset, "Couldn't resize asset", err)
+			return
+		}
+		if path == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		http.ServeFile(w, r, path)
+	})
+}
+
+// assetVariant returns the cached variant of the named asset, or "" when the
+// options leave the original as is.
+func (cfg *apiConfig) assetVariant(ctx context.Context, name string, info os.FileInfo, opts resizeOptions, format string) (string, error) {
+	if opts.width == 0 && opts.height == 0 && format == "" && !opts.lowQuality {
+		return "", nil
+	}
+
+	ext := filepath.Ext(name)
+	outExt := ext
+	if format != "" {
+		outExt = imageEncoders[format].ext
+	}
+
+	// the modification time keeps replaced assets from hitting old variants
+	fit := opts.fit
+	if opts.noUpscale {
+		fit += "-max"
+	}
+	if opts.fit == "cover" && opts.width > 0 && opts.height > 0 && opts.focus != nil {
+		fit += fmt.Sprintf("-at%gx%g", opts.focus.X, opts.focus.Y)
+	}
+	if opts.lowQuality {
+		fit += "-lq"
+	}
+	key := fmt.Sprintf("%s-%d-%dx%d-%s%s", strings.TrimSuffix(name, ext), info.ModTime().UnixNano(), opts.width, opts.height, fit, outExt)
+	return cfg.assetVariants.get(ctx, key, func(dst string) error {
+		return transformImage(cfg.commands, cfg.getAssetDiskPath(name), dst, opts, format)
+	})
+}
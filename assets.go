@@ -1,7 +1,11 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,11 +13,21 @@ import (
 
 func (cfg apiConfig) ensureAssetsDir() error {
 	if _, err := os.Stat(cfg.assetsRoot); os.IsNotExist(err) {
-		return os.Mkdir(cfg.assetsRoot, 0755)
+		return os.Mkdir(cfg.assetsRoot, assetDirMode)
 	}
 	return nil
 }
 
+// makeRandomID returns a random URL-safe base64 string for naming assets.
+func makeRandomID() (string, error) {
+	randBytes := make([]byte, 32)
+	_, err := rand.Read(randBytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randBytes), nil
+}
+
 func getAssetPath(videoID string, mediaType string) string {
 	ext := mediaTypeToExt(mediaType)
 	return fmt.Sprintf("%s%s", videoID, ext)
@@ -23,9 +37,36 @@ func (cfg apiConfig) getAssetDiskPath(assetPath string) string {
 	return filepath.Join(cfg.assetsRoot, assetPath)
 }
 
-func (cfg apiConfig) getAssetURL(assetPath string) string {
-	fmt.Println("PORT: ", cfg.port)
-	return fmt.Sprintf("http://localhost:%s/assets/%s", cfg.port, assetPath)
+// getAssetURL builds the public URL of a file in the assets directory. With
+// no ASSET_BASE_URL it points at this server as the client reached it, which
+// behind a trusted proxy is the proxy's scheme and host.
+func (cfg apiConfig) getAssetURL(r *http.Request, assetPath string) string {
+	if cfg.assetBaseURL != "" {
+		return strings.TrimSuffix(cfg.assetBaseURL, "/") + "/" + assetPath
+	}
+	return fmt.Sprintf("%s/assets/%s", publicBaseURL(r), assetPath)
+}
+
+// parseAssetBaseURL accepts an absolute http(s) URL, e.g. a CDN domain, or
+// a path starting with "/" for assets served relative to the site.
+func parseAssetBaseURL(s string) (string, error) {
+	if s == "" || strings.HasPrefix(s, "/") {
+		return s, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%q is neither an absolute http(s) URL nor a path", s)
+	}
+	return s, nil
+}
+
+// absoluteURL resolves a URL stored relative to the site against the
+// request, for places like Open Graph tags that need absolute URLs.
+func absoluteURL(r *http.Request, assetURL string) string {
+	if !strings.HasPrefix(assetURL, "/") || strings.HasPrefix(assetURL, "//") {
+		return assetURL
+	}
+	return publicBaseURL(r) + assetURL
 }
 
 func getAssetFromURL(assetURL string) string {
@@ -41,3 +82,30 @@ func mediaTypeToExt(mediaType string) string {
 
 	return "." + parts[1]
 }
+
+func (cfg apiConfig) getS3ObjectURL(key string) string {
+	return cfg.s3Endpoint.objectURLPrefix(cfg.s3Bucket, cfg.s3Region) + key
+}
+
+// getS3KeyFromURL returns the key of an object URL. With path-style URLs
+// the bucket in front of the key is dropped.
+func (cfg apiConfig) getS3KeyFromURL(objectURL string) (string, error) {
+	u, err := url.Parse(objectURL)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if cfg.s3Endpoint.pathStyle {
+		key = strings.TrimPrefix(key, cfg.s3Bucket+"/")
+	}
+	if key == "" {
+		return "", fmt.Errorf("no object key in URL %q", objectURL)
+	}
+	return key, nil
+}
+
+// isS3ObjectURL reports whether assetURL points into the bucket, as opposed
+// to a file served from the local assets directory.
+func (cfg apiConfig) isS3ObjectURL(assetURL string) bool {
+	return strings.HasPrefix(assetURL, cfg.getS3ObjectURL(""))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+const adminActor = "admin"
+
+func userActor(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
+
+// recordAudit appends to the audit log. The action already happened, so a
+// failure to record it is only logged.
+func (cfg *apiConfig) recordAudit(actor, action, targetType, targetID string, details any) {
+	data, err := json.Marshal(details)
+	if err != nil {
+		log.Printf("Couldn't marshal audit details of %s: %v", action, err)
+		data = []byte("null")
+	}
+	err = cfg.db.CreateAuditEntry(actor, action, targetType, targetID, string(data))
+	if err != nil {
+		log.Printf("Couldn't record %s by %s on %s %s: %v", action, actor, targetType, targetID, err)
+	}
+}
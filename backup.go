@@ -0,0 +1,430 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	dbBackupPrefix           = "db-backups/"
+	defaultDBBackupInterval  = 6 * time.Hour
+	defaultDBBackupRetention = 7 * 24 * time.Hour
+	// how many unmatched objects the restore report lists by name
+	restoreReportSample = 20
+)
+
+// matches keys made by videoObjectKey
+var videoObjectKeyPattern = regexp.MustCompile(`^([^/]+)/([0-9a-f-]{36})/v([0-9]+)$`)
+
+// startDBBackups uploads a snapshot of the database to bucket every
+// interval and deletes snapshots older than retention, always keeping the
+// newest. The bucket holds password hashes and tokens, so it must not be
+// the public media bucket.
+func (cfg *apiConfig) startDBBackups(bucket string, interval, retention time.Duration) {
+	if bucket == "" {
+		return
+	}
+	cfg.startScheduledTask("db_backup", interval, func(ctx context.Context) {
+		key, err := cfg.backupDB(ctx, bucket)
+		if err != nil {
+			log.Printf("Database backup failed: %v", err)
+			return
+		}
+		log.Printf("Backed up database to %s", key)
+		if err := cfg.pruneDBBackups(ctx, bucket, retention); err != nil {
+			log.Printf("Couldn't prune database backups: %v", err)
+		}
+	})
+}
+
+func (cfg *apiConfig) backupDB(ctx context.Context, bucket string) (string, error) {
+	dir, err := os.MkdirTemp("", "tubely-backup")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot := filepath.Join(dir, "tubely.db")
+	if err := cfg.db.BackupTo(snapshot); err != nil {
+		return "", fmt.Errorf("couldn't snapshot database: %w", err)
+	}
+	f, err := os.Open(snapshot)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// compressed on the way to S3, snapshots are mostly text
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, f)
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	key := dbBackupPrefix + time.Now().UTC().Format("20060102T150405Z") + ".db.gz"
+	uploader := manager.NewUploader(cfg.s3Client)
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		Body:                 pr,
+		ContentType:          aws.String("application/gzip"),
+		ServerSideEncryption: s3types.ServerSideEncryptionAes256,
+		ChecksumAlgorithm:    s3types.ChecksumAlgorithmSha256,
+		Metadata: map[string]string{
+			"schema-version": strconv.Itoa(database.CurrentSchemaVersion),
+		},
+	})
+	// unblocks the compressor when the upload gave up early
+	pr.CloseWithError(err)
+	if err != nil {
+		return "", fmt.Errorf("couldn't upload backup: %w", err)
+	}
+	return key, nil
+}
+
+func (cfg *apiConfig) pruneDBBackups(ctx context.Context, bucket string, retention time.Duration) error {
+	backups, err := listDBBackups(ctx, cfg.s3Client, bucket)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-retention)
+	// the newest is last and always kept
+	for _, backup := range backups[:max(len(backups)-1, 0)] {
+		if aws.ToTime(backup.LastModified).After(cutoff) {
+			continue
+		}
+		_, err := cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    backup.Key,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't delete %s: %w", aws.ToString(backup.Key), err)
+		}
+	}
+	return nil
+}
+
+// listDBBackups returns the backups in bucket, oldest first.
+func listDBBackups(ctx context.Context, client *s3.Client, bucket string) ([]s3types.Object, error) {
+	var backups []s3types.Object
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(dbBackupPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't list backups: %w", err)
+		}
+		backups = append(backups, page.Contents...)
+	}
+	// keys embed the time they were taken
+	sort.Slice(backups, func(i, j int) bool {
+		return aws.ToString(backups[i].Key) < aws.ToString(backups[j].Key)
+	})
+	return backups, nil
+}
+
+// runDBRestore replaces the database at pathToDB with a backup. The backup
+// must not be newer than this build's schema; older ones are migrated. It is
+// then reconciled with the media bucket: videos whose newer versions were
+// uploaded after the backup are pointed at them again, and media the backup
+// doesn't know about or references that are gone are reported. The server
+// must be stopped while this runs.
+func runDBRestore(args []string, pathToDB string) error {
+	fs := flag.NewFlagSet("restore-db", flag.ExitOnError)
+	backupKey := fs.String("backup", "", "key of the backup to restore, the newest by default")
+	force := fs.Bool("force", false, "replace an existing database, which is kept next to it")
+	fs.Parse(args)
+
+	backupBucket := os.Getenv("DB_BACKUP_BUCKET")
+	mediaBucket := os.Getenv("S3_BUCKET")
+	region := os.Getenv("S3_REGION")
+	if backupBucket == "" || mediaBucket == "" || region == "" {
+		return errors.New("DB_BACKUP_BUCKET, S3_BUCKET and S3_REGION must be set")
+	}
+	if _, err := os.Stat(pathToDB); err == nil && !*force {
+		return fmt.Errorf("%s exists, pass -force to replace it", pathToDB)
+	}
+
+	ctx := context.Background()
+	awsConfig, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config: %w", err)
+	}
+	s3Endpoint, err := s3EndpointSettingsFromEnv()
+	if err != nil {
+		return err
+	}
+	s3Credentials, err := s3CredentialSettingsFromEnv()
+	if err != nil {
+		return err
+	}
+	client := s3.NewFromConfig(s3Credentials.config(awsConfig), s3Endpoint.apply)
+
+	if *backupKey == "" {
+		backups, err := listDBBackups(ctx, client, backupBucket)
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			return fmt.Errorf("no backups in %s", backupBucket)
+		}
+		*backupKey = aws.ToString(backups[len(backups)-1].Key)
+	}
+
+	// next to the database, so it can be renamed into place
+	restorePath := pathToDB + ".restore"
+	os.Remove(restorePath)
+	if err := downloadDBBackup(ctx, client, backupBucket, *backupKey, restorePath); err != nil {
+		os.Remove(restorePath)
+		return err
+	}
+
+	version, err := database.ReadSchemaVersion(restorePath)
+	if err != nil {
+		os.Remove(restorePath)
+		return fmt.Errorf("backup %s is unusable: %w", *backupKey, err)
+	}
+	if version > database.CurrentSchemaVersion {
+		os.Remove(restorePath)
+		return fmt.Errorf("backup %s has schema version %d, this build only knows up to %d", *backupKey, version, database.CurrentSchemaVersion)
+	}
+	log.Printf("Restoring %s (schema version %d)", *backupKey, version)
+
+	db, err := database.NewClient(restorePath)
+	if err != nil {
+		os.Remove(restorePath)
+		return fmt.Errorf("couldn't migrate backup: %w", err)
+	}
+	err = reconcileRestoredDB(ctx, db, client, mediaBucket, s3Endpoint.objectURLPrefix(mediaBucket, region))
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(restorePath)
+		return err
+	}
+
+	if _, err := os.Stat(pathToDB); err == nil {
+		// the WAL files belong to the old database and must move with it
+		keep := fmt.Sprintf("%s.pre-restore-%s", pathToDB, time.Now().UTC().Format("20060102T150405Z"))
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			err := os.Rename(pathToDB+suffix, keep+suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("couldn't move the existing database aside: %w", err)
+			}
+		}
+		log.Printf("Kept the replaced database as %s", keep)
+	}
+	if err := os.Rename(restorePath, pathToDB); err != nil {
+		return fmt.Errorf("couldn't move restored database into place: %w", err)
+	}
+	log.Printf("Restored database to %s", pathToDB)
+	return nil
+}
+
+func downloadDBBackup(ctx context.Context, client *s3.Client, bucket, key, dest string) error {
+	obj, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't download backup %s: %w", key, err)
+	}
+	defer obj.Body.Close()
+
+	gz, err := gzip.NewReader(obj.Body)
+	if err != nil {
+		return fmt.Errorf("backup %s isn't gzip compressed: %w", key, err)
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, gz); err != nil {
+		f.Close()
+		return fmt.Errorf("couldn't decompress backup %s: %w", key, err)
+	}
+	return f.Close()
+}
+
+// reconcileRestoredDB compares a restored database with the objects in the
+// media bucket, whose URLs start with urlPrefix.
+func reconcileRestoredDB(ctx context.Context, db database.Client, client *s3.Client, bucket, urlPrefix string) error {
+	objects := map[string]s3types.Object{}
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("couldn't list media bucket: %w", err)
+		}
+		for _, obj := range page.Contents {
+			objects[aws.ToString(obj.Key)] = obj
+		}
+	}
+
+	urls, err := db.GetReferencedObjectURLs()
+	if err != nil {
+		return fmt.Errorf("couldn't load referenced objects: %w", err)
+	}
+	referenced := map[string]bool{}
+	var missing []string
+	for _, u := range urls {
+		key, ok := strings.CutPrefix(u, urlPrefix)
+		if !ok {
+			continue
+		}
+		referenced[key] = true
+		if _, ok := objects[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+
+	// media uploaded after the backup, by video
+	newer := map[uuid.UUID][]versionObject{}
+	var unknown []string
+	for key := range objects {
+		if referenced[key] {
+			continue
+		}
+		m := videoObjectKeyPattern.FindStringSubmatch(key)
+		if m == nil {
+			unknown = append(unknown, key)
+			continue
+		}
+		videoID, err := uuid.Parse(m[2])
+		if err != nil {
+			unknown = append(unknown, key)
+			continue
+		}
+		version, _ := strconv.Atoi(m[3])
+		newer[videoID] = append(newer[videoID], versionObject{key: key, version: version})
+	}
+
+	relinked := 0
+	for videoID, versions := range newer {
+		n, err := relinkVideoVersions(ctx, db, client, bucket, urlPrefix, videoID, versions)
+		if err != nil {
+			log.Printf("Couldn't relink video %s: %v", videoID, err)
+		}
+		relinked += n
+		// sorted by relinkVideoVersions, the relinked ones come last
+		for _, v := range versions[:len(versions)-n] {
+			unknown = append(unknown, v.key)
+		}
+	}
+
+	log.Printf("Relinked %d video versions uploaded after the backup", relinked)
+	reportObjects("referenced objects missing from the bucket", missing)
+	reportObjects("objects the restored database doesn't know about", unknown)
+	return nil
+}
+
+type versionObject struct {
+	key     string
+	version int
+}
+
+// relinkVideoVersions records versions of a video found in the bucket but
+// not in the restored database and makes the newest one current. It returns
+// how many were recorded, always the newest of versions. Versions of videos
+// the backup doesn't have and versions encrypted with their owner's key,
+// which can't be inspected, are left alone.
+func relinkVideoVersions(ctx context.Context, db database.Client, client *s3.Client, bucket, urlPrefix string, videoID uuid.UUID, versions []versionObject) (int, error) {
+	sort.Slice(versions, func(i, j int) bool { return versions[i].version < versions[j].version })
+
+	video, err := db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		return 0, err
+	}
+	next, err := db.GetNextVideoVersion(videoID)
+	if err != nil {
+		return 0, err
+	}
+	first := sort.Search(len(versions), func(i int) bool { return versions[i].version >= next })
+
+	var params []database.CreateVideoVersionParams
+	for _, v := range versions[first:] {
+		head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:       aws.String(bucket),
+			Key:          aws.String(v.key),
+			ChecksumMode: s3types.ChecksumModeEnabled,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("couldn't inspect %s: %w", v.key, err)
+		}
+		p := database.CreateVideoVersionParams{
+			VideoID:    videoID,
+			Version:    v.version,
+			VideoURL:   urlPrefix + v.key,
+			VideoSize:  head.ContentLength,
+			ObjectETag: head.ETag,
+		}
+		if sum := aws.ToString(head.ChecksumSHA256); sum != "" && !strings.Contains(sum, "-") {
+			if raw, err := base64.StdEncoding.DecodeString(sum); err == nil {
+				p.ContentSHA256 = aws.String(hex.EncodeToString(raw))
+			}
+		}
+		params = append(params, p)
+	}
+	if len(params) == 0 {
+		return 0, nil
+	}
+
+	for _, p := range params {
+		if _, err := db.CreateVideoVersion(p); err != nil {
+			return 0, err
+		}
+	}
+	newest := params[len(params)-1]
+	video.VideoURL = &newest.VideoURL
+	video.VideoSize = newest.VideoSize
+	video.EncryptionKeyMD5 = nil
+	video.ContentSHA256 = newest.ContentSHA256
+	video.ObjectETag = newest.ObjectETag
+	if err := db.UpdateVideo(video); err != nil {
+		return 0, err
+	}
+	return len(params), nil
+}
+
+func reportObjects(what string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+	log.Printf("%d %s:", len(keys), what)
+	for _, key := range keys[:min(len(keys), restoreReportSample)] {
+		log.Printf("  %s", key)
+	}
+	if len(keys) > restoreReportSample {
+		log.Printf("  ... and %d more", len(keys)-restoreReportSample)
+	}
+}
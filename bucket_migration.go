@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// the largest object a single CopyObject request can copy
+const maxServerSideCopySize = 5 << 30
+
+type bucketMigration struct {
+	cfg        *apiConfig
+	dest       *s3.Client
+	destBucket string
+	// content hashes recorded at upload, by object key
+	recorded map[string]string
+	migrated map[string]database.MigratedObject
+}
+
+// runBucketMigration copies every object of the current bucket to another
+// bucket, possibly in another region, and then points the database at it.
+// Objects are copied server side and checked against their recorded hashes.
+// Progress is kept in the database, so an interrupted or partly failed run
+// picks up where it stopped; run it again with uploads in maintenance mode
+// to catch what changed during the first pass. URLs are only rewritten once
+// every object is in place, after which S3_BUCKET and S3_REGION must be
+// changed to match.
+func (cfg *apiConfig) runBucketMigration(args []string) error {
+	fs := flag.NewFlagSet("migrate-bucket", flag.ExitOnError)
+	destBucket := fs.String("bucket", "", "bucket to move all objects to")
+	destRegion := fs.String("region", cfg.s3Region, "region of the destination bucket")
+	concurrency := fs.Int("concurrency", 4, "number of objects copied at once")
+	fs.Parse(args)
+
+	if *destBucket == "" {
+		return fmt.Errorf("-bucket is required")
+	}
+	if *destBucket == cfg.s3Bucket {
+		return fmt.Errorf("-bucket must differ from S3_BUCKET")
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("-concurrency must be positive")
+	}
+
+	encrypted, err := cfg.db.GetEncryptedVideoURLs()
+	if err != nil {
+		return fmt.Errorf("couldn't check for encrypted videos: %w", err)
+	}
+	if len(encrypted) > 0 {
+		return fmt.Errorf("%d encrypted video objects can't be copied without their owners' keys, e.g. %s", len(encrypted), encrypted[0])
+	}
+
+	m := &bucketMigration{
+		cfg: cfg,
+		dest: s3.New(cfg.s3Client.Options(), func(o *s3.Options) {
+			o.Region = *destRegion
+		}),
+		destBucket: *destBucket,
+		recorded:   map[string]string{},
+	}
+	m.migrated, err = cfg.db.GetMigratedObjects(*destBucket)
+	if err != nil {
+		return fmt.Errorf("couldn't load migration progress: %w", err)
+	}
+	objects, err := cfg.db.GetChecksummedObjects()
+	if err != nil {
+		return fmt.Errorf("couldn't load recorded checksums: %w", err)
+	}
+	for _, obj := range objects {
+		key, err := cfg.getS3KeyFromURL(obj.VideoURL)
+		if err == nil && obj.ContentSHA256 != nil {
+			m.recorded[key] = *obj.ContentSHA256
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	copied, skipped, failed, err := m.copyObjects(ctx, *concurrency)
+	log.Printf("Copied %d objects, %d were already copied, %d failed", copied, skipped, failed)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d objects failed to copy, run the migration again to retry them", failed)
+	}
+
+	// the copies are complete, progress now reflects every object
+	m.migrated, err = cfg.db.GetMigratedObjects(*destBucket)
+	if err != nil {
+		return fmt.Errorf("couldn't load migration progress: %w", err)
+	}
+	oldPrefix := cfg.getS3ObjectURL("")
+	newPrefix := cfg.s3Endpoint.objectURLPrefix(*destBucket, *destRegion)
+	etags := make(map[string]string, len(m.migrated))
+	for key, obj := range m.migrated {
+		etags[newPrefix+key] = obj.DestETag
+	}
+	changed, err := cfg.db.RewriteObjectURLs(oldPrefix, newPrefix, etags)
+	if err != nil {
+		return fmt.Errorf("couldn't rewrite object URLs: %w", err)
+	}
+
+	log.Printf("Moved %d videos to %s, set S3_BUCKET=%s and S3_REGION=%s and restart", changed, *destBucket, *destBucket, *destRegion)
+	return nil
+}
+
+// copyObjects copies every source object that isn't in the destination yet
+// or changed since it was copied.
+func (m *bucketMigration) copyObjects(ctx context.Context, concurrency int) (copied, skipped, failed int, err error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	objects := make(chan s3types.Object)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range objects {
+				err := m.copyObject(ctx, obj)
+				mu.Lock()
+				if err != nil {
+					log.Printf("Couldn't copy %s: %v", aws.ToString(obj.Key), err)
+					failed++
+				} else {
+					copied++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(m.cfg.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(m.cfg.s3Bucket),
+	})
+	for paginator.HasMorePages() && err == nil {
+		var page *s3.ListObjectsV2Output
+		page, err = paginator.NextPage(ctx)
+		if err != nil {
+			err = fmt.Errorf("couldn't list source bucket: %w", err)
+			break
+		}
+		for _, obj := range page.Contents {
+			prev, ok := m.migrated[aws.ToString(obj.Key)]
+			if ok && prev.SourceETag == aws.ToString(obj.ETag) {
+				skipped++
+				continue
+			}
+			select {
+			case objects <- obj:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+	close(objects)
+	wg.Wait()
+	return copied, skipped, failed, err
+}
+
+// copyObject copies one object server side and checks that the copy holds
+// the same content before recording it as done.
+func (m *bucketMigration) copyObject(ctx context.Context, obj s3types.Object) error {
+	key := aws.ToString(obj.Key)
+	if aws.ToInt64(obj.Size) > maxServerSideCopySize {
+		return fmt.Errorf("object is too large for a server side copy")
+	}
+
+	source, err := m.cfg.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(m.cfg.s3Bucket),
+		Key:          aws.String(key),
+		ChecksumMode: s3types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't inspect source: %w", err)
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(m.destBucket),
+		Key:        aws.String(key),
+		CopySource: aws.String(m.cfg.s3Bucket + "/" + escapeObjectKey(key)),
+		// the source ETag pins the copy to the version that was inspected
+		CopySourceIfMatch: source.ETag,
+		// S3 hashes the copy, which is what gets verified below
+		ChecksumAlgorithm: s3types.ChecksumAlgorithmSha256,
+	}
+	// retention locks don't carry over on their own
+	if source.ObjectLockMode != "" && source.ObjectLockRetainUntilDate != nil {
+		input.ObjectLockMode = source.ObjectLockMode
+		input.ObjectLockRetainUntilDate = source.ObjectLockRetainUntilDate
+	}
+	if _, err := m.dest.CopyObject(ctx, input); err != nil {
+		return fmt.Errorf("couldn't copy object: %w", err)
+	}
+
+	dest, err := m.dest.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(m.destBucket),
+		Key:          aws.String(key),
+		ChecksumMode: s3types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't inspect copy: %w", err)
+	}
+	if err := m.verifyCopy(key, source, dest); err != nil {
+		return err
+	}
+
+	return m.cfg.db.RecordMigratedObject(m.destBucket, database.MigratedObject{
+		Key:        key,
+		SourceETag: aws.ToString(source.ETag),
+		DestETag:   aws.ToString(dest.ETag),
+	})
+}
+
+// verifyCopy compares the copy's size and SHA-256 against the source's
+// checksum, falling back to the hash recorded at upload for objects stored
+// without one.
+func (m *bucketMigration) verifyCopy(key string, source, dest *s3.HeadObjectOutput) error {
+	if aws.ToInt64(source.ContentLength) != aws.ToInt64(dest.ContentLength) {
+		return fmt.Errorf("copy is %d bytes, the source %d", aws.ToInt64(dest.ContentLength), aws.ToInt64(source.ContentLength))
+	}
+
+	expected := ""
+	// multipart checksums only cover the parts and can't be compared
+	if sum := aws.ToString(source.ChecksumSHA256); sum != "" && !strings.Contains(sum, "-") {
+		expected = sum
+	} else if recorded, ok := m.recorded[key]; ok {
+		raw, err := hex.DecodeString(recorded)
+		if err != nil {
+			return fmt.Errorf("invalid recorded checksum: %w", err)
+		}
+		expected = base64.StdEncoding.EncodeToString(raw)
+	}
+	if expected == "" {
+		return nil
+	}
+
+	actual := aws.ToString(dest.ChecksumSHA256)
+	if actual == "" {
+		return errors.New("copy has no checksum to verify")
+	}
+	if actual != expected {
+		return fmt.Errorf("copy checksum %s doesn't match %s", actual, expected)
+	}
+	return nil
+}
+
+// escapeObjectKey URL-encodes a key for CopySource, keeping its slashes.
+func escapeObjectKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
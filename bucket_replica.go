@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultReplicaInterval = 5 * time.Minute
+	replicaBatch           = 50
+)
+
+// bucketReplica is a bucket in a second region that uploaded video objects
+// are copied to for disaster recovery. With failover on, playback URLs
+// point at it instead of the primary bucket.
+type bucketReplica struct {
+	client   *s3.Client
+	bucket   string
+	region   string
+	endpoint s3EndpointSettings
+	failover bool
+}
+
+func (r *bucketReplica) objectURL(key string) string {
+	return r.endpoint.objectURLPrefix(r.bucket, r.region) + key
+}
+
+// playbackURL returns where an object URL should be served from, the
+// replica's copy while failed over. Encrypted objects aren't replicated and
+// keep pointing at the primary bucket, they are streamed from it anyway.
+func (cfg *apiConfig) playbackURL(objectURL string) string {
+	if cfg.replica == nil || !cfg.replica.failover {
+		return objectURL
+	}
+	key, ok := strings.CutPrefix(objectURL, cfg.getS3ObjectURL(""))
+	if !ok {
+		return objectURL
+	}
+	return cfg.replica.objectURL(key)
+}
+
+// playbackBucket returns the client and bucket to presign playback URLs
+// against.
+func (cfg *apiConfig) playbackBucket() (*s3.Client, string) {
+	if cfg.replica != nil && cfg.replica.failover {
+		return cfg.replica.client, cfg.replica.bucket
+	}
+	return cfg.s3Client, cfg.s3Bucket
+}
+
+func (cfg *apiConfig) startBucketReplication(interval time.Duration) {
+	// while failed over the primary is what's unreachable
+	if cfg.replica == nil || cfg.replica.failover {
+		return
+	}
+	cfg.startScheduledTask("bucket_replication", interval, cfg.replicateObjects)
+}
+
+// replicateObjects copies video objects that aren't in the replica yet. The
+// copy is done server side by S3, nothing passes through this server.
+func (cfg *apiConfig) replicateObjects(ctx context.Context) {
+	for ctx.Err() == nil {
+		objects, err := cfg.db.GetUnreplicatedObjects(replicaBatch)
+		if err != nil {
+			log.Printf("Couldn't load objects to replicate: %v", err)
+			return
+		}
+
+		replicated := 0
+		for _, obj := range objects {
+			if err := cfg.replicateObject(ctx, obj); err != nil {
+				log.Printf("Couldn't replicate %s of video %s: %v", obj.VideoURL, obj.VideoID, err)
+				continue
+			}
+			replicated++
+		}
+		// stop when done, or when every object in the batch keeps failing
+		if len(objects) < replicaBatch || replicated == 0 {
+			return
+		}
+	}
+}
+
+func (cfg *apiConfig) replicateObject(ctx context.Context, obj database.StoredObject) error {
+	key, err := cfg.getS3KeyFromURL(obj.VideoURL)
+	if err != nil {
+		return fmt.Errorf("couldn't determine object key: %w", err)
+	}
+	out, err := cfg.replica.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(cfg.replica.bucket),
+		Key:        aws.String(key),
+		CopySource: aws.String(cfg.s3Bucket + "/" + escapeObjectKey(key)),
+	})
+	if err != nil {
+		return err
+	}
+	return cfg.db.RecordReplicatedObject(obj.VideoURL, aws.ToString(out.CopyObjectResult.ETag))
+}
+
+// deleteReplicaObjects removes the replica's copies of deleted objects, so
+// media that expired doesn't live on in the other region.
+func (cfg *apiConfig) deleteReplicaObjects(ctx context.Context, keys []string) {
+	if cfg.replica == nil {
+		return
+	}
+	for _, key := range keys {
+		_, err := cfg.replica.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(cfg.replica.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			log.Printf("Couldn't delete replica of %s: %v", key, err)
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerReplicationStatus(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Bucket     string `json:"bucket"`
+		Region     string `json:"region"`
+		Failover   bool   `json:"failover"`
+		Replicated int    `json:"replicated"`
+		// objects that would be unavailable if failed over now
+		Pending int `json:"pending"`
+	}
+
+	if cfg.replica == nil {
+		respondWithError(w, http.StatusNotFound, codeNoReplicaBucketIsConfigured, "No replica bucket is configured", nil)
+		return
+	}
+
+	replicated, pending, err := cfg.db.GetReplicationCounts()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetReplicationStatus, "Couldn't get replication status", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		Bucket:     cfg.replica.bucket,
+		Region:     cfg.replica.region,
+		Failover:   cfg.replica.failover,
+		Replicated: replicated,
+		Pending:    pending,
+	})
+}
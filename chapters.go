@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// videoWithChapters is how a single video is served, with its chapters in
+// playback order.
+type videoWithChapters struct {
+	database.Video
+	Chapters []database.Chapter `json:"chapters"`
+	// Language is the translation the title and description are in, empty
+	// for the video's own
+	Language string `json:"language,omitempty"`
+}
+
+// chaptersVTT renders chapters, sorted by start, as a WebVTT file. Each
+// chapter runs until the next one starts, the last until the end of the
+// video.
+func chaptersVTT(chapters []database.Chapter, duration float64) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i, chapter := range chapters {
+		// chapters past the end are left from a longer earlier version
+		if chapter.StartSeconds >= duration {
+			break
+		}
+		end := duration
+		if i+1 < len(chapters) && chapters[i+1].StartSeconds < duration {
+			end = chapters[i+1].StartSeconds
+		}
+		if end <= chapter.StartSeconds {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%d\n%s --> %s\n%s\n", i+1, vttTimestamp(chapter.StartSeconds), vttTimestamp(end), vttText(chapter.Title))
+	}
+	return b.String()
+}
+
+func vttTimestamp(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// vttText escapes the characters WebVTT cue text treats as markup.
+func vttText(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
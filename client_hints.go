@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// widths picked from the Width hint are rounded up to this step, so every
+// layout width doesn't get a variant of its own
+const clientHintWidthStep = 64
+
+// clientHintHeaders are the request headers thumbnail responses vary on.
+// The Sec-CH- names replaced the older ones, browsers send either.
+const clientHintHeaders = "DPR, Width, Sec-CH-DPR, Sec-CH-Width, Save-Data"
+
+type clientHints struct {
+	dpr float64
+	// in physical pixels
+	width    int
+	saveData bool
+}
+
+func clientHintsFromRequest(r *http.Request) clientHints {
+	hints := clientHints{
+		saveData: strings.EqualFold(strings.TrimSpace(r.Header.Get("Save-Data")), "on"),
+	}
+	if v, err := strconv.ParseFloat(firstHeader(r, "Sec-CH-DPR", "DPR"), 64); err == nil && v > 0 && v <= 8 {
+		hints.dpr = v
+	}
+	if v, err := strconv.Atoi(firstHeader(r, "Sec-CH-Width", "Width")); err == nil && v > 0 {
+		hints.width = v
+	}
+	return hints
+}
+
+func firstHeader(r *http.Request, names ...string) string {
+	for _, name := range names {
+		if v := r.Header.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// apply adjusts the requested size to the client. Explicit w and h are in
+// CSS pixels and scaled by the DPR; without them the Width hint picks the
+// size. Save-Data clients get CSS pixel sizes and lower quality encodes.
+func (hints clientHints) apply(opts resizeOptions) resizeOptions {
+	dpr := hints.dpr
+	if hints.saveData && dpr > 1 {
+		dpr = 1
+	}
+	opts.lowQuality = hints.saveData
+
+	switch {
+	case opts.width > 0 || opts.height > 0:
+		if dpr > 1 {
+			opts.width = min(int(float64(opts.width)*dpr+0.5), maxVariantDimension)
+			opts.height = min(int(float64(opts.height)*dpr+0.5), maxVariantDimension)
+		}
+	case hints.width > 0:
+		width := hints.width
+		if hints.saveData && hints.dpr > 1 {
+			width = int(float64(width) / hints.dpr)
+		}
+		width = (width + clientHintWidthStep - 1) / clientHintWidthStep * clientHintWidthStep
+		opts.width = min(width, maxVariantDimension)
+		opts.noUpscale = true
+	}
+	return opts
+}
+
+func isJPEG(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// acceptClientHintsMiddleware asks browsers loading the app to send the
+// hints with their image requests.
+func acceptClientHintsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-CH", "Sec-CH-DPR, Sec-CH-Width, DPR, Width")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,13 @@
+package main
+
+import "time"
+
+// clock is where expiry and retention checks get the time from, so they
+// can be checked against a fixed time instead of waiting for it.
+type clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
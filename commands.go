@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+)
+
+// commandRunner runs the ffmpeg and ffprobe invocations of the media
+// pipeline, so they can be replaced where ffmpeg isn't installed.
+type commandRunner interface {
+	// Run runs name with args, writing its output to stdout and stderr,
+	// either of which may be nil. A command that ran but exited with an
+	// error returns a *commandExitError.
+	Run(ctx context.Context, stdout, stderr io.Writer, name string, args ...string) error
+}
+
+// commandExitError tells a command that rejected its input apart from one
+// that couldn't be started at all.
+type commandExitError struct {
+	err error
+}
+
+func (e *commandExitError) Error() string { return e.err.Error() }
+func (e *commandExitError) Unwrap() error { return e.err }
+
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, stdout, stderr io.Writer, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &commandExitError{err: err}
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// costRates are list prices used for estimates, overridable per deployment.
+type costRates struct {
+	storagePerGBMonth   float64
+	egressPerGB         float64
+	processingPerMinute float64
+}
+
+func costRatesFromEnv() (costRates, error) {
+	rates := costRates{
+		storagePerGBMonth:   0.023,
+		egressPerGB:         0.09,
+		processingPerMinute: 0.015,
+	}
+
+	for env, dst := range map[string]*float64{
+		"COST_STORAGE_PER_GB_MONTH":  &rates.storagePerGBMonth,
+		"COST_EGRESS_PER_GB":         &rates.egressPerGB,
+		"COST_PROCESSING_PER_MINUTE": &rates.processingPerMinute,
+	} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 {
+			return costRates{}, fmt.Errorf("invalid %s: %q", env, v)
+		}
+		*dst = rate
+	}
+	return rates, nil
+}
+
+type videoCost struct {
+	database.VideoUsage
+	// every view is assumed to download the whole file
+	EstimatedEgressBytes int64   `json:"estimated_egress_bytes"`
+	StorageCost          float64 `json:"storage_cost_per_month"`
+	EgressCost           float64 `json:"egress_cost"`
+	ProcessingCost       float64 `json:"processing_cost"`
+	TotalCost            float64 `json:"total_cost"`
+}
+
+func (rates costRates) estimate(usage database.VideoUsage) videoCost {
+	const gb = 1 << 30
+
+	vc := videoCost{
+		VideoUsage:           usage,
+		EstimatedEgressBytes: usage.VideoBytes * usage.ViewCount,
+	}
+	vc.StorageCost = float64(usage.StorageBytes) / gb * rates.storagePerGBMonth
+	vc.EgressCost = float64(vc.EstimatedEgressBytes) / gb * rates.egressPerGB
+	vc.ProcessingCost = usage.ProcessingSeconds / 60 * rates.processingPerMinute
+	vc.TotalCost = vc.StorageCost + vc.EgressCost + vc.ProcessingCost
+	return vc
+}
+
+func (cfg *apiConfig) recordView(video database.Video) {
+	err := cfg.db.IncrementVideoViews(video.ID)
+	if err != nil {
+		log.Printf("Couldn't record view for video %s: %v", video.ID, err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"expvar"
+	"io"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// inflightUpload is an upload whose request hasn't finished yet.
+type inflightUpload struct {
+	requestID     string
+	kind          string
+	videoID       uuid.UUID
+	userID        uuid.UUID
+	startedAt     time.Time
+	contentLength int64
+	received      atomic.Int64
+	bodyDone      atomic.Bool
+}
+
+// uploadTracker keeps the in-flight uploads for /debug/uploads.
+type uploadTracker struct {
+	mu      sync.Mutex
+	uploads map[*inflightUpload]struct{}
+}
+
+func newUploadTracker() *uploadTracker {
+	return &uploadTracker{uploads: map[*inflightUpload]struct{}{}}
+}
+
+// track counts the bytes read from r's body and lists the upload until the
+// request is done. The returned body replaces r.Body.
+func (t *uploadTracker) track(r *http.Request, kind string, videoID, userID uuid.UUID) io.ReadCloser {
+	u := &inflightUpload{
+		requestID:     requestID(r),
+		kind:          kind,
+		videoID:       videoID,
+		userID:        userID,
+		startedAt:     time.Now(),
+		contentLength: r.ContentLength,
+	}
+	t.mu.Lock()
+	t.uploads[u] = struct{}{}
+	t.mu.Unlock()
+	registerRequestCleanup(r, func() {
+		t.mu.Lock()
+		delete(t.uploads, u)
+		t.mu.Unlock()
+	})
+	return &trackedBody{ReadCloser: r.Body, upload: u}
+}
+
+func (t *uploadTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.uploads)
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	upload *inflightUpload
+}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.upload.received.Add(int64(n))
+	if err == io.EOF {
+		b.upload.bodyDone.Store(true)
+	}
+	return n, err
+}
+
+type inflightUploadResponse struct {
+	RequestID string    `json:"request_id"`
+	Kind      string    `json:"kind"`
+	VideoID   uuid.UUID `json:"video_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	StartedAt time.Time `json:"started_at"`
+	// "receiving" while the body is read, "processing" after
+	State         string  `json:"state"`
+	ContentLength int64   `json:"content_length"`
+	Received      int64   `json:"received"`
+	BytesPerSec   float64 `json:"bytes_per_second"`
+}
+
+func (t *uploadTracker) handlerList(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	uploads := make([]inflightUploadResponse, 0, len(t.uploads))
+	for u := range t.uploads {
+		received := u.received.Load()
+		state := "receiving"
+		if u.bodyDone.Load() {
+			state = "processing"
+		}
+		resp := inflightUploadResponse{
+			RequestID:     u.requestID,
+			Kind:          u.kind,
+			VideoID:       u.videoID,
+			UserID:        u.userID,
+			StartedAt:     u.startedAt,
+			State:         state,
+			ContentLength: u.contentLength,
+			Received:      received,
+		}
+		if elapsed := time.Since(u.startedAt).Seconds(); elapsed > 0 {
+			resp.BytesPerSec = float64(received) / elapsed
+		}
+		uploads = append(uploads, resp)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].StartedAt.Before(uploads[j].StartedAt)
+	})
+	respondWithJSON(w, http.StatusOK, uploads)
+}
+
+// serveDiagnostics serves pprof, expvar and the in-flight uploads on addr.
+// It has no authentication, addr should only be reachable from inside.
+func (cfg *apiConfig) serveDiagnostics(addr string) {
+	expvar.Publish("uploads_in_flight", expvar.Func(func() any {
+		return cfg.uploads.count()
+	}))
+	expvar.Publish("temp_store_reserved_bytes", expvar.Func(func() any {
+		cfg.tempStore.mu.Lock()
+		defer cfg.tempStore.mu.Unlock()
+		return cfg.tempStore.used
+	}))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("GET /debug/uploads", cfg.uploads.handlerList)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+	}
+	go func() {
+		log.Printf("Serving diagnostics on %s", addr)
+		log.Fatal(srv.ListenAndServe())
+	}()
+}
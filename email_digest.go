@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+	// time zones resolve even where the system has no zoneinfo
+	_ "time/tzdata"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	digestCheckInterval = 15 * time.Minute
+	// digests go out on this day and hour of the owner's time zone, and
+	// cover the week before
+	digestWeekday   = time.Monday
+	digestHour      = 8
+	digestTopVideos = 5
+)
+
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"watchTime": formatWatchTime,
+	"inc":       func(i int) int { return i + 1 },
+}).Parse(`Your week on Tubely, {{.From}} to {{.To}}
+
+Views: {{.Stats.Sessions}}
+Watch time: {{watchTime .Stats.WatchedSeconds}}
+{{if .Stats.TopVideos}}
+Top videos:
+{{range $i, $v := .Stats.TopVideos}}{{inc $i}}. {{$v.Title}}: {{$v.Sessions}} views, {{watchTime $v.WatchedSeconds}} watched
+{{end}}{{end}}
+You get this email because you turned on the weekly digest. Turn it off
+in your account settings to stop it.
+`))
+
+// startEmailDigests sends owners who opted in a weekly summary of how their
+// videos did. Nothing is sent without a mailer.
+func (cfg *apiConfig) startEmailDigests() {
+	if cfg.mailer == nil {
+		return
+	}
+	cfg.startScheduledTask("email_digests", digestCheckInterval, cfg.sendDueDigests)
+}
+
+// sendDueDigests sends the digests whose slot passed since the last one
+// was sent. A digest that fails is retried on the next check.
+func (cfg *apiConfig) sendDueDigests(ctx context.Context) {
+	recipients, err := cfg.db.GetDigestRecipients()
+	if err != nil {
+		log.Printf("Couldn't load digest recipients: %v", err)
+		return
+	}
+
+	now := cfg.clock.Now()
+	for _, recipient := range recipients {
+		if ctx.Err() != nil {
+			return
+		}
+		loc, err := time.LoadLocation(recipient.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		slot := lastDigestSlot(now, loc)
+		if recipient.LastSentAt != nil && !recipient.LastSentAt.Before(slot) {
+			continue
+		}
+		if err := cfg.sendDigest(recipient, slot); err != nil {
+			log.Printf("Couldn't send digest to user %s: %v", recipient.UserID, err)
+			continue
+		}
+		if err := cfg.db.MarkDigestSent(recipient.UserID, now); err != nil {
+			log.Printf("Couldn't mark digest of user %s sent: %v", recipient.UserID, err)
+		}
+	}
+}
+
+// sendDigest sends the digest of the week that ended at slot. Weeks
+// nobody watched anything aren't worth an email.
+func (cfg *apiConfig) sendDigest(recipient database.DigestRecipient, slot time.Time) error {
+	since := slot.AddDate(0, 0, -7)
+	stats, err := cfg.db.GetDigestStats(recipient.UserID, since, slot, digestTopVideos)
+	if err != nil {
+		return fmt.Errorf("couldn't get digest stats: %w", err)
+	}
+	if stats.Sessions == 0 {
+		return nil
+	}
+
+	var body strings.Builder
+	err = digestTemplate.Execute(&body, struct {
+		From, To string
+		Stats    database.DigestStats
+	}{
+		From:  since.Format("Jan 2"),
+		To:    slot.AddDate(0, 0, -1).Format("Jan 2"),
+		Stats: stats,
+	})
+	if err != nil {
+		return err
+	}
+	return cfg.mailer.send(recipient.Email, "Your weekly Tubely digest", body.String())
+}
+
+// lastDigestSlot is the latest digest time in loc at or before now.
+func lastDigestSlot(now time.Time, loc *time.Location) time.Time {
+	local := now.In(loc)
+	daysBack := (int(local.Weekday()) - int(digestWeekday) + 7) % 7
+	// built from the date rather than subtracting hours, so days that DST
+	// makes 23 or 25 hours long don't shift it
+	slot := time.Date(local.Year(), local.Month(), local.Day()-daysBack, digestHour, 0, 0, 0, loc)
+	if slot.After(local) {
+		slot = slot.AddDate(0, 0, -7)
+	}
+	return slot
+}
+
+func formatWatchTime(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func (cfg *apiConfig) handlerDigestSettingsGet(w http.ResponseWriter, r *http.Request) {
+	settings, err := cfg.db.GetDigestSettings(requestUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetDigestSettings, "Couldn't get digest settings", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+func (cfg *apiConfig) handlerDigestSettingsSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Enabled  bool   `json:"enabled"`
+		Timezone string `json:"timezone"`
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Timezone == "" {
+		params.Timezone = "UTC"
+	}
+	// "Local" is the server's zone, not the owner's
+	if _, err := time.LoadLocation(params.Timezone); err != nil || params.Timezone == "Local" {
+		respondWithFieldErrors(w, codeInvalidDigestSettings, "Invalid digest settings", []fieldError{{Field: "timezone", Message: "must be an IANA time zone like Europe/Amsterdam"}})
+		return
+	}
+	if params.Enabled && cfg.mailer == nil {
+		respondWithError(w, http.StatusConflict, codeEmailIsntSetUpOnThisServer, "Email isn't set up on this server", nil)
+		return
+	}
+
+	settings, err := cfg.db.GetDigestSettings(requestUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetDigestSettings, "Couldn't get digest settings", err)
+		return
+	}
+	// the first digest covers the first full week after opting in
+	if params.Enabled && !settings.Enabled {
+		now := cfg.clock.Now()
+		settings.LastSentAt = &now
+	}
+	settings.Enabled = params.Enabled
+	settings.Timezone = params.Timezone
+	err = cfg.db.SetDigestSettings(settings)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntSaveDigestSettings, "Couldn't save digest settings", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, settings)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// encryptionKeyHeader carries a base64 encoded 256-bit key for videos that
+// are stored with S3 server-side encryption using customer-provided keys
+// (SSE-C). S3 encrypts with the key and throws it away, so it must be sent
+// again to read the object. Only its MD5 is stored, to tell a wrong key
+// apart from other failures.
+const encryptionKeyHeader = "X-Encryption-Key"
+
+const sseCustomerAlgorithm = "AES256"
+
+var errWrongEncryptionKey = errors.New("encryption key doesn't match the video")
+
+type customerKey struct {
+	// both base64 encoded, as S3 expects them
+	key string
+	md5 string
+}
+
+// customerKeyFromRequest returns the key sent with the request, or nil when
+// there is none.
+func customerKeyFromRequest(r *http.Request) (*customerKey, error) {
+	encoded := r.Header.Get(encryptionKeyHeader)
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not valid base64: %w", encryptionKeyHeader, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%s must be a 256-bit key, got %d bits", encryptionKeyHeader, len(key)*8)
+	}
+	sum := md5.Sum(key)
+	return &customerKey{
+		key: encoded,
+		md5: base64.StdEncoding.EncodeToString(sum[:]),
+	}, nil
+}
+
+// checkVideoKey verifies key is the one the video's media was encrypted
+// with. Unencrypted videos must come without a key.
+func checkVideoKey(video database.Video, key *customerKey) error {
+	if video.EncryptionKeyMD5 == nil && key == nil {
+		return nil
+	}
+	if video.EncryptionKeyMD5 == nil || key == nil || *video.EncryptionKeyMD5 != key.md5 {
+		return errWrongEncryptionKey
+	}
+	return nil
+}
+
+// keyMD5 is what gets recorded for objects stored with key.
+func (k *customerKey) keyMD5() *string {
+	if k == nil {
+		return nil
+	}
+	return aws.String(k.md5)
+}
+
+func (k *customerKey) applyToPut(in *s3.PutObjectInput) {
+	if k == nil {
+		return
+	}
+	in.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+	in.SSECustomerKey = aws.String(k.key)
+	in.SSECustomerKeyMD5 = aws.String(k.md5)
+}
+
+func (k *customerKey) applyToGet(in *s3.GetObjectInput) {
+	if k == nil {
+		return
+	}
+	in.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+	in.SSECustomerKey = aws.String(k.key)
+	in.SSECustomerKeyMD5 = aws.String(k.md5)
+}
+
+// applyToCopy sets the key on both ends of a copy, objects keep the key
+// they were encrypted with.
+func (k *customerKey) applyToCopy(in *s3.CopyObjectInput) {
+	if k == nil {
+		return
+	}
+	in.CopySourceSSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+	in.CopySourceSSECustomerKey = aws.String(k.key)
+	in.CopySourceSSECustomerKeyMD5 = aws.String(k.md5)
+	in.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+	in.SSECustomerKey = aws.String(k.key)
+	in.SSECustomerKeyMD5 = aws.String(k.md5)
+}
@@ -0,0 +1,319 @@
+package main
+
+// errorCode is the stable code an error response is reported with. Clients
+// branch on it, the message next to it is for people and may be reworded or
+// translated, so codes are never derived from messages. Several messages may
+// share a code when they mean the same thing to a client.
+//
+// Most codes began as the message they were sent with, lowercased, back when
+// codes were derived, and clients already rely on them. They are frozen:
+// rewording a message leaves its code, and the constant's name, as they are.
+// New codes name the condition, not the message.
+type errorCode string
+
+const (
+	codeAFolderCantBeMovedIntoItself                   errorCode = "a_folder_cant_be_moved_into_itself"
+	codeAReasonIsRequired                              errorCode = "a_reason_is_required"
+	codeAvatarMustBeAJPEGOrPNGImage                    errorCode = "avatar_must_be_a_jpeg_or_png_image"
+	codeCampaignWrongStatus                            errorCode = "campaign_wrong_status"
+	codeChapterNotFound                                errorCode = "chapter_not_found"
+	codeCopyingNeedsTheVideosEncryptionKey             errorCode = "copying_needs_the_videos_encryption_key"
+	codeCouldntApplyRetentionInS3                      errorCode = "couldnt_apply_retention_in_s3"
+	codeCouldntBuildFeed                               errorCode = "couldnt_build_feed"
+	codeCouldntCancelUpload                            errorCode = "couldnt_cancel_upload"
+	codeCouldntCheckArchiveTarget                      errorCode = "couldnt_check_archive_target"
+	codeCouldntCheckFolderContents                     errorCode = "couldnt_check_folder_contents"
+	codeCouldntCheckIntegrity                          errorCode = "couldnt_check_integrity"
+	codeCouldntComputeETag                             errorCode = "couldnt_compute_etag"
+	codeCouldntCopyThumbnail                           errorCode = "couldnt_copy_thumbnail"
+	codeCouldntCopyVideoFile                           errorCode = "couldnt_copy_video_file"
+	codeCouldntCountNotifications                      errorCode = "couldnt_count_notifications"
+	codeCouldntCountUnarchivedVideos                   errorCode = "couldnt_count_unarchived_videos"
+	codeCouldntCreateAccessJWT                         errorCode = "couldnt_create_access_jwt"
+	codeCouldntCreateAudioDescriptionID                errorCode = "couldnt_create_audio_description_id"
+	codeCouldntCreateCampaign                          errorCode = "couldnt_create_campaign"
+	codeCouldntCreateChapter                           errorCode = "couldnt_create_chapter"
+	codeCouldntCreateFolder                            errorCode = "couldnt_create_folder"
+	codeCouldntCreateLiveStream                        errorCode = "couldnt_create_live_stream"
+	codeCouldntCreateRefreshToken                      errorCode = "couldnt_create_refresh_token"
+	codeCouldntCreateReport                            errorCode = "couldnt_create_report"
+	codeCouldntCreateShareLink                         errorCode = "couldnt_create_share_link"
+	codeCouldntCreateStreamKey                         errorCode = "couldnt_create_stream_key"
+	codeCouldntCreateThumbnailExperiment               errorCode = "couldnt_create_thumbnail_experiment"
+	codeCouldntCreateUploadPreset                      errorCode = "couldnt_create_upload_preset"
+	codeCouldntCreateUser                              errorCode = "couldnt_create_user"
+	codeCouldntCreateVideo                             errorCode = "couldnt_create_video"
+	codeCouldntDecodeParameters                        errorCode = "couldnt_decode_parameters"
+	codeCouldntDeleteChapter                           errorCode = "couldnt_delete_chapter"
+	codeCouldntDeleteFeatureFlag                       errorCode = "couldnt_delete_feature_flag"
+	codeCouldntDeleteFolder                            errorCode = "couldnt_delete_folder"
+	codeCouldntDeleteLiveStream                        errorCode = "couldnt_delete_live_stream"
+	codeCouldntDeleteShareLink                         errorCode = "couldnt_delete_share_link"
+	codeCouldntDeleteStreamKey                         errorCode = "couldnt_delete_stream_key"
+	codeCouldntDeleteTranslation                       errorCode = "couldnt_delete_translation"
+	codeCouldntDeleteUploadPreset                      errorCode = "couldnt_delete_upload_preset"
+	codeCouldntDeleteVideo                             errorCode = "couldnt_delete_video"
+	codeCouldntDetermineVideoObjectKey                 errorCode = "couldnt_determine_video_object_key"
+	codeCouldntDismissReport                           errorCode = "couldnt_dismiss_report"
+	codeCouldntFindJWT                                 errorCode = "couldnt_find_jwt"
+	codeCouldntFindToken                               errorCode = "couldnt_find_token"
+	codeCouldntGetArchivedObjects                      errorCode = "couldnt_get_archived_objects"
+	codeCouldntGetCampaign                             errorCode = "couldnt_get_campaign"
+	codeCouldntGetCampaigns                            errorCode = "couldnt_get_campaigns"
+	codeCouldntGetChapter                              errorCode = "couldnt_get_chapter"
+	codeCouldntGetDigestSettings                       errorCode = "couldnt_get_digest_settings"
+	codeCouldntGetEgress                               errorCode = "couldnt_get_egress"
+	codeCouldntGetFolder                               errorCode = "couldnt_get_folder"
+	codeCouldntGetFolderDepth                          errorCode = "couldnt_get_folder_depth"
+	codeCouldntGetFolderEncodingProfile                errorCode = "couldnt_get_folder_encoding_profile"
+	codeCouldntGetFolderPath                           errorCode = "couldnt_get_folder_path"
+	codeCouldntGetFolders                              errorCode = "couldnt_get_folders"
+	codeCouldntGetFollowStatus                         errorCode = "couldnt_get_follow_status"
+	codeCouldntGetJob                                  errorCode = "couldnt_get_job"
+	codeCouldntGetLiveStream                           errorCode = "couldnt_get_live_stream"
+	codeCouldntGetParentFolder                         errorCode = "couldnt_get_parent_folder"
+	codeCouldntGetPlaybackAnalytics                    errorCode = "couldnt_get_playback_analytics"
+	codeCouldntGetPlaybackRestrictions                 errorCode = "couldnt_get_playback_restrictions"
+	codeCouldntGetPlaybackSession                      errorCode = "couldnt_get_playback_session"
+	codeCouldntGetProfile                              errorCode = "couldnt_get_profile"
+	codeCouldntGetReplayHeatmap                        errorCode = "couldnt_get_replay_heatmap"
+	codeCouldntGetReplicationStatus                    errorCode = "couldnt_get_replication_status"
+	codeCouldntGetReport                               errorCode = "couldnt_get_report"
+	codeCouldntGetShareLinks                           errorCode = "couldnt_get_share_links"
+	codeCouldntGetStreamKey                            errorCode = "couldnt_get_stream_key"
+	codeCouldntGetStreamKeys                           errorCode = "couldnt_get_stream_keys"
+	codeCouldntGetTakedown                             errorCode = "couldnt_get_takedown"
+	codeCouldntGetThumbnailExperiment                  errorCode = "couldnt_get_thumbnail_experiment"
+	codeCouldntGetTranslation                          errorCode = "couldnt_get_translation"
+	codeCouldntGetUpload                               errorCode = "couldnt_get_upload"
+	codeCouldntGetUploadPreset                         errorCode = "couldnt_get_upload_preset"
+	codeCouldntGetUploadPresets                        errorCode = "couldnt_get_upload_presets"
+	codeCouldntGetUser                                 errorCode = "couldnt_get_user"
+	codeCouldntGetUserForRefreshToken                  errorCode = "couldnt_get_user_for_refresh_token"
+	codeCouldntGetVideo                                errorCode = "couldnt_get_video"
+	codeCouldntGetVideoFromStorage                     errorCode = "couldnt_get_video_from_storage"
+	codeCouldntGetVideoVersion                         errorCode = "couldnt_get_video_version"
+	codeCouldntGetVideoVersions                        errorCode = "couldnt_get_video_versions"
+	codeCouldntGetWatchProgress                        errorCode = "couldnt_get_watch_progress"
+	codeCouldntHashPassword                            errorCode = "couldnt_hash_password"
+	codeCouldntMarkNotificationRead                    errorCode = "couldnt_mark_notification_read"
+	codeCouldntMarkNotificationsRead                   errorCode = "couldnt_mark_notifications_read"
+	codeCouldntMoveFolder                              errorCode = "couldnt_move_folder"
+	codeCouldntMoveVideo                               errorCode = "couldnt_move_video"
+	codeCouldntReadAsset                               errorCode = "couldnt_read_asset"
+	codeCouldntReadLiveStream                          errorCode = "couldnt_read_live_stream"
+	codeCouldntRecordAppeal                            errorCode = "couldnt_record_appeal"
+	codeCouldntRecordPlaybackEvents                    errorCode = "couldnt_record_playback_events"
+	codeCouldntRenameFolder                            errorCode = "couldnt_rename_folder"
+	codeCouldntResetDatabase                           errorCode = "couldnt_reset_database"
+	codeCouldntResizeAsset                             errorCode = "couldnt_resize_asset"
+	codeCouldntResolveReports                          errorCode = "couldnt_resolve_reports"
+	codeCouldntRetrieveAuditLog                        errorCode = "couldnt_retrieve_audit_log"
+	codeCouldntRetrieveChapters                        errorCode = "couldnt_retrieve_chapters"
+	codeCouldntRetrieveFeatureFlags                    errorCode = "couldnt_retrieve_feature_flags"
+	codeCouldntRetrieveIntegrityFailures               errorCode = "couldnt_retrieve_integrity_failures"
+	codeCouldntRetrieveNotifications                   errorCode = "couldnt_retrieve_notifications"
+	codeCouldntRetrievePendingUploads                  errorCode = "couldnt_retrieve_pending_uploads"
+	codeCouldntRetrieveReports                         errorCode = "couldnt_retrieve_reports"
+	codeCouldntRetrieveStorageUsage                    errorCode = "couldnt_retrieve_storage_usage"
+	codeCouldntRetrieveThumbnailExperiments            errorCode = "couldnt_retrieve_thumbnail_experiments"
+	codeCouldntRetrieveThumbnailHistory                errorCode = "couldnt_retrieve_thumbnail_history"
+	codeCouldntRetrieveTranslations                    errorCode = "couldnt_retrieve_translations"
+	codeCouldntRetrieveTrendingVideos                  errorCode = "couldnt_retrieve_trending_videos"
+	codeCouldntRetrieveVideos                          errorCode = "couldnt_retrieve_videos"
+	codeCouldntRetrieveVideoUsage                      errorCode = "couldnt_retrieve_video_usage"
+	codeCouldntRetrieveVideoVersions                   errorCode = "couldnt_retrieve_video_versions"
+	codeCouldntRevertThumbnail                         errorCode = "couldnt_revert_thumbnail"
+	codeCouldntRevokeSession                           errorCode = "couldnt_revoke_session"
+	codeCouldntRotateStreamKey                         errorCode = "couldnt_rotate_stream_key"
+	codeCouldntRunUploadHooks                          errorCode = "couldnt_run_upload_hooks"
+	codeCouldntSaveDigestSettings                      errorCode = "couldnt_save_digest_settings"
+	codeCouldntSaveFeatureFlag                         errorCode = "couldnt_save_feature_flag"
+	codeCouldntSaveLiveStreamSettings                  errorCode = "couldnt_save_live_stream_settings"
+	codeCouldntSavePlaybackRestrictions                errorCode = "couldnt_save_playback_restrictions"
+	codeCouldntSaveRefreshToken                        errorCode = "couldnt_save_refresh_token"
+	codeCouldntSaveTranslation                         errorCode = "couldnt_save_translation"
+	codeCouldntSaveVideoVersion                        errorCode = "couldnt_save_video_version"
+	codeCouldntSetPlan                                 errorCode = "couldnt_set_plan"
+	codeCouldntSetRetentionLock                        errorCode = "couldnt_set_retention_lock"
+	codeCouldntSignThumbnailURL                        errorCode = "couldnt_sign_thumbnail_url"
+	codeCouldntSignUploadPolicy                        errorCode = "couldnt_sign_upload_policy"
+	codeCouldntSignVideoURL                            errorCode = "couldnt_sign_video_url"
+	codeCouldntStopThumbnailExperiment                 errorCode = "couldnt_stop_thumbnail_experiment"
+	codeCouldntUpdateArchivedObjects                   errorCode = "couldnt_update_archived_objects"
+	codeCouldntUpdateCampaign                          errorCode = "couldnt_update_campaign"
+	codeCouldntUpdateChapter                           errorCode = "couldnt_update_chapter"
+	codeCouldntUpdateFolderSettings                    errorCode = "couldnt_update_folder_settings"
+	codeCouldntUpdateFollow                            errorCode = "couldnt_update_follow"
+	codeCouldntUpdateList                              errorCode = "couldnt_update_list"
+	codeCouldntUpdateProfile                           errorCode = "couldnt_update_profile"
+	codeCouldntUpdateTakedown                          errorCode = "couldnt_update_takedown"
+	codeCouldntUpdateUploadPreset                      errorCode = "couldnt_update_upload_preset"
+	codeCouldntUpdateVideo                             errorCode = "couldnt_update_video"
+	codeCouldntUpdateVideoData                         errorCode = "couldnt_update_video_data"
+	codeCouldntValidateAdminAPIKey                     errorCode = "couldnt_validate_admin_api_key"
+	codeCouldntValidateJWT                             errorCode = "couldnt_validate_jwt"
+	codeCouldntValidateToken                           errorCode = "couldnt_validate_token"
+	codeEmailAndPasswordAreRequired                    errorCode = "email_and_password_are_required"
+	codeEmailIsntSetUpOnThisServer                     errorCode = "email_isnt_set_up_on_this_server"
+	codeEncryptionKeyRequired                          errorCode = "encryption_key_required"
+	codeErrorCreatingAvatarRandomID                    errorCode = "error_creating_avatar_random_id"
+	codeErrorCreatingStagingID                         errorCode = "error_creating_staging_id"
+	codeErrorCreatingUploadID                          errorCode = "error_creating_upload_id"
+	codeErrorProcessingVideo                           errorCode = "error_processing_video"
+	codeErrorReplacingVideo                            errorCode = "error_replacing_video"
+	codeErrorSavingFile                                errorCode = "error_saving_file"
+	codeErrorSavingThumbnail                           errorCode = "error_saving_thumbnail"
+	codeErrorStoringAudioDescription                   errorCode = "error_storing_audio_description"
+	codeFileSizeTooBig                                 errorCode = "file_size_too_big"
+	codeFolderForbidden                                errorCode = "folder_forbidden"
+	codeFolderIsntEmpty                                errorCode = "folder_isnt_empty"
+	codeFolderNotFound                                 errorCode = "folder_not_found"
+	codeFolderTooDeep                                  errorCode = "folder_too_deep"
+	codeHLSMSNIsTooFarAheadOfTheLiveEdge               errorCode = "hls_msn_is_too_far_ahead_of_the_live_edge"
+	codeHotlinkingIsNotAllowed                         errorCode = "hotlinking_is_not_allowed"
+	codeIncorrectEmailOrPassword                       errorCode = "incorrect_email_or_password"
+	codeInvalidAppeal                                  errorCode = "invalid_appeal"
+	codeInvalidBatchSize                               errorCode = "invalid_batch_size"
+	codeInvalidCampaign                                errorCode = "invalid_campaign"
+	codeInvalidCampaignID                              errorCode = "invalid_campaign_id"
+	codeInvalidChapter                                 errorCode = "invalid_chapter"
+	codeInvalidChapterID                               errorCode = "invalid_chapter_id"
+	codeInvalidChecksum                                errorCode = "invalid_checksum"
+	codeInvalidDigestSettings                          errorCode = "invalid_digest_settings"
+	codeInvalidEncryptionKey                           errorCode = "invalid_encryption_key"
+	codeInvalidExperimentID                            errorCode = "invalid_experiment_id"
+	codeInvalidFeatureFlagName                         errorCode = "invalid_feature_flag_name"
+	codeInvalidFocusPoint                              errorCode = "invalid_focus_point"
+	codeInvalidFolder                                  errorCode = "invalid_folder"
+	codeInvalidFolderID                                errorCode = "invalid_folder_id"
+	codeInvalidFolderSettings                          errorCode = "invalid_folder_settings"
+	codeInvalidHLSMSN                                  errorCode = "invalid_hls_msn"
+	codeInvalidHLSPart                                 errorCode = "invalid_hls_part"
+	codeInvalidID                                      errorCode = "invalid_id"
+	codeInvalidJobID                                   errorCode = "invalid_job_id"
+	codeInvalidLanguageTag                             errorCode = "invalid_language_tag"
+	codeInvalidLimit                                   errorCode = "invalid_limit"
+	codeInvalidLiveStreamSettings                      errorCode = "invalid_live_stream_settings"
+	codeInvalidNotificationID                          errorCode = "invalid_notification_id"
+	codeInvalidPageParameters                          errorCode = "invalid_page_parameters"
+	codeInvalidPathParameters                          errorCode = "invalid_path_parameters"
+	codeInvalidPlan                                    errorCode = "invalid_plan"
+	codeInvalidPlaybackEvents                          errorCode = "invalid_playback_events"
+	codeInvalidPlaybackRestrictions                    errorCode = "invalid_playback_restrictions"
+	codeInvalidPresetID                                errorCode = "invalid_preset_id"
+	codeInvalidProfile                                 errorCode = "invalid_profile"
+	codeInvalidReport                                  errorCode = "invalid_report"
+	codeInvalidReportID                                errorCode = "invalid_report_id"
+	codeInvalidResizeOptions                           errorCode = "invalid_resize_options"
+	codeInvalidRetentionLock                           errorCode = "invalid_retention_lock"
+	codeInvalidShareLink                               errorCode = "invalid_share_link"
+	codeInvalidShareLinkID                             errorCode = "invalid_share_link_id"
+	codeInvalidStreamKey                               errorCode = "invalid_stream_key"
+	codeInvalidStreamKeyID                             errorCode = "invalid_stream_key_id"
+	codeInvalidTakedownTransition                      errorCode = "invalid_takedown_transition"
+	codeInvalidThumbnail                               errorCode = "invalid_thumbnail"
+	codeInvalidThumbnailExperiment                     errorCode = "invalid_thumbnail_experiment"
+	codeInvalidThumbnailID                             errorCode = "invalid_thumbnail_id"
+	codeInvalidTranslation                             errorCode = "invalid_translation"
+	codeInvalidUpload                                  errorCode = "invalid_upload"
+	codeInvalidUploadID                                errorCode = "invalid_upload_id"
+	codeInvalidUploadPreset                            errorCode = "invalid_upload_preset"
+	codeInvalidUserID                                  errorCode = "invalid_user_id"
+	codeInvalidVersion                                 errorCode = "invalid_version"
+	codeInvalidVideoFile                               errorCode = "invalid_video_file"
+	codeInvalidVideoID                                 errorCode = "invalid_video_id"
+	codeInvalidVideoMetadata                           errorCode = "invalid_video_metadata"
+	codeInvalidVisibility                              errorCode = "invalid_visibility"
+	codeInvalidWatchProgress                           errorCode = "invalid_watch_progress"
+	codeJobNotFound                                    errorCode = "job_not_found"
+	codeListNotFound                                   errorCode = "list_not_found"
+	codeLiveStreamDidntAdvance                         errorCode = "live_stream_didnt_advance"
+	codeLiveStreamingIsntSetUpOnThisServer             errorCode = "live_streaming_isnt_set_up_on_this_server"
+	codeMaintenance                                    errorCode = "maintenance"
+	codeMalformedUpload                                errorCode = "malformed_upload"
+	codeMissingAvatarFile                              errorCode = "missing_avatar_file"
+	codeMissingContentTypeForThumbnail                 errorCode = "missing_content_type_for_thumbnail"
+	codeMissingOrInvalidURLParameter                   errorCode = "missing_or_invalid_url_parameter"
+	codeMissingThumbnailFile                           errorCode = "missing_thumbnail_file"
+	codeMissingVideoFile                               errorCode = "missing_video_file"
+	codeNoArchiveTargetIsConfigured                    errorCode = "no_archive_target_is_configured"
+	codeNoReplicaBucketIsConfigured                    errorCode = "no_replica_bucket_is_configured"
+	codeNotEnoughTemporaryStorageToProcessUpload       errorCode = "not_enough_temporary_storage_to_process_upload"
+	codeNotFound                                       errorCode = "not_found"
+	codeNotificationNotFound                           errorCode = "notification_not_found"
+	codeNoVideoFoundForURL                             errorCode = "no_video_found_for_url"
+	codeOnlyTakenDownVideosCanBeAppealed               errorCode = "only_taken_down_videos_can_be_appealed"
+	codeOnlyTheJSONFormatIsSupported                   errorCode = "only_the_json_format_is_supported"
+	codeProblemTypeNotFound                            errorCode = "problem_type_not_found"
+	codeReadOnly                                       errorCode = "read_only"
+	codeReplacementShapeChanged                        errorCode = "replacement_shape_changed"
+	codeReplacementsMustUseTheVideosEncryptionKey      errorCode = "replacements_must_use_the_videos_encryption_key"
+	codeReportIsAlreadyClosed                          errorCode = "report_is_already_closed"
+	codeReportNotFound                                 errorCode = "report_not_found"
+	codeRetryAfterSecondsCantBeNegative                errorCode = "retry_after_seconds_cant_be_negative"
+	codeRolloutPercentageMustBeBetween0And100          errorCode = "rollout_percentage_must_be_between_0_and_100"
+	codeShareLinkNotFound                              errorCode = "share_link_not_found"
+	codeStatusMustBeFlaggedTakenDownReinstatedOrUpheld errorCode = "status_must_be_flagged_taken_down_reinstated_or_upheld"
+	codeStatusMustBeOpenResolvedOrDismissed            errorCode = "status_must_be_open_resolved_or_dismissed"
+	codeStorageAccessDenied                            errorCode = "storage_access_denied"
+	codeStorageBucketMissing                           errorCode = "storage_bucket_missing"
+	codeStorageEntityTooLarge                          errorCode = "storage_entity_too_large"
+	codeStorageObjectMissing                           errorCode = "storage_object_missing"
+	codeStorageThrottled                               errorCode = "storage_throttled"
+	codeStorageTimeout                                 errorCode = "storage_timeout"
+	codeStreamKeyNotFound                              errorCode = "stream_key_not_found"
+	codeThisVideoHasBeenTakenDown                      errorCode = "this_video_has_been_taken_down"
+	codeThisVideoIsntAvailableInYourLocation           errorCode = "this_video_isnt_available_in_your_location"
+	codeThumbnailExperimentHasAlreadyEnded             errorCode = "thumbnail_experiment_has_already_ended"
+	codeThumbnailExperimentNotFound                    errorCode = "thumbnail_experiment_not_found"
+	codeThumbnailNotFound                              errorCode = "thumbnail_not_found"
+	codeTooManyShareLinks                              errorCode = "too_many_share_links"
+	codeTooManyStreamKeys                              errorCode = "too_many_stream_keys"
+	codeTooManyTranslations                            errorCode = "too_many_translations"
+	codeTooManyUploadPresets                           errorCode = "too_many_upload_presets"
+	codeTranslationNotFound                            errorCode = "translation_not_found"
+	codeUnableToCreateFile                             errorCode = "unable_to_create_file"
+	codeUnknownUploadPreset                            errorCode = "unknown_upload_preset"
+	codeUploadHasAlreadyFinished                       errorCode = "upload_has_already_finished"
+	codeUploadNotFound                                 errorCode = "upload_not_found"
+	codeUploadPresetNotFound                           errorCode = "upload_preset_not_found"
+	codeUploadRejected                                 errorCode = "upload_rejected"
+	codeUploadTruncated                                errorCode = "upload_truncated"
+	codeUploadWasCorruptedOrIncomplete                 errorCode = "upload_was_corrupted_or_incomplete"
+	codeUserNotFound                                   errorCode = "user_not_found"
+	codeVerifyMustBeTrueOrFalse                        errorCode = "verify_must_be_true_or_false"
+	codeVideoAlreadyHasAThumbnailExperimentRunning     errorCode = "video_already_has_a_thumbnail_experiment_running"
+	codeVideoDurationIsUnknown                         errorCode = "video_duration_is_unknown"
+	codeVideoDurationIsUnknownUploadTheVideoFirst      errorCode = "video_duration_is_unknown_upload_the_video_first"
+	codeVideoForbidden                                 errorCode = "video_forbidden"
+	codeVideoHasAlreadyExpired                         errorCode = "video_has_already_expired"
+	codeVideoHasExpired                                errorCode = "video_has_expired"
+	codeVideoHasNoAudioDescription                     errorCode = "video_has_no_audio_description"
+	codeVideoHasNoLiveStream                           errorCode = "video_has_no_live_stream"
+	codeVideoHasNoMedia                                errorCode = "video_has_no_media"
+	codeVideoHasNoMediaToReplaceUploadItInstead        errorCode = "video_has_no_media_to_replace_upload_it_instead"
+	codeVideoHasNoMediaYet                             errorCode = "video_has_no_media_yet"
+	codeVideoHasNoTakedown                             errorCode = "video_has_no_takedown"
+	codeVideoHasNoThumbnail                            errorCode = "video_has_no_thumbnail"
+	codeVideoIsLive                                    errorCode = "video_is_live"
+	codeVideoIsntEncryptedPlayItFromItsURL             errorCode = "video_isnt_encrypted_play_it_from_its_url"
+	codeVideoIsntLive                                  errorCode = "video_isnt_live"
+	codeVideoIsUnderARetentionLock                     errorCode = "video_is_under_a_retention_lock"
+	codeVideoNeedsAThumbnailToTestAgainst              errorCode = "video_needs_a_thumbnail_to_test_against"
+	codeVideoNotFound                                  errorCode = "video_not_found"
+	codeWrongAudioTypeForAudioDescription              errorCode = "wrong_audio_type_for_audio_description"
+	codeWrongContentTypeForVideo                       errorCode = "wrong_content_type_for_video"
+	codeWrongEncryptionKey                             errorCode = "wrong_encryption_key"
+	codeWrongImageTypeForThumbnail                     errorCode = "wrong_image_type_for_thumbnail"
+	codeYouCantChangeThisStreamKey                     errorCode = "you_cant_change_this_stream_key"
+	codeYouCantChangeThisUploadPreset                  errorCode = "you_cant_change_this_upload_preset"
+	codeYouCantCopyThisVideo                           errorCode = "you_cant_copy_this_video"
+	codeYouCantEditChaptersOfThisVideo                 errorCode = "you_cant_edit_chapters_of_this_video"
+	codeYouCantFollowYourself                          errorCode = "you_cant_follow_yourself"
+	codeYouCantManagePlaybackRestrictionsOfThisVideo   errorCode = "you_cant_manage_playback_restrictions_of_this_video"
+	codeYouCantRollBackThisVideo                       errorCode = "you_cant_roll_back_this_video"
+	codeYouCantViewAnalyticsOfThisVideo                errorCode = "you_cant_view_analytics_of_this_video"
+	codeYouCantViewVersionsOfThisVideo                 errorCode = "you_cant_view_versions_of_this_video"
+	codeYouDontOwnThisVideo                            errorCode = "you_dont_own_this_video"
+)
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+)
+
+// errorMessages translates the messages of error responses, by language and
+// then by error code. Codes without a translation keep the English message.
+var errorMessages = map[string]map[errorCode]string{
+	"de": {
+		codeCouldntFindJWT:                                 "JWT nicht gefunden",
+		codeCouldntValidateJWT:                             "JWT konnte nicht überprüft werden",
+		codeCouldntValidateAdminAPIKey:                     "Admin-API-Schlüssel konnte nicht überprüft werden",
+		codeCouldntDecodeParameters:                        "Parameter konnten nicht gelesen werden",
+		codeCouldntGetVideo:                                "Video konnte nicht abgerufen werden",
+		codeCouldntUpdateVideoData:                         "Videodaten konnten nicht aktualisiert werden",
+		codeCouldntRetrieveVideos:                          "Videos konnten nicht abgerufen werden",
+		codeInvalidVideoID:                                 "Ungültige Video-ID",
+		codeInvalidUserID:                                  "Ungültige Benutzer-ID",
+		codeInvalidID:                                      "Ungültige ID",
+		codeInvalidLanguageTag:                             "Ungültiges Sprachkürzel",
+		codeVideoNotFound:                                  "Video nicht gefunden",
+		codeUserNotFound:                                   "Benutzer nicht gefunden",
+		codeVideoHasExpired:                                "Das Video ist abgelaufen",
+		codeThisVideoHasBeenTakenDown:                      "Dieses Video wurde entfernt",
+		codeVideoHasNoMediaYet:                             "Das Video hat noch keine Mediendatei",
+		codeMissingVideoFile:                               "Videodatei fehlt",
+		codeFileSizeTooBig:                                 "Die Datei ist zu groß",
+		codeIncorrectEmailOrPassword:                       "E-Mail-Adresse oder Passwort ist falsch",
+		codeStorageAccessDenied:                            "Der Speicher hat die Zugangsdaten des Servers abgelehnt. Der Betreiber sollte die IAM-Richtlinie und die Schlüssel des Buckets prüfen.",
+		codeStorageThrottled:                               "Der Speicher drosselt Anfragen. Versuche es nach der Wartezeit aus Retry-After erneut.",
+		codeStorageBucketMissing:                           "Der konfigurierte Speicher-Bucket existiert nicht. Der Betreiber sollte S3_BUCKET und S3_REGION prüfen.",
+		codeStorageObjectMissing:                           "Die Datei fehlt im Speicher. Lade sie erneut hoch.",
+		codeStorageEntityTooLarge:                          "Die Datei ist größer, als der Speicher in einem Objekt annimmt. Lade eine kleinere Datei hoch.",
+		codeStorageTimeout:                                 "Der Speicher hat nicht länger auf den Upload gewartet. Versuche es erneut, möglichst mit einer schnelleren Verbindung.",
+		codeNotEnoughTemporaryStorageToProcessUpload:       "Nicht genug temporärer Speicher, um den Upload zu verarbeiten",
+		codeAFolderCantBeMovedIntoItself:                   "Ein Ordner kann nicht in sich selbst verschoben werden",
+		codeAReasonIsRequired:                              "Eine Begründung ist erforderlich",
+		codeAvatarMustBeAJPEGOrPNGImage:                    "Das Profilbild muss ein JPEG- oder PNG-Bild sein",
+		codeChapterNotFound:                                "Kapitel nicht gefunden",
+		codeCopyingNeedsTheVideosEncryptionKey:             "Zum Kopieren wird der Schlüssel des Videos benötigt",
+		codeCouldntFindToken:                               "Token nicht gefunden",
+		codeCouldntGetCampaign:                             "Kampagne konnte nicht abgerufen werden",
+		codeCouldntGetUser:                                 "Benutzer konnte nicht abgerufen werden",
+		codeCouldntGetUserForRefreshToken:                  "Benutzer zum Refresh-Token konnte nicht abgerufen werden",
+		codeCouldntGetVideoVersion:                         "Videoversion konnte nicht abgerufen werden",
+		codeCouldntValidateToken:                           "Token konnte nicht überprüft werden",
+		codeEmailAndPasswordAreRequired:                    "E-Mail-Adresse und Passwort sind erforderlich",
+		codeEmailIsntSetUpOnThisServer:                     "E-Mail ist auf diesem Server nicht eingerichtet",
+		codeFolderIsntEmpty:                                "Der Ordner ist nicht leer",
+		codeFolderNotFound:                                 "Ordner nicht gefunden",
+		codeHLSMSNIsTooFarAheadOfTheLiveEdge:               "_HLS_msn liegt zu weit vor dem Live-Rand",
+		codeHotlinkingIsNotAllowed:                         "Hotlinking ist nicht erlaubt",
+		codeInvalidAppeal:                                  "Ungültiger Einspruch",
+		codeInvalidCampaign:                                "Ungültige Kampagne",
+		codeInvalidCampaignID:                              "Ungültige Kampagnen-ID",
+		codeInvalidChapter:                                 "Ungültiges Kapitel",
+		codeInvalidChapterID:                               "Ungültige Kapitel-ID",
+		codeInvalidChecksum:                                "Ungültige Prüfsumme",
+		codeInvalidDigestSettings:                          "Ungültige Einstellungen für die Zusammenfassung",
+		codeInvalidEncryptionKey:                           "Ungültiger Schlüssel",
+		codeInvalidExperimentID:                            "Ungültige Experiment-ID",
+		codeInvalidFeatureFlagName:                         "Ungültiger Name des Feature-Flags",
+		codeInvalidFocusPoint:                              "Ungültiger Fokuspunkt",
+		codeInvalidFolder:                                  "Ungültiger Ordner",
+		codeInvalidFolderID:                                "Ungültige Ordner-ID",
+		codeInvalidFolderSettings:                          "Ungültige Ordnereinstellungen",
+		codeInvalidHLSMSN:                                  "Ungültiger Wert für _HLS_msn",
+		codeInvalidHLSPart:                                 "Ungültiger Wert für _HLS_part",
+		codeInvalidJobID:                                   "Ungültige Job-ID",
+		codeInvalidLiveStreamSettings:                      "Ungültige Livestream-Einstellungen",
+		codeInvalidNotificationID:                          "Ungültige Benachrichtigungs-ID",
+		codeInvalidPathParameters:                          "Ungültige Pfadparameter",
+		codeInvalidPlan:                                    "Ungültiger Tarif",
+		codeInvalidPlaybackEvents:                          "Ungültige Wiedergabeereignisse",
+		codeInvalidPlaybackRestrictions:                    "Ungültige Wiedergabebeschränkungen",
+		codeInvalidPresetID:                                "Ungültige Vorlagen-ID",
+		codeInvalidProfile:                                 "Ungültiges Profil",
+		codeInvalidReport:                                  "Ungültige Meldung",
+		codeInvalidReportID:                                "Ungültige Meldungs-ID",
+		codeInvalidRetentionLock:                           "Ungültige Aufbewahrungssperre",
+		codeInvalidShareLink:                               "Ungültiger Freigabelink",
+		codeInvalidShareLinkID:                             "Ungültige Freigabelink-ID",
+		codeInvalidStreamKey:                               "Ungültiger Streamschlüssel",
+		codeInvalidStreamKeyID:                             "Ungültige Streamschlüssel-ID",
+		codeInvalidThumbnail:                               "Ungültiges Vorschaubild",
+		codeInvalidThumbnailExperiment:                     "Ungültiges Vorschaubild-Experiment",
+		codeInvalidThumbnailID:                             "Ungültige Vorschaubild-ID",
+		codeInvalidTranslation:                             "Ungültige Übersetzung",
+		codeInvalidUpload:                                  "Ungültiger Upload",
+		codeInvalidUploadID:                                "Ungültige Upload-ID",
+		codeInvalidUploadPreset:                            "Ungültige Upload-Vorlage",
+		codeInvalidVersion:                                 "Ungültige Version",
+		codeInvalidVideoFile:                               "Ungültige Videodatei",
+		codeInvalidVideoMetadata:                           "Ungültige Videometadaten",
+		codeInvalidVisibility:                              "Ungültige Sichtbarkeit",
+		codeInvalidWatchProgress:                           "Ungültiger Wiedergabefortschritt",
+		codeJobNotFound:                                    "Job nicht gefunden",
+		codeListNotFound:                                   "Liste nicht gefunden",
+		codeLiveStreamingIsntSetUpOnThisServer:             "Livestreaming ist auf diesem Server nicht eingerichtet",
+		codeMalformedUpload:                                "Fehlerhafter Upload",
+		codeMissingAvatarFile:                              "Profilbild-Datei fehlt",
+		codeMissingContentTypeForThumbnail:                 "Content-Type des Vorschaubilds fehlt",
+		codeMissingOrInvalidURLParameter:                   "Parameter url fehlt oder ist ungültig",
+		codeMissingThumbnailFile:                           "Vorschaubild-Datei fehlt",
+		codeNoArchiveTargetIsConfigured:                    "Es ist kein Archivziel konfiguriert",
+		codeNoReplicaBucketIsConfigured:                    "Es ist kein Replikat-Bucket konfiguriert",
+		codeNoVideoFoundForURL:                             "Kein Video zu dieser URL gefunden",
+		codeNotFound:                                       "Nicht gefunden",
+		codeNotificationNotFound:                           "Benachrichtigung nicht gefunden",
+		codeOnlyTakenDownVideosCanBeAppealed:               "Nur entfernte Videos können angefochten werden",
+		codeProblemTypeNotFound:                            "Problemtyp nicht gefunden",
+		codeReplacementShapeChanged:                        "Der Ersatz hat ein anderes Format als das Video, lade ihn stattdessen als neue Version hoch",
+		codeReplacementsMustUseTheVideosEncryptionKey:      "Ersatzdateien müssen den Schlüssel des Videos verwenden",
+		codeReportIsAlreadyClosed:                          "Die Meldung ist bereits geschlossen",
+		codeReportNotFound:                                 "Meldung nicht gefunden",
+		codeRetryAfterSecondsCantBeNegative:                "retry_after_seconds darf nicht negativ sein",
+		codeRolloutPercentageMustBeBetween0And100:          "rollout_percentage muss zwischen 0 und 100 liegen",
+		codeShareLinkNotFound:                              "Freigabelink nicht gefunden",
+		codeStatusMustBeFlaggedTakenDownReinstatedOrUpheld: "status muss flagged, taken_down, reinstated oder upheld sein",
+		codeStatusMustBeOpenResolvedOrDismissed:            "status muss open, resolved oder dismissed sein",
+		codeStreamKeyNotFound:                              "Streamschlüssel nicht gefunden",
+		codeThisVideoIsntAvailableInYourLocation:           "Dieses Video ist an deinem Standort nicht verfügbar",
+		codeThumbnailExperimentHasAlreadyEnded:             "Das Vorschaubild-Experiment ist bereits beendet",
+		codeThumbnailExperimentNotFound:                    "Vorschaubild-Experiment nicht gefunden",
+		codeThumbnailNotFound:                              "Vorschaubild nicht gefunden",
+		codeTranslationNotFound:                            "Übersetzung nicht gefunden",
+		codeUnknownUploadPreset:                            "Unbekannte Upload-Vorlage",
+		codeUploadHasAlreadyFinished:                       "Der Upload ist bereits abgeschlossen",
+		codeUploadNotFound:                                 "Upload nicht gefunden",
+		codeUploadPresetNotFound:                           "Upload-Vorlage nicht gefunden",
+		codeUploadWasCorruptedOrIncomplete:                 "Der Upload war beschädigt oder unvollständig",
+		codeVerifyMustBeTrueOrFalse:                        "verify muss true oder false sein",
+		codeVideoAlreadyHasAThumbnailExperimentRunning:     "Für das Video läuft bereits ein Vorschaubild-Experiment",
+		codeVideoDurationIsUnknown:                         "Die Videolänge ist unbekannt",
+		codeVideoDurationIsUnknownUploadTheVideoFirst:      "Die Videolänge ist unbekannt, lade zuerst das Video hoch",
+		codeVideoHasAlreadyExpired:                         "Das Video ist bereits abgelaufen",
+		codeVideoHasNoAudioDescription:                     "Das Video hat keine Audiodeskription",
+		codeVideoHasNoLiveStream:                           "Das Video hat keinen Livestream",
+		codeVideoHasNoMedia:                                "Das Video hat keine Mediendatei",
+		codeVideoHasNoMediaToReplaceUploadItInstead:        "Das Video hat keine Mediendatei zum Ersetzen, lade sie stattdessen hoch",
+		codeVideoHasNoTakedown:                             "Für das Video gibt es keine Entfernung",
+		codeVideoHasNoThumbnail:                            "Das Video hat kein Vorschaubild",
+		codeVideoIsLive:                                    "Das Video läuft gerade live",
+		codeVideoIsntEncryptedPlayItFromItsURL:             "Das Video ist nicht verschlüsselt, spiele es über seine URL ab",
+		codeVideoIsntLive:                                  "Das Video läuft nicht live",
+		codeVideoNeedsAThumbnailToTestAgainst:              "Das Video braucht ein Vorschaubild, gegen das getestet wird",
+		codeWrongAudioTypeForAudioDescription:              "Falscher Audiotyp für die Audiodeskription",
+		codeWrongContentTypeForVideo:                       "Falscher Inhaltstyp für das Video",
+		codeWrongEncryptionKey:                             "Falscher Schlüssel",
+		codeWrongImageTypeForThumbnail:                     "Falscher Bildtyp für das Vorschaubild",
+		codeYouCantChangeThisStreamKey:                     "Du kannst diesen Streamschlüssel nicht ändern",
+		codeYouCantChangeThisUploadPreset:                  "Du kannst diese Upload-Vorlage nicht ändern",
+		codeYouCantCopyThisVideo:                           "Du kannst dieses Video nicht kopieren",
+		codeYouCantEditChaptersOfThisVideo:                 "Du kannst die Kapitel dieses Videos nicht bearbeiten",
+		codeYouCantFollowYourself:                          "Du kannst dir nicht selbst folgen",
+		codeYouCantManagePlaybackRestrictionsOfThisVideo:   "Du kannst die Wiedergabebeschränkungen dieses Videos nicht verwalten",
+		codeYouCantRollBackThisVideo:                       "Du kannst dieses Video nicht zurücksetzen",
+		codeYouCantViewAnalyticsOfThisVideo:                "Du kannst die Statistiken dieses Videos nicht ansehen",
+		codeYouCantViewVersionsOfThisVideo:                 "Du kannst die Versionen dieses Videos nicht ansehen",
+		codeYouDontOwnThisVideo:                            "Dieses Video gehört dir nicht",
+	},
+	"es": {
+		codeCouldntFindJWT:                                 "No se encontró el JWT",
+		codeCouldntValidateJWT:                             "No se pudo validar el JWT",
+		codeCouldntValidateAdminAPIKey:                     "No se pudo validar la clave de API de administración",
+		codeCouldntDecodeParameters:                        "No se pudieron leer los parámetros",
+		codeCouldntGetVideo:                                "No se pudo obtener el vídeo",
+		codeCouldntUpdateVideoData:                         "No se pudieron actualizar los datos del vídeo",
+		codeCouldntRetrieveVideos:                          "No se pudieron obtener los vídeos",
+		codeInvalidVideoID:                                 "ID de vídeo no válido",
+		codeInvalidUserID:                                  "ID de usuario no válido",
+		codeInvalidID:                                      "ID no válido",
+		codeInvalidLanguageTag:                             "Etiqueta de idioma no válida",
+		codeVideoNotFound:                                  "Vídeo no encontrado",
+		codeUserNotFound:                                   "Usuario no encontrado",
+		codeVideoHasExpired:                                "El vídeo ha caducado",
+		codeThisVideoHasBeenTakenDown:                      "Este vídeo ha sido retirado",
+		codeVideoHasNoMediaYet:                             "El vídeo todavía no tiene archivo multimedia",
+		codeMissingVideoFile:                               "Falta el archivo de vídeo",
+		codeFileSizeTooBig:                                 "El archivo es demasiado grande",
+		codeIncorrectEmailOrPassword:                       "Correo electrónico o contraseña incorrectos",
+		codeStorageAccessDenied:                            "El almacenamiento rechazó las credenciales del servidor. El operador debe revisar la política de IAM y las claves del bucket.",
+		codeStorageThrottled:                               "El almacenamiento está limitando las solicitudes. Vuelve a intentarlo tras el tiempo indicado en Retry-After.",
+		codeStorageBucketMissing:                           "El bucket de almacenamiento configurado no existe. El operador debe revisar S3_BUCKET y S3_REGION.",
+		codeStorageObjectMissing:                           "El archivo ya no está en el almacenamiento. Vuelve a subirlo.",
+		codeStorageEntityTooLarge:                          "El archivo supera el tamaño que el almacenamiento acepta en un objeto. Sube un archivo más pequeño.",
+		codeStorageTimeout:                                 "El almacenamiento dejó de esperar la subida. Vuelve a intentarlo, si es posible con una conexión más rápida.",
+		codeNotEnoughTemporaryStorageToProcessUpload:       "No hay suficiente almacenamiento temporal para procesar la subida",
+		codeAFolderCantBeMovedIntoItself:                   "Una carpeta no se puede mover dentro de sí misma",
+		codeAReasonIsRequired:                              "Se requiere un motivo",
+		codeAvatarMustBeAJPEGOrPNGImage:                    "El avatar debe ser una imagen JPEG o PNG",
+		codeChapterNotFound:                                "No se encontró el capítulo",
+		codeCopyingNeedsTheVideosEncryptionKey:             "Para copiarlo se necesita la clave de cifrado del vídeo",
+		codeCouldntFindToken:                               "No se encontró el token",
+		codeCouldntGetCampaign:                             "No se pudo obtener la campaña",
+		codeCouldntGetUser:                                 "No se pudo obtener el usuario",
+		codeCouldntGetUserForRefreshToken:                  "No se pudo obtener el usuario del token de actualización",
+		codeCouldntGetVideoVersion:                         "No se pudo obtener la versión del vídeo",
+		codeCouldntValidateToken:                           "No se pudo validar el token",
+		codeEmailAndPasswordAreRequired:                    "Se requieren el correo electrónico y la contraseña",
+		codeEmailIsntSetUpOnThisServer:                     "El correo electrónico no está configurado en este servidor",
+		codeFolderIsntEmpty:                                "La carpeta no está vacía",
+		codeFolderNotFound:                                 "No se encontró la carpeta",
+		codeHLSMSNIsTooFarAheadOfTheLiveEdge:               "_HLS_msn está demasiado por delante del borde en directo",
+		codeHotlinkingIsNotAllowed:                         "No se permite el hotlinking",
+		codeInvalidAppeal:                                  "Apelación no válida",
+		codeInvalidCampaign:                                "Campaña no válida",
+		codeInvalidCampaignID:                              "ID de campaña no válido",
+		codeInvalidChapter:                                 "Capítulo no válido",
+		codeInvalidChapterID:                               "ID de capítulo no válido",
+		codeInvalidChecksum:                                "Suma de comprobación no válida",
+		codeInvalidDigestSettings:                          "Configuración del resumen no válida",
+		codeInvalidEncryptionKey:                           "Clave de cifrado no válida",
+		codeInvalidExperimentID:                            "ID de experimento no válido",
+		codeInvalidFeatureFlagName:                         "Nombre de feature flag no válido",
+		codeInvalidFocusPoint:                              "Punto de enfoque no válido",
+		codeInvalidFolder:                                  "Carpeta no válida",
+		codeInvalidFolderID:                                "ID de carpeta no válido",
+		codeInvalidFolderSettings:                          "Configuración de carpeta no válida",
+		codeInvalidHLSMSN:                                  "Valor de _HLS_msn no válido",
+		codeInvalidHLSPart:                                 "Valor de _HLS_part no válido",
+		codeInvalidJobID:                                   "ID de tarea no válido",
+		codeInvalidLiveStreamSettings:                      "Configuración de emisión en directo no válida",
+		codeInvalidNotificationID:                          "ID de notificación no válido",
+		codeInvalidPathParameters:                          "Parámetros de ruta no válidos",
+		codeInvalidPlan:                                    "Plan no válido",
+		codeInvalidPlaybackEvents:                          "Eventos de reproducción no válidos",
+		codeInvalidPlaybackRestrictions:                    "Restricciones de reproducción no válidas",
+		codeInvalidPresetID:                                "ID de ajuste preestablecido no válido",
+		codeInvalidProfile:                                 "Perfil no válido",
+		codeInvalidReport:                                  "Denuncia no válida",
+		codeInvalidReportID:                                "ID de denuncia no válido",
+		codeInvalidRetentionLock:                           "Bloqueo de retención no válido",
+		codeInvalidShareLink:                               "Enlace para compartir no válido",
+		codeInvalidShareLinkID:                             "ID de enlace para compartir no válido",
+		codeInvalidStreamKey:                               "Clave de emisión no válida",
+		codeInvalidStreamKeyID:                             "ID de clave de emisión no válido",
+		codeInvalidThumbnail:                               "Miniatura no válida",
+		codeInvalidThumbnailExperiment:                     "Experimento de miniaturas no válido",
+		codeInvalidThumbnailID:                             "ID de miniatura no válido",
+		codeInvalidTranslation:                             "Traducción no válida",
+		codeInvalidUpload:                                  "Subida no válida",
+		codeInvalidUploadID:                                "ID de subida no válido",
+		codeInvalidUploadPreset:                            "Ajuste preestablecido de subida no válido",
+		codeInvalidVersion:                                 "Versión no válida",
+		codeInvalidVideoFile:                               "Archivo de vídeo no válido",
+		codeInvalidVideoMetadata:                           "Metadatos del vídeo no válidos",
+		codeInvalidVisibility:                              "Visibilidad no válida",
+		codeInvalidWatchProgress:                           "Progreso de reproducción no válido",
+		codeJobNotFound:                                    "No se encontró la tarea",
+		codeListNotFound:                                   "No se encontró la lista",
+		codeLiveStreamingIsntSetUpOnThisServer:             "Las emisiones en directo no están configuradas en este servidor",
+		codeMalformedUpload:                                "Subida mal formada",
+		codeMissingAvatarFile:                              "Falta el archivo del avatar",
+		codeMissingContentTypeForThumbnail:                 "Falta el Content-Type de la miniatura",
+		codeMissingOrInvalidURLParameter:                   "Falta el parámetro url o no es válido",
+		codeMissingThumbnailFile:                           "Falta el archivo de la miniatura",
+		codeNoArchiveTargetIsConfigured:                    "No hay ningún destino de archivo configurado",
+		codeNoReplicaBucketIsConfigured:                    "No hay ningún bucket de réplica configurado",
+		codeNoVideoFoundForURL:                             "No se encontró ningún vídeo para la URL",
+		codeNotFound:                                       "No encontrado",
+		codeNotificationNotFound:                           "No se encontró la notificación",
+		codeOnlyTakenDownVideosCanBeAppealed:               "Solo se puede apelar contra vídeos retirados",
+		codeProblemTypeNotFound:                            "No se encontró el tipo de problema",
+		codeReplacementShapeChanged:                        "El reemplazo tiene un formato distinto al del vídeo, súbelo como una versión nueva",
+		codeReplacementsMustUseTheVideosEncryptionKey:      "Los reemplazos deben usar la clave de cifrado del vídeo",
+		codeReportIsAlreadyClosed:                          "La denuncia ya está cerrada",
+		codeReportNotFound:                                 "No se encontró la denuncia",
+		codeRetryAfterSecondsCantBeNegative:                "retry_after_seconds no puede ser negativo",
+		codeRolloutPercentageMustBeBetween0And100:          "rollout_percentage debe estar entre 0 y 100",
+		codeShareLinkNotFound:                              "No se encontró el enlace para compartir",
+		codeStatusMustBeFlaggedTakenDownReinstatedOrUpheld: "status debe ser flagged, taken_down, reinstated o upheld",
+		codeStatusMustBeOpenResolvedOrDismissed:            "status debe ser open, resolved o dismissed",
+		codeStreamKeyNotFound:                              "No se encontró la clave de emisión",
+		codeThisVideoIsntAvailableInYourLocation:           "Este vídeo no está disponible en tu ubicación",
+		codeThumbnailExperimentHasAlreadyEnded:             "El experimento de miniaturas ya ha terminado",
+		codeThumbnailExperimentNotFound:                    "No se encontró el experimento de miniaturas",
+		codeThumbnailNotFound:                              "No se encontró la miniatura",
+		codeTranslationNotFound:                            "No se encontró la traducción",
+		codeUnknownUploadPreset:                            "Ajuste preestablecido de subida desconocido",
+		codeUploadHasAlreadyFinished:                       "La subida ya ha terminado",
+		codeUploadNotFound:                                 "No se encontró la subida",
+		codeUploadPresetNotFound:                           "No se encontró el ajuste preestablecido de subida",
+		codeUploadWasCorruptedOrIncomplete:                 "La subida estaba dañada o incompleta",
+		codeVerifyMustBeTrueOrFalse:                        "verify debe ser true o false",
+		codeVideoAlreadyHasAThumbnailExperimentRunning:     "El vídeo ya tiene un experimento de miniaturas en curso",
+		codeVideoDurationIsUnknown:                         "Se desconoce la duración del vídeo",
+		codeVideoDurationIsUnknownUploadTheVideoFirst:      "Se desconoce la duración del vídeo, sube primero el vídeo",
+		codeVideoHasAlreadyExpired:                         "El vídeo ya ha caducado",
+		codeVideoHasNoAudioDescription:                     "El vídeo no tiene audiodescripción",
+		codeVideoHasNoLiveStream:                           "El vídeo no tiene emisión en directo",
+		codeVideoHasNoMedia:                                "El vídeo no tiene archivo multimedia",
+		codeVideoHasNoMediaToReplaceUploadItInstead:        "El vídeo no tiene archivo multimedia que reemplazar, súbelo en su lugar",
+		codeVideoHasNoTakedown:                             "El vídeo no tiene ninguna retirada",
+		codeVideoHasNoThumbnail:                            "El vídeo no tiene miniatura",
+		codeVideoIsLive:                                    "El vídeo está en directo",
+		codeVideoIsntEncryptedPlayItFromItsURL:             "El vídeo no está cifrado, reprodúcelo desde su URL",
+		codeVideoIsntLive:                                  "El vídeo no está en directo",
+		codeVideoNeedsAThumbnailToTestAgainst:              "El vídeo necesita una miniatura con la que comparar",
+		codeWrongAudioTypeForAudioDescription:              "Tipo de audio incorrecto para la audiodescripción",
+		codeWrongContentTypeForVideo:                       "Tipo de contenido incorrecto para el vídeo",
+		codeWrongEncryptionKey:                             "Clave de cifrado incorrecta",
+		codeWrongImageTypeForThumbnail:                     "Tipo de imagen incorrecto para la miniatura",
+		codeYouCantChangeThisStreamKey:                     "No puedes cambiar esta clave de emisión",
+		codeYouCantChangeThisUploadPreset:                  "No puedes cambiar este ajuste preestablecido de subida",
+		codeYouCantCopyThisVideo:                           "No puedes copiar este vídeo",
+		codeYouCantEditChaptersOfThisVideo:                 "No puedes editar los capítulos de este vídeo",
+		codeYouCantFollowYourself:                          "No puedes seguirte a ti mismo",
+		codeYouCantManagePlaybackRestrictionsOfThisVideo:   "No puedes gestionar las restricciones de reproducción de este vídeo",
+		codeYouCantRollBackThisVideo:                       "No puedes revertir este vídeo",
+		codeYouCantViewAnalyticsOfThisVideo:                "No puedes ver las estadísticas de este vídeo",
+		codeYouCantViewVersionsOfThisVideo:                 "No puedes ver las versiones de este vídeo",
+		codeYouDontOwnThisVideo:                            "Este vídeo no es tuyo",
+	},
+	"fr": {
+		codeCouldntFindJWT:                                 "JWT introuvable",
+		codeCouldntValidateJWT:                             "Impossible de valider le JWT",
+		codeCouldntValidateAdminAPIKey:                     "Impossible de valider la clé d'API d'administration",
+		codeCouldntDecodeParameters:                        "Impossible de lire les paramètres",
+		codeCouldntGetVideo:                                "Impossible de récupérer la vidéo",
+		codeCouldntUpdateVideoData:                         "Impossible de mettre à jour les données de la vidéo",
+		codeCouldntRetrieveVideos:                          "Impossible de récupérer les vidéos",
+		codeInvalidVideoID:                                 "Identifiant de vidéo invalide",
+		codeInvalidUserID:                                  "Identifiant d'utilisateur invalide",
+		codeInvalidID:                                      "Identifiant invalide",
+		codeInvalidLanguageTag:                             "Code de langue invalide",
+		codeVideoNotFound:                                  "Vidéo introuvable",
+		codeUserNotFound:                                   "Utilisateur introuvable",
+		codeVideoHasExpired:                                "La vidéo a expiré",
+		codeThisVideoHasBeenTakenDown:                      "Cette vidéo a été retirée",
+		codeVideoHasNoMediaYet:                             "La vidéo n'a pas encore de fichier média",
+		codeMissingVideoFile:                               "Fichier vidéo manquant",
+		codeFileSizeTooBig:                                 "Le fichier est trop volumineux",
+		codeIncorrectEmailOrPassword:                       "Adresse e-mail ou mot de passe incorrect",
+		codeStorageAccessDenied:                            "Le stockage a refusé les identifiants du serveur. L'opérateur doit vérifier la politique IAM et les clés du bucket.",
+		codeStorageThrottled:                               "Le stockage limite les requêtes. Réessayez après le délai indiqué par Retry-After.",
+		codeStorageBucketMissing:                           "Le bucket de stockage configuré n'existe pas. L'opérateur doit vérifier S3_BUCKET et S3_REGION.",
+		codeStorageObjectMissing:                           "Le fichier a disparu du stockage. Envoyez-le à nouveau.",
+		codeStorageEntityTooLarge:                          "Le fichier dépasse la taille que le stockage accepte pour un objet. Envoyez un fichier plus petit.",
+		codeStorageTimeout:                                 "Le stockage a cessé d'attendre l'envoi. Réessayez, si possible avec une connexion plus rapide.",
+		codeNotEnoughTemporaryStorageToProcessUpload:       "Pas assez d'espace temporaire pour traiter l'envoi",
+		codeAFolderCantBeMovedIntoItself:                   "Un dossier ne peut pas être déplacé dans lui-même",
+		codeAReasonIsRequired:                              "Un motif est requis",
+		codeAvatarMustBeAJPEGOrPNGImage:                    "L'avatar doit être une image JPEG ou PNG",
+		codeChapterNotFound:                                "Chapitre introuvable",
+		codeCopyingNeedsTheVideosEncryptionKey:             "La copie nécessite la clé de chiffrement de la vidéo",
+		codeCouldntFindToken:                               "Jeton introuvable",
+		codeCouldntGetCampaign:                             "Impossible de récupérer la campagne",
+		codeCouldntGetUser:                                 "Impossible de récupérer l'utilisateur",
+		codeCouldntGetUserForRefreshToken:                  "Impossible de récupérer l'utilisateur du jeton d'actualisation",
+		codeCouldntGetVideoVersion:                         "Impossible de récupérer la version de la vidéo",
+		codeCouldntValidateToken:                           "Impossible de valider le jeton",
+		codeEmailAndPasswordAreRequired:                    "L'adresse e-mail et le mot de passe sont requis",
+		codeEmailIsntSetUpOnThisServer:                     "L'e-mail n'est pas configuré sur ce serveur",
+		codeFolderIsntEmpty:                                "Le dossier n'est pas vide",
+		codeFolderNotFound:                                 "Dossier introuvable",
+		codeHLSMSNIsTooFarAheadOfTheLiveEdge:               "_HLS_msn est trop en avance sur le direct",
+		codeHotlinkingIsNotAllowed:                         "Le hotlinking n'est pas autorisé",
+		codeInvalidAppeal:                                  "Recours invalide",
+		codeInvalidCampaign:                                "Campagne invalide",
+		codeInvalidCampaignID:                              "ID de campagne invalide",
+		codeInvalidChapter:                                 "Chapitre invalide",
+		codeInvalidChapterID:                               "ID de chapitre invalide",
+		codeInvalidChecksum:                                "Somme de contrôle invalide",
+		codeInvalidDigestSettings:                          "Paramètres du récapitulatif invalides",
+		codeInvalidEncryptionKey:                           "Clé de chiffrement invalide",
+		codeInvalidExperimentID:                            "ID d'expérience invalide",
+		codeInvalidFeatureFlagName:                         "Nom de feature flag invalide",
+		codeInvalidFocusPoint:                              "Point de focus invalide",
+		codeInvalidFolder:                                  "Dossier invalide",
+		codeInvalidFolderID:                                "ID de dossier invalide",
+		codeInvalidFolderSettings:                          "Paramètres de dossier invalides",
+		codeInvalidHLSMSN:                                  "Valeur de _HLS_msn invalide",
+		codeInvalidHLSPart:                                 "Valeur de _HLS_part invalide",
+		codeInvalidJobID:                                   "ID de tâche invalide",
+		codeInvalidLiveStreamSettings:                      "Paramètres du direct invalides",
+		codeInvalidNotificationID:                          "ID de notification invalide",
+		codeInvalidPathParameters:                          "Paramètres de chemin invalides",
+		codeInvalidPlan:                                    "Forfait invalide",
+		codeInvalidPlaybackEvents:                          "Événements de lecture invalides",
+		codeInvalidPlaybackRestrictions:                    "Restrictions de lecture invalides",
+		codeInvalidPresetID:                                "ID de préréglage invalide",
+		codeInvalidProfile:                                 "Profil invalide",
+		codeInvalidReport:                                  "Signalement invalide",
+		codeInvalidReportID:                                "ID de signalement invalide",
+		codeInvalidRetentionLock:                           "Verrou de conservation invalide",
+		codeInvalidShareLink:                               "Lien de partage invalide",
+		codeInvalidShareLinkID:                             "ID de lien de partage invalide",
+		codeInvalidStreamKey:                               "Clé de stream invalide",
+		codeInvalidStreamKeyID:                             "ID de clé de stream invalide",
+		codeInvalidThumbnail:                               "Miniature invalide",
+		codeInvalidThumbnailExperiment:                     "Expérience de miniatures invalide",
+		codeInvalidThumbnailID:                             "ID de miniature invalide",
+		codeInvalidTranslation:                             "Traduction invalide",
+		codeInvalidUpload:                                  "Envoi invalide",
+		codeInvalidUploadID:                                "ID d'envoi invalide",
+		codeInvalidUploadPreset:                            "Préréglage d'envoi invalide",
+		codeInvalidVersion:                                 "Version invalide",
+		codeInvalidVideoFile:                               "Fichier vidéo invalide",
+		codeInvalidVideoMetadata:                           "Métadonnées de la vidéo invalides",
+		codeInvalidVisibility:                              "Visibilité invalide",
+		codeInvalidWatchProgress:                           "Progression de lecture invalide",
+		codeJobNotFound:                                    "Tâche introuvable",
+		codeListNotFound:                                   "Liste introuvable",
+		codeLiveStreamingIsntSetUpOnThisServer:             "Le direct n'est pas configuré sur ce serveur",
+		codeMalformedUpload:                                "Envoi mal formé",
+		codeMissingAvatarFile:                              "Fichier d'avatar manquant",
+		codeMissingContentTypeForThumbnail:                 "Content-Type de la miniature manquant",
+		codeMissingOrInvalidURLParameter:                   "Paramètre url manquant ou invalide",
+		codeMissingThumbnailFile:                           "Fichier de miniature manquant",
+		codeNoArchiveTargetIsConfigured:                    "Aucune cible d'archivage n'est configurée",
+		codeNoReplicaBucketIsConfigured:                    "Aucun bucket de réplique n'est configuré",
+		codeNoVideoFoundForURL:                             "Aucune vidéo trouvée pour cette URL",
+		codeNotFound:                                       "Introuvable",
+		codeNotificationNotFound:                           "Notification introuvable",
+		codeOnlyTakenDownVideosCanBeAppealed:               "Seules les vidéos retirées peuvent faire l'objet d'un recours",
+		codeProblemTypeNotFound:                            "Type de problème introuvable",
+		codeReplacementShapeChanged:                        "Le remplacement n'a pas le même format que la vidéo, envoyez-le plutôt comme nouvelle version",
+		codeReplacementsMustUseTheVideosEncryptionKey:      "Les remplacements doivent utiliser la clé de chiffrement de la vidéo",
+		codeReportIsAlreadyClosed:                          "Le signalement est déjà clos",
+		codeReportNotFound:                                 "Signalement introuvable",
+		codeRetryAfterSecondsCantBeNegative:                "retry_after_seconds ne peut pas être négatif",
+		codeRolloutPercentageMustBeBetween0And100:          "rollout_percentage doit être compris entre 0 et 100",
+		codeShareLinkNotFound:                              "Lien de partage introuvable",
+		codeStatusMustBeFlaggedTakenDownReinstatedOrUpheld: "status doit valoir flagged, taken_down, reinstated ou upheld",
+		codeStatusMustBeOpenResolvedOrDismissed:            "status doit valoir open, resolved ou dismissed",
+		codeStreamKeyNotFound:                              "Clé de stream introuvable",
+		codeThisVideoIsntAvailableInYourLocation:           "Cette vidéo n'est pas disponible dans votre région",
+		codeThumbnailExperimentHasAlreadyEnded:             "L'expérience de miniatures est déjà terminée",
+		codeThumbnailExperimentNotFound:                    "Expérience de miniatures introuvable",
+		codeThumbnailNotFound:                              "Miniature introuvable",
+		codeTranslationNotFound:                            "Traduction introuvable",
+		codeUnknownUploadPreset:                            "Préréglage d'envoi inconnu",
+		codeUploadHasAlreadyFinished:                       "L'envoi est déjà terminé",
+		codeUploadNotFound:                                 "Envoi introuvable",
+		codeUploadPresetNotFound:                           "Préréglage d'envoi introuvable",
+		codeUploadWasCorruptedOrIncomplete:                 "L'envoi était corrompu ou incomplet",
+		codeVerifyMustBeTrueOrFalse:                        "verify doit valoir true ou false",
+		codeVideoAlreadyHasAThumbnailExperimentRunning:     "Une expérience de miniatures est déjà en cours pour cette vidéo",
+		codeVideoDurationIsUnknown:                         "La durée de la vidéo est inconnue",
+		codeVideoDurationIsUnknownUploadTheVideoFirst:      "La durée de la vidéo est inconnue, envoyez d'abord la vidéo",
+		codeVideoHasAlreadyExpired:                         "La vidéo a déjà expiré",
+		codeVideoHasNoAudioDescription:                     "La vidéo n'a pas d'audiodescription",
+		codeVideoHasNoLiveStream:                           "La vidéo n'a pas de direct",
+		codeVideoHasNoMedia:                                "La vidéo n'a pas de fichier média",
+		codeVideoHasNoMediaToReplaceUploadItInstead:        "La vidéo n'a pas de fichier média à remplacer, envoyez-le plutôt",
+		codeVideoHasNoTakedown:                             "La vidéo ne fait l'objet d'aucun retrait",
+		codeVideoHasNoThumbnail:                            "La vidéo n'a pas de miniature",
+		codeVideoIsLive:                                    "La vidéo est en direct",
+		codeVideoIsntEncryptedPlayItFromItsURL:             "La vidéo n'est pas chiffrée, lisez-la depuis son URL",
+		codeVideoIsntLive:                                  "La vidéo n'est pas en direct",
+		codeVideoNeedsAThumbnailToTestAgainst:              "La vidéo a besoin d'une miniature de référence pour le test",
+		codeWrongAudioTypeForAudioDescription:              "Type audio incorrect pour l'audiodescription",
+		codeWrongContentTypeForVideo:                       "Type de contenu incorrect pour la vidéo",
+		codeWrongEncryptionKey:                             "Clé de chiffrement incorrecte",
+		codeWrongImageTypeForThumbnail:                     "Type d'image incorrect pour la miniature",
+		codeYouCantChangeThisStreamKey:                     "Vous ne pouvez pas modifier cette clé de stream",
+		codeYouCantChangeThisUploadPreset:                  "Vous ne pouvez pas modifier ce préréglage d'envoi",
+		codeYouCantCopyThisVideo:                           "Vous ne pouvez pas copier cette vidéo",
+		codeYouCantEditChaptersOfThisVideo:                 "Vous ne pouvez pas modifier les chapitres de cette vidéo",
+		codeYouCantFollowYourself:                          "Vous ne pouvez pas vous suivre vous-même",
+		codeYouCantManagePlaybackRestrictionsOfThisVideo:   "Vous ne pouvez pas gérer les restrictions de lecture de cette vidéo",
+		codeYouCantRollBackThisVideo:                       "Vous ne pouvez pas restaurer une version antérieure de cette vidéo",
+		codeYouCantViewAnalyticsOfThisVideo:                "Vous ne pouvez pas consulter les statistiques de cette vidéo",
+		codeYouCantViewVersionsOfThisVideo:                 "Vous ne pouvez pas consulter les versions de cette vidéo",
+		codeYouDontOwnThisVideo:                            "Cette vidéo ne vous appartient pas",
+	},
+}
+
+// errorLanguages are the languages errorMessages has a catalog for.
+var errorLanguages = func() []string {
+	langs := make([]string, 0, len(errorMessages))
+	for lang := range errorMessages {
+		langs = append(langs, lang)
+	}
+	return langs
+}()
+
+// errorNegotiationMiddleware picks the language of error responses from
+// Accept-Language and their format from Accept. It has to run inside
+// http.TimeoutHandler, whose writer hides whatever wrapped the one it was
+// given.
+func errorNegotiationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefs := errorPrefs{
+			lang:    negotiateLanguage(parseAcceptLanguage(r.Header.Get("Accept-Language")), errorLanguages),
+			problem: acceptsProblemJSON(r.Header.Get("Accept")),
+		}
+		if prefs == (errorPrefs{}) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&errorPrefsWriter{ResponseWriter: w, prefs: prefs}, r)
+	})
+}
+
+// errorPrefs is how a client asked for errors to be written.
+type errorPrefs struct {
+	// "" for English
+	lang string
+	// application/problem+json instead of the plain JSON error
+	problem bool
+}
+
+// errorPrefsWriter carries the negotiated errorPrefs to respondWithError,
+// which only gets the writer.
+type errorPrefsWriter struct {
+	http.ResponseWriter
+	prefs errorPrefs
+}
+
+func (e *errorPrefsWriter) Flush() {
+	http.NewResponseController(e.ResponseWriter).Flush()
+}
+
+func (e *errorPrefsWriter) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
+
+// errorPrefsOf finds how errors to w are written.
+func errorPrefsOf(w http.ResponseWriter) errorPrefs {
+	for {
+		switch rw := w.(type) {
+		case *errorPrefsWriter:
+			return rw.prefs
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return errorPrefs{}
+		}
+	}
+}
+
+// localizeError returns the message for code in the language of w, or
+// fallback when there's no translation. It marks the response as varying
+// by language and, since errors can be problem details, by format.
+func localizeError(w http.ResponseWriter, code errorCode, fallback string) string {
+	for _, header := range []string{"Accept-Language", "Accept"} {
+		if !slices.Contains(w.Header().Values("Vary"), header) {
+			w.Header().Add("Vary", header)
+		}
+	}
+	lang := errorPrefsOf(w).lang
+	if msg, ok := errorMessages[lang][code]; ok {
+		w.Header().Set("Content-Language", lang)
+		return msg
+	}
+	return fallback
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"testing"
+)
+
+// untranslatedErrorCodes are client errors left out of the catalogs on
+// purpose: their messages carry values, like a limit or the reason a hook
+// gave, that a fixed translation would drop.
+var untranslatedErrorCodes = map[errorCode]bool{
+	codeCampaignWrongStatus:        true,
+	codeEncryptionKeyRequired:      true,
+	codeFolderForbidden:            true,
+	codeFolderTooDeep:              true,
+	codeInvalidBatchSize:           true,
+	codeInvalidLimit:               true,
+	codeInvalidPageParameters:      true,
+	codeInvalidResizeOptions:       true,
+	codeInvalidTakedownTransition:  true,
+	codeTooManyShareLinks:          true,
+	codeTooManyStreamKeys:          true,
+	codeTooManyTranslations:        true,
+	codeTooManyUploadPresets:       true,
+	codeUploadRejected:             true,
+	codeUploadTruncated:            true,
+	codeVideoForbidden:             true,
+	codeVideoIsUnderARetentionLock: true,
+}
+
+// errorCodeValues maps the names of the errorCode constants to their values.
+func errorCodeValues(files []*ast.File) map[string]errorCode {
+	values := map[string]errorCode{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if typ, ok := vs.Type.(*ast.Ident); !ok || typ.Name != "errorCode" {
+					continue
+				}
+				for i, name := range vs.Names {
+					lit, ok := vs.Values[i].(*ast.BasicLit)
+					if !ok || lit.Kind != token.STRING {
+						continue
+					}
+					value, err := strconv.Unquote(lit.Value)
+					if err == nil {
+						values[name.Name] = errorCode(value)
+					}
+				}
+			}
+		}
+	}
+	return values
+}
+
+// clientErrorCodes returns the codes the package reports with a 4xx status,
+// by file and line: a status followed by a code in a call or return, a
+// storageError literal, or a respondWithFieldErrors call, which is a 400.
+func clientErrorCodes(t *testing.T) map[errorCode]string {
+	t.Helper()
+	fset, files := packageFiles(t)
+	values := errorCodeValues(files)
+	found := map[errorCode]string{}
+	add := func(expr ast.Expr) {
+		ident, ok := expr.(*ast.Ident)
+		if !ok {
+			return
+		}
+		code, ok := values[ident.Name]
+		if !ok {
+			return
+		}
+		if _, seen := found[code]; !seen {
+			found[code] = fset.Position(ident.Pos()).String()
+		}
+	}
+	isClientError := func(expr ast.Expr) bool {
+		status := errorStatusOf(expr)
+		return status >= 400 && status < 500
+	}
+	pairs := func(exprs []ast.Expr) {
+		for i := 0; i+1 < len(exprs); i++ {
+			if isClientError(exprs[i]) {
+				add(exprs[i+1])
+			}
+		}
+	}
+
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				pairs(n.Args)
+				if fn, ok := n.Fun.(*ast.Ident); ok && fn.Name == "respondWithFieldErrors" && len(n.Args) > 1 {
+					add(n.Args[1])
+				}
+			case *ast.ReturnStmt:
+				pairs(n.Results)
+			case *ast.CompositeLit:
+				fields := map[string]ast.Expr{}
+				for _, elt := range n.Elts {
+					if kv, ok := elt.(*ast.KeyValueExpr); ok {
+						if key, ok := kv.Key.(*ast.Ident); ok {
+							fields[key.Name] = kv.Value
+						}
+					}
+				}
+				if status, ok := fields["status"]; ok && isClientError(status) {
+					if code, ok := fields["code"]; ok {
+						add(code)
+					}
+				}
+			}
+			return true
+		})
+	}
+	return found
+}
+
+// TestErrorMessagesCoverClientErrors makes sure clients asking for another
+// language get every error they can act on in it.
+func TestErrorMessagesCoverClientErrors(t *testing.T) {
+	used := clientErrorCodes(t)
+	if len(used) == 0 {
+		t.Fatal("found no codes used with a 4xx status")
+	}
+	for code, where := range used {
+		if untranslatedErrorCodes[code] {
+			continue
+		}
+		for lang, catalog := range errorMessages {
+			if _, ok := catalog[code]; !ok {
+				t.Errorf("%s, used with a 4xx status at %s, has no %q message", code, where, lang)
+			}
+		}
+	}
+	for code := range untranslatedErrorCodes {
+		if _, ok := used[code]; !ok {
+			t.Errorf("%s is left out of the catalogs but isn't used with a 4xx status", code)
+		}
+	}
+}
+
+func TestErrorMessagesAreKnownCodes(t *testing.T) {
+	_, files := packageFiles(t)
+	known := map[errorCode]bool{}
+	for _, code := range errorCodeValues(files) {
+		known[code] = true
+	}
+	for lang, catalog := range errorMessages {
+		for code := range catalog {
+			if !known[code] {
+				t.Errorf("%q catalog has a message for unknown code %s", lang, code)
+			}
+		}
+	}
+}
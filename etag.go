@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// jsonETag derives a weak ETag from the JSON v is served as. It's weak since
+// the body may still differ in fields left out of the tag.
+func jsonETag(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(sum[:16])), nil
+}
+
+// videoETag changes whenever the video's metadata, media or chapters do. View
+// counts are left out, otherwise every poll would invalidate the tag.
+func videoETag(video videoWithChapters) (string, error) {
+	video.ViewCount = 0
+	return jsonETag(video)
+}
+
+func videosETag(videos []database.Video) (string, error) {
+	stripped := make([]database.Video, len(videos))
+	for i, video := range videos {
+		video.ViewCount = 0
+		stripped[i] = video
+	}
+	return jsonETag(stripped)
+}
+
+// checkNotModified sets the ETag header and, when the client already has
+// this version, responds with 304 and reports true.
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
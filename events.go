@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/uuid"
+)
+
+const (
+	eventVideoCreated          = "video.created"
+	eventVideoUpdated          = "video.updated"
+	eventVideoUploaded         = "video.uploaded"
+	eventVideoDeleted          = "video.deleted"
+	eventVideoThumbnailUpdated = "video.thumbnail_updated"
+	eventVideoTakedownUpdated  = "video.takedown_updated"
+	eventVideoExpired          = "video.expired"
+	eventVideoProcessingFailed = "video.processing_failed"
+	eventUserFollowed          = "user.followed"
+
+	eventDispatchInterval = 5 * time.Second
+	eventDispatchBatch    = 100
+	eventMaxBackoff       = 30 * time.Minute
+	eventRetention        = 7 * 24 * time.Hour
+)
+
+// eventEnvelope is what consumers receive. IDs are stable across redeliveries
+// so consumers can deduplicate.
+type eventEnvelope struct {
+	ID         uuid.UUID       `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+type eventPublisher interface {
+	Publish(ctx context.Context, event eventEnvelope) error
+}
+
+// publishEvent records an event in the outbox. Delivery happens in the
+// background dispatcher, which retries until the bus accepts it.
+func (cfg *apiConfig) publishEvent(eventType string, data any) {
+	cfg.notifyForEvent(eventType, data)
+	if cfg.eventPublisher == nil {
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Couldn't marshal %s event: %v", eventType, err)
+		return
+	}
+	_, err = cfg.db.CreateEvent(eventType, string(payload))
+	if err != nil {
+		log.Printf("Couldn't store %s event: %v", eventType, err)
+	}
+}
+
+func (cfg *apiConfig) startEventDispatcher() {
+	if cfg.eventPublisher == nil {
+		return
+	}
+	// a single dispatcher keeps replicas from sending the same event at once
+	cfg.startScheduledTask("event_dispatch", eventDispatchInterval, cfg.dispatchEvents)
+	cfg.startScheduledTask("event_prune", time.Hour, func(ctx context.Context) {
+		if err := cfg.db.DeletePublishedEvents(time.Now().Add(-eventRetention)); err != nil {
+			log.Printf("Couldn't prune published events: %v", err)
+		}
+	})
+}
+
+func (cfg *apiConfig) dispatchEvents(ctx context.Context) {
+	events, err := cfg.db.GetPendingEvents(eventDispatchBatch)
+	if err != nil {
+		log.Printf("Couldn't load pending events: %v", err)
+		return
+	}
+
+	for _, e := range events {
+		err := cfg.eventPublisher.Publish(ctx, eventEnvelope{
+			ID:         e.ID,
+			Type:       e.Type,
+			OccurredAt: e.CreatedAt,
+			Data:       json.RawMessage(e.Payload),
+		})
+		if err != nil {
+			backoff := min(time.Duration(1<<min(e.Attempts, 20))*time.Second, eventMaxBackoff)
+			log.Printf("Couldn't publish event %s (attempt %d), retrying in %s: %v", e.ID, e.Attempts+1, backoff, err)
+			if err := cfg.db.MarkEventFailed(e.ID, time.Now().Add(backoff), err.Error()); err != nil {
+				log.Printf("Couldn't record failure of event %s: %v", e.ID, err)
+			}
+			continue
+		}
+
+		// if this fails the event is sent again, which at-least-once allows
+		if err := cfg.db.MarkEventPublished(e.ID); err != nil {
+			log.Printf("Couldn't mark event %s published: %v", e.ID, err)
+		}
+	}
+}
+
+type snsPublisher struct {
+	client   *sns.Client
+	topicARN string
+}
+
+func (p snsPublisher) Publish(ctx context.Context, event eventEnvelope) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = p.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(p.topicARN),
+		Message:  aws.String(string(body)),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"type": {DataType: aws.String("String"), StringValue: aws.String(event.Type)},
+		},
+	})
+	return err
+}
+
+type sqsPublisher struct {
+	client   *sqs.Client
+	queueURL string
+}
+
+func (p sqsPublisher) Publish(ctx context.Context, event eventEnvelope) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = p.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(p.queueURL),
+		MessageBody: aws.String(string(body)),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			"type": {DataType: aws.String("String"), StringValue: aws.String(event.Type)},
+		},
+	})
+	return err
+}
+
+// kafkaRESTPublisher produces to Kafka through a Confluent-compatible REST
+// proxy, keyed by event ID.
+type kafkaRESTPublisher struct {
+	client  *http.Client
+	baseURL string
+	topic   string
+}
+
+func (p kafkaRESTPublisher) Publish(ctx context.Context, event eventEnvelope) error {
+	body, err := json.Marshal(map[string]any{
+		"records": []map[string]any{
+			{"key": event.ID.String(), "value": event},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/topics/%s", p.baseURL, p.topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("kafka REST proxy responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func newEventPublisher(awsConfig aws.Config) (eventPublisher, error) {
+	switch backend := os.Getenv("EVENT_BUS"); backend {
+	case "":
+		return nil, nil
+	case "sns":
+		topicARN := os.Getenv("EVENT_SNS_TOPIC_ARN")
+		if topicARN == "" {
+			return nil, fmt.Errorf("EVENT_SNS_TOPIC_ARN must be set for the sns event bus")
+		}
+		return snsPublisher{client: sns.NewFromConfig(awsConfig), topicARN: topicARN}, nil
+	case "sqs":
+		queueURL := os.Getenv("EVENT_SQS_QUEUE_URL")
+		if queueURL == "" {
+			return nil, fmt.Errorf("EVENT_SQS_QUEUE_URL must be set for the sqs event bus")
+		}
+		return sqsPublisher{client: sqs.NewFromConfig(awsConfig), queueURL: queueURL}, nil
+	case "kafka":
+		restURL, topic := os.Getenv("EVENT_KAFKA_REST_URL"), os.Getenv("EVENT_KAFKA_TOPIC")
+		if restURL == "" || topic == "" {
+			return nil, fmt.Errorf("EVENT_KAFKA_REST_URL and EVENT_KAFKA_TOPIC must be set for the kafka event bus")
+		}
+		return kafkaRESTPublisher{
+			client:  &http.Client{Timeout: 10 * time.Second},
+			baseURL: restURL,
+			topic:   topic,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown EVENT_BUS %q", backend)
+	}
+}
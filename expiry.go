@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultVideoExpiryInterval = 10 * time.Minute
+	videoExpiryBatch           = 50
+)
+
+func (cfg *apiConfig) startVideoExpiry(interval time.Duration) {
+	cfg.startScheduledTask("video_expiry", interval, cfg.expireVideos)
+}
+
+// expireVideos deletes the media of videos past their expiry. The records
+// stay, marked expired, so owners can tell what happened to them.
+func (cfg *apiConfig) expireVideos(ctx context.Context) {
+	for {
+		videos, err := cfg.db.GetExpiredVideos(cfg.clock.Now(), videoExpiryBatch)
+		if err != nil {
+			log.Printf("Couldn't load expired videos: %v", err)
+			return
+		}
+
+		expired := 0
+		for _, video := range videos {
+			if err := cfg.expireVideo(ctx, video); err != nil {
+				log.Printf("Couldn't expire video %s: %v", video.ID, err)
+				continue
+			}
+			expired++
+		}
+		// stop rather than spin on videos that keep failing
+		if len(videos) < videoExpiryBatch || expired == 0 {
+			return
+		}
+	}
+}
+
+func (cfg *apiConfig) expireVideo(ctx context.Context, video database.Video) error {
+	keys, err := cfg.videoObjectKeys(video)
+	if err != nil {
+		return fmt.Errorf("couldn't get versions: %w", err)
+	}
+	for _, key := range keys {
+		_, err = cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(cfg.s3Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't delete object %s: %w", key, err)
+		}
+	}
+	cfg.deleteReplicaObjects(ctx, keys)
+
+	if video.ThumbnailURL != nil && !cfg.isS3ObjectURL(*video.ThumbnailURL) {
+		err := os.Remove(cfg.getAssetDiskPath(getAssetFromURL(*video.ThumbnailURL)))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("couldn't delete thumbnail: %w", err)
+		}
+	}
+
+	if err := cfg.db.MarkVideoExpired(video.ID); err != nil {
+		return fmt.Errorf("couldn't mark expired: %w", err)
+	}
+	log.Printf("Expired video %s, deleted %d objects", video.ID, len(keys))
+	cfg.publishEvent(eventVideoExpired, video)
+	return nil
+}
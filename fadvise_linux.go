@@ -0,0 +1,33 @@
+//go:build linux && (amd64 || arm64)
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	fadvSequential = 2
+	fadvDontNeed   = 4
+)
+
+func fadvise(f *os.File, advice int) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), 0, 0, uintptr(advice), 0, 0)
+	if errno != 0 && errno != syscall.ENOSYS {
+		return errno
+	}
+	return nil
+}
+
+// adviseSequential tells the kernel the file will be read or written front to
+// back, which enables more aggressive readahead.
+func adviseSequential(f *os.File) error {
+	return fadvise(f, fadvSequential)
+}
+
+// adviseDontNeed drops the file's pages from the page cache once we're done
+// with it, so large uploads don't evict everything else.
+func adviseDontNeed(f *os.File) error {
+	return fadvise(f, fadvDontNeed)
+}
@@ -0,0 +1,13 @@
+//go:build !(linux && (amd64 || arm64))
+
+package main
+
+import "os"
+
+func adviseSequential(f *os.File) error {
+	return nil
+}
+
+func adviseDontNeed(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"hash/fnv"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// skip the ffmpeg faststart remux when off
+	flagVideoFastStart = "video_fast_start"
+)
+
+// featureEnabled reports whether the named flag is on for userID. Flags that
+// haven't been created yet fall back to defaultValue.
+func (cfg *apiConfig) featureEnabled(name string, userID uuid.UUID, defaultValue bool) bool {
+	flag, err := cfg.db.GetFeatureFlag(name)
+	if err != nil {
+		log.Printf("Couldn't load feature flag %s: %v", name, err)
+		return defaultValue
+	}
+	if flag.Name == "" {
+		return defaultValue
+	}
+	if !flag.Enabled {
+		return false
+	}
+
+	for _, id := range flag.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+
+	return rolloutBucket(name, userID) < flag.RolloutPercentage
+}
+
+// rolloutBucket deterministically maps a user to 0-99 per flag, so raising a
+// flag's percentage only ever adds users.
+func rolloutBucket(name string, userID uuid.UUID) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write(userID[:])
+	return int(h.Sum32() % 100)
+}
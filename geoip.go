@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// geoIPLookup maps client IPs to ISO 3166-1 alpha-2 country codes. It returns
+// an empty code for addresses it doesn't know.
+type geoIPLookup interface {
+	Country(ip netip.Addr) (string, error)
+}
+
+type ipRange struct {
+	start, end netip.Addr
+	country    string
+}
+
+// csvGeoIP looks countries up in an IP range CSV loaded into memory, in the
+// "start,end,country" layout of the free DB-IP and IP2Location country files.
+type csvGeoIP struct {
+	ranges []ipRange
+}
+
+func loadCSVGeoIP(path string) (*csvGeoIP, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	var ranges []ipRange
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: expected start,end,country", line)
+		}
+		start, err := netip.ParseAddr(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(strings.TrimSpace(record[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if start.Is4() != end.Is4() || end.Less(start) {
+			return nil, fmt.Errorf("line %d: invalid range %s-%s", line, start, end)
+		}
+		ranges = append(ranges, ipRange{
+			start:   start,
+			end:     end,
+			country: strings.ToUpper(strings.TrimSpace(record[2])),
+		})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start.Less(ranges[j].start) })
+	return &csvGeoIP{ranges: ranges}, nil
+}
+
+func (g *csvGeoIP) Country(ip netip.Addr) (string, error) {
+	ip = ip.Unmap()
+	// the last range starting at or before ip is the only one that can hold it
+	i := sort.Search(len(g.ranges), func(i int) bool { return ip.Less(g.ranges[i].start) }) - 1
+	if i < 0 {
+		return "", nil
+	}
+	r := g.ranges[i]
+	if r.start.Is4() != ip.Is4() || r.end.Less(ip) {
+		return "", nil
+	}
+	return r.country, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+type archiveProblem struct {
+	database.ArchivedObject
+	// "missing" or "size_mismatch"
+	Problem    string `json:"problem"`
+	ActualSize *int64 `json:"actual_size,omitempty"`
+}
+
+type archiveReport struct {
+	Target        string `json:"target"`
+	Mirrored      int    `json:"mirrored"`
+	MirroredBytes int64  `json:"mirrored_bytes"`
+	// videos whose current media isn't mirrored yet
+	Pending int `json:"pending"`
+	// only filled in when the target was checked
+	Verified bool             `json:"verified"`
+	Problems []archiveProblem `json:"problems"`
+}
+
+// handlerArchiveReport reconciles the archive with what was recorded as
+// mirrored. With verify=true every recorded file is looked up in the target;
+// files that are gone or changed are reported and forgotten, so the next
+// mirror run copies them again.
+func (cfg *apiConfig) handlerArchiveReport(w http.ResponseWriter, r *http.Request) {
+	if cfg.archive == nil {
+		respondWithError(w, http.StatusNotFound, codeNoArchiveTargetIsConfigured, "No archive target is configured", nil)
+		return
+	}
+
+	var err error
+	verify := false
+	if v := r.URL.Query().Get("verify"); v != "" {
+		verify, err = strconv.ParseBool(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, codeVerifyMustBeTrueOrFalse, "verify must be true or false", err)
+			return
+		}
+	}
+
+	objects, err := cfg.db.GetArchivedObjects()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetArchivedObjects, "Couldn't get archived objects", err)
+		return
+	}
+
+	report := archiveReport{
+		Target:   cfg.archive.String(),
+		Verified: verify,
+		Problems: []archiveProblem{},
+	}
+	for _, obj := range objects {
+		report.Mirrored++
+		report.MirroredBytes += obj.Size
+		if !verify {
+			continue
+		}
+
+		size, err := cfg.archive.Size(r.Context(), obj.Path)
+		problem := archiveProblem{ArchivedObject: obj}
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			problem.Problem = "missing"
+		case err != nil:
+			respondWithError(w, http.StatusBadGateway, codeCouldntCheckArchiveTarget, "Couldn't check archive target", err)
+			return
+		case size != obj.Size:
+			problem.Problem = "size_mismatch"
+			problem.ActualSize = &size
+		default:
+			continue
+		}
+
+		report.Problems = append(report.Problems, problem)
+		if err := cfg.db.ForgetArchivedObject(obj.VideoURL); err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateArchivedObjects, "Couldn't update archived objects", err)
+			return
+		}
+	}
+
+	// counted last, forgotten files are pending again
+	report.Pending, err = cfg.db.CountUnarchivedVideos()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCountUnarchivedVideos, "Couldn't count unarchived videos", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+// 500 MB
+const maxAudioDescriptionSize = 500 << 20
+
+// audioDescriptionTypes maps the accepted audio types to their extension.
+var audioDescriptionTypes = map[string]string{
+	"audio/mp4":  ".m4a",
+	"audio/aac":  ".aac",
+	"audio/mpeg": ".mp3",
+}
+
+// handlerAudioDescriptionUpload stores the "audio" file of the body as the
+// video's audio description, replacing the one it had. It is streamed to
+// S3 without touching the disk.
+func (cfg *apiConfig) handlerAudioDescriptionUpload(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r, "change the audio description")
+	if !ok {
+		return
+	}
+	if video.ExpiredAt != nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasExpired, "Video has expired", nil)
+		return
+	}
+
+	fmt.Println("uploading audio description for video", video.ID, "by user", video.UserID, "from", clientIP(r))
+
+	if !checkDeclaredSize(w, r, maxAudioDescriptionSize) {
+		return
+	}
+	r.Body = newDeclaredSizeReader(r)
+	throttledBody := cfg.uploadThrottle.wrap(r.Context(), video.UserID, cfg.uploads.track(r, "audio_description", video.ID, video.UserID))
+	defer throttledBody.Close()
+	r.Body = http.MaxBytesReader(w, throttledBody, maxAudioDescriptionSize)
+
+	file, err := filePart(r, "audio", maxAudioDescriptionSize)
+	if err != nil {
+		respondWithVideoError(w, err)
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(file.ContentType())
+	ext, ok := audioDescriptionTypes[mediaType]
+	if !ok {
+		respondWithError(w, http.StatusUnsupportedMediaType, codeWrongAudioTypeForAudioDescription, "wrong audio type for audio description", nil)
+		return
+	}
+
+	randomID, err := makeRandomID()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateAudioDescriptionID, "Couldn't create audio description ID", err)
+		return
+	}
+	key := fmt.Sprintf("audio-descriptions/%s/%s%s", video.ID, randomID, ext)
+	uploader := manager.NewUploader(cfg.s3Client)
+	_, err = uploader.Upload(r.Context(), &s3.PutObjectInput{
+		Bucket:      aws.String(cfg.s3Bucket),
+		Key:         aws.String(key),
+		Body:        file,
+		ContentType: aws.String(mediaType),
+	})
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, codeFileSizeTooBig, "File size too big", err)
+			return
+		}
+		respondWithStorageError(w, http.StatusInternalServerError, codeErrorStoringAudioDescription, "Error storing audio description", err)
+		return
+	}
+	cfg.retainNewObject(r.Context(), video, key)
+
+	original := video
+	audioURL := cfg.getS3ObjectURL(key)
+	video.AudioDescriptionURL = &audioURL
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		cfg.deleteAudioDescription(video.ID, audioURL)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateVideoData, "Couldn't update video data", err)
+		return
+	}
+	if original.AudioDescriptionURL != nil {
+		cfg.deleteAudioDescription(video.ID, *original.AudioDescriptionURL)
+	}
+
+	cfg.publishEvent(eventVideoUpdated, video)
+
+	respondWithJSON(w, http.StatusOK, cfg.stampAssetURLs(video))
+}
+
+func (cfg *apiConfig) handlerAudioDescriptionDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r, "change the audio description")
+	if !ok {
+		return
+	}
+	if video.AudioDescriptionURL == nil {
+		respondWithError(w, http.StatusNotFound, codeVideoHasNoAudioDescription, "Video has no audio description", nil)
+		return
+	}
+
+	audioURL := *video.AudioDescriptionURL
+	video.AudioDescriptionURL = nil
+	err := cfg.db.UpdateVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateVideoData, "Couldn't update video data", err)
+		return
+	}
+	cfg.deleteAudioDescription(video.ID, audioURL)
+
+	cfg.publishEvent(eventVideoUpdated, video)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteAudioDescription removes an audio description the video no longer
+// points at. Failing to only leaves the object behind, so it is logged.
+// Retention locks make S3 refuse this, and the object is kept as it should.
+func (cfg *apiConfig) deleteAudioDescription(videoID uuid.UUID, audioURL string) {
+	key, err := cfg.getS3KeyFromURL(audioURL)
+	if err == nil {
+		_, err = cfg.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String(cfg.s3Bucket),
+			Key:    aws.String(key),
+		})
+	}
+	if err != nil {
+		log.Printf("Couldn't delete audio description %s of video %s: %v", audioURL, videoID, err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultAuditLogLimit = 100
+	maxAuditLogLimit     = 1000
+)
+
+// handlerAuditLog lists recent audit entries, optionally only those about
+// one object, e.g. ?target_id=<video id>.
+func (cfg *apiConfig) handlerAuditLog(w http.ResponseWriter, r *http.Request) {
+	var err error
+	limit := defaultAuditLogLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAuditLogLimit {
+			respondWithError(w, http.StatusBadRequest, codeInvalidLimit, fmt.Sprintf("limit must be between 1 and %d", maxAuditLogLimit), err)
+			return
+		}
+	}
+
+	entries, err := cfg.db.GetAuditEntries(r.URL.Query().Get("target_id"), limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveAuditLog, "Couldn't retrieve audit log", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, entries)
+}
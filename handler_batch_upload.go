@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/smithy-go"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxBatchFiles = 20
+	// 8 GB, the files are processed one at a time
+	maxBatchSize = 8 << 30
+)
+
+// batchUploadResult is the outcome of one file of a batch upload. Video is
+// set once the video was created, Job instead of a stored file when it was
+// queued for processing.
+type batchUploadResult struct {
+	Filename string                  `json:"filename"`
+	Status   int                     `json:"status"`
+	Error    string                  `json:"error,omitempty"`
+	Video    *database.Video         `json:"video,omitempty"`
+	Job      *database.ProcessingJob `json:"job,omitempty"`
+	Warnings []fieldError            `json:"warnings,omitempty"`
+}
+
+type batchUploadResponse struct {
+	Results []batchUploadResult `json:"results"`
+	// set when the body broke off, files after it weren't received
+	Error string `json:"error,omitempty"`
+}
+
+// handlerBatchUpload creates a video for every "video" file in the body.
+// "title", "description", "folder_id" and "preset_id" fields before a file
+// apply to it, the title defaults to the file name. Files are streamed and processed one at a
+// time, a bad file only fails itself.
+func (cfg *apiConfig) handlerBatchUpload(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	fmt.Println("uploading video batch by user", userID, "from", clientIP(r))
+
+	if !checkDeclaredSize(w, r, maxBatchSize) {
+		return
+	}
+
+	// only one file and its fast start copy are in temp storage at a time
+	uploadSize := r.ContentLength
+	if uploadSize <= 0 || uploadSize > maxVideoSize {
+		uploadSize = maxVideoSize
+	}
+	release, err := cfg.tempStore.reserve(2 * uploadSize)
+	if err != nil {
+		respondWithError(w, http.StatusInsufficientStorage, codeNotEnoughTemporaryStorageToProcessUpload, "Not enough temporary storage to process upload", err)
+		return
+	}
+	defer release()
+
+	r.Body = newDeclaredSizeReader(r)
+	throttledBody := cfg.uploadThrottle.wrap(r.Context(), userID, cfg.uploads.track(r, "batch", uuid.Nil, userID))
+	defer throttledBody.Close()
+	r.Body = http.MaxBytesReader(w, throttledBody, maxBatchSize)
+
+	encryptionKey, err := customerKeyFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidEncryptionKey, "Invalid encryption key", err)
+		return
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeMalformedUpload, "Malformed upload", err)
+		return
+	}
+
+	resp := batchUploadResponse{Results: []batchUploadResult{}}
+	for {
+		file, err := nextFilePart(mr, "video", maxVideoSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(resp.Results) == 0 {
+				respondWithVideoError(w, err)
+				return
+			}
+			resp.Error = err.Error()
+			break
+		}
+		if len(resp.Results) == maxBatchFiles {
+			resp.Error = fmt.Sprintf("a batch can have at most %d files", maxBatchFiles)
+			break
+		}
+		resp.Results = append(resp.Results, cfg.uploadBatchFile(r.Context(), userID, file, encryptionKey))
+	}
+	if len(resp.Results) == 0 {
+		respondWithError(w, http.StatusBadRequest, codeMissingVideoFile, "Missing video file", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// uploadBatchFile creates a video for file and stores or queues it. The
+// video is deleted again if its file is rejected.
+func (cfg *apiConfig) uploadBatchFile(ctx context.Context, userID uuid.UUID, file *multipartFile, key *customerKey) batchUploadResult {
+	result := batchUploadResult{Filename: file.FileName()}
+	fail := func(status int, msg string, err error) batchUploadResult {
+		if status > 499 {
+			log.Printf("Batch upload of %q failed: %v", result.Filename, err)
+		}
+		result.Status = status
+		result.Error = msg
+		result.Video = nil
+		return result
+	}
+
+	params := database.CreateVideoParams{
+		Title:       file.Field("title"),
+		Description: file.Field("description"),
+		UserID:      userID,
+	}
+	if params.Title == "" {
+		params.Title = strings.TrimSpace(strings.TrimSuffix(file.FileName(), filepath.Ext(file.FileName())))
+	}
+	if errs := validateVideoMeta(&params.Title, &params.Description); len(errs) > 0 {
+		return fail(http.StatusBadRequest, fmt.Sprintf("Invalid video metadata: %s %s", errs[0].Field, errs[0].Message), nil)
+	}
+	if v := file.Field("folder_id"); v != "" {
+		folderID, err := uuid.Parse(v)
+		if err != nil {
+			return fail(http.StatusBadRequest, "Invalid folder ID", nil)
+		}
+		settings, ok, err := cfg.folderSettings(userID, folderID)
+		if err != nil {
+			return fail(http.StatusInternalServerError, "Couldn't get folder", err)
+		}
+		if !ok {
+			return fail(http.StatusBadRequest, "Invalid video metadata: folder_id must be one of your folders", nil)
+		}
+		params.FolderID = &folderID
+		params.Visibility = settings.DefaultVisibility
+	}
+	preset, ok, err := cfg.uploadPreset(userID, file.Field("preset_id"))
+	if err != nil {
+		return fail(http.StatusInternalServerError, "Couldn't get upload preset", err)
+	}
+	if !ok {
+		return fail(http.StatusBadRequest, "Unknown upload preset", nil)
+	}
+	profile := cfg.applyUploadPreset(&params, preset)
+
+	mediaType, _, _ := mime.ParseMediaType(file.ContentType())
+	if mediaType != "video/mp4" {
+		return fail(http.StatusUnsupportedMediaType, "wrong content type for video", nil)
+	}
+
+	// the file is checked before there is a video to clean up
+	buffered, err := cfg.bufferVideoUpload(file, 0)
+	if err != nil {
+		status, msg := batchFileError(err)
+		return fail(status, msg, err)
+	}
+	defer buffered.cleanup()
+
+	video, err := cfg.db.CreateVideo(params)
+	if err != nil {
+		return fail(http.StatusInternalServerError, "Couldn't create video", err)
+	}
+	cfg.publishEvent(eventVideoCreated, video)
+	result.Video = &video
+	result.Warnings = cfg.duplicateTitleWarnings(video)
+
+	failAndDelete := func(status int, msg string, err error) batchUploadResult {
+		if err := cfg.db.DeleteVideo(video.ID); err != nil {
+			log.Printf("Couldn't delete video %s of a failed batch upload: %v", video.ID, err)
+		}
+		return fail(status, msg, err)
+	}
+
+	hookEvent := uploadEvent{
+		Kind:        "video",
+		VideoID:     video.ID,
+		UserID:      userID,
+		Title:       video.Title,
+		Filename:    file.FileName(),
+		ContentType: mediaType,
+		Size:        buffered.size,
+	}
+	err = cfg.runPreUploadHooks(ctx, hookEvent)
+	if err != nil {
+		status, msg := batchFileError(err)
+		return failAndDelete(status, msg, err)
+	}
+
+	if cfg.jobQueue != nil && key == nil && profile == nil {
+		job, err := cfg.enqueueVideoJob(ctx, video, &buffered, mediaType, file.FileName())
+		if err != nil {
+			status, msg := batchFileError(err)
+			return failAndDelete(status, msg, err)
+		}
+		result.Status = http.StatusAccepted
+		result.Job = &job
+		return result
+	}
+
+	video, err = cfg.storeVideoUpload(ctx, video, buffered, mediaType, key, profile)
+	if err != nil {
+		status, msg := batchFileError(err)
+		return failAndDelete(status, msg, err)
+	}
+	hookEvent.Size = *video.VideoSize
+	hookEvent.URL = *video.VideoURL
+	cfg.runPostUploadHooks(hookEvent)
+
+	video = cfg.stampAssetURLs(video)
+	result.Video = &video
+	result.Status = http.StatusCreated
+	return result
+}
+
+// batchFileError is the status and message respondWithVideoError and
+// respondWithHookError would have responded with, for a file's result.
+func batchFileError(err error) (int, string) {
+	var invalid *invalidVideoError
+	if errors.As(err, &invalid) {
+		return http.StatusBadRequest, "Invalid video file: " + invalid.reason
+	}
+	var truncated *truncatedUploadError
+	if errors.As(err, &truncated) {
+		return http.StatusBadRequest, "Upload was cut off: " + truncated.Error()
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge, "File size too big"
+	}
+	var malformed *multipartError
+	if errors.As(err, &malformed) {
+		return http.StatusBadRequest, "Malformed upload"
+	}
+	var rejected hookRejectedError
+	if errors.As(err, &rejected) {
+		return http.StatusUnprocessableEntity, rejected.reason
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if mapped, ok := storageErrors[apiErr.ErrorCode()]; ok {
+			return mapped.status, "Error processing video: " + mapped.hint
+		}
+	}
+	return http.StatusInternalServerError, "Error processing video"
+}
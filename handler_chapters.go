@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerChaptersList(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+
+	chapters, err := cfg.db.GetChapters(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveChapters, "Couldn't retrieve chapters", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chapters)
+}
+
+// handlerChaptersVTT serves the chapters as a WebVTT chapters track, for
+// players that take one through a <track kind="chapters"> element.
+func (cfg *apiConfig) handlerChaptersVTT(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	if video.DurationSeconds == nil {
+		respondWithError(w, http.StatusConflict, codeVideoDurationIsUnknown, "Video duration is unknown", nil)
+		return
+	}
+
+	chapters, err := cfg.db.GetChapters(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveChapters, "Couldn't retrieve chapters", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.Write([]byte(chaptersVTT(chapters, *video.DurationSeconds)))
+}
+
+func (cfg *apiConfig) handlerChapterCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title        string  `json:"title"`
+		StartSeconds float64 `json:"start_seconds"`
+	}
+
+	video, ok := cfg.chapterVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if errs := validateChapter(&params.Title, &params.StartSeconds, *video.DurationSeconds); len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidChapter, "Invalid chapter", errs)
+		return
+	}
+
+	chapter, err := cfg.db.CreateChapter(database.CreateChapterParams{
+		VideoID:      video.ID,
+		Title:        params.Title,
+		StartSeconds: params.StartSeconds,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateChapter, "Couldn't create chapter", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, chapter)
+}
+
+func (cfg *apiConfig) handlerChapterUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title        *string  `json:"title"`
+		StartSeconds *float64 `json:"start_seconds"`
+	}
+
+	video, ok := cfg.chapterVideo(w, r)
+	if !ok {
+		return
+	}
+	chapter, ok := cfg.videoChapter(w, r, video)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if errs := validateChapter(params.Title, params.StartSeconds, *video.DurationSeconds); len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidChapter, "Invalid chapter", errs)
+		return
+	}
+
+	if params.Title != nil {
+		chapter.Title = *params.Title
+	}
+	if params.StartSeconds != nil {
+		chapter.StartSeconds = *params.StartSeconds
+	}
+
+	err = cfg.db.UpdateChapter(chapter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateChapter, "Couldn't update chapter", err)
+		return
+	}
+
+	chapter, err = cfg.db.GetChapter(chapter.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetChapter, "Couldn't get chapter", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chapter)
+}
+
+func (cfg *apiConfig) handlerChapterDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.chapterVideo(w, r)
+	if !ok {
+		return
+	}
+	chapter, ok := cfg.videoChapter(w, r, video)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeleteChapter(chapter.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDeleteChapter, "Couldn't delete chapter", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// chapterVideo loads the video a chapter request is about and checks the
+// caller owns it. Chapters are validated against the duration, so the video
+// must have been uploaded first.
+func (cfg *apiConfig) chapterVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	userID := requestUserID(r)
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, codeYouCantEditChaptersOfThisVideo, "You can't edit chapters of this video", nil)
+		return database.Video{}, false
+	}
+	if video.DurationSeconds == nil {
+		respondWithError(w, http.StatusConflict, codeVideoDurationIsUnknownUploadTheVideoFirst, "Video duration is unknown, upload the video first", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+func (cfg *apiConfig) videoChapter(w http.ResponseWriter, r *http.Request, video database.Video) (database.Chapter, bool) {
+	chapterID, err := uuid.Parse(r.PathValue("chapterID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidChapterID, "Invalid chapter ID", err)
+		return database.Chapter{}, false
+	}
+
+	chapter, err := cfg.db.GetChapter(chapterID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetChapter, "Couldn't get chapter", err)
+		return database.Chapter{}, false
+	}
+	if chapter.ID == uuid.Nil || chapter.VideoID != video.ID {
+		respondWithError(w, http.StatusNotFound, codeChapterNotFound, "Chapter not found", nil)
+		return database.Chapter{}, false
+	}
+	return chapter, true
+}
+
+// validateChapter checks the fields a client sent, nil pointers are fields
+// left out of an update.
+func validateChapter(title *string, startSeconds *float64, duration float64) []fieldError {
+	var errs []fieldError
+	if title != nil {
+		if msg := validateTitle(*title); msg != "" {
+			errs = append(errs, fieldError{Field: "title", Message: msg})
+		}
+	}
+	if startSeconds != nil {
+		start := *startSeconds
+		switch {
+		case start < 0:
+			errs = append(errs, fieldError{Field: "start_seconds", Message: "must not be negative"})
+		case start >= duration:
+			errs = append(errs, fieldError{Field: "start_seconds", Message: fmt.Sprintf("must be before the end of the video (%.3f seconds)", duration)})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerCostReport(w http.ResponseWriter, r *http.Request) {
+	type userCost struct {
+		UserID         uuid.UUID `json:"user_id"`
+		VideoCount     int       `json:"video_count"`
+		StorageBytes   int64     `json:"storage_bytes"`
+		StorageCost    float64   `json:"storage_cost_per_month"`
+		EgressCost     float64   `json:"egress_cost"`
+		ProcessingCost float64   `json:"processing_cost"`
+		TotalCost      float64   `json:"total_cost"`
+	}
+	type response struct {
+		TotalCost float64     `json:"total_cost"`
+		Users     []userCost  `json:"users"`
+		Videos    []videoCost `json:"videos"`
+	}
+
+	var err error
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			respondWithError(w, http.StatusBadRequest, codeInvalidLimit, "Invalid limit", err)
+			return
+		}
+	}
+
+	usage, err := cfg.db.GetVideoUsage()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveVideoUsage, "Couldn't retrieve video usage", err)
+		return
+	}
+
+	resp := response{
+		Users:  []userCost{},
+		Videos: []videoCost{},
+	}
+	byUser := map[uuid.UUID]*userCost{}
+	for _, vu := range usage {
+		vc := cfg.costRates.estimate(vu)
+		resp.Videos = append(resp.Videos, vc)
+		resp.TotalCost += vc.TotalCost
+
+		uc, ok := byUser[vu.UserID]
+		if !ok {
+			uc = &userCost{UserID: vu.UserID}
+			byUser[vu.UserID] = uc
+		}
+		uc.VideoCount++
+		uc.StorageBytes += vu.StorageBytes
+		uc.StorageCost += vc.StorageCost
+		uc.EgressCost += vc.EgressCost
+		uc.ProcessingCost += vc.ProcessingCost
+		uc.TotalCost += vc.TotalCost
+	}
+
+	for _, uc := range byUser {
+		resp.Users = append(resp.Users, *uc)
+	}
+	sort.Slice(resp.Users, func(i, j int) bool { return resp.Users[i].TotalCost > resp.Users[j].TotalCost })
+	sort.Slice(resp.Videos, func(i, j int) bool { return resp.Videos[i].TotalCost > resp.Videos[j].TotalCost })
+	if len(resp.Videos) > limit {
+		resp.Videos = resp.Videos[:limit]
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
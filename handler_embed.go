@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	embedWidth  = 640
+	embedHeight = 360
+)
+
+var embedTemplate = template.Must(template.New("embed").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="alternate" type="application/json+oembed" href="{{.OEmbedURL}}" title="{{.Title}}">
+<style>
+html, body { margin: 0; height: 100%; background: #000; }
+video { width: 100%; height: 100%; }
+</style>
+</head>
+<body>
+<video src="{{.VideoURL}}"{{if .ThumbnailURL}} poster="{{.ThumbnailURL}}"{{end}} controls playsinline preload="metadata">{{if .ChaptersURL}}<track kind="chapters" src="{{.ChaptersURL}}" default>{{end}}</video>
+</body>
+</html>
+`))
+
+// isEmbeddable reports whether a video can be shown to anyone with its link.
+func isEmbeddable(video database.Video) bool {
+	if video.VideoURL == nil {
+		return false
+	}
+	return video.Visibility == database.VisibilityPublic || video.Visibility == database.VisibilityUnlisted
+}
+
+// videoDimensions returns the player size, derived from the aspect prefix the
+// video was stored under.
+func (cfg *apiConfig) videoDimensions(video database.Video) (int, int) {
+	if video.VideoURL != nil {
+		if key, err := cfg.getS3KeyFromURL(*video.VideoURL); err == nil {
+			switch getAspectFromKey(key) {
+			case "portrait":
+				return embedHeight, embedWidth
+			case "other":
+				return embedHeight, embedHeight
+			}
+		}
+	}
+	return embedWidth, embedHeight
+}
+
+func publicBaseURL(r *http.Request) string {
+	return fmt.Sprintf("%s://%s", requestScheme(r), r.Host)
+}
+
+func (cfg *apiConfig) handlerEmbed(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || !isEmbeddable(video) {
+		http.NotFound(w, r)
+		return
+	}
+	if !cfg.checkPlaybackPage(w, r, video) {
+		return
+	}
+
+	cfg.recordView(video)
+	video = cfg.stampAssetURLs(video)
+
+	embedURL := fmt.Sprintf("%s/embed/%s", publicBaseURL(r), video.ID)
+	data := struct {
+		Title        string
+		VideoURL     string
+		ThumbnailURL string
+		ChaptersURL  string
+		OEmbedURL    string
+	}{
+		Title:     video.Title,
+		VideoURL:  *video.VideoURL,
+		OEmbedURL: fmt.Sprintf("%s/oembed?format=json&url=%s", publicBaseURL(r), url.QueryEscape(embedURL)),
+	}
+	if video.ThumbnailURL != nil {
+		data.ThumbnailURL = *video.ThumbnailURL
+	}
+	if video.DurationSeconds != nil {
+		data.ChaptersURL = fmt.Sprintf("/api/videos/%s/chapters.vtt", video.ID)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	embedTemplate.Execute(w, data)
+}
+
+func (cfg *apiConfig) handlerOEmbed(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Version         string `json:"version"`
+		Type            string `json:"type"`
+		Title           string `json:"title"`
+		ProviderName    string `json:"provider_name"`
+		ProviderURL     string `json:"provider_url"`
+		HTML            string `json:"html"`
+		Width           int    `json:"width"`
+		Height          int    `json:"height"`
+		ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+		ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+		ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+	}
+
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != "json" {
+		respondWithError(w, http.StatusNotImplemented, codeOnlyTheJSONFormatIsSupported, "Only the json format is supported", nil)
+		return
+	}
+
+	resourceURL, err := url.Parse(query.Get("url"))
+	if err != nil || resourceURL.Path == "" {
+		respondWithError(w, http.StatusBadRequest, codeMissingOrInvalidURLParameter, "Missing or invalid url parameter", err)
+		return
+	}
+
+	// accepts any of our video URLs as long as they end with the video ID
+	videoID, err := uuid.Parse(path.Base(resourceURL.Path))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, codeNoVideoFoundForURL, "No video found for url", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || !isEmbeddable(video) {
+		respondWithError(w, http.StatusNotFound, codeNoVideoFoundForURL, "No video found for url", err)
+		return
+	}
+	if cfg.isTakenDown(video.ID) {
+		respondWithError(w, http.StatusNotFound, codeNoVideoFoundForURL, "No video found for url", nil)
+		return
+	}
+	video = cfg.stampAssetURLs(video)
+
+	width, height := cfg.videoDimensions(video)
+	width, height = fitDimensions(width, height, query.Get("maxwidth"), query.Get("maxheight"))
+
+	embedURL := fmt.Sprintf("%s/embed/%s", publicBaseURL(r), video.ID)
+	resp := response{
+		Version:      "1.0",
+		Type:         "video",
+		Title:        video.Title,
+		ProviderName: "Tubely",
+		ProviderURL:  publicBaseURL(r),
+		HTML: fmt.Sprintf(
+			`<iframe src="%s" width="%d" height="%d" frameborder="0" allow="fullscreen; picture-in-picture" allowfullscreen></iframe>`,
+			template.HTMLEscapeString(embedURL), width, height,
+		),
+		Width:  width,
+		Height: height,
+	}
+	if video.ThumbnailURL != nil {
+		resp.ThumbnailURL = absoluteURL(r, *video.ThumbnailURL)
+		resp.ThumbnailWidth, resp.ThumbnailHeight = width, height
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// fitDimensions scales width and height down to the consumer's maxwidth and
+// maxheight while keeping the aspect ratio.
+func fitDimensions(width, height int, maxWidthParam, maxHeightParam string) (int, int) {
+	if maxWidth, err := strconv.Atoi(maxWidthParam); err == nil && maxWidth > 0 && width > maxWidth {
+		height = height * maxWidth / width
+		width = maxWidth
+	}
+	if maxHeight, err := strconv.Atoi(maxHeightParam); err == nil && maxHeight > 0 && height > maxHeight {
+		width = width * maxHeight / height
+		height = maxHeight
+	}
+	return width, height
+}
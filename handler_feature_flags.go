@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+var featureFlagNameRegex = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+func (cfg *apiConfig) handlerFeatureFlagsList(w http.ResponseWriter, r *http.Request) {
+	flags, err := cfg.db.GetFeatureFlags()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveFeatureFlags, "Couldn't retrieve feature flags", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, flags)
+}
+
+func (cfg *apiConfig) handlerFeatureFlagSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Enabled           bool        `json:"enabled"`
+		RolloutPercentage int         `json:"rollout_percentage"`
+		UserIDs           []uuid.UUID `json:"user_ids"`
+	}
+
+	name := r.PathValue("name")
+	if !featureFlagNameRegex.MatchString(name) {
+		respondWithError(w, http.StatusBadRequest, codeInvalidFeatureFlagName, "Invalid feature flag name", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if params.RolloutPercentage < 0 || params.RolloutPercentage > 100 {
+		respondWithError(w, http.StatusBadRequest, codeRolloutPercentageMustBeBetween0And100, "rollout_percentage must be between 0 and 100", nil)
+		return
+	}
+
+	flag, err := cfg.db.UpsertFeatureFlag(database.UpsertFeatureFlagParams{
+		Name:              name,
+		Enabled:           params.Enabled,
+		RolloutPercentage: params.RolloutPercentage,
+		UserIDs:           params.UserIDs,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntSaveFeatureFlag, "Couldn't save feature flag", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, flag)
+}
+
+func (cfg *apiConfig) handlerFeatureFlagDelete(w http.ResponseWriter, r *http.Request) {
+	err := cfg.db.DeleteFeatureFlag(r.PathValue("name"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDeleteFeatureFlag, "Couldn't delete feature flag", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const feedItemLimit = 50
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	AtomLink      rssAtomLink `xml:"atom:link"`
+	LastBuildDate string      `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem   `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	Description string       `xml:"description"`
+	GUID        rssGUID      `xml:"guid"`
+	PubDate     string       `xml:"pubDate"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// handlerUserFeed serves an RSS feed of a user's public videos, with the MP4
+// as enclosure so podcast apps can play them. Videos with playback
+// restrictions, taken down or expired are left out.
+func (cfg *apiConfig) handlerUserFeed(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+	userIDString, ok := strings.CutSuffix(file, ".xml")
+	if !ok {
+		respondWithError(w, http.StatusNotFound, codeNotFound, "Not found", nil)
+		return
+	}
+	userID, err := uuid.Parse(userIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidUserID, "Invalid user ID", err)
+		return
+	}
+
+	videos, err := cfg.db.GetPublicVideos(userID, feedItemLimit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveVideos, "Couldn't retrieve videos", err)
+		return
+	}
+
+	baseURL := publicBaseURL(r)
+	feed := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       fmt.Sprintf("Tubely videos by %s", userID),
+			Link:        baseURL + "/app/",
+			Description: "Recent public videos",
+			AtomLink: rssAtomLink{
+				Href: fmt.Sprintf("%s/feeds/users/%s", baseURL, file),
+				Rel:  "self",
+				Type: "application/rss+xml",
+			},
+			Items: []rssItem{},
+		},
+	}
+	if len(videos) > 0 {
+		feed.Channel.LastBuildDate = videos[0].UpdatedAt.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, video := range videos {
+		// the query leaves these out too, but may read a replica that
+		// hasn't caught up with a takedown, and expiry runs in sweeps
+		if cfg.isTakenDown(video.ID) || video.ExpiredAt != nil || (video.ExpiresAt != nil && !video.ExpiresAt.After(cfg.clock.Now())) {
+			continue
+		}
+		// feed readers fetch on behalf of clients anywhere, restricted
+		// videos would hand their MP4 out to all of them
+		restrictions, err := cfg.db.GetPlaybackRestrictions(video.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackRestrictions, "Couldn't get playback restrictions", err)
+			return
+		}
+		if !restrictions.IsEmpty() {
+			continue
+		}
+
+		shareURL := fmt.Sprintf("%s/share/%s", baseURL, video.ID)
+		item := rssItem{
+			Title:       video.Title,
+			Link:        shareURL,
+			Description: video.Description,
+			GUID:        rssGUID{Value: video.ID.String()},
+			PubDate:     video.CreatedAt.UTC().Format(time.RFC1123Z),
+			Enclosure: rssEnclosure{
+				URL:  cfg.playbackURL(*video.VideoURL),
+				Type: "video/mp4",
+			},
+		}
+		if video.VideoSize != nil {
+			item.Enclosure.Length = *video.VideoSize
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	dat, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntBuildFeed, "Couldn't build feed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(dat)
+}
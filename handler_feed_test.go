@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerUserFeed(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner := uuid.New()
+
+	publish := func(title string, update func(*database.Video)) database.Video {
+		video := createTestVideo(t, cfg, owner)
+		videoURL := "https://tubely.s3.amazonaws.com/landscape/" + video.ID.String() + "/v1"
+		video.Title = title
+		video.VideoURL = &videoURL
+		video.Visibility = database.VisibilityPublic
+		if update != nil {
+			update(&video)
+		}
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+		return video
+	}
+	publish("Boots", nil)
+	takenDown := publish("Taken down", nil)
+	ok, err := cfg.db.SetTakedownStatus(takenDown.ID, []string{""}, database.TakedownStatusTakenDown, "copyright", nil)
+	if err != nil || !ok {
+		t.Fatalf("couldn't take down video: %v", err)
+	}
+	// past its expiry, but not swept yet
+	publish("Expiring", func(video *database.Video) {
+		expiresAt := time.Now().Add(-time.Minute)
+		video.ExpiresAt = &expiresAt
+	})
+	expired := publish("Expired", nil)
+	if err := cfg.db.MarkVideoExpired(expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	publish("Private", func(video *database.Video) {
+		video.Visibility = database.VisibilityPrivate
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/feeds/users/"+owner.String()+".xml", nil)
+	r.SetPathValue("file", owner.String()+".xml")
+	w := httptest.NewRecorder()
+
+	cfg.handlerUserFeed(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var feed rssFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, item := range feed.Channel.Items {
+		titles = append(titles, item.Title)
+	}
+	if len(titles) != 1 || titles[0] != "Boots" {
+		t.Errorf("feed has %q, want only the playable public video", titles)
+	}
+}
+
+func TestHandlerUserFeedRejections(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	tests := []struct {
+		name       string
+		file       string
+		wantStatus int
+		wantCode   errorCode
+	}{
+		{name: "not a feed", file: uuid.NewString() + ".json", wantStatus: http.StatusNotFound, wantCode: codeNotFound},
+		{name: "invalid user ID", file: "boots.xml", wantStatus: http.StatusBadRequest, wantCode: codeInvalidUserID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/feeds/users/"+tt.file, nil)
+			r.SetPathValue("file", tt.file)
+			w := httptest.NewRecorder()
+
+			cfg.handlerUserFeed(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var body struct {
+				Code errorCode `json:"code"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != tt.wantCode {
+				t.Errorf("got body %s, want code %s", w.Body, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxFolderDepth is how deeply folders can nest, top-level folders are at
+// depth 1.
+const maxFolderDepth = 10
+
+type folderResponse struct {
+	database.Folder
+	// Path is the folder's ancestors, top-level folder first
+	Path       []database.Folder `json:"path"`
+	Subfolders []database.Folder `json:"subfolders"`
+	// EffectiveSettings are the folder's settings with the inherited ones
+	// filled in, what videos in it actually get
+	EffectiveSettings database.FolderSettings `json:"effective_settings"`
+}
+
+// effectiveSettings merges the settings of the folders on path, the last
+// folder's own settings winning over its ancestors'.
+func effectiveSettings(path []database.Folder) database.FolderSettings {
+	var settings database.FolderSettings
+	for i := len(path) - 1; i >= 0; i-- {
+		settings = settings.Inherit(path[i].FolderSettings)
+	}
+	return settings
+}
+
+// folderSettings returns the effective settings of folderID, or false if it
+// isn't one of userID's folders.
+func (cfg *apiConfig) folderSettings(userID, folderID uuid.UUID) (database.FolderSettings, bool, error) {
+	path, err := cfg.db.GetFolderPath(folderID)
+	if err != nil {
+		return database.FolderSettings{}, false, err
+	}
+	if len(path) == 0 || path[0].UserID != userID {
+		return database.FolderSettings{}, false, nil
+	}
+	return effectiveSettings(path), true, nil
+}
+
+// uploadEncoding returns the encoding profile the video's folder sets for
+// uploads, or nil when they are stored as they are.
+func (cfg *apiConfig) uploadEncoding(video database.Video) (*database.EncodingProfile, error) {
+	if video.FolderID == nil {
+		return nil, nil
+	}
+	settings, ok, err := cfg.folderSettings(video.UserID, *video.FolderID)
+	if err != nil || !ok || settings.VideoCodec == "" {
+		return nil, err
+	}
+	return &settings.EncodingProfile, nil
+}
+
+// ownedFolder loads the folder the request's {folderID} names, responding
+// with an error and returning false unless the request's user owns it.
+// Folders are private to their owner.
+func (cfg *apiConfig) ownedFolder(w http.ResponseWriter, r *http.Request, action string) (database.Folder, bool) {
+	folderID, err := uuid.Parse(r.PathValue("folderID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidFolderID, "Invalid folder ID", err)
+		return database.Folder{}, false
+	}
+	userID := requestUserID(r)
+
+	folder, err := cfg.db.GetFolder(folderID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetFolder, "Couldn't get folder", err)
+		return database.Folder{}, false
+	}
+	if folder.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeFolderNotFound, "Folder not found", nil)
+		return database.Folder{}, false
+	}
+	if folder.UserID != userID {
+		respondWithError(w, http.StatusForbidden, codeFolderForbidden, "You can't "+action+" this folder", nil)
+		return database.Folder{}, false
+	}
+	return folder, true
+}
+
+// parentFolder checks that parentID, if set, is one of the user's folders
+// and returns its path, responding with an error and returning false if it
+// isn't.
+func (cfg *apiConfig) parentFolder(w http.ResponseWriter, userID uuid.UUID, parentID *uuid.UUID) ([]database.Folder, bool) {
+	if parentID == nil {
+		return nil, true
+	}
+	path, err := cfg.db.GetFolderPath(*parentID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetParentFolder, "Couldn't get parent folder", err)
+		return nil, false
+	}
+	if len(path) == 0 || path[0].UserID != userID {
+		respondWithFieldErrors(w, codeInvalidFolder, "Invalid folder", []fieldError{{Field: "parent_id", Message: "must be one of your folders"}})
+		return nil, false
+	}
+	return path, true
+}
+
+func respondWithFolderError(w http.ResponseWriter, code errorCode, msg string, err error) {
+	if errors.Is(err, database.ErrFolderNameTaken) {
+		respondWithFieldErrors(w, codeInvalidFolder, "Invalid folder", []fieldError{{Field: "name", Message: "is already used by another folder here"}})
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, code, msg, err)
+}
+
+// handlerFoldersList lists the user's top-level folders.
+func (cfg *apiConfig) handlerFoldersList(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	folders, err := cfg.db.GetFolders(userID, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetFolders, "Couldn't get folders", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, folders)
+}
+
+func (cfg *apiConfig) handlerFolderCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name     string     `json:"name"`
+		ParentID *uuid.UUID `json:"parent_id"`
+	}
+
+	userID := requestUserID(r)
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if msg := validateTitle(params.Name); msg != "" {
+		respondWithFieldErrors(w, codeInvalidFolder, "Invalid folder", []fieldError{{Field: "name", Message: msg}})
+		return
+	}
+
+	path, ok := cfg.parentFolder(w, userID, params.ParentID)
+	if !ok {
+		return
+	}
+	if len(path)+1 > maxFolderDepth {
+		respondWithError(w, http.StatusConflict, codeFolderTooDeep, fmt.Sprintf("Folders can be nested at most %d deep", maxFolderDepth), nil)
+		return
+	}
+
+	folder, err := cfg.db.CreateFolder(userID, params.ParentID, params.Name)
+	if err != nil {
+		respondWithFolderError(w, codeCouldntCreateFolder, "Couldn't create folder", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, folderResponse{
+		Folder:            folder,
+		Path:              path,
+		Subfolders:        []database.Folder{},
+		EffectiveSettings: effectiveSettings(append(path, folder)),
+	})
+}
+
+func (cfg *apiConfig) handlerFolderGet(w http.ResponseWriter, r *http.Request) {
+	folder, ok := cfg.ownedFolder(w, r, "view")
+	if !ok {
+		return
+	}
+
+	path, err := cfg.db.GetFolderPath(folder.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetFolderPath, "Couldn't get folder path", err)
+		return
+	}
+	subfolders, err := cfg.db.GetFolders(folder.UserID, &folder.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetFolders, "Couldn't get folders", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, folderResponse{
+		Folder:            folder,
+		Path:              path[:len(path)-1],
+		Subfolders:        subfolders,
+		EffectiveSettings: effectiveSettings(path),
+	})
+}
+
+func (cfg *apiConfig) handlerFolderRename(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name string `json:"name"`
+	}
+
+	folder, ok := cfg.ownedFolder(w, r, "rename")
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if msg := validateTitle(params.Name); msg != "" {
+		respondWithFieldErrors(w, codeInvalidFolder, "Invalid folder", []fieldError{{Field: "name", Message: msg}})
+		return
+	}
+
+	folder.Name = params.Name
+	err = cfg.db.UpdateFolder(folder)
+	if err != nil {
+		respondWithFolderError(w, codeCouldntRenameFolder, "Couldn't rename folder", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, folder)
+}
+
+// handlerFolderSettingsSet replaces the folder's settings. Videos created
+// in it or its subfolders get its default visibility unless they set their
+// own, and uploads to them are encoded with its profile.
+func (cfg *apiConfig) handlerFolderSettingsSet(w http.ResponseWriter, r *http.Request) {
+	folder, ok := cfg.ownedFolder(w, r, "change the settings of")
+	if !ok {
+		return
+	}
+
+	settings := database.FolderSettings{}
+	err := json.NewDecoder(r.Body).Decode(&settings)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+
+	var errs []fieldError
+	if settings.DefaultVisibility != "" && !isValidVisibility(settings.DefaultVisibility) {
+		errs = append(errs, fieldError{Field: "default_visibility", Message: "must be private, unlisted or public, or empty to inherit"})
+	}
+	if settings.VideoCodec != "" {
+		errs = append(errs, validateEncodingProfile(settings.EncodingProfile)...)
+	} else if settings.MaxHeight != 0 || settings.CRF != 0 {
+		errs = append(errs, fieldError{Field: "video_codec", Message: "is required to set max_height or crf"})
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidFolderSettings, "Invalid folder settings", errs)
+		return
+	}
+
+	err = cfg.db.UpdateFolderSettings(folder.ID, settings)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateFolderSettings, "Couldn't update folder settings", err)
+		return
+	}
+	folder.FolderSettings = settings
+	respondWithJSON(w, http.StatusOK, folder)
+}
+
+// handlerFolderMove moves a folder and everything in it under another
+// folder, or to the top level when parent_id is null.
+func (cfg *apiConfig) handlerFolderMove(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ParentID *uuid.UUID `json:"parent_id"`
+	}
+
+	folder, ok := cfg.ownedFolder(w, r, "move")
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+
+	path, ok := cfg.parentFolder(w, folder.UserID, params.ParentID)
+	if !ok {
+		return
+	}
+	for _, ancestor := range path {
+		if ancestor.ID == folder.ID {
+			respondWithError(w, http.StatusConflict, codeAFolderCantBeMovedIntoItself, "A folder can't be moved into itself", nil)
+			return
+		}
+	}
+	depth, err := cfg.db.GetFolderDepth(folder.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetFolderDepth, "Couldn't get folder depth", err)
+		return
+	}
+	if len(path)+1+depth > maxFolderDepth {
+		respondWithError(w, http.StatusConflict, codeFolderTooDeep, fmt.Sprintf("Folders can be nested at most %d deep", maxFolderDepth), nil)
+		return
+	}
+
+	folder.ParentID = params.ParentID
+	err = cfg.db.UpdateFolder(folder)
+	if err != nil {
+		respondWithFolderError(w, codeCouldntMoveFolder, "Couldn't move folder", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, folder)
+}
+
+// handlerFolderDelete only deletes empty folders, so nothing is lost or
+// silently moved.
+func (cfg *apiConfig) handlerFolderDelete(w http.ResponseWriter, r *http.Request) {
+	folder, ok := cfg.ownedFolder(w, r, "delete")
+	if !ok {
+		return
+	}
+
+	empty, err := cfg.db.IsFolderEmpty(folder.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCheckFolderContents, "Couldn't check folder contents", err)
+		return
+	}
+	if !empty {
+		respondWithError(w, http.StatusConflict, codeFolderIsntEmpty, "Folder isn't empty", nil)
+		return
+	}
+
+	err = cfg.db.DeleteFolder(folder.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDeleteFolder, "Couldn't delete folder", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerFolderVideos lists the videos directly in a folder, newest first.
+func (cfg *apiConfig) handlerFolderVideos(w http.ResponseWriter, r *http.Request) {
+	folder, ok := cfg.ownedFolder(w, r, "view")
+	if !ok {
+		return
+	}
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidPageParameters, err.Error(), err)
+		return
+	}
+
+	// one extra row tells whether there is a next page
+	videos, err := cfg.db.GetFolderVideosPage(folder.ID, cursor, limit+1)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveVideos, "Couldn't retrieve videos", err)
+		return
+	}
+	if len(videos) > limit {
+		videos = videos[:limit]
+		setNextPageLink(w, r, encodeVideoCursor(videos[limit-1]))
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.stampVideosAssetURLs(videos))
+}
+
+// handlerVideoFolderSet files a video in one of its owner's folders, or
+// takes it out of its folder when folder_id is null.
+func (cfg *apiConfig) handlerVideoFolderSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		FolderID *uuid.UUID `json:"folder_id"`
+	}
+
+	video, ok := cfg.ownedVideo(w, r, "change the folder")
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if params.FolderID != nil {
+		folder, err := cfg.db.GetFolder(*params.FolderID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntGetFolder, "Couldn't get folder", err)
+			return
+		}
+		if folder.UserID != video.UserID {
+			respondWithFieldErrors(w, codeInvalidFolder, "Invalid folder", []fieldError{{Field: "folder_id", Message: "must be one of your folders"}})
+			return
+		}
+	}
+
+	err = cfg.db.SetVideoFolder(video, params.FolderID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntMoveVideo, "Couldn't move video", err)
+		return
+	}
+	video.FolderID = params.FolderID
+	respondWithJSON(w, http.StatusOK, cfg.stampAssetURLs(video))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultIntegrityFailureLimit = 100
+	maxIntegrityFailureLimit     = 1000
+)
+
+// handlerIntegrityCheck runs the integrity check right away instead of
+// waiting for the scheduled run.
+func (cfg *apiConfig) handlerIntegrityCheck(w http.ResponseWriter, r *http.Request) {
+	report, err := cfg.checkIntegrity(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCheckIntegrity, "Couldn't check integrity", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+func (cfg *apiConfig) handlerIntegrityFailures(w http.ResponseWriter, r *http.Request) {
+	var err error
+	limit := defaultIntegrityFailureLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxIntegrityFailureLimit {
+			respondWithError(w, http.StatusBadRequest, codeInvalidLimit, fmt.Sprintf("limit must be between 1 and %d", maxIntegrityFailureLimit), err)
+			return
+		}
+	}
+
+	failures, err := cfg.db.GetIntegrityFailures(limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveIntegrityFailures, "Couldn't retrieve integrity failures", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, failures)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultNotificationLimit = 50
+	maxNotificationLimit     = 200
+)
+
+func (cfg *apiConfig) handlerNotificationsList(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	limit, ok := limitParam(r, defaultNotificationLimit, maxNotificationLimit)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, codeInvalidLimit, "limit must be between 1 and "+strconv.Itoa(maxNotificationLimit), nil)
+		return
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	notifications, err := cfg.db.GetNotifications(userID, unreadOnly, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveNotifications, "Couldn't retrieve notifications", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, notifications)
+}
+
+func (cfg *apiConfig) handlerNotificationsUnreadCount(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Unread int `json:"unread"`
+	}
+
+	userID := requestUserID(r)
+
+	count, err := cfg.db.CountUnreadNotifications(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCountNotifications, "Couldn't count notifications", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{Unread: count})
+}
+
+func (cfg *apiConfig) handlerNotificationRead(w http.ResponseWriter, r *http.Request) {
+	notificationID, err := uuid.Parse(r.PathValue("notificationID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidNotificationID, "Invalid notification ID", err)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	// other users' notifications look the same as missing ones
+	found, err := cfg.db.MarkNotificationRead(userID, notificationID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntMarkNotificationRead, "Couldn't mark notification read", err)
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, codeNotificationNotFound, "Notification not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerNotificationsReadAll(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Marked int64 `json:"marked"`
+	}
+
+	userID := requestUserID(r)
+
+	marked, err := cfg.db.MarkAllNotificationsRead(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntMarkNotificationsRead, "Couldn't mark notifications read", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{Marked: marked})
+}
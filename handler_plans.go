@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// handlerUserPlanSet moves a user to one of the plans in PLAN_MAX_DURATIONS,
+// or back to the default plan with an empty plan.
+func (cfg *apiConfig) handlerUserPlanSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Plan string `json:"plan"`
+	}
+	type response struct {
+		UserID uuid.UUID `json:"user_id"`
+		Plan   string    `json:"plan"`
+		// nil when the plan has no limit
+		MaxDuration *string `json:"max_duration"`
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidUserID, "Invalid user ID", err)
+		return
+	}
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	plan := strings.TrimSpace(params.Plan)
+	if plan == defaultPlan {
+		plan = ""
+	}
+	if _, ok := cfg.planMaxDurations[plan]; plan != "" && !ok {
+		known := make([]string, 0, len(cfg.planMaxDurations))
+		for name := range cfg.planMaxDurations {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		respondWithFieldErrors(w, codeInvalidPlan, "Invalid plan", []fieldError{{Field: "plan", Message: "must be one of the configured plans: " + strings.Join(known, ", ")}})
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetUser, "Couldn't get user", err)
+		return
+	}
+
+	err = cfg.db.SetUserPlan(userID, plan)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntSetPlan, "Couldn't set plan", err)
+		return
+	}
+
+	resp := response{UserID: userID, Plan: plan}
+	if resp.Plan == "" {
+		resp.Plan = defaultPlan
+	}
+	cfg.recordAudit(adminActor, "user.plan_set", "user", userID.String(), map[string]any{
+		"plan": resp.Plan,
+	})
+
+	if limit, ok := cfg.planMaxDurations[resp.Plan]; ok {
+		s := limit.Round(time.Second).String()
+		resp.MaxDuration = &s
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxPlaybackBatchBytes  = 64 << 10
+	maxPlaybackBatchEvents = 100
+	// position jumps between heartbeats larger than this are seeks, not
+	// watching
+	maxHeartbeatGap = 30.0
+	// longest single buffering stall counted, longer ones are abandoned tabs
+	maxBufferingMillis = 60_000
+	// share of the video a session has to reach to count as watched through
+	watchThroughFraction = 0.9
+	// how far back analytics show egress from the access logs
+	egressWindow = 30 * 24 * time.Hour
+)
+
+type playbackEvent struct {
+	// "heartbeat", "buffering" or "quality_switch"
+	Type       string  `json:"type"`
+	Position   float64 `json:"position"`
+	DurationMS int     `json:"duration_ms"`
+}
+
+// handlerPlaybackAnalytics takes batches of player events for a playback
+// session. Sessions are identified by an ID the player makes up, events are
+// folded into the session rather than stored one by one.
+func (cfg *apiConfig) handlerPlaybackAnalytics(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		SessionID uuid.UUID       `json:"session_id"`
+		VideoID   uuid.UUID       `json:"video_id"`
+		Events    []playbackEvent `json:"events"`
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPlaybackBatchBytes)
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+
+	var errs []fieldError
+	if params.SessionID == uuid.Nil {
+		errs = append(errs, fieldError{Field: "session_id", Message: "is required"})
+	}
+	if len(params.Events) == 0 || len(params.Events) > maxPlaybackBatchEvents {
+		errs = append(errs, fieldError{Field: "events", Message: fmt.Sprintf("must have between 1 and %d events", maxPlaybackBatchEvents)})
+	}
+	for i, event := range params.Events {
+		field := fmt.Sprintf("events[%d]", i)
+		switch {
+		case event.Type != "heartbeat" && event.Type != "buffering" && event.Type != "quality_switch":
+			errs = append(errs, fieldError{Field: field + ".type", Message: "must be heartbeat, buffering or quality_switch"})
+		case event.Position < 0:
+			errs = append(errs, fieldError{Field: field + ".position", Message: "can't be negative"})
+		case event.DurationMS < 0:
+			errs = append(errs, fieldError{Field: field + ".duration_ms", Message: "can't be negative"})
+		}
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidPlaybackEvents, "Invalid playback events", errs)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(params.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || video.Visibility == database.VisibilityPrivate {
+		respondWithError(w, http.StatusNotFound, codeVideoNotFound, "Video not found", nil)
+		return
+	}
+	if video.DurationSeconds == nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasNoMediaYet, "Video has no media yet", nil)
+		return
+	}
+
+	lastPosition, seen, err := cfg.db.GetPlaybackLastPosition(video.ID, params.SessionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackSession, "Couldn't get playback session", err)
+		return
+	}
+
+	batch := foldPlaybackEvents(params.Events, *video.DurationSeconds, lastPosition, seen)
+	batch.SessionID = params.SessionID
+	batch.VideoID = video.ID
+	err = cfg.db.RecordPlaybackBatch(batch)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRecordPlaybackEvents, "Couldn't record playback events", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// foldPlaybackEvents sums up a batch of events. Positions are clamped to
+// the video, and watch time only counts forward progress between
+// heartbeats, so players can't inflate it. The stretches watched are kept
+// as spans, contiguous ones merged.
+func foldPlaybackEvents(events []playbackEvent, duration, lastPosition float64, seen bool) database.PlaybackBatch {
+	batch := database.PlaybackBatch{MaxPosition: lastPosition, LastPosition: lastPosition}
+	for _, event := range events {
+		position := min(event.Position, duration)
+		batch.MaxPosition = max(batch.MaxPosition, position)
+
+		switch event.Type {
+		case "heartbeat":
+			if delta := position - batch.LastPosition; seen && delta > 0 && delta <= maxHeartbeatGap {
+				batch.WatchedSeconds += delta
+				if n := len(batch.Spans); n > 0 && batch.Spans[n-1].End == batch.LastPosition {
+					batch.Spans[n-1].End = position
+				} else {
+					batch.Spans = append(batch.Spans, database.PlaybackSpan{Start: batch.LastPosition, End: position})
+				}
+			}
+			batch.LastPosition = position
+			seen = true
+		case "buffering":
+			batch.BufferingSeconds += float64(min(event.DurationMS, maxBufferingMillis)) / 1000
+		case "quality_switch":
+			batch.QualitySwitches++
+		}
+	}
+	return batch
+}
+
+type playbackRetentionPoint struct {
+	PositionPercent int     `json:"position_percent"`
+	Sessions        int     `json:"sessions"`
+	Fraction        float64 `json:"fraction"`
+}
+
+type egressPoint struct {
+	Day      string `json:"day"`
+	Bytes    int64  `json:"bytes"`
+	Requests int    `json:"requests"`
+}
+
+// handlerPlaybackAnalyticsGet shows a video's owner how its playbacks went:
+// how many sessions watched it through and where viewers dropped off. Egress
+// comes from the access logs and also counts plays straight from the CDN,
+// which players don't report.
+func (cfg *apiConfig) handlerPlaybackAnalyticsGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Sessions                  int                      `json:"sessions"`
+		WatchThroughRate          float64                  `json:"watch_through_rate"`
+		AverageWatchedSeconds     float64                  `json:"average_watched_seconds"`
+		BufferingRatio            float64                  `json:"buffering_ratio"`
+		QualitySwitchesPerSession float64                  `json:"quality_switches_per_session"`
+		Retention                 []playbackRetentionPoint `json:"retention"`
+		EgressBytes               int64                    `json:"egress_bytes"`
+		EgressRequests            int                      `json:"egress_requests"`
+		Egress                    []egressPoint            `json:"egress"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, codeYouCantViewAnalyticsOfThisVideo, "You can't view analytics of this video", nil)
+		return
+	}
+	if video.DurationSeconds == nil || *video.DurationSeconds <= 0 {
+		respondWithError(w, http.StatusConflict, codeVideoHasNoMediaYet, "Video has no media yet", nil)
+		return
+	}
+
+	stats, err := cfg.db.GetPlaybackStats(video.ID, *video.DurationSeconds)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackAnalytics, "Couldn't get playback analytics", err)
+		return
+	}
+
+	resp := response{
+		Sessions:  stats.Sessions,
+		Retention: make([]playbackRetentionPoint, 0, database.PlaybackDropOffBuckets+1),
+	}
+	// sessions still watching at each slice are the ones that got further
+	remaining := stats.Sessions
+	watchThroughBucket := int(watchThroughFraction * database.PlaybackDropOffBuckets)
+	for bucket := 0; bucket <= database.PlaybackDropOffBuckets; bucket++ {
+		point := playbackRetentionPoint{
+			PositionPercent: bucket * 100 / database.PlaybackDropOffBuckets,
+			Sessions:        remaining,
+		}
+		if stats.Sessions > 0 {
+			point.Fraction = float64(remaining) / float64(stats.Sessions)
+		}
+		if bucket == watchThroughBucket {
+			resp.WatchThroughRate = point.Fraction
+		}
+		resp.Retention = append(resp.Retention, point)
+		remaining -= stats.FurthestBuckets[bucket]
+	}
+	if stats.Sessions > 0 {
+		resp.AverageWatchedSeconds = stats.WatchedSeconds / float64(stats.Sessions)
+		resp.QualitySwitchesPerSession = float64(stats.QualitySwitches) / float64(stats.Sessions)
+	}
+	if total := stats.WatchedSeconds + stats.BufferingSeconds; total > 0 {
+		resp.BufferingRatio = stats.BufferingSeconds / total
+	}
+
+	egress, err := cfg.db.GetVideoEgress(video.ID, time.Now().Add(-egressWindow))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetEgress, "Couldn't get egress", err)
+		return
+	}
+	resp.Egress = make([]egressPoint, 0, len(egress))
+	for _, day := range egress {
+		resp.EgressBytes += day.Bytes
+		resp.EgressRequests += day.Requests
+		resp.Egress = append(resp.Egress, egressPoint{
+			Day:      day.Day.Format(time.DateOnly),
+			Bytes:    day.Bytes,
+			Requests: day.Requests,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
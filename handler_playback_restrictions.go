@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerPlaybackRestrictionsGet(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.restrictionsVideo(w, r)
+	if !ok {
+		return
+	}
+
+	restrictions, err := cfg.db.GetPlaybackRestrictions(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackRestrictions, "Couldn't get playback restrictions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, restrictions)
+}
+
+// handlerPlaybackRestrictionsSet replaces all of the video's restrictions,
+// an empty body lifts them.
+func (cfg *apiConfig) handlerPlaybackRestrictionsSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		AllowedCountries []string `json:"allowed_countries"`
+		AllowedCIDRs     []string `json:"allowed_cidrs"`
+		DeniedCIDRs      []string `json:"denied_cidrs"`
+	}
+
+	video, ok := cfg.restrictionsVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+
+	restrictions := database.PlaybackRestrictions{
+		VideoID:          video.ID,
+		AllowedCountries: params.AllowedCountries,
+		AllowedCIDRs:     params.AllowedCIDRs,
+		DeniedCIDRs:      params.DeniedCIDRs,
+	}
+	if errs := cfg.normalizePlaybackRestrictions(&restrictions); len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidPlaybackRestrictions, "Invalid playback restrictions", errs)
+		return
+	}
+
+	err = cfg.db.SetPlaybackRestrictions(restrictions)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntSavePlaybackRestrictions, "Couldn't save playback restrictions", err)
+		return
+	}
+
+	restrictions, err = cfg.db.GetPlaybackRestrictions(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackRestrictions, "Couldn't get playback restrictions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, restrictions)
+}
+
+func (cfg *apiConfig) restrictionsVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	userID := requestUserID(r)
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, codeYouCantManagePlaybackRestrictionsOfThisVideo, "You can't manage playback restrictions of this video", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// handlerProcessingJobGet lets clients poll an upload that was accepted for
+// background processing.
+func (cfg *apiConfig) handlerProcessingJobGet(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("jobID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidJobID, "Invalid job ID", err)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	job, err := cfg.db.GetProcessingJob(jobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetJob, "Couldn't get job", err)
+		return
+	}
+	if job.ID == uuid.Nil || job.UserID != userID {
+		respondWithError(w, http.StatusNotFound, codeJobNotFound, "Job not found", nil)
+		return
+	}
+
+	etag, err := jsonETag(job)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntComputeETag, "Couldn't compute ETag", err)
+		return
+	}
+	if checkNotModified(w, r, etag) {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// handlerUploadCancel stops an upload accepted for background processing,
+// identified by its job ID. The raw upload is deleted right away, a worker
+// already processing it aborts within a few seconds.
+func (cfg *apiConfig) handlerUploadCancel(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidUploadID, "Invalid upload ID", err)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	job, err := cfg.db.GetProcessingJob(jobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetUpload, "Couldn't get upload", err)
+		return
+	}
+	if job.ID == uuid.Nil || job.UserID != userID {
+		respondWithError(w, http.StatusNotFound, codeUploadNotFound, "Upload not found", nil)
+		return
+	}
+
+	cancelled, err := cfg.db.CancelProcessingJob(jobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCancelUpload, "Couldn't cancel upload", err)
+		return
+	}
+	if !cancelled {
+		respondWithError(w, http.StatusConflict, codeUploadHasAlreadyFinished, "Upload has already finished", nil)
+		return
+	}
+
+	cfg.deleteJobSource(job)
+
+	job, err = cfg.db.GetProcessingJob(jobID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetUpload, "Couldn't get upload", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
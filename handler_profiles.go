@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 1000
+)
+
+type profileResponse struct {
+	database.Profile
+	// only set when the request came with a JWT of another user
+	Following *bool `json:"following,omitempty"`
+}
+
+func validateDisplayName(name string) string {
+	switch {
+	case !utf8.ValidString(name):
+		return "must be valid UTF-8"
+	case name != strings.TrimSpace(name):
+		return "must not start or end with whitespace"
+	case utf8.RuneCountInString(name) > maxDisplayNameLength:
+		return fmt.Sprintf("must be at most %d characters", maxDisplayNameLength)
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) && r != ' ' {
+			return "must not contain control or invisible characters"
+		}
+	}
+	return ""
+}
+
+func validateBio(bio string) string {
+	if utf8.RuneCountInString(bio) > maxBioLength {
+		return fmt.Sprintf("must be at most %d characters", maxBioLength)
+	}
+	return validateDescription(bio)
+}
+
+// profileUserID resolves the {userID} path value, "me" meaning the user of
+// the request's JWT. A non-zero status comes with the code and message to
+// respond with.
+func (cfg *apiConfig) profileUserID(r *http.Request) (uuid.UUID, int, errorCode, string, error) {
+	if r.PathValue("userID") != "me" {
+		userID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			return uuid.Nil, http.StatusBadRequest, codeInvalidUserID, "Invalid user ID", err
+		}
+		return userID, 0, "", "", nil
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, http.StatusUnauthorized, codeCouldntFindJWT, "Couldn't find JWT", err
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		return uuid.Nil, http.StatusUnauthorized, codeCouldntValidateJWT, "Couldn't validate JWT", err
+	}
+	return userID, 0, "", "", nil
+}
+
+func (cfg *apiConfig) handlerProfileGet(w http.ResponseWriter, r *http.Request) {
+	userID, status, code, msg, err := cfg.profileUserID(r)
+	if status != 0 {
+		respondWithError(w, status, code, msg, err)
+		return
+	}
+
+	profile, err := cfg.db.GetProfile(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetProfile, "Couldn't get profile", err)
+		return
+	}
+	if profile.UserID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeUserNotFound, "User not found", nil)
+		return
+	}
+
+	resp := profileResponse{Profile: profile}
+	// profiles are public, a JWT only adds whether the viewer follows them
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		if viewerID, err := auth.ValidateJWT(token, cfg.jwtSecret); err == nil && viewerID != userID {
+			following, err := cfg.db.IsFollowing(viewerID, userID)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, codeCouldntGetFollowStatus, "Couldn't get follow status", err)
+				return
+			}
+			resp.Following = &following
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerProfileUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+	}
+
+	userID := requestUserID(r)
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+
+	profile, err := cfg.db.GetProfile(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetProfile, "Couldn't get profile", err)
+		return
+	}
+	if profile.UserID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeUserNotFound, "User not found", nil)
+		return
+	}
+
+	var errs []fieldError
+	if params.DisplayName != nil {
+		if msg := validateDisplayName(*params.DisplayName); msg != "" {
+			errs = append(errs, fieldError{Field: "display_name", Message: msg})
+		}
+		profile.DisplayName = *params.DisplayName
+	}
+	if params.Bio != nil {
+		if msg := validateBio(*params.Bio); msg != "" {
+			errs = append(errs, fieldError{Field: "bio", Message: msg})
+		}
+		profile.Bio = *params.Bio
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidProfile, "Invalid profile", errs)
+		return
+	}
+
+	err = cfg.db.UpdateProfile(userID, profile.DisplayName, profile.Bio)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateProfile, "Couldn't update profile", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, profileResponse{Profile: profile})
+}
+
+func (cfg *apiConfig) handlerAvatarUpload(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	profile, err := cfg.db.GetProfile(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetProfile, "Couldn't get profile", err)
+		return
+	}
+	if profile.UserID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeUserNotFound, "User not found", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMemory)
+	err = r.ParseMultipartForm(maxMemory)
+	if err != nil {
+		respondWithFormError(w, err)
+		return
+	}
+	registerRequestCleanup(r, func() { r.MultipartForm.RemoveAll() })
+
+	avatar, header, err := r.FormFile("avatar")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeMissingAvatarFile, "Missing avatar file", err)
+		return
+	}
+	defer avatar.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	if mediaType != "image/jpeg" && mediaType != "image/png" {
+		respondWithError(w, http.StatusUnsupportedMediaType, codeAvatarMustBeAJPEGOrPNGImage, "Avatar must be a JPEG or PNG image", nil)
+		return
+	}
+
+	randomBase64String, err := makeRandomID()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeErrorCreatingAvatarRandomID, "Error creating avatar random ID", err)
+		return
+	}
+	assetPath := getAssetPath(randomBase64String, mediaType)
+
+	dst, err := createAssetFile(cfg.getAssetDiskPath(assetPath))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeUnableToCreateFile, "Unable to create file", err)
+		return
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, avatar)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeErrorSavingFile, "Error saving file", err)
+		return
+	}
+
+	avatarURL := cfg.getAssetURL(r, assetPath)
+	err = cfg.db.SetAvatarURL(userID, avatarURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateProfile, "Couldn't update profile", err)
+		return
+	}
+
+	if profile.AvatarURL != nil {
+		oldAvatarPath := cfg.getAssetDiskPath(getAssetFromURL(*profile.AvatarURL))
+		if err := os.Remove(oldAvatarPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Couldn't remove old avatar %s: %v", oldAvatarPath, err)
+		}
+	}
+
+	profile.AvatarURL = &avatarURL
+	respondWithJSON(w, http.StatusOK, profileResponse{Profile: profile})
+}
+
+// handlerChannelVideos lists a user's public videos, newest first.
+func (cfg *apiConfig) handlerChannelVideos(w http.ResponseWriter, r *http.Request) {
+	userID, status, code, msg, err := cfg.profileUserID(r)
+	if status != 0 {
+		respondWithError(w, status, code, msg, err)
+		return
+	}
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidPageParameters, err.Error(), err)
+		return
+	}
+
+	// one extra row tells whether there is a next page
+	videos, err := cfg.db.GetChannelVideosPage(userID, cursor, limit+1)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveVideos, "Couldn't retrieve videos", err)
+		return
+	}
+	if len(videos) > limit {
+		videos = videos[:limit]
+		setNextPageLink(w, r, encodeVideoCursor(videos[limit-1]))
+	}
+
+	videos, err = cfg.withoutRestrictedMedia(r, videos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackRestrictions, "Couldn't get playback restrictions", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.stampVideosAssetURLs(cfg.withThumbnailExperiments(r, videos)))
+}
+
+func (cfg *apiConfig) handlerFollow(w http.ResponseWriter, r *http.Request) {
+	cfg.setFollowing(w, r, true)
+}
+
+func (cfg *apiConfig) handlerUnfollow(w http.ResponseWriter, r *http.Request) {
+	cfg.setFollowing(w, r, false)
+}
+
+func (cfg *apiConfig) setFollowing(w http.ResponseWriter, r *http.Request, follow bool) {
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidUserID, "Invalid user ID", err)
+		return
+	}
+
+	userID := requestUserID(r)
+	if followeeID == userID {
+		respondWithError(w, http.StatusBadRequest, codeYouCantFollowYourself, "You can't follow yourself", nil)
+		return
+	}
+
+	followee, err := cfg.db.GetUser(followeeID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetUser, "Couldn't get user", err)
+		return
+	}
+	if followee == nil {
+		respondWithError(w, http.StatusNotFound, codeUserNotFound, "User not found", nil)
+		return
+	}
+
+	// both are idempotent, following twice or unfollowing a stranger is
+	// not an error
+	var changed bool
+	if follow {
+		changed, err = cfg.db.Follow(userID, followeeID)
+	} else {
+		changed, err = cfg.db.Unfollow(userID, followeeID)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateFollow, "Couldn't update follow", err)
+		return
+	}
+	if follow && changed {
+		cfg.publishEvent(eventUserFollowed, followEvent{FollowerID: userID, FolloweeID: followeeID})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSubscriptionVideos is the feed of everyone the user follows,
+// newest first.
+func (cfg *apiConfig) handlerSubscriptionVideos(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidPageParameters, err.Error(), err)
+		return
+	}
+
+	videos, err := cfg.db.GetSubscriptionVideosPage(userID, cursor, limit+1)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveVideos, "Couldn't retrieve videos", err)
+		return
+	}
+	if len(videos) > limit {
+		videos = videos[:limit]
+		setNextPageLink(w, r, encodeVideoCursor(videos[limit-1]))
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.stampVideosAssetURLs(cfg.withThumbnailExperiments(r, videos)))
+}
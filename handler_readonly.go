@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+func (cfg *apiConfig) handlerReadOnlyGet(w http.ResponseWriter, r *http.Request) {
+	enabled, retryAfter, message := cfg.readOnly.get()
+	respondWithJSON(w, http.StatusOK, maintenanceResponse{
+		Enabled:           enabled,
+		RetryAfterSeconds: int(retryAfter.Seconds()),
+		Message:           message,
+	})
+}
+
+func (cfg *apiConfig) handlerReadOnlySet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Enabled           bool   `json:"enabled"`
+		RetryAfterSeconds int    `json:"retry_after_seconds"`
+		Message           string `json:"message"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if params.RetryAfterSeconds < 0 {
+		respondWithError(w, http.StatusBadRequest, codeRetryAfterSecondsCantBeNegative, "retry_after_seconds can't be negative", nil)
+		return
+	}
+
+	retryAfter := defaultMaintenanceRetryAfter
+	if params.RetryAfterSeconds > 0 {
+		retryAfter = time.Duration(params.RetryAfterSeconds) * time.Second
+	}
+	cfg.readOnly.set(params.Enabled, retryAfter, params.Message)
+
+	respondWithJSON(w, http.StatusOK, maintenanceResponse{
+		Enabled:           params.Enabled,
+		RetryAfterSeconds: int(retryAfter.Seconds()),
+		Message:           params.Message,
+	})
+}
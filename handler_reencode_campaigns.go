@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerReencodeCampaignCreate starts re-encoding every video with media to
+// a new profile. The work happens in the background, see reencode.go.
+func (cfg *apiConfig) handlerReencodeCampaignCreate(w http.ResponseWriter, r *http.Request) {
+	params := database.CreateReencodeCampaignParams{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+
+	errs := validateEncodingProfile(params.EncodingProfile)
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidCampaign, "Invalid campaign", errs)
+		return
+	}
+
+	campaign, err := cfg.db.CreateReencodeCampaign(params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateCampaign, "Couldn't create campaign", err)
+		return
+	}
+	cfg.recordAudit(adminActor, "reencode.created", "reencode_campaign", campaign.ID.String(), map[string]any{
+		"video_codec": params.VideoCodec,
+		"max_height":  params.MaxHeight,
+		"crf":         params.CRF,
+		"total":       campaign.Total,
+	})
+
+	respondWithJSON(w, http.StatusCreated, campaign)
+}
+
+func (cfg *apiConfig) handlerReencodeCampaignsList(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := cfg.db.GetReencodeCampaigns()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetCampaigns, "Couldn't get campaigns", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, campaigns)
+}
+
+func (cfg *apiConfig) handlerReencodeCampaignGet(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := cfg.campaignFromPath(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, campaign)
+}
+
+func (cfg *apiConfig) handlerReencodeCampaignPause(w http.ResponseWriter, r *http.Request) {
+	cfg.setReencodeCampaignStatus(w, r, database.CampaignStatusRunning, database.CampaignStatusPaused, "reencode.paused")
+}
+
+func (cfg *apiConfig) handlerReencodeCampaignResume(w http.ResponseWriter, r *http.Request) {
+	cfg.setReencodeCampaignStatus(w, r, database.CampaignStatusPaused, database.CampaignStatusRunning, "reencode.resumed")
+}
+
+// setReencodeCampaignStatus moves a campaign between running and paused. A
+// video being encoded when it is paused is still finished.
+func (cfg *apiConfig) setReencodeCampaignStatus(w http.ResponseWriter, r *http.Request, from, status, action string) {
+	campaign, ok := cfg.campaignFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	changed, err := cfg.db.SetReencodeCampaignStatus(campaign.ID, from, status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateCampaign, "Couldn't update campaign", err)
+		return
+	}
+	if !changed {
+		respondWithError(w, http.StatusConflict, codeCampaignWrongStatus, "Campaign isn't "+from, nil)
+		return
+	}
+	cfg.recordAudit(adminActor, action, "reencode_campaign", campaign.ID.String(), nil)
+
+	campaign, err = cfg.db.GetReencodeCampaign(campaign.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetCampaign, "Couldn't get campaign", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, campaign)
+}
+
+func (cfg *apiConfig) campaignFromPath(w http.ResponseWriter, r *http.Request) (database.ReencodeCampaign, bool) {
+	campaignID, err := uuid.Parse(r.PathValue("campaignID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidCampaignID, "Invalid campaign ID", err)
+		return database.ReencodeCampaign{}, false
+	}
+	campaign, err := cfg.db.GetReencodeCampaign(campaignID)
+	if err != nil || campaign.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetCampaign, "Couldn't get campaign", err)
+		return database.ReencodeCampaign{}, false
+	}
+	return campaign, true
+}
+
+func validateEncodingProfile(profile database.EncodingProfile) []fieldError {
+	var errs []fieldError
+	if _, ok := reencodeCodecs[profile.VideoCodec]; !ok {
+		codecs := make([]string, 0, len(reencodeCodecs))
+		for name := range reencodeCodecs {
+			codecs = append(codecs, name)
+		}
+		sort.Strings(codecs)
+		errs = append(errs, fieldError{Field: "video_codec", Message: "must be one of " + strings.Join(codecs, ", ")})
+	}
+	if profile.MaxHeight < 0 || profile.MaxHeight%2 != 0 {
+		errs = append(errs, fieldError{Field: "max_height", Message: "must be a positive even number, or 0 to keep the source height"})
+	}
+	if profile.CRF < 0 || profile.CRF > 63 {
+		errs = append(errs, fieldError{Field: "crf", Message: "must be between 1 and 63, or 0 for the codec's default"})
+	}
+	return errs
+}
@@ -14,13 +14,13 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Couldn't find token", err)
+		respondWithError(w, http.StatusBadRequest, codeCouldntFindToken, "Couldn't find token", err)
 		return
 	}
 
 	user, err := cfg.db.GetUserByRefreshToken(refreshToken)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+		respondWithError(w, http.StatusUnauthorized, codeCouldntGetUserForRefreshToken, "Couldn't get user for refresh token", err)
 		return
 	}
 
@@ -30,7 +30,7 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		time.Hour,
 	)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
+		respondWithError(w, http.StatusUnauthorized, codeCouldntValidateToken, "Couldn't validate token", err)
 		return
 	}
 
@@ -42,13 +42,13 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Couldn't find token", err)
+		respondWithError(w, http.StatusBadRequest, codeCouldntFindToken, "Couldn't find token", err)
 		return
 	}
 
 	err = cfg.db.RevokeRefreshToken(refreshToken)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRevokeSession, "Couldn't revoke session", err)
 		return
 	}
 
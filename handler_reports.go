@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+var reportReasons = map[string]bool{
+	"copyright": true,
+	"abuse":     true,
+	"spam":      true,
+	"other":     true,
+}
+
+// handlerReportCreate lets anyone who can see a video report it. Copyright
+// notices need a contact address and a description of the infringed work.
+func (cfg *apiConfig) handlerReportCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason        string `json:"reason"`
+		Details       string `json:"details"`
+		ReporterEmail string `json:"reporter_email"`
+	}
+	type response struct {
+		ID     uuid.UUID `json:"id"`
+		Status string    `json:"status"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+
+	var errs []fieldError
+	if !reportReasons[params.Reason] {
+		errs = append(errs, fieldError{Field: "reason", Message: "must be copyright, abuse, spam or other"})
+	}
+	if msg := validateDescription(params.Details); msg != "" {
+		errs = append(errs, fieldError{Field: "details", Message: msg})
+	} else if params.Reason == "copyright" && strings.TrimSpace(params.Details) == "" {
+		errs = append(errs, fieldError{Field: "details", Message: "must describe the copyrighted work"})
+	}
+	if params.ReporterEmail != "" {
+		if _, err := mail.ParseAddress(params.ReporterEmail); err != nil || len(params.ReporterEmail) > 254 {
+			errs = append(errs, fieldError{Field: "reporter_email", Message: "must be a valid email address"})
+		}
+	} else if params.Reason == "copyright" {
+		errs = append(errs, fieldError{Field: "reporter_email", Message: "is required for copyright notices"})
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidReport, "Invalid report", errs)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || video.Visibility == database.VisibilityPrivate {
+		respondWithError(w, http.StatusNotFound, codeVideoNotFound, "Video not found", nil)
+		return
+	}
+
+	report, err := cfg.db.CreateReport(database.CreateReportParams{
+		VideoID:       videoID,
+		Reason:        params.Reason,
+		Details:       params.Details,
+		ReporterEmail: params.ReporterEmail,
+		ReporterIP:    clientIP(r),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateReport, "Couldn't create report", err)
+		return
+	}
+
+	cfg.recordAudit(fmt.Sprintf("reporter:%s", report.ReporterIP), "report.created", "video", videoID.String(), map[string]any{
+		"report_id": report.ID,
+		"reason":    report.Reason,
+	})
+
+	respondWithJSON(w, http.StatusCreated, response{ID: report.ID, Status: report.Status})
+}
+
+func (cfg *apiConfig) handlerReportsList(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = database.ReportStatusOpen
+	}
+	if status != database.ReportStatusOpen && status != database.ReportStatusResolved && status != database.ReportStatusDismissed {
+		respondWithError(w, http.StatusBadRequest, codeStatusMustBeOpenResolvedOrDismissed, "status must be open, resolved or dismissed", nil)
+		return
+	}
+
+	reports, err := cfg.db.GetReports(status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveReports, "Couldn't retrieve reports", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, reports)
+}
+
+// handlerReportDismiss closes a report without acting on the video.
+func (cfg *apiConfig) handlerReportDismiss(w http.ResponseWriter, r *http.Request) {
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidReportID, "Invalid report ID", err)
+		return
+	}
+
+	report, err := cfg.db.GetReport(reportID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetReport, "Couldn't get report", err)
+		return
+	}
+	if report.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeReportNotFound, "Report not found", nil)
+		return
+	}
+
+	dismissed, err := cfg.db.SetReportStatus(reportID, database.ReportStatusDismissed)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDismissReport, "Couldn't dismiss report", err)
+		return
+	}
+	if !dismissed {
+		respondWithError(w, http.StatusConflict, codeReportIsAlreadyClosed, "Report is already closed", nil)
+		return
+	}
+
+	cfg.recordAudit(adminActor, "report.dismissed", "video", report.VideoID.String(), map[string]any{
+		"report_id": report.ID,
+	})
+
+	report, err = cfg.db.GetReport(reportID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetReport, "Couldn't get report", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// handlerRetentionSet places a video under a retention lock until a date, or
+// lifts it with an empty until. While locked the video can't be deleted,
+// neither by its owner nor by expiry.
+func (cfg *apiConfig) handlerRetentionSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Until  string `json:"until"`
+		Reason string `json:"reason"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+
+	var until *time.Time
+	if params.Until != "" {
+		t, err := time.Parse(time.RFC3339, params.Until)
+		if err != nil || !t.After(cfg.clock.Now()) {
+			respondWithFieldErrors(w, codeInvalidRetentionLock, "Invalid retention lock", []fieldError{{Field: "until", Message: "must be a future RFC 3339 timestamp"}})
+			return
+		}
+		until = &t
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+
+	keys, err := cfg.videoObjectKeys(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideoVersions, "Couldn't get video versions", err)
+		return
+	}
+	// lock the objects first, a failure then leaves the record unchanged
+	err = cfg.applyObjectRetention(r.Context(), keys, until)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, codeCouldntApplyRetentionInS3, "Couldn't apply retention in S3", err)
+		return
+	}
+
+	err = cfg.db.SetVideoRetention(videoID, until)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntSetRetentionLock, "Couldn't set retention lock", err)
+		return
+	}
+
+	cfg.recordAudit(adminActor, "retention.set", "video", videoID.String(), map[string]any{
+		"until":  until,
+		"reason": params.Reason,
+	})
+
+	video, err = cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, withPlaceholderThumbnail(video))
+}
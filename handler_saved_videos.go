@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultSavedVideosLimit = 50
+	maxSavedVideosLimit     = 500
+)
+
+// savedList maps the {list} path value to a built-in list, they're spelled
+// with a hyphen in URLs.
+func savedList(r *http.Request) (string, bool) {
+	switch r.PathValue("list") {
+	case "watch-later":
+		return database.ListWatchLater, true
+	case "favorites":
+		return database.ListFavorites, true
+	}
+	return "", false
+}
+
+func (cfg *apiConfig) handlerSavedVideosList(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	list, ok := savedList(r)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, codeListNotFound, "List not found", nil)
+		return
+	}
+	limit, ok := limitParam(r, defaultSavedVideosLimit, maxSavedVideosLimit)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, codeInvalidLimit, "limit must be between 1 and "+strconv.Itoa(maxSavedVideosLimit), nil)
+		return
+	}
+
+	videos, err := cfg.db.GetSavedVideos(userID, list, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveVideos, "Couldn't retrieve videos", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.stampVideosAssetURLs(cfg.withThumbnailExperiments(r, videos)))
+}
+
+func (cfg *apiConfig) handlerSavedVideoAdd(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	list, ok := savedList(r)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, codeListNotFound, "List not found", nil)
+		return
+	}
+	video, ok := cfg.watchableVideo(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// saving twice is not an error
+	_, err := cfg.db.SaveVideo(userID, list, video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateList, "Couldn't update list", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSavedVideoRemove doesn't check access to the video, so users can
+// clean out videos that went private or were taken down.
+func (cfg *apiConfig) handlerSavedVideoRemove(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+	userID := requestUserID(r)
+	list, ok := savedList(r)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, codeListNotFound, "List not found", nil)
+		return
+	}
+
+	_, err = cfg.db.UnsaveVideo(userID, list, videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateList, "Couldn't update list", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
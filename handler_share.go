@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+var shareTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html{{if .Language}} lang="{{.Language}}"{{end}}>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<meta name="description" content="{{.Description}}">
+<meta property="og:site_name" content="Tubely">
+<meta property="og:type" content="video.other">
+<meta property="og:title" content="{{.Title}}">
+<meta property="og:description" content="{{.Description}}">
+<meta property="og:url" content="{{.ShareURL}}">
+{{- if .ThumbnailURL}}
+<meta property="og:image" content="{{.ThumbnailURL}}">
+{{- if .ThumbnailAltText}}
+<meta property="og:image:alt" content="{{.ThumbnailAltText}}">
+{{- end}}
+{{- end}}
+<meta property="og:video" content="{{.VideoURL}}">
+<meta property="og:video:secure_url" content="{{.VideoURL}}">
+<meta property="og:video:type" content="video/mp4">
+<meta property="og:video:width" content="{{.Width}}">
+<meta property="og:video:height" content="{{.Height}}">
+<meta name="twitter:card" content="player">
+<meta name="twitter:title" content="{{.Title}}">
+<meta name="twitter:description" content="{{.Description}}">
+{{- if .ThumbnailURL}}
+<meta name="twitter:image" content="{{.ThumbnailURL}}">
+{{- if .ThumbnailAltText}}
+<meta name="twitter:image:alt" content="{{.ThumbnailAltText}}">
+{{- end}}
+{{- end}}
+<meta name="twitter:player" content="{{.EmbedURL}}">
+<meta name="twitter:player:width" content="{{.Width}}">
+<meta name="twitter:player:height" content="{{.Height}}">
+<link rel="alternate" type="application/json+oembed" href="{{.OEmbedURL}}" title="{{.Title}}">
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; }
+video { width: 100%; background: #000; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<video src="{{.VideoURL}}"{{if .ThumbnailURL}} poster="{{.ThumbnailURL}}"{{end}} controls playsinline preload="metadata"></video>
+<p>{{.Description}}</p>
+</body>
+</html>
+`))
+
+// handlerShare serves a page with Open Graph and Twitter Card tags so link
+// unfurlers, which don't run JavaScript, get a rich preview.
+func (cfg *apiConfig) handlerShare(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || !isEmbeddable(video) {
+		http.NotFound(w, r)
+		return
+	}
+	if !cfg.checkPlaybackPage(w, r, video) {
+		return
+	}
+
+	cfg.recordView(video)
+	cfg.recordShareLinkView(r, video)
+	video = cfg.stampAssetURLs(video)
+	// unfurlers send the language of who is sharing, if any
+	localized, lang, err := cfg.localizeVideo(r, video)
+	if err != nil {
+		log.Printf("Couldn't localize share page of video %s: %v", videoID, err)
+	} else {
+		video = localized
+	}
+	w.Header().Add("Vary", "Accept-Language")
+
+	width, height := cfg.videoDimensions(video)
+	baseURL := publicBaseURL(r)
+	shareURL := fmt.Sprintf("%s/share/%s", baseURL, video.ID)
+
+	data := struct {
+		Title        string
+		Description  string
+		ShareURL     string
+		EmbedURL     string
+		OEmbedURL    string
+		VideoURL     string
+		ThumbnailURL string
+		// only set with a thumbnail of the video's own, not the placeholder
+		ThumbnailAltText string
+		Width            int
+		Height           int
+		Language         string
+	}{
+		Title:       video.Title,
+		Description: video.Description,
+		ShareURL:    shareURL,
+		EmbedURL:    fmt.Sprintf("%s/embed/%s", baseURL, video.ID),
+		OEmbedURL:   fmt.Sprintf("%s/oembed?format=json&url=%s", baseURL, url.QueryEscape(shareURL)),
+		VideoURL:    *video.VideoURL,
+		Width:       width,
+		Height:      height,
+		Language:    lang,
+	}
+	if video.ThumbnailURL != nil {
+		data.ThumbnailURL = absoluteURL(r, *video.ThumbnailURL)
+		data.ThumbnailAltText = video.ThumbnailAltText
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	shareTemplate.Execute(w, data)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxShareLinksPerVideo   = 100
+	maxShareLinkLabelLength = 100
+)
+
+// linkPreviewCrawlers fetch share pages to unfurl links in chats and
+// feeds, which says nothing about whether anyone watched.
+var linkPreviewCrawlers = []string{
+	"bot",
+	"facebookexternalhit",
+	"slack",
+	"whatsapp",
+	"skypeuripreview",
+	"embedly",
+	"iframely",
+}
+
+func isLinkPreviewCrawler(r *http.Request) bool {
+	ua := strings.ToLower(r.UserAgent())
+	for _, crawler := range linkPreviewCrawlers {
+		if strings.Contains(ua, crawler) {
+			return true
+		}
+	}
+	return false
+}
+
+type shareLinkResponse struct {
+	database.ShareLink
+	URL string `json:"url"`
+}
+
+func shareLinkURL(r *http.Request, link database.ShareLink) string {
+	return fmt.Sprintf("%s/share/%s?link=%s", publicBaseURL(r), link.VideoID, link.ID)
+}
+
+// recordShareLinkView counts a view of the share page if it was opened
+// through one of the owner's links.
+func (cfg *apiConfig) recordShareLinkView(r *http.Request, video database.Video) {
+	linkID, err := uuid.Parse(r.URL.Query().Get("link"))
+	if err != nil || isLinkPreviewCrawler(r) {
+		return
+	}
+	if _, err := cfg.db.RecordShareLinkView(linkID, video.ID); err != nil {
+		log.Printf("Couldn't record view of share link %s: %v", linkID, err)
+	}
+}
+
+func (cfg *apiConfig) handlerShareLinkCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Label string `json:"label"`
+	}
+
+	video, ok := cfg.ownedVideo(w, r, "create share links")
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if !utf8.ValidString(params.Label) || utf8.RuneCountInString(params.Label) > maxShareLinkLabelLength {
+		respondWithFieldErrors(w, codeInvalidShareLink, "Invalid share link", []fieldError{{
+			Field:   "label",
+			Message: fmt.Sprintf("must be valid UTF-8 and at most %d characters", maxShareLinkLabelLength),
+		}})
+		return
+	}
+
+	links, err := cfg.db.GetShareLinks(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetShareLinks, "Couldn't get share links", err)
+		return
+	}
+	if len(links) >= maxShareLinksPerVideo {
+		respondWithError(w, http.StatusConflict, codeTooManyShareLinks, fmt.Sprintf("A video can have at most %d share links", maxShareLinksPerVideo), nil)
+		return
+	}
+
+	link, err := cfg.db.CreateShareLink(video.ID, strings.TrimSpace(params.Label))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateShareLink, "Couldn't create share link", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, shareLinkResponse{ShareLink: link, URL: shareLinkURL(r, link)})
+}
+
+func (cfg *apiConfig) handlerShareLinksList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r, "view share links")
+	if !ok {
+		return
+	}
+
+	links, err := cfg.db.GetShareLinks(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetShareLinks, "Couldn't get share links", err)
+		return
+	}
+	resp := make([]shareLinkResponse, 0, len(links))
+	for _, link := range links {
+		resp = append(resp, shareLinkResponse{ShareLink: link, URL: shareLinkURL(r, link)})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerShareLinkDelete stops counting views of a link. The link itself
+// keeps working for as long as the video's visibility allows.
+func (cfg *apiConfig) handlerShareLinkDelete(w http.ResponseWriter, r *http.Request) {
+	linkID, err := uuid.Parse(r.PathValue("linkID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidShareLinkID, "Invalid share link ID", err)
+		return
+	}
+	video, ok := cfg.ownedVideo(w, r, "delete share links")
+	if !ok {
+		return
+	}
+
+	found, err := cfg.db.DeleteShareLink(linkID, video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDeleteShareLink, "Couldn't delete share link", err)
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, codeShareLinkNotFound, "Share link not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
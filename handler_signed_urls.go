@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxSignedURLBatch  = 100
+	presignedURLExpiry = 15 * time.Minute
+)
+
+type signedVideoURLs struct {
+	ID           uuid.UUID `json:"id"`
+	VideoURL     *string   `json:"video_url"`
+	ThumbnailURL *string   `json:"thumbnail_url"`
+	// Encrypted videos have no video URL, they are played through the
+	// stream endpoint with their key
+	Encrypted bool `json:"encrypted"`
+	// lets clients verify what they downloaded
+	ContentSHA256 *string `json:"content_sha256"`
+}
+
+// handlerSignedURLs presigns the media of many videos at once, so a gallery
+// needs a single round trip. Videos the caller can't see are reported as
+// not found rather than failing the whole batch, videos that were taken
+// down or whose playback restrictions exclude the caller as restricted.
+func (cfg *apiConfig) handlerSignedURLs(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoIDs []uuid.UUID `json:"video_ids"`
+	}
+	type response struct {
+		Videos     []signedVideoURLs `json:"videos"`
+		NotFound   []uuid.UUID       `json:"not_found"`
+		Restricted []uuid.UUID       `json:"restricted"`
+	}
+
+	userID := requestUserID(r)
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if len(params.VideoIDs) == 0 || len(params.VideoIDs) > maxSignedURLBatch {
+		respondWithError(w, http.StatusBadRequest, codeInvalidBatchSize, fmt.Sprintf("Provide between 1 and %d video IDs", maxSignedURLBatch), nil)
+		return
+	}
+
+	playbackClient, _ := cfg.playbackBucket()
+	presignClient := s3.NewPresignClient(playbackClient)
+	resp := response{Videos: []signedVideoURLs{}, NotFound: []uuid.UUID{}, Restricted: []uuid.UUID{}}
+	seen := make(map[uuid.UUID]bool, len(params.VideoIDs))
+	for _, videoID := range params.VideoIDs {
+		if seen[videoID] {
+			continue
+		}
+		seen[videoID] = true
+
+		video, err := cfg.db.GetVideo(videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
+			return
+		}
+		if video.ID == uuid.Nil || (video.UserID != userID && video.Visibility == database.VisibilityPrivate) {
+			resp.NotFound = append(resp.NotFound, videoID)
+			continue
+		}
+		if video.UserID != userID {
+			if cfg.isTakenDown(video.ID) {
+				resp.Restricted = append(resp.Restricted, videoID)
+				continue
+			}
+			restrictions, err := cfg.db.GetPlaybackRestrictions(video.ID)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackRestrictions, "Couldn't get playback restrictions", err)
+				return
+			}
+			if !cfg.playbackAllowed(r, restrictions) {
+				resp.Restricted = append(resp.Restricted, videoID)
+				continue
+			}
+		}
+
+		signed := signedVideoURLs{
+			ID:            video.ID,
+			Encrypted:     video.EncryptionKeyMD5 != nil,
+			ContentSHA256: video.ContentSHA256,
+		}
+		if !signed.Encrypted {
+			signed.VideoURL, err = cfg.presignAssetURL(r.Context(), presignClient, video.VideoURL)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, codeCouldntSignVideoURL, "Couldn't sign video URL", err)
+				return
+			}
+			// the URL is handed out to be played
+			if signed.VideoURL != nil && video.UserID != userID {
+				cfg.recordView(video)
+			}
+		}
+		signed.ThumbnailURL, err = cfg.presignAssetURL(r.Context(), presignClient, video.ThumbnailURL)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntSignThumbnailURL, "Couldn't sign thumbnail URL", err)
+			return
+		}
+		resp.Videos = append(resp.Videos, signed)
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// presignAssetURL signs URLs pointing into the bucket and passes others,
+// like locally served thumbnails, through unchanged.
+func (cfg *apiConfig) presignAssetURL(ctx context.Context, client *s3.PresignClient, assetURL *string) (*string, error) {
+	if assetURL == nil || !cfg.isS3ObjectURL(*assetURL) {
+		return assetURL, nil
+	}
+
+	key, err := cfg.getS3KeyFromURL(*assetURL)
+	if err != nil {
+		return nil, err
+	}
+	_, bucket := cfg.playbackBucket()
+	req, err := client.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(presignedURLExpiry))
+	if err != nil {
+		return nil, err
+	}
+	return &req.URL, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func (cfg *apiConfig) handlerUserStorage(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		TotalBytes     int64                   `json:"total_bytes"`
+		VideoBytes     int64                   `json:"video_bytes"`
+		ThumbnailBytes int64                   `json:"thumbnail_bytes"`
+		VersionBytes   int64                   `json:"version_bytes"`
+		PendingBytes   int64                   `json:"pending_bytes"`
+		QuotaBytes     *int64                  `json:"quota_bytes"`
+		QuotaRemaining *int64                  `json:"quota_remaining"`
+		Videos         []database.VideoStorage `json:"videos"`
+	}
+
+	userID := requestUserID(r)
+
+	usage, err := cfg.db.GetVideoStorage(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveStorageUsage, "Couldn't retrieve storage usage", err)
+		return
+	}
+
+	resp := response{Videos: usage}
+	for _, vs := range usage {
+		resp.VideoBytes += vs.VideoBytes
+		resp.ThumbnailBytes += vs.ThumbnailBytes
+		resp.VersionBytes += vs.VersionBytes
+	}
+	// queued uploads hold their size until processed, uploads rejected then,
+	// e.g. for being too long for the plan, give it back
+	resp.PendingBytes, err = cfg.db.GetPendingUploadBytes(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrievePendingUploads, "Couldn't retrieve pending uploads", err)
+		return
+	}
+	resp.TotalBytes = resp.VideoBytes + resp.ThumbnailBytes + resp.VersionBytes + resp.PendingBytes
+
+	if cfg.userStorageQuota > 0 {
+		quota := cfg.userStorageQuota
+		remaining := max(quota-resp.TotalBytes, 0)
+		resp.QuotaBytes = &quota
+		resp.QuotaRemaining = &remaining
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
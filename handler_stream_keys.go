@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxStreamKeysPerUser = 20
+	// leaves room for the date in the titles of the videos broadcasts
+	// create
+	maxStreamKeyLabelLength = 60
+)
+
+type streamKeyResponse struct {
+	database.StreamKey
+	IngestURL string `json:"ingest_url"`
+}
+
+func (cfg *apiConfig) streamKeyResponse(key database.StreamKey) streamKeyResponse {
+	resp := streamKeyResponse{StreamKey: key}
+	if cfg.live != nil {
+		resp.IngestURL = cfg.live.ingestURL
+	}
+	return resp
+}
+
+func (cfg *apiConfig) ownedStreamKey(w http.ResponseWriter, r *http.Request) (database.StreamKey, bool) {
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidStreamKeyID, "Invalid stream key ID", err)
+		return database.StreamKey{}, false
+	}
+
+	key, err := cfg.db.GetStreamKey(keyID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetStreamKey, "Couldn't get stream key", err)
+		return database.StreamKey{}, false
+	}
+	if key.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeStreamKeyNotFound, "Stream key not found", nil)
+		return database.StreamKey{}, false
+	}
+	if key.UserID != requestUserID(r) {
+		respondWithError(w, http.StatusForbidden, codeYouCantChangeThisStreamKey, "You can't change this stream key", nil)
+		return database.StreamKey{}, false
+	}
+	return key, true
+}
+
+func (cfg *apiConfig) handlerStreamKeysList(w http.ResponseWriter, r *http.Request) {
+	keys, err := cfg.db.GetStreamKeys(requestUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetStreamKeys, "Couldn't get stream keys", err)
+		return
+	}
+	resp := make([]streamKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, cfg.streamKeyResponse(key))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerStreamKeyCreate gives the user a stream key. Each broadcast to it
+// becomes a new video, with the key's label and the date as its title.
+func (cfg *apiConfig) handlerStreamKeyCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Label      string  `json:"label"`
+		Visibility string  `json:"visibility"`
+		LowLatency bool    `json:"low_latency"`
+		PartTarget float64 `json:"part_target"`
+	}
+
+	if cfg.live == nil {
+		respondWithError(w, http.StatusConflict, codeLiveStreamingIsntSetUpOnThisServer, "Live streaming isn't set up on this server", nil)
+		return
+	}
+	userID := requestUserID(r)
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	// viewers can open the live link, but the video isn't listed until
+	// the owner decides
+	if params.Visibility == "" {
+		params.Visibility = database.VisibilityUnlisted
+	}
+	if params.PartTarget == 0 {
+		params.PartTarget = defaultPartTarget
+	}
+	var errs []fieldError
+	if !utf8.ValidString(params.Label) || utf8.RuneCountInString(params.Label) > maxStreamKeyLabelLength {
+		errs = append(errs, fieldError{Field: "label", Message: fmt.Sprintf("must be at most %d characters", maxStreamKeyLabelLength)})
+	}
+	if !isValidVisibility(params.Visibility) {
+		errs = append(errs, fieldError{Field: "visibility", Message: "must be private, unlisted or public"})
+	}
+	if params.PartTarget < minPartTarget || params.PartTarget > maxPartTarget {
+		errs = append(errs, fieldError{Field: "part_target", Message: fmt.Sprintf("must be between %g and %g seconds", minPartTarget, maxPartTarget)})
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidStreamKey, "Invalid stream key", errs)
+		return
+	}
+
+	keys, err := cfg.db.GetStreamKeys(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetStreamKeys, "Couldn't get stream keys", err)
+		return
+	}
+	if len(keys) >= maxStreamKeysPerUser {
+		respondWithError(w, http.StatusConflict, codeTooManyStreamKeys, fmt.Sprintf("You can have at most %d stream keys", maxStreamKeysPerUser), nil)
+		return
+	}
+
+	secret, err := newStreamKey()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateStreamKey, "Couldn't create stream key", err)
+		return
+	}
+	key, err := cfg.db.CreateStreamKey(database.CreateStreamKeyParams{
+		UserID:     userID,
+		Key:        secret,
+		Label:      params.Label,
+		Visibility: params.Visibility,
+		LowLatency: params.LowLatency,
+		PartTarget: params.PartTarget,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateStreamKey, "Couldn't create stream key", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, cfg.streamKeyResponse(key))
+}
+
+// handlerStreamKeyRotate replaces a stream key, for when it leaked. A
+// broadcast already going on isn't cut off.
+func (cfg *apiConfig) handlerStreamKeyRotate(w http.ResponseWriter, r *http.Request) {
+	key, ok := cfg.ownedStreamKey(w, r)
+	if !ok {
+		return
+	}
+	secret, err := newStreamKey()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateStreamKey, "Couldn't create stream key", err)
+		return
+	}
+	if err := cfg.db.RotateStreamKey(key.ID, secret); err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRotateStreamKey, "Couldn't rotate stream key", err)
+		return
+	}
+	key, err = cfg.db.GetStreamKey(key.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetStreamKey, "Couldn't get stream key", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.streamKeyResponse(key))
+}
+
+// handlerStreamKeyDelete revokes a stream key. The videos broadcast to it
+// stay.
+func (cfg *apiConfig) handlerStreamKeyDelete(w http.ResponseWriter, r *http.Request) {
+	key, ok := cfg.ownedStreamKey(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.db.DeleteStreamKey(key.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDeleteStreamKey, "Couldn't delete stream key", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerTakedownSet is the admin side of the takedown workflow: flagging a
+// video for review, taking it down, and deciding on appeals.
+func (cfg *apiConfig) handlerTakedownSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if _, ok := takedownTransitions[params.Status]; !ok || params.Status == database.TakedownStatusAppealed {
+		respondWithError(w, http.StatusBadRequest, codeStatusMustBeFlaggedTakenDownReinstatedOrUpheld, "status must be flagged, taken_down, reinstated or upheld", nil)
+		return
+	}
+	if strings.TrimSpace(params.Reason) == "" && (params.Status == database.TakedownStatusFlagged || params.Status == database.TakedownStatusTakenDown) {
+		respondWithError(w, http.StatusBadRequest, codeAReasonIsRequired, "A reason is required", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+
+	takedown, ok, err := cfg.transitionTakedown(video, adminActor, params.Status, params.Reason, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateTakedown, "Couldn't update takedown", err)
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusConflict, codeInvalidTakedownTransition, fmt.Sprintf("Video can't be moved to %s from its current status", params.Status), nil)
+		return
+	}
+
+	// a decision settles every report about the video, flagging doesn't
+	if params.Status != database.TakedownStatusFlagged {
+		resolved, err := cfg.db.ResolveVideoReports(videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntResolveReports, "Couldn't resolve reports", err)
+			return
+		}
+		if resolved > 0 {
+			cfg.recordAudit(adminActor, "report.resolved", "video", videoID.String(), map[string]any{
+				"count": resolved,
+			})
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, takedown)
+}
+
+func (cfg *apiConfig) handlerTakedownGet(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.takedownVideo(w, r)
+	if !ok {
+		return
+	}
+
+	takedown, err := cfg.db.GetTakedown(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetTakedown, "Couldn't get takedown", err)
+		return
+	}
+	if takedown.Status == "" {
+		respondWithError(w, http.StatusNotFound, codeVideoHasNoTakedown, "Video has no takedown", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, takedown)
+}
+
+// handlerTakedownAppeal lets the owner of a taken down video contest it. An
+// admin then reinstates the video or upholds the takedown.
+func (cfg *apiConfig) handlerTakedownAppeal(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Statement string `json:"statement"`
+	}
+
+	video, ok := cfg.takedownVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	msg := validateDescription(params.Statement)
+	if msg == "" && strings.TrimSpace(params.Statement) == "" {
+		msg = "is required"
+	}
+	if msg != "" {
+		respondWithFieldErrors(w, codeInvalidAppeal, "Invalid appeal", []fieldError{{Field: "statement", Message: msg}})
+		return
+	}
+
+	takedown, ok, err := cfg.transitionTakedown(video, userActor(video.UserID), database.TakedownStatusAppealed, "", &params.Statement)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRecordAppeal, "Couldn't record appeal", err)
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusConflict, codeOnlyTakenDownVideosCanBeAppealed, "Only taken down videos can be appealed", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, takedown)
+}
+
+func (cfg *apiConfig) takedownVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	userID := requestUserID(r)
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, codeYouDontOwnThisVideo, "You don't own this video", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// handlerThumbnailFocusSet saves the point of the thumbnail that cropped
+// variants keep in view, as fractions of its width and height.
+func (cfg *apiConfig) handlerThumbnailFocusSet(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r, "change the thumbnail")
+	if !ok {
+		return
+	}
+	if video.ThumbnailURL == nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasNoThumbnail, "Video has no thumbnail", nil)
+		return
+	}
+
+	params := database.FocusPoint{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	var errs []fieldError
+	if params.X < 0 || params.X > 1 {
+		errs = append(errs, fieldError{Field: "x", Message: "must be between 0 and 1"})
+	}
+	if params.Y < 0 || params.Y > 1 {
+		errs = append(errs, fieldError{Field: "y", Message: "must be between 0 and 1"})
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidFocusPoint, "Invalid focus point", errs)
+		return
+	}
+
+	cfg.saveThumbnailFocus(w, video, &params)
+}
+
+// handlerThumbnailFocusDelete centers crops of the thumbnail again.
+func (cfg *apiConfig) handlerThumbnailFocusDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r, "change the thumbnail")
+	if !ok {
+		return
+	}
+	cfg.saveThumbnailFocus(w, video, nil)
+}
+
+func (cfg *apiConfig) saveThumbnailFocus(w http.ResponseWriter, video database.Video, focus *database.FocusPoint) {
+	err := cfg.db.SetThumbnailFocus(video, focus)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateVideoData, "Couldn't update video data", err)
+		return
+	}
+	video.ThumbnailFocus = focus
+
+	cfg.publishEvent(eventVideoThumbnailUpdated, video)
+
+	respondWithJSON(w, http.StatusOK, cfg.stampAssetURLs(video))
+}
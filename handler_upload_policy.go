@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+// browser uploads land under this prefix until they are completed
+const directUploadPrefix = "uploads/"
+
+// directUploadKeyPrefix is where the upload policy of videoID lets the
+// browser put its file.
+func directUploadKeyPrefix(videoID uuid.UUID) string {
+	return directUploadPrefix + videoID.String() + "/"
+}
+
+// handlerUploadPolicy signs an S3 POST policy for uploading the video's
+// file straight from a browser form, without going through the server or
+// needing the multipart upload API. S3 enforces the policy's conditions:
+// the key prefix, an MP4 content type and the size limit of the upload
+// endpoint. The upload is then completed with handlerUploadPolicyComplete.
+func (cfg *apiConfig) handlerUploadPolicy(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		URL       string            `json:"url"`
+		Fields    map[string]string `json:"fields"`
+		Key       string            `json:"key"`
+		MaxSize   int64             `json:"max_size"`
+		ExpiresAt time.Time         `json:"expires_at"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+	video, err := cfg.authorizeVideoAccess(videoID, requestUserID(r))
+	if err != nil {
+		respondWithVideoAccessError(w, err, "upload to this video")
+		return
+	}
+	if video.ExpiredAt != nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasExpired, "Video has expired", nil)
+		return
+	}
+
+	uploadID, err := makeRandomID()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeErrorCreatingUploadID, "Error creating upload ID", err)
+		return
+	}
+	prefix := directUploadKeyPrefix(videoID)
+	key := prefix + uploadID + ".mp4"
+	expiresAt := time.Now().Add(presignedURLExpiry).UTC()
+	req, err := s3.NewPresignClient(cfg.s3Client).PresignPostObject(r.Context(), &s3.PutObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	}, func(o *s3.PresignPostOptions) {
+		o.Expires = presignedURLExpiry
+		o.Conditions = []interface{}{
+			[]interface{}{"starts-with", "$key", prefix},
+			[]interface{}{"eq", "$Content-Type", "video/mp4"},
+			[]interface{}{"content-length-range", 1, maxVideoSize},
+		}
+	})
+	if err != nil {
+		respondWithStorageError(w, http.StatusInternalServerError, codeCouldntSignUploadPolicy, "Couldn't sign upload policy", err)
+		return
+	}
+	// the form has to send every field the policy checks
+	req.Values["Content-Type"] = "video/mp4"
+
+	respondWithJSON(w, http.StatusOK, response{
+		URL:       req.URL,
+		Fields:    req.Values,
+		Key:       key,
+		MaxSize:   maxVideoSize,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// handlerUploadPolicyComplete processes a file the browser uploaded with an
+// upload policy like one sent to handlerUploadVideo, then deletes it.
+func (cfg *apiConfig) handlerUploadPolicyComplete(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Key      string `json:"key"`
+		PresetID string `json:"preset_id"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+	userID := requestUserID(r)
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	// keys are only ever under the video's own prefix, and cleaned so ".."
+	// can't reach out of it
+	if !strings.HasPrefix(params.Key, directUploadKeyPrefix(videoID)) || path.Clean(params.Key) != params.Key {
+		respondWithFieldErrors(w, codeInvalidUpload, "Invalid upload", []fieldError{{Field: "key", Message: "must be the key of an upload to this video"}})
+		return
+	}
+
+	videoData, err := cfg.authorizeVideoAccess(videoID, userID)
+	if err != nil {
+		respondWithVideoAccessError(w, err, "upload to this video")
+		return
+	}
+	if videoData.ExpiredAt != nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasExpired, "Video has expired", nil)
+		return
+	}
+	preset, ok, err := cfg.uploadPreset(userID, params.PresetID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetUploadPreset, "Couldn't get upload preset", err)
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, codeUnknownUploadPreset, "Unknown upload preset", nil)
+		return
+	}
+
+	object, err := cfg.s3Client.GetObject(r.Context(), &s3.GetObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(params.Key),
+	})
+	if err != nil {
+		// NoSuchKey when the browser never finished the upload
+		respondWithStorageError(w, http.StatusInternalServerError, codeCouldntGetUpload, "Couldn't get upload", err)
+		return
+	}
+	defer object.Body.Close()
+	// the upload is processed into a new object either way
+	defer cfg.deleteDirectUpload(params.Key)
+
+	size := aws.ToInt64(object.ContentLength)
+	if size > maxVideoSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, codeFileSizeTooBig, "File size too big", nil)
+		return
+	}
+	release, err := cfg.tempStore.reserve(2 * size)
+	if err != nil {
+		respondWithError(w, http.StatusInsufficientStorage, codeNotEnoughTemporaryStorageToProcessUpload, "Not enough temporary storage to process upload", err)
+		return
+	}
+	defer release()
+
+	fmt.Println("completing browser upload", params.Key, "by user", userID)
+
+	original := videoData
+	profile := cfg.applyUploadPreset(&videoData.CreateVideoParams, preset)
+	hookEvent := uploadEvent{
+		Kind:        "video",
+		VideoID:     videoID,
+		UserID:      userID,
+		Title:       videoData.Title,
+		Filename:    path.Base(params.Key),
+		ContentType: "video/mp4",
+	}
+	buffered, err := cfg.bufferVideoUpload(http.MaxBytesReader(w, object.Body, maxVideoSize), size)
+	if err != nil {
+		respondWithVideoError(w, err)
+		return
+	}
+	defer buffered.cleanup()
+
+	hookEvent.Size = buffered.size
+	err = cfg.runPreUploadHooks(r.Context(), hookEvent)
+	if err != nil {
+		respondWithHookError(w, err)
+		return
+	}
+
+	if cfg.jobQueue != nil && profile == nil {
+		if preset != nil {
+			err = cfg.db.UpdateVideo(videoData)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateVideoData, "Couldn't update video data", err)
+				return
+			}
+		}
+		job, err := cfg.enqueueVideoJob(r.Context(), videoData, &buffered, "video/mp4", hookEvent.Filename)
+		if err != nil {
+			if preset != nil {
+				if err := cfg.db.UpdateVideo(original); err != nil {
+					log.Printf("Couldn't restore video %s after a failed upload: %v", videoID, err)
+				}
+			}
+			respondWithVideoError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusAccepted, job)
+		return
+	}
+
+	videoData, err = cfg.storeVideoUpload(r.Context(), videoData, buffered, "video/mp4", nil, profile)
+	if err != nil {
+		respondWithVideoError(w, err)
+		return
+	}
+
+	hookEvent.Size = *videoData.VideoSize
+	hookEvent.URL = *videoData.VideoURL
+	cfg.runPostUploadHooks(hookEvent)
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (cfg *apiConfig) deleteDirectUpload(key string) {
+	_, err := cfg.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete browser upload %s: %v", key, err)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxUploadPresetsPerUser = 50
+	maxPresetExpiry         = 10 * 365 * 24 * time.Hour
+)
+
+func validateUploadPreset(params database.UploadPresetParams) []fieldError {
+	var errs []fieldError
+	if msg := validateTitle(params.Name); msg != "" {
+		errs = append(errs, fieldError{Field: "name", Message: msg})
+	}
+	if params.Visibility != "" && !isValidVisibility(params.Visibility) {
+		errs = append(errs, fieldError{Field: "visibility", Message: "must be private, unlisted or public, or empty to keep the video's"})
+	}
+	if params.ExpiresInSeconds < 0 || params.ExpiresInSeconds > int64(maxPresetExpiry/time.Second) {
+		errs = append(errs, fieldError{Field: "expires_in_seconds", Message: fmt.Sprintf("must be between 0 and %d", int64(maxPresetExpiry/time.Second))})
+	}
+	if params.VideoCodec != "" {
+		errs = append(errs, validateEncodingProfile(params.EncodingProfile)...)
+	} else if params.MaxHeight != 0 || params.CRF != 0 {
+		errs = append(errs, fieldError{Field: "video_codec", Message: "is required to set max_height or crf"})
+	}
+	return errs
+}
+
+// uploadPreset loads the preset an upload's preset_id field names, nil when
+// it has none. It returns false for IDs that aren't one of userID's presets.
+func (cfg *apiConfig) uploadPreset(userID uuid.UUID, presetID string) (*database.UploadPreset, bool, error) {
+	if presetID == "" {
+		return nil, true, nil
+	}
+	id, err := uuid.Parse(presetID)
+	if err != nil {
+		return nil, false, nil
+	}
+	preset, err := cfg.db.GetUploadPreset(id)
+	if err != nil {
+		return nil, false, err
+	}
+	if preset.UserID != userID {
+		return nil, false, nil
+	}
+	return &preset, true, nil
+}
+
+// applyUploadPreset sets what preset configures on the video and returns
+// the encoding profile it asks for, nil when the folder's applies.
+func (cfg *apiConfig) applyUploadPreset(params *database.CreateVideoParams, preset *database.UploadPreset) *database.EncodingProfile {
+	if preset == nil {
+		return nil
+	}
+	if preset.Visibility != "" {
+		params.Visibility = preset.Visibility
+	}
+	if preset.ExpiresInSeconds > 0 {
+		expiresAt := cfg.clock.Now().Add(time.Duration(preset.ExpiresInSeconds) * time.Second)
+		params.ExpiresAt = &expiresAt
+	}
+	if preset.VideoCodec == "" {
+		return nil
+	}
+	return &preset.EncodingProfile
+}
+
+// ownedUploadPreset loads the preset the request's {presetID} names,
+// responding with an error and returning false unless the request's user
+// owns it.
+func (cfg *apiConfig) ownedUploadPreset(w http.ResponseWriter, r *http.Request) (database.UploadPreset, bool) {
+	presetID, err := uuid.Parse(r.PathValue("presetID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidPresetID, "Invalid preset ID", err)
+		return database.UploadPreset{}, false
+	}
+	userID := requestUserID(r)
+
+	preset, err := cfg.db.GetUploadPreset(presetID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetUploadPreset, "Couldn't get upload preset", err)
+		return database.UploadPreset{}, false
+	}
+	if preset.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeUploadPresetNotFound, "Upload preset not found", nil)
+		return database.UploadPreset{}, false
+	}
+	if preset.UserID != userID {
+		respondWithError(w, http.StatusForbidden, codeYouCantChangeThisUploadPreset, "You can't change this upload preset", nil)
+		return database.UploadPreset{}, false
+	}
+	return preset, true
+}
+
+func (cfg *apiConfig) handlerUploadPresetsList(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	presets, err := cfg.db.GetUploadPresets(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetUploadPresets, "Couldn't get upload presets", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, presets)
+}
+
+func (cfg *apiConfig) handlerUploadPresetCreate(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	params := database.UploadPresetParams{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if errs := validateUploadPreset(params); len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidUploadPreset, "Invalid upload preset", errs)
+		return
+	}
+
+	presets, err := cfg.db.GetUploadPresets(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetUploadPresets, "Couldn't get upload presets", err)
+		return
+	}
+	if len(presets) >= maxUploadPresetsPerUser {
+		respondWithError(w, http.StatusConflict, codeTooManyUploadPresets, fmt.Sprintf("You can have at most %d upload presets", maxUploadPresetsPerUser), nil)
+		return
+	}
+
+	preset, err := cfg.db.CreateUploadPreset(userID, params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateUploadPreset, "Couldn't create upload preset", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, preset)
+}
+
+func (cfg *apiConfig) handlerUploadPresetUpdate(w http.ResponseWriter, r *http.Request) {
+	preset, ok := cfg.ownedUploadPreset(w, r)
+	if !ok {
+		return
+	}
+
+	params := database.UploadPresetParams{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if errs := validateUploadPreset(params); len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidUploadPreset, "Invalid upload preset", errs)
+		return
+	}
+
+	err = cfg.db.UpdateUploadPreset(preset.ID, params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateUploadPreset, "Couldn't update upload preset", err)
+		return
+	}
+	preset.UploadPresetParams = params
+	respondWithJSON(w, http.StatusOK, preset)
+}
+
+func (cfg *apiConfig) handlerUploadPresetDelete(w http.ResponseWriter, r *http.Request) {
+	preset, ok := cfg.ownedUploadPreset(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeleteUploadPreset(preset.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDeleteUploadPreset, "Couldn't delete upload preset", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,15 +1,12 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"mime"
 	"net/http"
 	"os"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/google/uuid"
 )
 
@@ -19,111 +16,141 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		respondWithError(w, http.StatusBadRequest, codeInvalidID, "Invalid ID", err)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
+	userID := requestUserID(r)
 
-	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
+	fmt.Println("uploading thumbnail for video", videoID, "by user", userID, "from", clientIP(r))
 
+	r.Body = http.MaxBytesReader(w, cfg.uploads.track(r, "thumbnail", videoID, userID), maxMemory)
 	err = r.ParseMultipartForm(maxMemory)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "File size too big", err)
+		respondWithFormError(w, err)
 		return
 	}
+	// net/http only cleans up the form on the request it created, not on the
+	// copies middlewares pass down
+	registerRequestCleanup(r, func() { r.MultipartForm.RemoveAll() })
 
 	thumbnail, header, err := r.FormFile("thumbnail")
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "something went wrong retrieving the form data", err)
+		respondWithError(w, http.StatusBadRequest, codeMissingThumbnailFile, "Missing thumbnail file", err)
 		return
 	}
 	defer thumbnail.Close()
 
 	mediaType, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
 	if mediaType == "" {
-		respondWithError(w, http.StatusBadRequest, "Missing Content-Type for thumbnail", err)
+		respondWithError(w, http.StatusBadRequest, codeMissingContentTypeForThumbnail, "Missing Content-Type for thumbnail", err)
 		return
 	}
 
-	if mediaType != "image/jpeg" && mediaType != "image/png" {
-		respondWithError(w, http.StatusBadRequest, "wrong image type for thumbnail", err)
+	if !isThumbnailType(mediaType) {
+		respondWithError(w, http.StatusUnsupportedMediaType, codeWrongImageTypeForThumbnail, "wrong image type for thumbnail", err)
 		return
 	}
 
-	videoData, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Video not found", err)
+	// the old alt text described the old image
+	altText := r.FormValue("alt_text")
+	if msg := validateAltText(altText); msg != "" {
+		respondWithFieldErrors(w, codeInvalidThumbnail, "Invalid thumbnail", []fieldError{{Field: "alt_text", Message: msg}})
 		return
 	}
 
-	if videoData.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized for this video", err)
+	videoData, err := cfg.authorizeVideoAccess(videoID, userID)
+	if err != nil {
+		respondWithVideoAccessError(w, err, "change the thumbnail of this video")
+		return
+	}
+	if videoData.ExpiredAt != nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasExpired, "Video has expired", nil)
 		return
 	}
 
-	// creates a 32-byte slice to hold data
-	randBytes := make([]byte, 32)
-
-	// fills the byte slice with random bytes.
-	_, err = rand.Read(randBytes)
+	hookEvent := uploadEvent{
+		Kind:        "thumbnail",
+		VideoID:     videoID,
+		UserID:      userID,
+		Title:       videoData.Title,
+		Filename:    header.Filename,
+		ContentType: mediaType,
+		Size:        header.Size,
+	}
+	err = cfg.runPreUploadHooks(r.Context(), hookEvent)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error creating thumbnail random ID", err)
+		respondWithHookError(w, err)
 		return
 	}
 
-	// encode random bytes into a URL-safe base64 string
-	randomBase64String := base64.RawURLEncoding.EncodeToString(randBytes)
-	assetPath := getAssetPath(randomBase64String, mediaType)
-	assetDiskPath := cfg.getAssetDiskPath(assetPath)
-
-	dst, err := os.Create(assetDiskPath)
+	thumbnailURL, thumbnailSize, err := cfg.saveThumbnail(r, mediaType, thumbnail)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to create file", err)
+		respondWithError(w, http.StatusInternalServerError, codeErrorSavingFile, "Error saving file", err)
 		return
 	}
-	defer dst.Close()
 
-	_, err = io.Copy(dst, thumbnail)
+	original := videoData
+	videoData.ThumbnailURL = &thumbnailURL
+	videoData.ThumbnailSize = &thumbnailSize
+	videoData.ThumbnailFocus = nil
+	videoData.ThumbnailAltText = altText
+
+	err = cfg.db.UpdateVideo(videoData)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error saving file", err)
+		cfg.removeThumbnail(thumbnailURL)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateVideoData, "Couldn't update video data", err)
 		return
 	}
 
-	thumbnailURL := cfg.getAssetURL(assetPath)
+	cfg.retireThumbnail(original)
 
-	var oldThumbnail string
-	if videoData.ThumbnailURL != nil {
-		oldThumbnail = getAssetFromURL(*videoData.ThumbnailURL)
-	}
+	cfg.publishEvent(eventVideoThumbnailUpdated, videoData)
 
-	videoData.ThumbnailURL = &thumbnailURL
+	hookEvent.Size = thumbnailSize
+	hookEvent.URL = thumbnailURL
+	cfg.runPostUploadHooks(hookEvent)
 
-	err = cfg.db.UpdateVideo(videoData)
+	respondWithJSON(w, http.StatusOK, videoData)
+}
+
+func isThumbnailType(mediaType string) bool {
+	return mediaType == "image/jpeg" || mediaType == "image/png"
+}
+
+// saveThumbnail stores a thumbnail in the assets directory under a random
+// name and returns its URL and size.
+func (cfg *apiConfig) saveThumbnail(r *http.Request, mediaType string, src io.Reader) (string, int64, error) {
+	randomBase64String, err := makeRandomID()
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't update video data", err)
-		return
+		return "", 0, fmt.Errorf("couldn't create thumbnail random ID: %w", err)
+	}
+	assetPath := getAssetPath(randomBase64String, mediaType)
+	assetDiskPath := cfg.getAssetDiskPath(assetPath)
+
+	dst, err := createAssetFile(assetDiskPath)
+	if err != nil {
+		return "", 0, err
 	}
+	defer dst.Close()
 
-	// Only try to delete old thumbnail if there was one
-	if oldThumbnail != "" {
-		oldThumbnailPath := fmt.Sprintf("./assets/%s", oldThumbnail)
-		err = os.Remove(oldThumbnailPath)
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Error removing old thumbnail", err)
-			return
-		}
+	size, err := io.Copy(dst, src)
+	if err != nil {
+		os.Remove(assetDiskPath)
+		return "", 0, err
 	}
+	return cfg.getAssetURL(r, assetPath), size, nil
+}
 
-	respondWithJSON(w, http.StatusOK, videoData)
+// removeThumbnail deletes a thumbnail saveThumbnail stored. Thumbnails in
+// S3 and files that are already gone are left alone.
+func (cfg *apiConfig) removeThumbnail(thumbnailURL string) error {
+	if cfg.isS3ObjectURL(thumbnailURL) {
+		return nil
+	}
+	err := os.Remove(cfg.getAssetDiskPath(getAssetFromURL(thumbnailURL)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
 }
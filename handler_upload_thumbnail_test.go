@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHandlerUploadThumbnailRejections(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner := uuid.New()
+	video := createTestVideo(t, cfg, owner)
+	png := []byte("\x89PNG\r\n\x1a\n")
+
+	tests := []struct {
+		name        string
+		userID      uuid.UUID
+		videoID     string
+		field       string
+		contentType string
+		data        []byte
+		// a body that isn't a multipart form
+		notMultipart bool
+		wantStatus   int
+	}{
+		{name: "invalid video ID", userID: owner, videoID: "boots", field: "thumbnail", contentType: "image/png", data: png, wantStatus: http.StatusBadRequest},
+		{name: "unknown video", userID: owner, videoID: uuid.NewString(), field: "thumbnail", contentType: "image/png", data: png, wantStatus: http.StatusNotFound},
+		{name: "someone else's video", userID: uuid.New(), videoID: video.ID.String(), field: "thumbnail", contentType: "image/png", data: png, wantStatus: http.StatusForbidden},
+		{name: "not a form", userID: owner, videoID: video.ID.String(), notMultipart: true, wantStatus: http.StatusBadRequest},
+		{name: "no thumbnail part", userID: owner, videoID: video.ID.String(), field: "image", contentType: "image/png", data: png, wantStatus: http.StatusBadRequest},
+		{name: "not an image", userID: owner, videoID: video.ID.String(), field: "thumbnail", contentType: "image/gif", data: png, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "over the size limit", userID: owner, videoID: video.ID.String(), field: "thumbnail", contentType: "image/png", data: bytes.Repeat([]byte{0}, maxMemory+1), wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r *http.Request
+			if tt.notMultipart {
+				r = authedRequest(http.MethodPost, "/api/thumbnail_upload/"+tt.videoID, bytes.NewReader([]byte("boots")), tt.userID, tt.videoID)
+				r.Header.Set("Content-Type", "text/plain")
+			} else {
+				body, contentType := multipartBody(t, tt.field, "boots.png", tt.contentType, tt.data)
+				r = authedRequest(http.MethodPost, "/api/thumbnail_upload/"+tt.videoID, body, tt.userID, tt.videoID)
+				r.Header.Set("Content-Type", contentType)
+			}
+			w := httptest.NewRecorder()
+
+			cfg.handlerUploadThumbnail(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -3,223 +3,522 @@ package main
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math"
 	"mime"
 	"net/http"
 	"os"
-	"os/exec"
+	"strconv"
+	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
 // 1 GB
 const maxVideoSize = 1 << 30
 
-const (
-	Portrait  = "9:16"
-	Landscape = "16:9"
-)
-
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+	userID := requestUserID(r)
+
+	fmt.Println("uploading video", videoID, "by user", userID, "from", clientIP(r))
+
+	if !checkDeclaredSize(w, r, maxVideoSize) {
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	// the upload and its fast start copy both live in temp storage
+	uploadSize := r.ContentLength
+	if uploadSize <= 0 {
+		uploadSize = maxVideoSize
+	}
+	release, err := cfg.tempStore.reserve(2 * uploadSize)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusInsufficientStorage, codeNotEnoughTemporaryStorageToProcessUpload, "Not enough temporary storage to process upload", err)
 		return
 	}
+	defer release()
 
-	fmt.Println("uploading video", videoID, "by user", userID)
+	r.Body = newDeclaredSizeReader(r)
+	throttledBody := cfg.uploadThrottle.wrap(r.Context(), userID, cfg.uploads.track(r, "video", videoID, userID))
+	defer throttledBody.Close()
+	r.Body = http.MaxBytesReader(w, throttledBody, maxVideoSize)
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxVideoSize)
-	err = r.ParseMultipartForm(maxVideoSize)
+	videoData, err := cfg.authorizeVideoAccess(videoID, userID)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "File size too big", err)
+		respondWithVideoAccessError(w, err, "upload to this video")
 		return
 	}
-
-	videoData, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Video not found", err)
+	if videoData.ExpiredAt != nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasExpired, "Video has expired", nil)
 		return
 	}
 
-	if videoData.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized for this video", err)
+	encryptionKey, err := customerKeyFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidEncryptionKey, "Invalid encryption key", err)
 		return
 	}
 
-	file, header, err := r.FormFile("video")
+	// streamed rather than parsed up front, so oversized or padded forms
+	// can't pile up in memory
+	file, err := filePart(r, "video", maxVideoSize)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "something went wrong retrieving the form data", err)
+		respondWithError(w, http.StatusBadRequest, codeMissingVideoFile, "Missing video file", err)
 		return
 	}
-	defer file.Close()
 
-	mediaType, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	mediaType, _, _ := mime.ParseMediaType(file.ContentType())
 	if mediaType != "video/mp4" {
-		respondWithError(w, http.StatusBadRequest, "wrong content type for video", err)
+		respondWithError(w, http.StatusUnsupportedMediaType, codeWrongContentTypeForVideo, "wrong content type for video", err)
 		return
 	}
-
-	tempFile, err := os.CreateTemp("", "tubely-upload.mp4")
-
+	preset, ok, err := cfg.uploadPreset(userID, file.Field("preset_id"))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error creating file", err)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetUploadPreset, "Couldn't get upload preset", err)
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, codeUnknownUploadPreset, "Unknown upload preset", nil)
 		return
 	}
-	defer tempFile.Close()
-	defer os.Remove(tempFile.Name())
+	// a thumbnail sent before the video is stored along with it, so the
+	// new media is never shown without it
+	thumbnail, hasThumbnail := file.Attachment("thumbnail")
+	var thumbnailType string
+	if hasThumbnail {
+		thumbnailType, _, _ = mime.ParseMediaType(thumbnail.contentType)
+		if !isThumbnailType(thumbnailType) {
+			respondWithError(w, http.StatusUnsupportedMediaType, codeWrongImageTypeForThumbnail, "wrong image type for thumbnail", nil)
+			return
+		}
+		if msg := validateAltText(file.Field("thumbnail_alt_text")); msg != "" {
+			respondWithFieldErrors(w, codeInvalidThumbnail, "Invalid thumbnail", []fieldError{{Field: "thumbnail_alt_text", Message: msg}})
+			return
+		}
+	}
 
-	_, err = io.Copy(tempFile, file)
+	// restored if queueing fails after the video was already updated
+	original := videoData
+	profile := cfg.applyUploadPreset(&videoData.CreateVideoParams, preset)
+
+	hookEvent := uploadEvent{
+		Kind:        "video",
+		VideoID:     videoID,
+		UserID:      userID,
+		Title:       videoData.Title,
+		Filename:    file.FileName(),
+		ContentType: mediaType,
+	}
+	contents, err := verifiedUpload(r, file)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error copying file", err)
+		respondWithError(w, http.StatusBadRequest, codeInvalidChecksum, "Invalid checksum", err)
 		return
 	}
-
-	aspectRatio, err := getVideoAspectRatio(tempFile.Name())
+	buffered, err := cfg.bufferVideoUpload(contents, r.ContentLength)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to get aspect ratio of video", err)
+		respondWithVideoError(w, err)
 		return
 	}
+	defer buffered.cleanup()
 
-	fastStartVideoPath, err := processVideoForFastStart(tempFile.Name())
+	// the size is only known once the file has been received
+	hookEvent.Size = buffered.size
+	err = cfg.runPreUploadHooks(r.Context(), hookEvent)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error creating fast start video", err)
+		respondWithHookError(w, err)
 		return
 	}
 
-	processedFile, err := os.Open(fastStartVideoPath)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error opening processed file", err)
+	thumbnailEvent := uploadEvent{
+		Kind:        "thumbnail",
+		VideoID:     videoID,
+		UserID:      userID,
+		Title:       videoData.Title,
+		Filename:    thumbnail.filename,
+		ContentType: thumbnailType,
+		Size:        int64(len(thumbnail.data)),
+	}
+	thumbnailStored := false
+	if hasThumbnail {
+		err = cfg.runPreUploadHooks(r.Context(), thumbnailEvent)
+		if err != nil {
+			respondWithHookError(w, err)
+			return
+		}
+		thumbnailURL, thumbnailSize, err := cfg.saveThumbnail(r, thumbnailType, bytes.NewReader(thumbnail.data))
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeErrorSavingThumbnail, "Error saving thumbnail", err)
+			return
+		}
+		defer func() {
+			if !thumbnailStored {
+				cfg.removeThumbnail(thumbnailURL)
+			}
+		}()
+		videoData.ThumbnailURL = &thumbnailURL
+		videoData.ThumbnailSize = &thumbnailSize
+		videoData.ThumbnailFocus = nil
+		videoData.ThumbnailAltText = file.Field("thumbnail_alt_text")
+		thumbnailEvent.URL = thumbnailURL
+	}
+
+	// queued jobs are picked up without the key or the preset's encoding,
+	// such uploads are processed right away instead
+	if cfg.jobQueue != nil && encryptionKey == nil && profile == nil {
+		if preset != nil || hasThumbnail {
+			// the worker loads the video when it gets to the job
+			err = cfg.db.UpdateVideo(videoData)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateVideoData, "Couldn't update video data", err)
+				return
+			}
+		}
+		job, err := cfg.enqueueVideoJob(r.Context(), videoData, &buffered, mediaType, file.FileName())
+		if err != nil {
+			if preset != nil || hasThumbnail {
+				if err := cfg.db.UpdateVideo(original); err != nil {
+					log.Printf("Couldn't restore video %s after a failed upload: %v", videoID, err)
+				}
+			}
+			respondWithVideoError(w, err)
+			return
+		}
+		thumbnailStored = true
+		if hasThumbnail {
+			cfg.replacedThumbnail(videoData, original, thumbnailEvent)
+		}
+		respondWithJSON(w, http.StatusAccepted, job)
 		return
 	}
-	defer processedFile.Close()
-	defer os.Remove(processedFile.Name())
 
-	_, err = processedFile.Seek(0, io.SeekStart)
+	videoData, err = cfg.storeVideoUpload(r.Context(), videoData, buffered, mediaType, encryptionKey, profile)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error seeking to start of video", err)
+		respondWithVideoError(w, err)
 		return
 	}
+	thumbnailStored = true
+	if hasThumbnail {
+		cfg.replacedThumbnail(videoData, original, thumbnailEvent)
+	}
+
+	hookEvent.Size = *videoData.VideoSize
+	hookEvent.URL = *videoData.VideoURL
+	cfg.runPostUploadHooks(hookEvent)
+
+	w.WriteHeader(http.StatusCreated)
+}
 
-	// creates a 32-byte slice to hold data
-	randBytes := make([]byte, 32)
+// replacedThumbnail finishes storing a thumbnail sent with a video once the
+// video points at it, keeping the one original had in its history.
+func (cfg *apiConfig) replacedThumbnail(video, original database.Video, event uploadEvent) {
+	cfg.retireThumbnail(original)
+	cfg.publishEvent(eventVideoThumbnailUpdated, video)
+	cfg.runPostUploadHooks(event)
+}
 
-	// fills the byte slice with random bytes.
-	_, err = rand.Read(randBytes)
+// storeVideoUpload validates and transcodes a buffered upload into the next
+// version of video and points the video at it. A non-nil key stores it
+// encrypted, a nil profile encodes it like the video's folder says.
+func (cfg *apiConfig) storeVideoUpload(ctx context.Context, video database.Video, buffered bufferedVideo, contentType string, key *customerKey, profile *database.EncodingProfile) (database.Video, error) {
+	version, err := cfg.nextVideoVersion(video)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error creating video random ID", err)
-		return
+		return database.Video{}, fmt.Errorf("couldn't determine video version: %w", err)
+	}
+	if profile == nil {
+		profile, err = cfg.uploadEncoding(video)
+		if err != nil {
+			return database.Video{}, fmt.Errorf("couldn't get folder encoding profile: %w", err)
+		}
 	}
 
-	// encode random bytes into a URL-safe base64 string
-	randomBase64String := base64.RawURLEncoding.EncodeToString(randBytes)
-
-	aspect := "portrait"
-	if aspectRatio == Landscape {
-		aspect = "landscape"
+	transcoded, err := cfg.transcodeWhileValidating(ctx, transcodeJob{
+		videoID:       video.ID,
+		sourcePath:    buffered.path,
+		sourceSize:    buffered.size,
+		contentType:   contentType,
+		fastStart:     cfg.featureEnabled(flagVideoFastStart, video.UserID, true),
+		destKey:       videoObjectKey(buffered.aspect, video.ID, version),
+		encryptionKey: key,
+		profile:       profile,
+	}, &buffered, video.UserID)
+	if err != nil {
+		return database.Video{}, err
 	}
 
-	uploader := manager.NewUploader(cfg.s3Client)
-	result, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(cfg.s3Bucket),
-		Key:         aws.String(fmt.Sprintf("%s/%s", aspect, randomBase64String)),
-		Body:        processedFile,
-		ContentType: &mediaType,
+	videoURL := cfg.getS3ObjectURL(transcoded.key)
+	contentSHA256, objectETag := transcoded.checksums()
+	_, err = cfg.db.CreateVideoVersion(database.CreateVideoVersionParams{
+		VideoID:          video.ID,
+		Version:          version,
+		VideoURL:         videoURL,
+		VideoSize:        &transcoded.size,
+		EncryptionKeyMD5: key.keyMD5(),
+		ContentSHA256:    contentSHA256,
+		ObjectETag:       objectETag,
 	})
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't save video version: %w", err)
+	}
+	cfg.retainNewObject(ctx, video, transcoded.key)
+
+	video.VideoURL = &videoURL
+	video.VideoSize = &transcoded.size
+	video.EncryptionKeyMD5 = key.keyMD5()
+	video.ContentSHA256 = contentSHA256
+	video.ObjectETag = objectETag
+	video.DurationSeconds = &buffered.duration
+	// a frame of an encrypted video would be public
+	if key == nil {
+		cfg.addFrameThumbnail(&video, buffered.path)
+	}
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't update video data: %w", err)
+	}
+
+	cfg.publishEvent(eventVideoUploaded, video)
+	return video, nil
+}
 
+type bufferedVideo struct {
+	path     string
+	size     int64
+	aspect   string
+	duration float64
+	cleanup  func()
+}
+
+// bufferVideoUpload copies src to temp storage, rejects files that aren't
+// well-formed MP4s or have no playable duration with an invalidVideoError,
+// and probes the aspect ratio. The rest of the validation is left to
+// probeVideo.
+// The caller must call cleanup once the file has been transcoded.
+func (cfg *apiConfig) bufferVideoUpload(src io.Reader, sizeHint int64) (bufferedVideo, error) {
+	tempFile, err := cfg.tempStore.createTemp("tubely-upload.mp4")
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error uploading video to server", err)
-		return
+		return bufferedVideo{}, fmt.Errorf("couldn't create temp file: %w", err)
+	}
+	cleanup := func() {
+		// the file is about to be deleted, don't let it crowd the page cache
+		adviseDontNeed(tempFile)
+		tempFile.Close()
+		os.Remove(tempFile.Name())
 	}
 
-	videoData.VideoURL = &result.Location
+	// these are only hints, the upload works fine without them
+	if err := preallocateFile(tempFile, sizeHint); err != nil {
+		log.Printf("Couldn't preallocate temp file: %v", err)
+	}
+	if err := adviseSequential(tempFile); err != nil {
+		log.Printf("Couldn't set access hint on temp file: %v", err)
+	}
 
-	err = cfg.db.UpdateVideo(videoData)
+	size, err := io.Copy(tempFile, src)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't update video data", err)
-		return
+		cleanup()
+		return bufferedVideo{}, fmt.Errorf("couldn't copy upload to temp file: %w", err)
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	if err := validateMP4Structure(tempFile.Name()); err != nil {
+		cleanup()
+		return bufferedVideo{}, err
+	}
+
+	// the object key depends on the aspect ratio, so it is probed before
+	// the upload starts. Files ffprobe already shows to be empty are
+	// rejected here, the slower checks run alongside the upload.
+	probe, err := cfg.probeVideoFile(tempFile.Name())
+	if err != nil {
+		cleanup()
+		return bufferedVideo{}, err
+	}
+	if err := validateProbe(probe); err != nil {
+		cleanup()
+		return bufferedVideo{}, err
+	}
+
+	return bufferedVideo{
+		path:     tempFile.Name(),
+		size:     size,
+		aspect:   aspectClass(probe.aspectRatio),
+		duration: probe.duration,
+		cleanup:  cleanup,
+	}, nil
 }
 
-func getVideoAspectRatio(filePath string) (string, error) {
-	var stdout bytes.Buffer
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
-	cmd.Stdout = &stdout
+// videoProbe is what ffprobe tells about an upload before it is stored.
+type videoProbe struct {
+	aspectRatio string
+	duration    float64
+	// bits per second, -1 when ffprobe couldn't tell
+	bitRate int64
+}
 
-	err := cmd.Run()
+func (cfg *apiConfig) probeVideoFile(filePath string) (videoProbe, error) {
+	var stdout bytes.Buffer
+	err := cfg.commands.Run(context.Background(), &stdout, nil, "ffprobe", "-v", "error", "-print_format", "json", "-show_format", "-show_streams", filePath)
+	var exitErr *commandExitError
+	if errors.As(err, &exitErr) {
+		return videoProbe{}, invalidVideo("ffprobe can't read the file")
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to run ffprobe: %w", err)
+		return videoProbe{}, fmt.Errorf("failed to run ffprobe: %w", err)
 	}
+	return parseProbe(stdout.Bytes())
+}
 
+func parseProbe(ffprobeOutput []byte) (videoProbe, error) {
 	var result struct {
-		Streams []struct {
-			Width  int `json:"width"`
-			Height int `json:"height"`
-		}
+		Format struct {
+			Duration string `json:"duration"`
+			BitRate  string `json:"bit_rate"`
+		} `json:"format"`
+		Streams []ffprobeStream `json:"streams"`
+	}
+	if err := json.Unmarshal(ffprobeOutput, &result); err != nil {
+		return videoProbe{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
 	}
 
-	if err = json.Unmarshal(stdout.Bytes(), &result); err != nil {
-		return "", fmt.Errorf("failed to parse ffprobe output: %w", err)
+	aspectRatio, err := parseAspectRatio(result.Streams)
+	if err != nil {
+		return videoProbe{}, err
+	}
+	probe := videoProbe{aspectRatio: aspectRatio, bitRate: -1}
+	// a missing duration stays 0, which validation rejects
+	probe.duration, _ = strconv.ParseFloat(result.Format.Duration, 64)
+	if bitRate, err := strconv.ParseInt(result.Format.BitRate, 10, 64); err == nil {
+		probe.bitRate = bitRate
 	}
+	return probe, nil
+}
 
-	if len(result.Streams) == 0 {
-		return "", fmt.Errorf("no streamsa found in video")
+type ffprobeStream struct {
+	CodecType          string `json:"codec_type"`
+	Width              int    `json:"width"`
+	Height             int    `json:"height"`
+	SampleAspectRatio  string `json:"sample_aspect_ratio"`
+	DisplayAspectRatio string `json:"display_aspect_ratio"`
+	Disposition        struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+	// older ffmpeg reports rotation as a tag, newer as display matrix side
+	// data
+	Tags struct {
+		Rotate string `json:"rotate"`
+	} `json:"tags"`
+	SideDataList []struct {
+		Rotation float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// parseAspectRatio returns the simplified aspect ratio the first video
+// stream is displayed at. That is its display aspect ratio when set, which
+// covers anamorphic video with non-square pixels, turned by the rotation
+// players apply.
+func parseAspectRatio(streams []ffprobeStream) (string, error) {
+	for _, stream := range streams {
+		// cover art in audio files and MP4s is a video stream too
+		if stream.CodecType != "video" || stream.Disposition.AttachedPic == 1 {
+			continue
+		}
+		if stream.Width <= 0 || stream.Height <= 0 {
+			continue
+		}
+
+		width, height := stream.Width, stream.Height
+		if w, h, ok := parseRatio(stream.DisplayAspectRatio); ok {
+			width, height = w, h
+		} else if w, h, ok := parseRatio(stream.SampleAspectRatio); ok {
+			width, height = width*w, height*h
+		}
+		if quarterTurns(stream)%2 == 1 {
+			width, height = height, width
+		}
+
+		divisor := gcd(width, height)
+		return fmt.Sprintf("%d:%d", width/divisor, height/divisor), nil
 	}
 
-	// Find the first video stream with width and height
-	for _, stream := range result.Streams {
-		if stream.Width > 0 && stream.Height > 0 {
-			// Calculate greatest common divisor to simplify the ratio
-			gcd := func(a, b int) int {
-				for b != 0 {
-					a, b = b, a%b
-				}
-				return a
-			}
+	return "", invalidVideo("the file has no video stream")
+}
 
-			divisor := gcd(stream.Width, stream.Height)
-			calcWidth := stream.Width / divisor
-			calcHeight := stream.Height / divisor
+// parseRatio parses ffprobe's "16:9" form. Unknown ratios come out as
+// "0:1" or "N/A" and are reported as not ok.
+func parseRatio(s string) (int, int, bool) {
+	a, b, found := strings.Cut(s, ":")
+	if !found {
+		return 0, 0, false
+	}
+	x, err := strconv.Atoi(a)
+	if err != nil || x <= 0 {
+		return 0, 0, false
+	}
+	y, err := strconv.Atoi(b)
+	if err != nil || y <= 0 {
+		return 0, 0, false
+	}
+	return x, y, true
+}
 
-			return fmt.Sprintf("%d:%d", calcWidth, calcHeight), nil
+// quarterTurns returns how many times 90 degrees the stream is rotated for
+// display, between 0 and 3.
+func quarterTurns(stream ffprobeStream) int {
+	rotation := 0.0
+	if r, err := strconv.ParseFloat(stream.Tags.Rotate, 64); err == nil {
+		rotation = r
+	}
+	for _, side := range stream.SideDataList {
+		if side.Rotation != 0 {
+			rotation = side.Rotation
 		}
 	}
+	turns := int(math.Round(rotation/90)) % 4
+	if turns < 0 {
+		turns += 4
+	}
+	return turns
+}
+
+// aspectClass buckets a simplified aspect ratio into the prefix videos are
+// stored under. Anything wider than tall is landscape, so 4:3 and 21:9
+// sources aren't filed as portrait.
+func aspectClass(aspectRatio string) string {
+	width, height, ok := parseRatio(aspectRatio)
+	switch {
+	case !ok || width == height:
+		return "other"
+	case width > height:
+		return "landscape"
+	}
+	return "portrait"
+}
 
-	return "", fmt.Errorf("no video stream with valid dimensions found")
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
 }
 
-func processVideoForFastStart(filePath string) (string, error) {
+func processVideoForFastStart(ctx context.Context, commands commandRunner, filePath string) (string, error) {
 	outputPath := filePath + ".processing"
 
-	var stdout bytes.Buffer
-	cmd := exec.Command("ffmpeg", "-i", filePath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", outputPath)
-	cmd.Stdout = &stdout
-
-	err := cmd.Run()
+	err := commands.Run(ctx, nil, nil, "ffmpeg", "-i", filePath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", outputPath)
 	if err != nil {
+		// a cancelled run leaves a partial file behind
+		os.Remove(outputPath)
 		return "", fmt.Errorf("failed to run ffmeg command on file: %w", err)
 	}
 
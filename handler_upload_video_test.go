@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// newTestConfig returns a config with a fresh database and temp storage,
+// enough for the handlers to get as far as rejecting a request.
+func newTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+	db, err := database.NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	tempStore, err := newTempStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &apiConfig{
+		db:             db,
+		assetsRoot:     t.TempDir(),
+		tempStore:      tempStore,
+		uploadThrottle: newUploadThrottle(0, 0),
+		uploads:        newUploadTracker(),
+		commands:       &fakeCommands{},
+		clock:          systemClock{},
+	}
+}
+
+// createTestVideo stores a video owned by userID.
+func createTestVideo(t *testing.T, cfg *apiConfig, userID uuid.UUID) database.Video {
+	t.Helper()
+	video, err := cfg.db.CreateVideo(database.CreateVideoParams{Title: "Boots", UserID: userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return video
+}
+
+// authedRequest is a request the auth middleware let through for userID,
+// with {videoID} set to videoID.
+func authedRequest(method, target string, body io.Reader, userID uuid.UUID, videoID string) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	r = r.WithContext(context.WithValue(r.Context(), userIDKey{}, userID))
+	r.SetPathValue("videoID", videoID)
+	return r
+}
+
+// multipartBody is a form with a single file part of contentType.
+func multipartBody(t *testing.T, field, filename, contentType string, data []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="`+field+`"; filename="`+filename+`"`)
+	header.Set("Content-Type", contentType)
+	pw, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, mw.FormDataContentType()
+}
+
+// fakeCommands stands in for ffmpeg and ffprobe, answering every command
+// with the same output and error.
+type fakeCommands struct {
+	stdout []byte
+	err    error
+	// the commands that were run, by name
+	ran []string
+}
+
+func (f *fakeCommands) Run(ctx context.Context, stdout, stderr io.Writer, name string, args ...string) error {
+	f.ran = append(f.ran, name)
+	if stdout != nil {
+		if _, err := stdout.Write(f.stdout); err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+// ffprobeFixture returns ffprobe output recorded from a real file, kept in
+// testdata/ffprobe.
+func ffprobeFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "ffprobe", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestProbeVideoFile(t *testing.T) {
+	tests := []struct {
+		fixture         string
+		wantAspectRatio string
+		wantAspect      string
+		wantDuration    float64
+		wantBitRate     int64
+		wantInvalid     bool
+	}{
+		{fixture: "landscape", wantAspectRatio: "16:9", wantAspect: "landscape", wantDuration: 12.501333, wantBitRate: 4953321},
+		{fixture: "portrait", wantAspectRatio: "9:16", wantAspect: "portrait", wantDuration: 8.011338, wantBitRate: 6139606},
+		{fixture: "square", wantAspectRatio: "1:1", wantAspect: "other", wantDuration: 15.04, wantBitRate: 2873516},
+		// phones store the sensor's landscape frame and a rotation
+		{fixture: "rotated_tag", wantAspectRatio: "9:16", wantAspect: "portrait", wantDuration: 4.266667, wantBitRate: 16898146},
+		{fixture: "rotated_matrix", wantAspectRatio: "9:16", wantAspect: "portrait", wantDuration: 3.016667, wantBitRate: 48318870},
+		// non-square pixels, the display aspect ratio wins over the frame
+		{fixture: "anamorphic", wantAspectRatio: "16:9", wantAspect: "landscape", wantDuration: 60, wantBitRate: 6000000},
+		// no display aspect ratio, derived from the sample aspect ratio
+		{fixture: "anamorphic_sar", wantAspectRatio: "16:9", wantAspect: "landscape", wantDuration: 20.02, wantBitRate: -1},
+		// the first video stream counts, audio and subtitles are skipped
+		{fixture: "multi_stream", wantAspectRatio: "16:9", wantAspect: "landscape", wantDuration: 30, wantBitRate: 6000000},
+		// cover art isn't the video
+		{fixture: "attached_pic", wantAspectRatio: "4:5", wantAspect: "portrait", wantDuration: 9.9, wantBitRate: 3200000},
+		{fixture: "audio_only", wantInvalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			commands := &fakeCommands{stdout: ffprobeFixture(t, tt.fixture)}
+			cfg := &apiConfig{commands: commands}
+
+			probe, err := cfg.probeVideoFile("upload.mp4")
+			if len(commands.ran) != 1 || commands.ran[0] != "ffprobe" {
+				t.Fatalf("ran %v, want ffprobe", commands.ran)
+			}
+			if tt.wantInvalid {
+				var invalid *invalidVideoError
+				if !errors.As(err, &invalid) {
+					t.Fatalf("got error %v, want an invalid video", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if probe.aspectRatio != tt.wantAspectRatio {
+				t.Errorf("aspect ratio = %q, want %q", probe.aspectRatio, tt.wantAspectRatio)
+			}
+			if aspect := aspectClass(probe.aspectRatio); aspect != tt.wantAspect {
+				t.Errorf("aspect class = %q, want %q", aspect, tt.wantAspect)
+			}
+			if probe.duration != tt.wantDuration {
+				t.Errorf("duration = %v, want %v", probe.duration, tt.wantDuration)
+			}
+			if probe.bitRate != tt.wantBitRate {
+				t.Errorf("bit rate = %d, want %d", probe.bitRate, tt.wantBitRate)
+			}
+		})
+	}
+}
+
+func TestProbeVideoFileErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		commands    *fakeCommands
+		wantInvalid bool
+	}{
+		{
+			name:        "ffprobe rejects the file",
+			commands:    &fakeCommands{err: &commandExitError{err: errors.New("exit status 1")}},
+			wantInvalid: true,
+		},
+		{
+			// the server's fault, not the uploader's
+			name:     "ffprobe isn't installed",
+			commands: &fakeCommands{err: errors.New(`exec: "ffprobe": executable file not found in $PATH`)},
+		},
+		{
+			name:     "unparsable output",
+			commands: &fakeCommands{stdout: []byte("Input #0, mov,mp4")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{commands: tt.commands}
+			_, err := cfg.probeVideoFile("upload.mp4")
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			var invalid *invalidVideoError
+			if errors.As(err, &invalid) != tt.wantInvalid {
+				t.Errorf("got error %v, want invalid video %t", err, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestQuarterTurns(t *testing.T) {
+	tests := []struct {
+		rotate       string
+		sideRotation float64
+		want         int
+	}{
+		{want: 0},
+		{rotate: "90", want: 1},
+		{rotate: "180", want: 2},
+		{rotate: "270", want: 3},
+		{sideRotation: -90, want: 3},
+		{sideRotation: 90, want: 1},
+		{sideRotation: -180, want: 2},
+		// the display matrix is what newer ffmpeg applies
+		{rotate: "90", sideRotation: -90, want: 3},
+	}
+
+	for _, tt := range tests {
+		var stream ffprobeStream
+		stream.Tags.Rotate = tt.rotate
+		if tt.sideRotation != 0 {
+			stream.SideDataList = append(stream.SideDataList, struct {
+				Rotation float64 `json:"rotation"`
+			}{Rotation: tt.sideRotation})
+		}
+		if got := quarterTurns(stream); got != tt.want {
+			t.Errorf("quarterTurns(rotate %q, side data %v) = %d, want %d", tt.rotate, tt.sideRotation, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerUploadVideoRejections(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner := uuid.New()
+	video := createTestVideo(t, cfg, owner)
+
+	tests := []struct {
+		name        string
+		userID      uuid.UUID
+		videoID     string
+		field       string
+		contentType string
+		// a body that isn't a multipart form
+		notMultipart bool
+		// Content-Length claimed by the client
+		declaredSize int64
+		wantStatus   int
+	}{
+		{name: "invalid video ID", userID: owner, videoID: "boots", field: "video", contentType: "video/mp4", wantStatus: http.StatusBadRequest},
+		{name: "unknown video", userID: owner, videoID: uuid.NewString(), field: "video", contentType: "video/mp4", wantStatus: http.StatusNotFound},
+		{name: "someone else's video", userID: uuid.New(), videoID: video.ID.String(), field: "video", contentType: "video/mp4", wantStatus: http.StatusForbidden},
+		{name: "declared size over the limit", userID: owner, videoID: video.ID.String(), field: "video", contentType: "video/mp4", declaredSize: maxVideoSize + 1, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "not a form", userID: owner, videoID: video.ID.String(), notMultipart: true, wantStatus: http.StatusBadRequest},
+		{name: "no video part", userID: owner, videoID: video.ID.String(), field: "thumbnail", contentType: "image/png", wantStatus: http.StatusBadRequest},
+		{name: "not an MP4", userID: owner, videoID: video.ID.String(), field: "video", contentType: "video/quicktime", wantStatus: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r *http.Request
+			if tt.notMultipart {
+				r = authedRequest(http.MethodPost, "/api/video_upload/"+tt.videoID, bytes.NewReader([]byte("boots")), tt.userID, tt.videoID)
+				r.Header.Set("Content-Type", "text/plain")
+			} else {
+				body, contentType := multipartBody(t, tt.field, "boots.mp4", tt.contentType, []byte("not really a video"))
+				r = authedRequest(http.MethodPost, "/api/video_upload/"+tt.videoID, body, tt.userID, tt.videoID)
+				r.Header.Set("Content-Type", contentType)
+			}
+			if tt.declaredSize != 0 {
+				r.ContentLength = tt.declaredSize
+			}
+			w := httptest.NewRecorder()
+
+			cfg.handlerUploadVideo(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
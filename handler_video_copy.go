@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerVideoCopy(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	// the body is optional, it only overrides the copied metadata
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if errs := validateVideoMeta(params.Title, params.Description); len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidVideoMetadata, "Invalid video metadata", errs)
+		return
+	}
+
+	source, err := cfg.db.GetVideo(videoID)
+	if err != nil || source.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	if source.UserID != userID {
+		respondWithError(w, http.StatusForbidden, codeYouCantCopyThisVideo, "You can't copy this video", nil)
+		return
+	}
+	// a copy is a new ID the takedown and expiry don't cover
+	if cfg.isTakenDown(source.ID) {
+		respondWithError(w, http.StatusUnavailableForLegalReasons, codeThisVideoHasBeenTakenDown, "This video has been taken down", nil)
+		return
+	}
+	if source.ExpiredAt != nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasExpired, "Video has expired", nil)
+		return
+	}
+
+	// S3 can only copy encrypted media by decrypting it with the key
+	encryptionKey, err := customerKeyFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidEncryptionKey, "Invalid encryption key", err)
+		return
+	}
+	if source.VideoURL != nil {
+		if err := checkVideoKey(source, encryptionKey); err != nil {
+			respondWithError(w, http.StatusForbidden, codeCopyingNeedsTheVideosEncryptionKey, "Copying needs the video's encryption key", err)
+			return
+		}
+	}
+
+	createParams := source.CreateVideoParams
+	if params.Title != nil {
+		createParams.Title = *params.Title
+	}
+	if params.Description != nil {
+		createParams.Description = *params.Description
+	}
+
+	video, err := cfg.db.CreateVideo(createParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateVideo, "Couldn't create video", err)
+		return
+	}
+
+	if source.VideoURL != nil {
+		videoURL, objectETag, err := cfg.copyS3Object(r.Context(), *source.VideoURL, video.ID, encryptionKey)
+		if err != nil {
+			cfg.db.DeleteVideo(video.ID)
+			respondWithStorageError(w, http.StatusInternalServerError, codeCouldntCopyVideoFile, "Couldn't copy video file", err)
+			return
+		}
+		_, err = cfg.db.CreateVideoVersion(database.CreateVideoVersionParams{
+			VideoID:          video.ID,
+			Version:          1,
+			VideoURL:         videoURL,
+			VideoSize:        source.VideoSize,
+			EncryptionKeyMD5: source.EncryptionKeyMD5,
+			ContentSHA256:    source.ContentSHA256,
+			ObjectETag:       objectETag,
+		})
+		if err != nil {
+			cfg.db.DeleteVideo(video.ID)
+			respondWithError(w, http.StatusInternalServerError, codeCouldntSaveVideoVersion, "Couldn't save video version", err)
+			return
+		}
+		video.VideoURL = &videoURL
+		video.VideoSize = source.VideoSize
+		video.EncryptionKeyMD5 = source.EncryptionKeyMD5
+		video.ContentSHA256 = source.ContentSHA256
+		video.ObjectETag = objectETag
+	}
+
+	if source.ThumbnailURL != nil {
+		thumbnailURL, err := cfg.copyLocalAsset(r, *source.ThumbnailURL)
+		if err != nil {
+			cfg.db.DeleteVideo(video.ID)
+			respondWithError(w, http.StatusInternalServerError, codeCouldntCopyThumbnail, "Couldn't copy thumbnail", err)
+			return
+		}
+		video.ThumbnailURL = &thumbnailURL
+		video.ThumbnailSize = source.ThumbnailSize
+		video.ThumbnailFocus = source.ThumbnailFocus
+		video.ThumbnailAltText = source.ThumbnailAltText
+	}
+
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateVideoData, "Couldn't update video data", err)
+		return
+	}
+
+	cfg.publishEvent(eventVideoCreated, video)
+
+	respondWithJSON(w, http.StatusCreated, withPlaceholderThumbnail(video))
+}
+
+// copyS3Object duplicates a video object server-side as the first version of
+// videoID and returns its URL and ETag. Encrypted objects keep their key.
+func (cfg *apiConfig) copyS3Object(ctx context.Context, objectURL string, videoID uuid.UUID, encryptionKey *customerKey) (string, *string, error) {
+	sourceKey, err := cfg.getS3KeyFromURL(objectURL)
+	if err != nil {
+		return "", nil, err
+	}
+	key := videoObjectKey(getAspectFromKey(sourceKey), videoID, 1)
+
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(cfg.s3Bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(fmt.Sprintf("%s/%s", cfg.s3Bucket, sourceKey)),
+		ChecksumAlgorithm: s3types.ChecksumAlgorithmSha256,
+	}
+	encryptionKey.applyToCopy(input)
+	out, err := cfg.s3Client.CopyObject(ctx, input)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var etag *string
+	if out.CopyObjectResult != nil {
+		etag = out.CopyObjectResult.ETag
+	}
+	return cfg.getS3ObjectURL(key), etag, nil
+}
+
+func (cfg *apiConfig) copyLocalAsset(r *http.Request, assetURL string) (string, error) {
+	sourcePath := cfg.getAssetDiskPath(getAssetFromURL(assetURL))
+
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	randomID, err := makeRandomID()
+	if err != nil {
+		return "", err
+	}
+	assetPath := randomID + filepath.Ext(sourcePath)
+
+	dst, err := createAssetFile(cfg.getAssetDiskPath(assetPath))
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		return "", err
+	}
+
+	return cfg.getAssetURL(r, assetPath), nil
+}
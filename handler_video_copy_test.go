@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideoCopyRejections(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner := uuid.New()
+
+	takenDown := createTestVideo(t, cfg, owner)
+	ok, err := cfg.db.SetTakedownStatus(takenDown.ID, []string{""}, database.TakedownStatusTakenDown, "copyright", nil)
+	if err != nil || !ok {
+		t.Fatalf("couldn't take down video: %v", err)
+	}
+	expired := createTestVideo(t, cfg, owner)
+	if err := cfg.db.MarkVideoExpired(expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	other := createTestVideo(t, cfg, uuid.New())
+
+	tests := []struct {
+		name       string
+		videoID    uuid.UUID
+		wantStatus int
+	}{
+		{name: "taken down", videoID: takenDown.ID, wantStatus: http.StatusUnavailableForLegalReasons},
+		{name: "expired", videoID: expired.ID, wantStatus: http.StatusConflict},
+		{name: "someone else's video", videoID: other.ID, wantStatus: http.StatusForbidden},
+		{name: "unknown video", videoID: uuid.New(), wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := authedRequest(http.MethodPost, "/api/videos/"+tt.videoID.String()+"/copy", http.NoBody, owner, tt.videoID.String())
+			w := httptest.NewRecorder()
+
+			cfg.handlerVideoCopy(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+
+	videos, err := cfg.db.GetVideos(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(videos) != 2 {
+		t.Errorf("owner has %d videos after the rejected copies, want 2", len(videos))
+	}
+}
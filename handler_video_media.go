@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+)
+
+// handlerVideoMediaReplace swaps the file behind a video while keeping its
+// URL, so existing embeds keep working. The replacement is staged under a
+// temporary key and copied over the live object in a single S3 operation.
+func (cfg *apiConfig) handlerVideoMediaReplace(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	userID := requestUserID(r)
+	if !checkDeclaredSize(w, r, maxVideoSize) {
+		return
+	}
+
+	video, err := cfg.authorizeVideoAccess(videoID, userID)
+	if err != nil {
+		respondWithVideoAccessError(w, err, "replace this video")
+		return
+	}
+	if video.ExpiredAt != nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasExpired, "Video has expired", nil)
+		return
+	}
+	// replacing overwrites the stored object in place
+	if cfg.isRetained(video) {
+		respondWithError(w, http.StatusLocked, codeVideoIsUnderARetentionLock, "Video is under a retention lock", nil)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasNoMediaToReplaceUploadItInstead, "Video has no media to replace, upload it instead", nil)
+		return
+	}
+
+	// the replacement takes over the object, and with it the key the
+	// video's versions record
+	encryptionKey, err := customerKeyFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidEncryptionKey, "Invalid encryption key", err)
+		return
+	}
+	if err := checkVideoKey(video, encryptionKey); err != nil {
+		respondWithError(w, http.StatusForbidden, codeReplacementsMustUseTheVideosEncryptionKey, "Replacements must use the video's encryption key", err)
+		return
+	}
+
+	key, err := cfg.getS3KeyFromURL(*video.VideoURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDetermineVideoObjectKey, "Couldn't determine video object key", err)
+		return
+	}
+
+	uploadSize := r.ContentLength
+	if uploadSize <= 0 {
+		uploadSize = maxVideoSize
+	}
+	release, err := cfg.tempStore.reserve(2 * uploadSize)
+	if err != nil {
+		respondWithError(w, http.StatusInsufficientStorage, codeNotEnoughTemporaryStorageToProcessUpload, "Not enough temporary storage to process upload", err)
+		return
+	}
+	defer release()
+
+	r.Body = newDeclaredSizeReader(r)
+	throttledBody := cfg.uploadThrottle.wrap(r.Context(), userID, cfg.uploads.track(r, "replacement", videoID, userID))
+	defer throttledBody.Close()
+	r.Body = http.MaxBytesReader(w, throttledBody, maxVideoSize)
+
+	// streamed rather than parsed up front, so oversized or padded forms
+	// can't pile up in memory
+	file, err := filePart(r, "video", maxVideoSize)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeMissingVideoFile, "Missing video file", err)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(file.ContentType())
+	if mediaType != "video/mp4" {
+		respondWithError(w, http.StatusUnsupportedMediaType, codeWrongContentTypeForVideo, "wrong content type for video", nil)
+		return
+	}
+
+	hookEvent := uploadEvent{
+		Kind:        "video",
+		VideoID:     videoID,
+		UserID:      userID,
+		Title:       video.Title,
+		Filename:    file.FileName(),
+		ContentType: mediaType,
+	}
+	contents, err := verifiedUpload(r, file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidChecksum, "Invalid checksum", err)
+		return
+	}
+	buffered, err := cfg.bufferVideoUpload(contents, r.ContentLength)
+	if err != nil {
+		respondWithVideoError(w, err)
+		return
+	}
+	defer buffered.cleanup()
+	// the object keeps its key, and with it the aspect prefix embeds size
+	// the player by
+	if buffered.aspect != getAspectFromKey(key) {
+		respondWithError(w, http.StatusConflict, codeReplacementShapeChanged, "Replacement has a different shape than the video, upload it as a new version instead", nil)
+		return
+	}
+
+	// the size is only known once the file has been received
+	hookEvent.Size = buffered.size
+	err = cfg.runPreUploadHooks(r.Context(), hookEvent)
+	if err != nil {
+		respondWithHookError(w, err)
+		return
+	}
+
+	stagingID, err := makeRandomID()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeErrorCreatingStagingID, "Error creating staging ID", err)
+		return
+	}
+	profile, err := cfg.uploadEncoding(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetFolderEncodingProfile, "Couldn't get folder encoding profile", err)
+		return
+	}
+
+	transcoded, err := cfg.transcodeWhileValidating(r.Context(), transcodeJob{
+		videoID:       videoID,
+		sourcePath:    buffered.path,
+		sourceSize:    buffered.size,
+		contentType:   mediaType,
+		fastStart:     cfg.featureEnabled(flagVideoFastStart, userID, true),
+		destKey:       fmt.Sprintf("staging/%s", stagingID),
+		encryptionKey: encryptionKey,
+		profile:       profile,
+	}, &buffered, userID)
+	if err != nil {
+		respondWithVideoError(w, err)
+		return
+	}
+	stagingKey := transcoded.key
+	defer func() {
+		_, err := cfg.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String(cfg.s3Bucket),
+			Key:    aws.String(stagingKey),
+		})
+		if err != nil {
+			log.Printf("Couldn't delete staging object %s: %v", stagingKey, err)
+		}
+	}()
+
+	// readers see either the old or the new object, never a partial one
+	copyInput := &s3.CopyObjectInput{
+		Bucket:            aws.String(cfg.s3Bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(fmt.Sprintf("%s/%s", cfg.s3Bucket, stagingKey)),
+		ChecksumAlgorithm: s3types.ChecksumAlgorithmSha256,
+	}
+	encryptionKey.applyToCopy(copyInput)
+	copied, err := cfg.s3Client.CopyObject(r.Context(), copyInput)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeErrorReplacingVideo, "Error replacing video", err)
+		return
+	}
+
+	// the copy is a new object with an ETag of its own
+	transcoded.etag = ""
+	if copied.CopyObjectResult != nil {
+		transcoded.etag = aws.ToString(copied.CopyObjectResult.ETag)
+	}
+	contentSHA256, objectETag := transcoded.checksums()
+
+	// also bumps updated_at so clients know the media changed
+	video.VideoSize = &transcoded.size
+	video.DurationSeconds = &buffered.duration
+	video.ContentSHA256 = contentSHA256
+	video.ObjectETag = objectETag
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateVideoData, "Couldn't update video data", err)
+		return
+	}
+	err = cfg.db.UpdateVideoVersionMedia(videoID, *video.VideoURL, video.VideoSize, contentSHA256, objectETag)
+	if err != nil {
+		log.Printf("Couldn't update versions of video %s: %v", videoID, err)
+	}
+
+	video, err = cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+
+	cfg.publishEvent(eventVideoUploaded, video)
+
+	hookEvent.Size = transcoded.size
+	hookEvent.URL = *video.VideoURL
+	cfg.runPostUploadHooks(hookEvent)
+
+	respondWithJSON(w, http.StatusOK, withPlaceholderThumbnail(video))
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
@@ -14,70 +16,203 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		database.CreateVideoParams
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	userID := requestUserID(r)
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	params.UserID = userID
+
+	errs := validateVideoMeta(&params.Title, &params.Description)
+	if params.ExpiresAt != nil && !params.ExpiresAt.After(cfg.clock.Now()) {
+		errs = append(errs, fieldError{Field: "expires_at", Message: "must be in the future"})
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidVideoMetadata, "Invalid video metadata", errs)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if params.Visibility != "" && !isValidVisibility(params.Visibility) {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVisibility, "Invalid visibility", nil)
+		return
+	}
+
+	if params.FolderID != nil {
+		settings, ok, err := cfg.folderSettings(userID, *params.FolderID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntGetFolder, "Couldn't get folder", err)
+			return
+		}
+		if !ok {
+			respondWithFieldErrors(w, codeInvalidVideoMetadata, "Invalid video metadata", []fieldError{{Field: "folder_id", Message: "must be one of your folders"}})
+			return
+		}
+		// a visibility sent with the video overrides the folder's
+		if params.Visibility == "" {
+			params.Visibility = settings.DefaultVisibility
+		}
+	}
+
+	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateVideo, "Couldn't create video", err)
 		return
 	}
 
+	cfg.publishEvent(eventVideoCreated, video)
+
+	respondWithJSON(w, http.StatusCreated, videoWithWarnings{
+		Video:    withPlaceholderThumbnail(video),
+		Warnings: cfg.duplicateTitleWarnings(video),
+	})
+}
+
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Visibility  *string `json:"visibility"`
+		Slug        *string `json:"slug"`
+		// an empty string removes the expiry
+		ExpiresAt        *string `json:"expires_at"`
+		ThumbnailAltText *string `json:"thumbnail_alt_text"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidID, "Invalid ID", err)
+		return
+	}
+
+	userID := requestUserID(r)
+
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	err = decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	errs := validateVideoMeta(params.Title, params.Description)
+	// an empty slug removes it
+	if params.Slug != nil && *params.Slug != "" {
+		if msg := validateSlug(*params.Slug); msg != "" {
+			errs = append(errs, fieldError{Field: "slug", Message: msg})
+		}
+	}
+	var expiresAt *time.Time
+	if params.ExpiresAt != nil && *params.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, *params.ExpiresAt)
+		if err != nil {
+			errs = append(errs, fieldError{Field: "expires_at", Message: "must be an RFC 3339 timestamp"})
+		} else if !t.After(cfg.clock.Now()) {
+			errs = append(errs, fieldError{Field: "expires_at", Message: "must be in the future"})
+		}
+		expiresAt = &t
+	}
+	if params.ThumbnailAltText != nil {
+		if msg := validateAltText(*params.ThumbnailAltText); msg != "" {
+			errs = append(errs, fieldError{Field: "thumbnail_alt_text", Message: msg})
+		}
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidVideoMetadata, "Invalid video metadata", errs)
 		return
 	}
-	params.UserID = userID
 
-	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
+	video, err := cfg.authorizeVideoAccess(videoID, userID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
+		respondWithVideoAccessError(w, err, "update this video")
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, video)
-}
+	if params.Title != nil {
+		video.Title = *params.Title
+	}
+	if params.Description != nil {
+		video.Description = *params.Description
+	}
+	if params.Visibility != nil {
+		if !isValidVisibility(*params.Visibility) {
+			respondWithError(w, http.StatusBadRequest, codeInvalidVisibility, "Invalid visibility", nil)
+			return
+		}
+		video.Visibility = *params.Visibility
+	}
+	if params.ExpiresAt != nil {
+		if video.ExpiredAt != nil {
+			respondWithError(w, http.StatusConflict, codeVideoHasAlreadyExpired, "Video has already expired", nil)
+			return
+		}
+		video.ExpiresAt = expiresAt
+	}
+	if params.Slug != nil {
+		video.Slug = nil
+		if *params.Slug != "" {
+			video.Slug = params.Slug
+		}
+	}
+	if params.ThumbnailAltText != nil {
+		video.ThumbnailAltText = *params.ThumbnailAltText
+	}
 
-func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
+	err = cfg.db.UpdateVideo(video)
+	if errors.Is(err, database.ErrSlugTaken) {
+		respondWithFieldErrors(w, codeInvalidVideoMetadata, "Invalid video metadata", []fieldError{{Field: "slug", Message: "is already used by another of your videos"}})
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateVideo, "Couldn't update video", err)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	video, err = cfg.db.GetVideo(videoID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+
+	cfg.publishEvent(eventVideoUpdated, video)
+
+	var warnings []fieldError
+	if params.Title != nil {
+		warnings = cfg.duplicateTitleWarnings(video)
+	}
+	respondWithJSON(w, http.StatusOK, videoWithWarnings{Video: withPlaceholderThumbnail(video), Warnings: warnings})
+}
+
+func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusBadRequest, codeInvalidID, "Invalid ID", err)
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	userID := requestUserID(r)
+
+	video, err := cfg.authorizeVideoAccess(videoID, userID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithVideoAccessError(w, err, "delete this video")
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
+	if cfg.isRetained(video) {
+		respondWithError(w, http.StatusLocked, codeVideoIsUnderARetentionLock, fmt.Sprintf("Video is under a retention lock until %s", video.RetainedUntil.Format(time.RFC3339)), nil)
 		return
 	}
 
 	err = cfg.db.DeleteVideo(videoID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDeleteVideo, "Couldn't delete video", err)
 		return
 	}
 
+	cfg.publishEvent(eventVideoDeleted, video)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -85,36 +220,199 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
 		return
 	}
 
 	video, err := cfg.db.GetVideo(videoID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	// private videos look like missing ones to everyone but their owner
+	if video.ID == uuid.Nil || !cfg.canViewVideo(r, video) {
+		respondWithError(w, http.StatusNotFound, codeVideoNotFound, "Video not found", nil)
+		return
+	}
+
+	if cfg.isTakenDown(video.ID) {
+		respondWithError(w, http.StatusUnavailableForLegalReasons, codeThisVideoHasBeenTakenDown, "This video has been taken down", nil)
+		return
+	}
+
+	allowed, err := cfg.videoPlaybackAllowed(r, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackRestrictions, "Couldn't get playback restrictions", err)
+		return
+	}
+	// the metadata stays public, the media only goes to clients the
+	// restrictions let play it
+	if !allowed {
+		video.VideoURL = nil
+	}
+
+	chapters, err := cfg.db.GetChapters(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveChapters, "Couldn't retrieve chapters", err)
+		return
+	}
+	shown, click := cfg.viewerThumbnail(r, video)
+	localized, lang, err := cfg.localizeVideo(r, shown)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveTranslations, "Couldn't retrieve translations", err)
 		return
 	}
+	w.Header().Add("Vary", "Accept-Language")
+	if lang != "" {
+		w.Header().Set("Content-Language", lang)
+	}
+	resp := videoWithChapters{Video: cfg.stampAssetURLs(localized), Chapters: chapters, Language: lang}
 
-	respondWithJSON(w, http.StatusOK, video)
+	etag, err := videoETag(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntComputeETag, "Couldn't compute ETag", err)
+		return
+	}
+	if checkNotModified(w, r, etag) {
+		return
+	}
+
+	// views are counted where the media is played, fetching the metadata
+	// isn't watching the video
+	cfg.recordThumbnailClick(click)
+
+	respondWithJSON(w, http.StatusOK, resp)
 }
 
-func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+// canViewVideo reports whether the caller of a public route may see video:
+// anyone for public and unlisted videos, only its owner otherwise.
+func (cfg *apiConfig) canViewVideo(r *http.Request, video database.Video) bool {
+	if video.Visibility == database.VisibilityPublic || video.Visibility == database.VisibilityUnlisted {
+		return true
+	}
+	userID, ok := cfg.optionalUserID(r)
+	return ok && userID == video.UserID
+}
+
+// handlerVideoGetBySlug resolves a video through its owner's ID and the slug
+// they gave it, giving embeds a stable and readable URL.
+func (cfg *apiConfig) handlerVideoGetBySlug(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidUserID, "Invalid user ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideoBySlug(userID, r.PathValue("slug"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	// private videos look like missing ones to everyone but their owner,
+	// slugs are readable enough to be guessed
+	if video.ID == uuid.Nil || !cfg.canViewVideo(r, video) {
+		respondWithError(w, http.StatusNotFound, codeVideoNotFound, "Video not found", nil)
+		return
+	}
+
+	if cfg.isTakenDown(video.ID) {
+		respondWithError(w, http.StatusUnavailableForLegalReasons, codeThisVideoHasBeenTakenDown, "This video has been taken down", nil)
+		return
+	}
+
+	allowed, err := cfg.videoPlaybackAllowed(r, video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackRestrictions, "Couldn't get playback restrictions", err)
+		return
+	}
+	// the metadata stays public, the media only goes to clients the
+	// restrictions let play it
+	if !allowed {
+		video.VideoURL = nil
+	}
+
+	chapters, err := cfg.db.GetChapters(video.ID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveChapters, "Couldn't retrieve chapters", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	shown, click := cfg.viewerThumbnail(r, video)
+	localized, lang, err := cfg.localizeVideo(r, shown)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveTranslations, "Couldn't retrieve translations", err)
 		return
 	}
+	w.Header().Add("Vary", "Accept-Language")
+	if lang != "" {
+		w.Header().Set("Content-Language", lang)
+	}
+	resp := videoWithChapters{Video: cfg.stampAssetURLs(localized), Chapters: chapters, Language: lang}
 
-	videos, err := cfg.db.GetVideos(userID)
+	etag, err := videoETag(resp)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		respondWithError(w, http.StatusInternalServerError, codeCouldntComputeETag, "Couldn't compute ETag", err)
+		return
+	}
+	if checkNotModified(w, r, etag) {
+		return
+	}
+
+	cfg.recordThumbnailClick(click)
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerVideosRetrieve lists the user's videos, newest first. With a limit
+// or cursor parameter the list is paged and a Link header points to the next
+// page.
+func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	var videos []database.Video
+	query := r.URL.Query()
+	if query.Has("limit") || query.Has("cursor") {
+		limit, cursor, err := pageParams(r)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, codeInvalidPageParameters, err.Error(), err)
+			return
+		}
+
+		// one extra row tells whether there is a next page
+		videos, err = cfg.db.GetVideosPage(userID, cursor, limit+1)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveVideos, "Couldn't retrieve videos", err)
+			return
+		}
+		if len(videos) > limit {
+			videos = videos[:limit]
+			setNextPageLink(w, r, encodeVideoCursor(videos[limit-1]))
+		}
+	} else {
+		var err error
+		videos, err = cfg.db.GetVideos(userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveVideos, "Couldn't retrieve videos", err)
+			return
+		}
+	}
+
+	videos = cfg.stampVideosAssetURLs(videos)
+	etag, err := videosETag(videos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntComputeETag, "Couldn't compute ETag", err)
+		return
+	}
+	if checkNotModified(w, r, etag) {
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, videos)
 }
+
+func isValidVisibility(visibility string) bool {
+	switch visibility {
+	case database.VisibilityPrivate, database.VisibilityUnlisted, database.VisibilityPublic:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideoGet(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.jwtSecret = "boots"
+	owner := uuid.New()
+	stranger := uuid.New()
+
+	private := createTestVideo(t, cfg, owner)
+	public := createTestVideo(t, cfg, owner)
+	public.Visibility = database.VisibilityPublic
+	if err := cfg.db.UpdateVideo(public); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		videoID string
+		// the caller's JWT, none when nil
+		viewer     *uuid.UUID
+		wantStatus int
+	}{
+		{name: "public video, anonymous", videoID: public.ID.String(), wantStatus: http.StatusOK},
+		{name: "private video, owner", videoID: private.ID.String(), viewer: &owner, wantStatus: http.StatusOK},
+		{name: "private video, anonymous", videoID: private.ID.String(), wantStatus: http.StatusNotFound},
+		{name: "private video, another user", videoID: private.ID.String(), viewer: &stranger, wantStatus: http.StatusNotFound},
+		{name: "unknown video", videoID: uuid.NewString(), wantStatus: http.StatusNotFound},
+		{name: "invalid video ID", videoID: "boots", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/videos/"+tt.videoID, nil)
+			r.SetPathValue("videoID", tt.videoID)
+			if tt.viewer != nil {
+				withJWT(t, cfg, r, *tt.viewer)
+			}
+			w := httptest.NewRecorder()
+
+			cfg.handlerVideoGet(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var got struct {
+				ID uuid.UUID `json:"id"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.ID.String() != tt.videoID {
+				t.Errorf("got video %s, want %s", got.ID, tt.videoID)
+			}
+		})
+	}
+}
+
+// withJWT authenticates r as userID the way a client would.
+func withJWT(t *testing.T, cfg *apiConfig, r *http.Request, userID uuid.UUID) {
+	t.Helper()
+	token, err := auth.MakeJWT(userID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+}
+
+func TestHandlerVideoGetBySlug(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.jwtSecret = "boots"
+	owner := uuid.New()
+	stranger := uuid.New()
+
+	slugged := func(slug, visibility string) {
+		video := createTestVideo(t, cfg, owner)
+		video.Slug = &slug
+		video.Visibility = visibility
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+	}
+	slugged("private", database.VisibilityPrivate)
+	slugged("unlisted", database.VisibilityUnlisted)
+	slugged("public", database.VisibilityPublic)
+
+	tests := []struct {
+		name string
+		slug string
+		// the caller's JWT, none when nil
+		viewer     *uuid.UUID
+		wantStatus int
+	}{
+		{name: "private video, anonymous", slug: "private", wantStatus: http.StatusNotFound},
+		{name: "private video, another user", slug: "private", viewer: &stranger, wantStatus: http.StatusNotFound},
+		{name: "private video, owner", slug: "private", viewer: &owner, wantStatus: http.StatusOK},
+		{name: "unlisted video, anonymous", slug: "unlisted", wantStatus: http.StatusOK},
+		{name: "public video, anonymous", slug: "public", wantStatus: http.StatusOK},
+		{name: "unknown slug", slug: "boots", viewer: &owner, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/users/"+owner.String()+"/videos/by-slug/"+tt.slug, nil)
+			r.SetPathValue("userID", owner.String())
+			r.SetPathValue("slug", tt.slug)
+			if tt.viewer != nil {
+				withJWT(t, cfg, r, *tt.viewer)
+			}
+			w := httptest.NewRecorder()
+
+			cfg.handlerVideoGetBySlug(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
+
+func TestHandlerVideoMetaCreateRejections(t *testing.T) {
+	cfg := newTestConfig(t)
+	owner := uuid.New()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "malformed JSON", body: `{"title": "Boots"`, wantStatus: http.StatusBadRequest},
+		{name: "wrong field type", body: `{"title": 42}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid visibility", body: `{"title": "Boots", "visibility": "secret"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := authedRequest(http.MethodPost, "/api/videos", strings.NewReader(tt.body), owner, "")
+			w := httptest.NewRecorder()
+
+			cfg.handlerVideoMetaCreate(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+// handlerVideoStream plays encrypted videos. Their objects can't be fetched
+// from S3 without the key, so clients send it in X-Encryption-Key and the
+// media is decrypted by S3 and relayed through here. Range requests are
+// passed on so players can seek.
+func (cfg *apiConfig) handlerVideoStream(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, codeVideoHasNoMedia, "Video has no media", nil)
+		return
+	}
+	if video.EncryptionKeyMD5 == nil {
+		respondWithError(w, http.StatusConflict, codeVideoIsntEncryptedPlayItFromItsURL, "Video isn't encrypted, play it from its URL", nil)
+		return
+	}
+
+	if cfg.isTakenDown(video.ID) {
+		respondWithError(w, http.StatusUnavailableForLegalReasons, codeThisVideoHasBeenTakenDown, "This video has been taken down", nil)
+		return
+	}
+	restrictions, err := cfg.db.GetPlaybackRestrictions(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackRestrictions, "Couldn't get playback restrictions", err)
+		return
+	}
+	if !cfg.playbackAllowed(r, restrictions) {
+		respondWithError(w, http.StatusForbidden, codeThisVideoIsntAvailableInYourLocation, "This video isn't available in your location", nil)
+		return
+	}
+
+	encryptionKey, err := customerKeyFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidEncryptionKey, "Invalid encryption key", err)
+		return
+	}
+	if encryptionKey == nil {
+		respondWithError(w, http.StatusUnauthorized, codeEncryptionKeyRequired, "Video is encrypted, send its key in "+encryptionKeyHeader, nil)
+		return
+	}
+	if err := checkVideoKey(video, encryptionKey); err != nil {
+		respondWithError(w, http.StatusForbidden, codeWrongEncryptionKey, "Wrong encryption key", err)
+		return
+	}
+
+	key, err := cfg.getS3KeyFromURL(*video.VideoURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDetermineVideoObjectKey, "Couldn't determine video object key", err)
+		return
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	}
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		input.Range = aws.String(rangeHeader)
+	}
+	encryptionKey.applyToGet(input)
+
+	obj, err := cfg.s3Client.GetObject(r.Context(), input)
+	if err != nil {
+		respondWithStorageError(w, http.StatusBadGateway, codeCouldntGetVideoFromStorage, "Couldn't get video from storage", err)
+		return
+	}
+	defer obj.Body.Close()
+
+	// the key is per request, shared caches must not keep the plaintext
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Accept-Ranges", "bytes")
+	if obj.ContentType != nil {
+		w.Header().Set("Content-Type", *obj.ContentType)
+	}
+	if obj.ContentLength != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*obj.ContentLength, 10))
+	}
+	status := http.StatusOK
+	if obj.ContentRange != nil {
+		w.Header().Set("Content-Range", *obj.ContentRange)
+		status = http.StatusPartialContent
+	}
+	// the digest of the whole video, for clients verifying their download
+	if digest := reprDigest(video.ContentSHA256); digest != "" {
+		w.Header().Set("Repr-Digest", digest)
+	}
+	w.WriteHeader(status)
+	// players seeking send more ranges, only the start of playback counts
+	if rangeHeader := r.Header.Get("Range"); rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-") {
+		cfg.recordView(video)
+	}
+
+	// clients going away while seeking is normal
+	if _, err := io.Copy(w, obj.Body); err != nil && r.Context().Err() == nil {
+		log.Printf("Couldn't stream video %s: %v", video.ID, err)
+	}
+}
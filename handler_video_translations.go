@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxTranslationsPerVideo = 50
+
+// localizeVideo swaps in the title and description of the translation the
+// request asks for, with a lang query parameter or else Accept-Language,
+// and returns its language. Without a matching translation the video is
+// returned as it is and the language is "".
+func (cfg *apiConfig) localizeVideo(r *http.Request, video database.Video) (database.Video, string, error) {
+	accepted := parseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if lang, ok := normalizeLanguageTag(r.URL.Query().Get("lang")); ok {
+		accepted = append([]string{lang}, accepted...)
+	}
+	if len(accepted) == 0 {
+		return video, "", nil
+	}
+
+	translations, err := cfg.db.GetVideoTranslations(video.ID)
+	if err != nil {
+		return database.Video{}, "", err
+	}
+	available := make([]string, len(translations))
+	for i, t := range translations {
+		available[i] = t.Language
+	}
+	lang := negotiateLanguage(accepted, available)
+	for _, t := range translations {
+		if t.Language == lang {
+			video.Title = t.Title
+			video.Description = t.Description
+		}
+	}
+	return video, lang, nil
+}
+
+func (cfg *apiConfig) handlerVideoTranslationsList(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+
+	translations, err := cfg.db.GetVideoTranslations(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveTranslations, "Couldn't retrieve translations", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, translations)
+}
+
+func (cfg *apiConfig) handlerVideoTranslationSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+
+	lang, ok := normalizeLanguageTag(r.PathValue("language"))
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, codeInvalidLanguageTag, "Invalid language tag", nil)
+		return
+	}
+	video, ok := cfg.ownedVideo(w, r, "change translations")
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if errs := validateVideoMeta(&params.Title, &params.Description); len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidTranslation, "Invalid translation", errs)
+		return
+	}
+
+	existing, err := cfg.db.GetVideoTranslation(video.ID, lang)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetTranslation, "Couldn't get translation", err)
+		return
+	}
+	if existing.Language == "" {
+		translations, err := cfg.db.GetVideoTranslations(video.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveTranslations, "Couldn't retrieve translations", err)
+			return
+		}
+		if len(translations) >= maxTranslationsPerVideo {
+			respondWithError(w, http.StatusConflict, codeTooManyTranslations, fmt.Sprintf("A video can have at most %d translations", maxTranslationsPerVideo), nil)
+			return
+		}
+	}
+
+	translation, err := cfg.db.SetVideoTranslation(video.ID, lang, params.Title, params.Description)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntSaveTranslation, "Couldn't save translation", err)
+		return
+	}
+
+	cfg.publishEvent(eventVideoUpdated, video)
+
+	status := http.StatusOK
+	if existing.Language == "" {
+		status = http.StatusCreated
+	}
+	respondWithJSON(w, status, translation)
+}
+
+func (cfg *apiConfig) handlerVideoTranslationDelete(w http.ResponseWriter, r *http.Request) {
+	lang, ok := normalizeLanguageTag(r.PathValue("language"))
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, codeInvalidLanguageTag, "Invalid language tag", nil)
+		return
+	}
+	video, ok := cfg.ownedVideo(w, r, "change translations")
+	if !ok {
+		return
+	}
+
+	deleted, err := cfg.db.DeleteVideoTranslation(video.ID, lang)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDeleteTranslation, "Couldn't delete translation", err)
+		return
+	}
+	if !deleted {
+		respondWithError(w, http.StatusNotFound, codeTranslationNotFound, "Translation not found", nil)
+		return
+	}
+
+	cfg.publishEvent(eventVideoUpdated, video)
+
+	w.WriteHeader(http.StatusNoContent)
+}
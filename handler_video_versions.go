@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerVideoVersionsList(w http.ResponseWriter, r *http.Request) {
+	type versionResponse struct {
+		database.VideoVersion
+		Current bool `json:"current"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, codeYouCantViewVersionsOfThisVideo, "You can't view versions of this video", nil)
+		return
+	}
+
+	versions, err := cfg.db.GetVideoVersions(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveVideoVersions, "Couldn't retrieve video versions", err)
+		return
+	}
+
+	resp := make([]versionResponse, 0, len(versions))
+	for _, v := range versions {
+		resp = append(resp, versionResponse{
+			VideoVersion: v,
+			Current:      video.VideoURL != nil && *video.VideoURL == v.VideoURL,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerVideoVersionRollback(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVersion, "Invalid version", err)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, codeYouCantRollBackThisVideo, "You can't roll back this video", nil)
+		return
+	}
+
+	target, err := cfg.db.GetVideoVersion(videoID, version)
+	if err != nil || target.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeCouldntGetVideoVersion, "Couldn't get video version", err)
+		return
+	}
+
+	video.VideoURL = &target.VideoURL
+	video.VideoSize = target.VideoSize
+	video.EncryptionKeyMD5 = target.EncryptionKeyMD5
+	video.ContentSHA256 = target.ContentSHA256
+	video.ObjectETag = target.ObjectETag
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntUpdateVideoData, "Couldn't update video data", err)
+		return
+	}
+
+	cfg.publishEvent(eventVideoUpdated, video)
+
+	respondWithJSON(w, http.StatusOK, withPlaceholderThumbnail(video))
+}
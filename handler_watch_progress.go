@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// positions this close to the end mean the video was finished, players
+// should start over instead of resuming at the credits
+const watchCompleteFraction = 0.95
+
+type watchProgressResponse struct {
+	VideoID   uuid.UUID  `json:"video_id"`
+	Position  float64    `json:"position"`
+	Completed bool       `json:"completed"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// watchableVideo loads the video the request's {videoID} names, responding
+// with an error and returning false if the user can't watch it.
+func (cfg *apiConfig) watchableVideo(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil || (video.Visibility == database.VisibilityPrivate && video.UserID != userID) {
+		respondWithError(w, http.StatusNotFound, codeVideoNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	if cfg.isTakenDown(video.ID) {
+		respondWithError(w, http.StatusUnavailableForLegalReasons, codeThisVideoHasBeenTakenDown, "This video has been taken down", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+func (cfg *apiConfig) handlerWatchProgressGet(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	video, ok := cfg.watchableVideo(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var err error
+	progress, pending := cfg.watchProgress.get(userID, video.ID)
+	if !pending {
+		progress, err = cfg.db.GetWatchProgress(userID, video.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntGetWatchProgress, "Couldn't get watch progress", err)
+			return
+		}
+	}
+
+	resp := watchProgressResponse{VideoID: video.ID, Position: progress.Position}
+	if !progress.UpdatedAt.IsZero() {
+		resp.UpdatedAt = &progress.UpdatedAt
+	}
+	if video.DurationSeconds != nil && progress.Position >= watchCompleteFraction*(*video.DurationSeconds) {
+		resp.Position = 0
+		resp.Completed = true
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerWatchProgressSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Position *float64 `json:"position"`
+	}
+
+	userID := requestUserID(r)
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Position == nil || *params.Position < 0 {
+		respondWithFieldErrors(w, codeInvalidWatchProgress, "Invalid watch progress", []fieldError{{Field: "position", Message: "must be a non-negative number of seconds"}})
+		return
+	}
+
+	video, ok := cfg.watchableVideo(w, r, userID)
+	if !ok {
+		return
+	}
+	if video.DurationSeconds == nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasNoMediaYet, "Video has no media yet", nil)
+		return
+	}
+
+	cfg.watchProgress.record(database.WatchProgress{
+		UserID:    userID,
+		VideoID:   video.ID,
+		Position:  min(*params.Position, *video.DurationSeconds),
+		UpdatedAt: time.Now().UTC().Truncate(time.Second),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
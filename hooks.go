@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	hookStagePreUpload  = "pre-upload"
+	hookStagePostUpload = "post-upload"
+
+	defaultUploadHookTimeout = 10 * time.Second
+)
+
+type uploadEvent struct {
+	Stage       string    `json:"stage"`
+	Kind        string    `json:"kind"` // "video" or "thumbnail"
+	VideoID     uuid.UUID `json:"video_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Title       string    `json:"title"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	URL         string    `json:"url,omitempty"`
+}
+
+// uploadHook lets deployments validate uploads before they are processed and
+// react to them once stored. Returning an error from PreUpload rejects the
+// upload; its message is shown to the uploader.
+type uploadHook interface {
+	PreUpload(ctx context.Context, event uploadEvent) error
+	PostUpload(ctx context.Context, event uploadEvent)
+}
+
+// compiledUploadHooks holds hooks built into the binary. Plugins add
+// themselves from an init func in their own file.
+var compiledUploadHooks []uploadHook
+
+func registerUploadHook(h uploadHook) {
+	compiledUploadHooks = append(compiledUploadHooks, h)
+}
+
+type hookRejectedError struct {
+	reason string
+}
+
+func (e hookRejectedError) Error() string {
+	return e.reason
+}
+
+func (cfg *apiConfig) runPreUploadHooks(ctx context.Context, event uploadEvent) error {
+	event.Stage = hookStagePreUpload
+	for _, h := range cfg.uploadHooks {
+		if err := h.PreUpload(ctx, event); err != nil {
+			var rejected hookRejectedError
+			if errors.As(err, &rejected) {
+				return rejected
+			}
+			return fmt.Errorf("pre-upload hook failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func respondWithHookError(w http.ResponseWriter, err error) {
+	var rejected hookRejectedError
+	if errors.As(err, &rejected) {
+		respondWithError(w, http.StatusUnprocessableEntity, codeUploadRejected, rejected.reason, err)
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, codeCouldntRunUploadHooks, "Couldn't run upload hooks", err)
+}
+
+// runPostUploadHooks runs in the background so slow hooks don't hold up the
+// response.
+func (cfg *apiConfig) runPostUploadHooks(event uploadEvent) {
+	if len(cfg.uploadHooks) == 0 {
+		return
+	}
+	event.Stage = hookStagePostUpload
+	go func() {
+		for _, h := range cfg.uploadHooks {
+			h.PostUpload(context.Background(), event)
+		}
+	}()
+}
+
+// commandHook runs a local executable for every hook stage. The event is
+// passed as JSON on stdin and the stage as the only argument. On pre-upload a
+// nonzero exit rejects the upload with the command's stderr as the reason.
+type commandHook struct {
+	path    string
+	timeout time.Duration
+}
+
+func (h commandHook) run(ctx context.Context, event uploadEvent) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	input, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.path, event.Stage)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("timed out after %s", h.timeout)
+	}
+	return strings.TrimSpace(stderr.String()), err
+}
+
+func (h commandHook) PreUpload(ctx context.Context, event uploadEvent) error {
+	stderr, err := h.run(ctx, event)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if stderr == "" {
+			stderr = "Upload rejected by policy"
+		}
+		return hookRejectedError{reason: stderr}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", h.path, err)
+	}
+	return nil
+}
+
+func (h commandHook) PostUpload(ctx context.Context, event uploadEvent) {
+	stderr, err := h.run(ctx, event)
+	if err != nil {
+		log.Printf("Post-upload hook %s failed: %v: %s", h.path, err, stderr)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const defaultAssetTokenTTL = time.Hour
+
+// hotlinkPolicy decides which requests for local assets are served: those
+// coming from this site or an allowed host, those with a valid token, and
+// unless disabled those that don't say where they come from.
+type hotlinkPolicy struct {
+	allowedHosts map[string]bool
+	// requests without Referer or Origin come from direct visits, privacy
+	// settings and link preview crawlers
+	allowEmptyReferer bool
+
+	// nil disables tokens
+	tokenSecret []byte
+	tokenTTL    time.Duration
+}
+
+func parseHotlinkPolicy(allowedHosts, allowEmptyReferer, tokenSecret, tokenTTL string) (*hotlinkPolicy, error) {
+	policy := &hotlinkPolicy{
+		allowedHosts:      map[string]bool{},
+		allowEmptyReferer: true,
+		tokenTTL:          defaultAssetTokenTTL,
+	}
+	for _, host := range strings.Split(allowedHosts, ",") {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" {
+			policy.allowedHosts[host] = true
+		}
+	}
+	if allowEmptyReferer != "" {
+		allow, err := strconv.ParseBool(allowEmptyReferer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid empty referer setting %q", allowEmptyReferer)
+		}
+		policy.allowEmptyReferer = allow
+	}
+	if tokenSecret != "" {
+		policy.tokenSecret = []byte(tokenSecret)
+	}
+	if tokenTTL != "" {
+		ttl, err := time.ParseDuration(tokenTTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid token TTL %q", tokenTTL)
+		}
+		policy.tokenTTL = ttl
+	}
+	return policy, nil
+}
+
+func (p *hotlinkPolicy) allows(r *http.Request) bool {
+	if p.tokenSecret != nil && p.validToken(r.URL.Path, r.URL.Query()) {
+		return true
+	}
+
+	source := r.Header.Get("Origin")
+	if source == "" || source == "null" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return p.allowEmptyReferer
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	return host == strings.ToLower(r.Host) || p.allowedHosts[host] || p.allowedHosts[strings.ToLower(u.Hostname())]
+}
+
+// sign covers the asset's file name rather than its full path, so tokens
+// still match when ASSET_BASE_URL puts the assets under another prefix.
+func (p *hotlinkPolicy) sign(name string, exp int64) string {
+	mac := hmac.New(sha256.New, p.tokenSecret)
+	mac.Write([]byte(name + "\n" + strconv.FormatInt(exp, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (p *hotlinkPolicy) validToken(urlPath string, query url.Values) bool {
+	exp, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(query.Get("sig")), []byte(p.sign(path.Base(urlPath), exp)))
+}
+
+// stamp adds an expiring token to a local asset URL. The expiry is rounded
+// to the TTL so responses, and their ETags, stay the same for a while.
+func (p *hotlinkPolicy) stamp(assetURL string) string {
+	u, err := url.Parse(assetURL)
+	if err != nil {
+		return assetURL
+	}
+	exp := time.Now().Truncate(p.tokenTTL).Add(2 * p.tokenTTL).Unix()
+	q := u.Query()
+	q.Set("exp", strconv.FormatInt(exp, 10))
+	q.Set("sig", p.sign(path.Base(u.Path), exp))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// hotlinkMiddleware rejects asset requests embedded by other sites.
+func (cfg *apiConfig) hotlinkMiddleware(next http.Handler) http.Handler {
+	if cfg.hotlink == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.hotlink.allows(r) {
+			respondWithError(w, http.StatusForbidden, codeHotlinkingIsNotAllowed, "Hotlinking is not allowed", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// stampAssetURLs adds tokens to the video's locally served assets when
+// tokens are enabled. Objects in S3 aren't served here and only move to the
+// replica bucket while failed over. Videos without a thumbnail get the
+// placeholder, which needs no token.
+func (cfg *apiConfig) stampAssetURLs(video database.Video) database.Video {
+	if video.VideoURL != nil {
+		videoURL := cfg.playbackURL(*video.VideoURL)
+		video.VideoURL = &videoURL
+	}
+	if video.ThumbnailURL != nil {
+		stamped := cfg.stampThumbnailURL(*video.ThumbnailURL, video.ThumbnailFocus)
+		video.ThumbnailURL = &stamped
+	}
+	return withPlaceholderThumbnail(video)
+}
+
+// stampThumbnailURL adds the focus point to a locally served thumbnail, for
+// the crops clients request from it, and a token when tokens are enabled.
+func (cfg *apiConfig) stampThumbnailURL(thumbnailURL string, focus *database.FocusPoint) string {
+	if cfg.isS3ObjectURL(thumbnailURL) {
+		return thumbnailURL
+	}
+	if focus != nil {
+		if u, err := url.Parse(thumbnailURL); err == nil {
+			q := u.Query()
+			q.Set("fx", strconv.FormatFloat(focus.X, 'f', -1, 64))
+			q.Set("fy", strconv.FormatFloat(focus.Y, 'f', -1, 64))
+			u.RawQuery = q.Encode()
+			thumbnailURL = u.String()
+		}
+	}
+	if cfg.hotlink == nil || cfg.hotlink.tokenSecret == nil {
+		return thumbnailURL
+	}
+	return cfg.hotlink.stamp(thumbnailURL)
+}
+
+func (cfg *apiConfig) stampVideosAssetURLs(videos []database.Video) []database.Video {
+	stamped := make([]database.Video, len(videos))
+	for i, video := range videos {
+		stamped[i] = cfg.stampAssetURLs(video)
+	}
+	return stamped
+}
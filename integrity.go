@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const defaultIntegrityCheckInterval = 24 * time.Hour
+
+type integrityReport struct {
+	Checked int `json:"checked"`
+	// encrypted objects can't be inspected without their key
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+}
+
+// checksums returns what gets recorded for a stored object.
+func (t transcodeResult) checksums() (sha256, etag *string) {
+	if t.sha256 != "" {
+		sha256 = aws.String(t.sha256)
+	}
+	if t.etag != "" {
+		etag = aws.String(t.etag)
+	}
+	return sha256, etag
+}
+
+// reprDigest formats a recorded hash as an RFC 9530 Repr-Digest header.
+func reprDigest(contentSHA256 *string) string {
+	if contentSHA256 == nil {
+		return ""
+	}
+	raw, err := hex.DecodeString(*contentSHA256)
+	if err != nil {
+		return ""
+	}
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(raw) + ":"
+}
+
+func (cfg *apiConfig) startIntegrityCheck(interval time.Duration) {
+	cfg.startScheduledTask("integrity_check", interval, func(ctx context.Context) {
+		report, err := cfg.checkIntegrity(ctx)
+		if err != nil {
+			log.Printf("Integrity check failed: %v", err)
+			return
+		}
+		if report.Failed > 0 {
+			log.Printf("Integrity check found %d of %d objects not matching their checksums", report.Failed, report.Checked)
+		}
+	})
+}
+
+// checkIntegrity compares the ETag and SHA-256 checksum S3 reports for every
+// stored video object against the values recorded when it was stored, to
+// catch objects that were corrupted, overwritten or deleted behind the
+// server's back. Failures are kept until the object passes again.
+func (cfg *apiConfig) checkIntegrity(ctx context.Context) (integrityReport, error) {
+	objects, err := cfg.db.GetChecksummedObjects()
+	if err != nil {
+		return integrityReport{}, fmt.Errorf("couldn't load stored objects: %w", err)
+	}
+
+	report := integrityReport{}
+	failedKeys := map[string]bool{}
+	for _, obj := range objects {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		if obj.EncryptionKeyMD5 != nil {
+			report.Skipped++
+			continue
+		}
+		key, err := cfg.getS3KeyFromURL(obj.VideoURL)
+		if err != nil {
+			log.Printf("Couldn't determine object key of video %s: %v", obj.VideoID, err)
+			continue
+		}
+
+		problem, expected, actual, err := cfg.checkObject(ctx, key, obj)
+		if err != nil {
+			log.Printf("Couldn't check integrity of %s: %v", key, err)
+			continue
+		}
+		report.Checked++
+
+		if problem == "" {
+			// a video and its version may record the same object differently,
+			// don't let the passing one clear the other's failure
+			if !failedKeys[key] {
+				if err := cfg.db.ClearIntegrityFailures(key); err != nil {
+					log.Printf("Couldn't clear integrity failures of %s: %v", key, err)
+				}
+			}
+			continue
+		}
+
+		report.Failed++
+		failedKeys[key] = true
+		log.Printf("Integrity check of video %s: %s %s", obj.VideoID, key, problem)
+		err = cfg.db.RecordIntegrityFailure(obj.VideoID, key, problem, expected, actual)
+		if err != nil {
+			log.Printf("Couldn't record integrity failure of %s: %v", key, err)
+		}
+	}
+	return report, nil
+}
+
+func (cfg *apiConfig) checkObject(ctx context.Context, key string, obj database.StoredObject) (problem string, expected, actual *string, err error) {
+	head, err := cfg.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(cfg.s3Bucket),
+		Key:          aws.String(key),
+		ChecksumMode: s3types.ChecksumModeEnabled,
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound" {
+		return database.IntegrityMissing, nil, nil, nil
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if obj.ObjectETag != nil && strings.Trim(*obj.ObjectETag, `"`) != strings.Trim(aws.ToString(head.ETag), `"`) {
+		return database.IntegrityETagMismatch, obj.ObjectETag, head.ETag, nil
+	}
+
+	// multipart uploads only have a checksum of their part checksums, it
+	// ends in the part count and can't be compared to the content hash
+	stored := aws.ToString(head.ChecksumSHA256)
+	if obj.ContentSHA256 == nil || stored == "" || strings.Contains(stored, "-") {
+		return "", nil, nil, nil
+	}
+	raw, err := hex.DecodeString(*obj.ContentSHA256)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid recorded checksum: %w", err)
+	}
+	if base64.StdEncoding.EncodeToString(raw) != stored {
+		decoded, _ := base64.StdEncoding.DecodeString(stored)
+		return database.IntegrityChecksumMismatch, obj.ContentSHA256, aws.String(hex.EncodeToString(decoded)), nil
+	}
+	return "", nil, nil, nil
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ArchivedObject is video media mirrored to the archive target. Records of
+// deleted videos are kept, as their copies stay in the archive.
+type ArchivedObject struct {
+	VideoID    uuid.UUID `json:"video_id"`
+	VideoURL   string    `json:"video_url"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	MirroredAt time.Time `json:"mirrored_at"`
+}
+
+// GetUnarchivedVideos returns up to limit videos whose current media isn't
+// mirrored yet, oldest first. Encrypted media is left out, it can't be
+// read without its owner's key.
+func (c Client) GetUnarchivedVideos(limit int) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE video_url IS NOT NULL
+		AND encryption_key_md5 IS NULL
+		AND NOT EXISTS (SELECT 1 FROM archived_objects a WHERE a.video_url = videos.video_url)
+	ORDER BY created_at
+	LIMIT ?
+	`
+
+	rows, err := c.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// CountUnarchivedVideos counts the videos GetUnarchivedVideos would return
+// without a limit.
+func (c Client) CountUnarchivedVideos() (int, error) {
+	var count int
+	err := c.db.QueryRow(`
+	SELECT COUNT(*)
+	FROM videos
+	WHERE video_url IS NOT NULL
+		AND encryption_key_md5 IS NULL
+		AND NOT EXISTS (SELECT 1 FROM archived_objects a WHERE a.video_url = videos.video_url)
+	`).Scan(&count)
+	return count, err
+}
+
+func (c Client) RecordArchivedObject(obj ArchivedObject) error {
+	query := `
+	INSERT INTO archived_objects (
+		video_url,
+		video_id,
+		path,
+		size,
+		mirrored_at
+	) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(video_url) DO UPDATE SET
+		path = excluded.path,
+		size = excluded.size,
+		mirrored_at = excluded.mirrored_at
+	`
+	_, err := c.exec(query, obj.VideoURL, obj.VideoID, obj.Path, obj.Size)
+	return err
+}
+
+// GetArchivedObjects returns everything mirrored so far, newest first.
+func (c Client) GetArchivedObjects() ([]ArchivedObject, error) {
+	rows, err := c.db.Query(`
+	SELECT video_id, video_url, path, size, mirrored_at
+	FROM archived_objects
+	ORDER BY mirrored_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := []ArchivedObject{}
+	for rows.Next() {
+		var o ArchivedObject
+		if err := rows.Scan(&o.VideoID, &o.VideoURL, &o.Path, &o.Size, &o.MirroredAt); err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	return objects, rows.Err()
+}
+
+// ForgetArchivedObject drops the record of a copy that went missing from
+// the archive, so it is mirrored again if the video still uses it.
+func (c Client) ForgetArchivedObject(videoURL string) error {
+	_, err := c.exec("DELETE FROM archived_objects WHERE video_url = ?", videoURL)
+	return err
+}
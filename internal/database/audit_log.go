@@ -0,0 +1,63 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEntry records who did what to which object. Entries are never
+// updated or deleted along with their target, so the history outlives it.
+type AuditEntry struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   string    `json:"target_id"`
+	Details    string    `json:"details"`
+}
+
+func (c Client) CreateAuditEntry(actor, action, targetType, targetID, details string) error {
+	query := `
+	INSERT INTO audit_log (
+		id,
+		created_at,
+		actor,
+		action,
+		target_type,
+		target_id,
+		details
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+	`
+	_, err := c.exec(query, uuid.New(), actor, action, targetType, targetID, details)
+	return err
+}
+
+// GetAuditEntries returns the newest entries first, only those about
+// targetID unless it is empty.
+func (c Client) GetAuditEntries(targetID string, limit int) ([]AuditEntry, error) {
+	query := `
+	SELECT id, created_at, actor, action, target_type, target_id, details
+	FROM audit_log
+	WHERE ? = '' OR target_id = ?
+	ORDER BY created_at DESC, rowid DESC
+	LIMIT ?
+	`
+
+	rows, err := c.reader().Query(query, targetID, targetID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Actor, &e.Action, &e.TargetType, &e.TargetID, &e.Details); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// BackupTo writes a consistent copy of the database to path, which must not
+// exist yet. Writers are only held up while the copy is taken.
+func (c Client) BackupTo(path string) error {
+	_, err := c.exec("VACUUM INTO ?", path)
+	return err
+}
+
+// ReadSchemaVersion returns the schema version of the database at path
+// without migrating it, e.g. to check a backup before restoring it.
+func ReadSchemaVersion(path string) (int, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("not a readable database: %w", err)
+	}
+	return version, nil
+}
+
+func (c Client) Close() error {
+	return c.db.Close()
+}
+
+// GetReferencedObjectURLs returns every media and thumbnail URL stored for a
+// video or version.
+func (c Client) GetReferencedObjectURLs() ([]string, error) {
+	query := `
+	SELECT video_url FROM videos WHERE video_url IS NOT NULL
+	UNION
+	SELECT thumbnail_url FROM videos WHERE thumbnail_url IS NOT NULL
+	UNION
+	SELECT video_url FROM video_versions
+	`
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []string{}
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, rows.Err()
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// MigratedObject is an object already copied to a migration's destination.
+// SourceETag tells whether the source changed since, so a rerun copies only
+// what is new.
+type MigratedObject struct {
+	Key        string
+	SourceETag string
+	DestETag   string
+}
+
+func (c Client) GetMigratedObjects(destBucket string) (map[string]MigratedObject, error) {
+	rows, err := c.db.Query(
+		"SELECT object_key, source_etag, dest_etag FROM bucket_migration_objects WHERE dest_bucket = ?",
+		destBucket,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := map[string]MigratedObject{}
+	for rows.Next() {
+		var o MigratedObject
+		if err := rows.Scan(&o.Key, &o.SourceETag, &o.DestETag); err != nil {
+			return nil, err
+		}
+		objects[o.Key] = o
+	}
+	return objects, rows.Err()
+}
+
+func (c Client) RecordMigratedObject(destBucket string, obj MigratedObject) error {
+	query := `
+	INSERT INTO bucket_migration_objects (
+		dest_bucket,
+		object_key,
+		copied_at,
+		source_etag,
+		dest_etag
+	) VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?)
+	ON CONFLICT(dest_bucket, object_key) DO UPDATE SET
+		copied_at = excluded.copied_at,
+		source_etag = excluded.source_etag,
+		dest_etag = excluded.dest_etag
+	`
+	_, err := c.exec(query, destBucket, obj.Key, obj.SourceETag, obj.DestETag)
+	return err
+}
+
+// GetEncryptedVideoURLs returns the media of videos and versions stored with
+// SSE-C, which can't be copied without their owners' keys.
+func (c Client) GetEncryptedVideoURLs() ([]string, error) {
+	query := `
+	SELECT video_url FROM videos WHERE video_url IS NOT NULL AND encryption_key_md5 IS NOT NULL
+	UNION
+	SELECT video_url FROM video_versions WHERE encryption_key_md5 IS NOT NULL
+	`
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []string{}
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, rows.Err()
+}
+
+// RewriteObjectURLs moves every stored URL starting with oldPrefix over to
+// newPrefix in one transaction, so no video ever points at a mix of
+// buckets. Recorded ETags are replaced with the ones in etags, keyed by the
+// new URL, as copies don't always keep them. It returns how many videos
+// were changed.
+func (c Client) RewriteObjectURLs(oldPrefix, newPrefix string, etags map[string]string) (int, error) {
+	var videoIDs []uuid.UUID
+	err := c.writeTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`
+		SELECT id FROM videos
+		WHERE substr(video_url, 1, length(?1)) = ?1 OR substr(thumbnail_url, 1, length(?1)) = ?1
+		UNION
+		SELECT video_id FROM video_versions WHERE substr(video_url, 1, length(?1)) = ?1
+		`, oldPrefix)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			videoIDs = append(videoIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// substr and length count characters, the prefixes are plain ASCII
+		statements := []string{
+			`UPDATE videos SET updated_at = CURRENT_TIMESTAMP, video_url = ?2 || substr(video_url, length(?1) + 1)
+			WHERE substr(video_url, 1, length(?1)) = ?1`,
+			`UPDATE videos SET updated_at = CURRENT_TIMESTAMP, thumbnail_url = ?2 || substr(thumbnail_url, length(?1) + 1)
+			WHERE substr(thumbnail_url, 1, length(?1)) = ?1`,
+			`UPDATE video_versions SET video_url = ?2 || substr(video_url, length(?1) + 1)
+			WHERE substr(video_url, 1, length(?1)) = ?1`,
+		}
+		for _, query := range statements {
+			if _, err := tx.Exec(query, oldPrefix, newPrefix); err != nil {
+				return err
+			}
+		}
+
+		for url, etag := range etags {
+			if _, err := tx.Exec("UPDATE videos SET object_etag = ? WHERE video_url = ? AND object_etag IS NOT NULL", etag, url); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE video_versions SET object_etag = ? WHERE video_url = ? AND object_etag IS NOT NULL", etag, url); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range videoIDs {
+		c.invalidateVideo(id, uuid.Nil)
+	}
+	return len(videoIDs), nil
+}
@@ -0,0 +1,57 @@
+package database
+
+const unreplicatedObjects = `
+	SELECT id, video_url, encryption_key_md5, content_sha256, object_etag
+	FROM videos
+	WHERE video_url IS NOT NULL AND encryption_key_md5 IS NULL
+		AND video_url NOT IN (SELECT video_url FROM replicated_objects)
+	UNION
+	SELECT video_id, video_url, encryption_key_md5, content_sha256, object_etag
+	FROM video_versions
+	WHERE encryption_key_md5 IS NULL
+		AND video_url NOT IN (SELECT video_url FROM replicated_objects)
+	`
+
+// GetUnreplicatedObjects returns up to limit video objects, current media and
+// versions, that weren't copied to the replica bucket yet. Encrypted ones
+// are left out, they can't be copied without their owner's key.
+func (c Client) GetUnreplicatedObjects(limit int) ([]StoredObject, error) {
+	rows, err := c.db.Query(unreplicatedObjects+" LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := []StoredObject{}
+	for rows.Next() {
+		var o StoredObject
+		if err := rows.Scan(&o.VideoID, &o.VideoURL, &o.EncryptionKeyMD5, &o.ContentSHA256, &o.ObjectETag); err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	return objects, rows.Err()
+}
+
+// GetReplicationCounts returns how many objects were replicated and how many
+// are still waiting.
+func (c Client) GetReplicationCounts() (replicated, pending int, err error) {
+	err = c.db.QueryRow("SELECT COUNT(*) FROM replicated_objects").Scan(&replicated)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = c.db.QueryRow("SELECT COUNT(*) FROM (" + unreplicatedObjects + ")").Scan(&pending)
+	return replicated, pending, err
+}
+
+func (c Client) RecordReplicatedObject(videoURL, etag string) error {
+	query := `
+	INSERT INTO replicated_objects (video_url, replicated_at, etag)
+	VALUES (?, CURRENT_TIMESTAMP, ?)
+	ON CONFLICT(video_url) DO UPDATE SET
+		replicated_at = excluded.replicated_at,
+		etag = excluded.etag
+	`
+	_, err := c.exec(query, videoURL, etag)
+	return err
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Cache holds serialized query results in front of the database.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(keys ...string)
+}
+
+type cacheSettings struct {
+	cache Cache
+	ttl   time.Duration
+}
+
+// SetCache caches single videos and per-user listings for up to ttl. Writes
+// through this client invalidate the affected entries, except view counts,
+// which may lag by up to ttl.
+func (c *Client) SetCache(cache Cache, ttl time.Duration) {
+	c.cache = &cacheSettings{cache: cache, ttl: ttl}
+}
+
+func videoCacheKey(id uuid.UUID) string {
+	return fmt.Sprintf("video:%s", id)
+}
+
+func userVideosCacheKey(userID uuid.UUID) string {
+	return fmt.Sprintf("videos:user:%s", userID)
+}
+
+func (c Client) cacheGet(key string, dest any) bool {
+	if c.cache == nil {
+		return false
+	}
+	data, ok := c.cache.cache.Get(key)
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		log.Printf("Ignoring corrupt cache entry %s: %v", key, err)
+		return false
+	}
+	return true
+}
+
+func (c Client) cacheSet(key string, value any) {
+	if c.cache == nil {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Couldn't cache %s: %v", key, err)
+		return
+	}
+	c.cache.cache.Set(key, data, c.cache.ttl)
+}
+
+// invalidateVideo drops a video and its owner's listing. Pass uuid.Nil for
+// userID when it isn't known and it is looked up.
+func (c Client) invalidateVideo(id, userID uuid.UUID) {
+	if c.cache == nil {
+		return
+	}
+	if userID == uuid.Nil {
+		err := c.db.QueryRow("SELECT user_id FROM videos WHERE id = ?", id).Scan(&userID)
+		if err != nil {
+			c.cache.cache.Delete(videoCacheKey(id))
+			return
+		}
+	}
+	c.cache.cache.Delete(videoCacheKey(id), userVideosCacheKey(userID))
+}
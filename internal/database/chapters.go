@@ -0,0 +1,124 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Chapter struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreateChapterParams
+}
+
+type CreateChapterParams struct {
+	VideoID      uuid.UUID `json:"video_id"`
+	Title        string    `json:"title"`
+	StartSeconds float64   `json:"start_seconds"`
+}
+
+const chapterColumns = `
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		title,
+		start_seconds`
+
+func scanChapter(row rowScanner) (Chapter, error) {
+	var chapter Chapter
+	err := row.Scan(
+		&chapter.ID,
+		&chapter.CreatedAt,
+		&chapter.UpdatedAt,
+		&chapter.VideoID,
+		&chapter.Title,
+		&chapter.StartSeconds,
+	)
+	return chapter, err
+}
+
+func (c Client) CreateChapter(params CreateChapterParams) (Chapter, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO chapters (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		title,
+		start_seconds
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	`
+	_, err := c.exec(query, id, params.VideoID, params.Title, params.StartSeconds)
+	if err != nil {
+		return Chapter{}, err
+	}
+
+	return c.GetChapter(id)
+}
+
+func (c Client) GetChapter(id uuid.UUID) (Chapter, error) {
+	query := `
+	SELECT` + chapterColumns + `
+	FROM chapters
+	WHERE id = ?
+	`
+
+	chapter, err := scanChapter(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Chapter{}, nil
+		}
+		return Chapter{}, err
+	}
+	return chapter, nil
+}
+
+// GetChapters returns a video's chapters in playback order.
+func (c Client) GetChapters(videoID uuid.UUID) ([]Chapter, error) {
+	query := `
+	SELECT` + chapterColumns + `
+	FROM chapters
+	WHERE video_id = ?
+	ORDER BY start_seconds ASC, created_at ASC
+	`
+
+	rows, err := c.reader().Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chapters := []Chapter{}
+	for rows.Next() {
+		chapter, err := scanChapter(rows)
+		if err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, chapter)
+	}
+	return chapters, rows.Err()
+}
+
+func (c Client) UpdateChapter(chapter Chapter) error {
+	query := `
+	UPDATE chapters
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		title = ?,
+		start_seconds = ?
+	WHERE id = ?
+	`
+	_, err := c.exec(query, chapter.Title, chapter.StartSeconds, chapter.ID)
+	return err
+}
+
+func (c Client) DeleteChapter(id uuid.UUID) error {
+	_, err := c.exec("DELETE FROM chapters WHERE id = ?", id)
+	return err
+}
@@ -2,21 +2,29 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"sync"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// CurrentSchemaVersion is bumped whenever autoMigrate changes the schema.
+const CurrentSchemaVersion = 35
+
 type Client struct {
-	db *sql.DB
+	db       *sql.DB
+	writeMu  *sync.Mutex
+	replicas *replicaSet
+	cache    *cacheSettings
 }
 
 func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+	db, err := sql.Open("sqlite3", sqliteDSN(pathToDB))
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
+	c := Client{db: db, writeMu: &sync.Mutex{}}
 	err = c.autoMigrate()
 	if err != nil {
 		return Client{}, err
@@ -35,7 +43,23 @@ func (c *Client) autoMigrate() error {
 		email TEXT UNIQUE NOT NULL
 	);
 	`
-	_, err := c.db.Exec(userTable)
+	_, err := c.exec(userTable)
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("users", "plan", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("users", "display_name", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("users", "bio", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("users", "avatar_url", "TEXT")
 	if err != nil {
 		return err
 	}
@@ -50,7 +74,7 @@ func (c *Client) autoMigrate() error {
 		FOREIGN KEY(user_id) REFERENCES users(id)
 	);
 	`
-	_, err = c.db.Exec(refreshTokenTable)
+	_, err = c.exec(refreshTokenTable)
 	if err != nil {
 		return err
 	}
@@ -68,22 +92,886 @@ func (c *Client) autoMigrate() error {
 		FOREIGN KEY(user_id) REFERENCES users(id)
 	);
 	`
-	_, err = c.db.Exec(videoTable)
+	_, err = c.exec(videoTable)
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "visibility", "TEXT NOT NULL DEFAULT 'private'")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "video_size", "INTEGER")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "thumbnail_size", "INTEGER")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "view_count", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "processing_seconds", "REAL NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "slug", "TEXT")
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_videos_user_slug ON videos(user_id, slug)")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "duration_seconds", "REAL")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "expires_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "expired_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "retained_until", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "encryption_key_md5", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "content_sha256", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "object_etag", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "folder_id", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "thumbnail_focus_x", "REAL")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "thumbnail_focus_y", "REAL")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "thumbnail_alt_text", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("videos", "audio_description_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	// the highest version number handed out, see AllocateVideoVersion
+	err = c.addColumnIfNotExists("videos", "last_version", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	videoVersionTable := `
+	CREATE TABLE IF NOT EXISTS video_versions (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		video_url TEXT NOT NULL,
+		UNIQUE(video_id, version),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(videoVersionTable)
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("video_versions", "video_size", "INTEGER")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("video_versions", "encryption_key_md5", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("video_versions", "content_sha256", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("video_versions", "object_etag", "TEXT")
+	if err != nil {
+		return err
+	}
+
+	chapterTable := `
+	CREATE TABLE IF NOT EXISTS chapters (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		start_seconds REAL NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(chapterTable)
+	if err != nil {
+		return err
+	}
+
+	playbackRestrictionTable := `
+	CREATE TABLE IF NOT EXISTS playback_restrictions (
+		video_id TEXT PRIMARY KEY,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		allowed_countries TEXT NOT NULL DEFAULT '',
+		allowed_cidrs TEXT NOT NULL DEFAULT '',
+		denied_cidrs TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(playbackRestrictionTable)
+	if err != nil {
+		return err
+	}
+
+	reportTable := `
+	CREATE TABLE IF NOT EXISTS reports (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		status TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		details TEXT NOT NULL,
+		reporter_email TEXT NOT NULL,
+		reporter_ip TEXT NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(reportTable)
+	if err != nil {
+		return err
+	}
+
+	takedownTable := `
+	CREATE TABLE IF NOT EXISTS takedowns (
+		video_id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		status TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		appeal TEXT,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(takedownTable)
+	if err != nil {
+		return err
+	}
+
+	auditLogTable := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		details TEXT NOT NULL
+	);
+	`
+	_, err = c.exec(auditLogTable)
+	if err != nil {
+		return err
+	}
+
+	integrityFailureTable := `
+	CREATE TABLE IF NOT EXISTS integrity_failures (
+		id TEXT PRIMARY KEY,
+		detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		object_key TEXT NOT NULL,
+		problem TEXT NOT NULL,
+		expected TEXT,
+		actual TEXT,
+		UNIQUE(object_key, problem),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(integrityFailureTable)
+	if err != nil {
+		return err
+	}
+
+	reencodeCampaignTable := `
+	CREATE TABLE IF NOT EXISTS reencode_campaigns (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		status TEXT NOT NULL,
+		total INTEGER NOT NULL DEFAULT 0,
+		processed INTEGER NOT NULL DEFAULT 0,
+		failed INTEGER NOT NULL DEFAULT 0,
+		skipped INTEGER NOT NULL DEFAULT 0,
+		cursor TEXT,
+		last_error TEXT,
+		video_codec TEXT NOT NULL,
+		max_height INTEGER NOT NULL DEFAULT 0,
+		crf INTEGER NOT NULL
+	);
+	`
+	_, err = c.exec(reencodeCampaignTable)
+	if err != nil {
+		return err
+	}
+
+	bucketMigrationTable := `
+	CREATE TABLE IF NOT EXISTS bucket_migration_objects (
+		dest_bucket TEXT NOT NULL,
+		object_key TEXT NOT NULL,
+		copied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		source_etag TEXT NOT NULL,
+		dest_etag TEXT NOT NULL,
+		PRIMARY KEY (dest_bucket, object_key)
+	);
+	`
+	_, err = c.exec(bucketMigrationTable)
+	if err != nil {
+		return err
+	}
+
+	archivedObjectTable := `
+	CREATE TABLE IF NOT EXISTS archived_objects (
+		video_url TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		path TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		mirrored_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err = c.exec(archivedObjectTable)
+	if err != nil {
+		return err
+	}
+
+	replicatedObjectTable := `
+	CREATE TABLE IF NOT EXISTS replicated_objects (
+		video_url TEXT PRIMARY KEY,
+		replicated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		etag TEXT NOT NULL
+	);
+	`
+	_, err = c.exec(replicatedObjectTable)
+	if err != nil {
+		return err
+	}
+
+	playbackSessionTable := `
+	CREATE TABLE IF NOT EXISTS playback_sessions (
+		video_id TEXT NOT NULL,
+		id TEXT NOT NULL,
+		started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		max_position REAL NOT NULL DEFAULT 0,
+		last_position REAL NOT NULL DEFAULT 0,
+		watched_seconds REAL NOT NULL DEFAULT 0,
+		buffering_seconds REAL NOT NULL DEFAULT 0,
+		quality_switches INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (video_id, id)
+	);
+	`
+	_, err = c.exec(playbackSessionTable)
+	if err != nil {
+		return err
+	}
+
+	playbackSpanTable := `
+	CREATE TABLE IF NOT EXISTS playback_spans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		video_id TEXT NOT NULL,
+		start_position REAL NOT NULL,
+		end_position REAL NOT NULL
+	);
+	`
+	_, err = c.exec(playbackSpanTable)
+	if err != nil {
+		return err
+	}
+
+	replayHeatmapTable := `
+	CREATE TABLE IF NOT EXISTS replay_heatmaps (
+		video_id TEXT PRIMARY KEY,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		duration_seconds REAL NOT NULL,
+		views TEXT NOT NULL
+	);
+	`
+	_, err = c.exec(replayHeatmapTable)
+	if err != nil {
+		return err
+	}
+
+	videoEgressTable := `
+	CREATE TABLE IF NOT EXISTS video_egress (
+		video_id TEXT NOT NULL,
+		day DATE NOT NULL,
+		bytes INTEGER NOT NULL DEFAULT 0,
+		requests INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (video_id, day)
+	);
+	`
+	_, err = c.exec(videoEgressTable)
+	if err != nil {
+		return err
+	}
+
+	accessLogFileTable := `
+	CREATE TABLE IF NOT EXISTS access_log_files (
+		key TEXT PRIMARY KEY,
+		imported_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		lines INTEGER NOT NULL
+	);
+	`
+	_, err = c.exec(accessLogFileTable)
+	if err != nil {
+		return err
+	}
+
+	watchProgressTable := `
+	CREATE TABLE IF NOT EXISTS watch_progress (
+		user_id TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		position REAL NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (user_id, video_id),
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(watchProgressTable)
+	if err != nil {
+		return err
+	}
+
+	savedVideoTable := `
+	CREATE TABLE IF NOT EXISTS saved_videos (
+		user_id TEXT NOT NULL,
+		list TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, list, video_id),
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(savedVideoTable)
+	if err != nil {
+		return err
+	}
+
+	shareLinkTable := `
+	CREATE TABLE IF NOT EXISTS share_links (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		label TEXT NOT NULL DEFAULT '',
+		view_count INTEGER NOT NULL DEFAULT 0,
+		last_viewed_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(shareLinkTable)
+	if err != nil {
+		return err
+	}
+
+	folderTable := `
+	CREATE TABLE IF NOT EXISTS folders (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		parent_id TEXT,
+		name TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(parent_id) REFERENCES folders(id)
+	);
+	`
+	_, err = c.exec(folderTable)
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("folders", "default_visibility", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("folders", "video_codec", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("folders", "max_height", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("folders", "crf", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	uploadPresetTable := `
+	CREATE TABLE IF NOT EXISTS upload_presets (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		name TEXT NOT NULL,
+		visibility TEXT NOT NULL DEFAULT '',
+		expires_in_seconds INTEGER NOT NULL DEFAULT 0,
+		video_codec TEXT NOT NULL DEFAULT '',
+		max_height INTEGER NOT NULL DEFAULT 0,
+		crf INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.exec(uploadPresetTable)
+	if err != nil {
+		return err
+	}
+
+	videoTranslationTable := `
+	CREATE TABLE IF NOT EXISTS video_translations (
+		video_id TEXT NOT NULL,
+		language TEXT NOT NULL,
+		title TEXT NOT NULL,
+		description TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (video_id, language),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(videoTranslationTable)
+	if err != nil {
+		return err
+	}
+
+	// no foreign key, entries outlive their video until the thumbnail GC
+	// has deleted their files
+	thumbnailHistoryTable := `
+	CREATE TABLE IF NOT EXISTS thumbnail_history (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		thumbnail_url TEXT NOT NULL,
+		thumbnail_size INTEGER,
+		replaced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err = c.exec(thumbnailHistoryTable)
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("thumbnail_history", "focus_x", "REAL")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("thumbnail_history", "focus_y", "REAL")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("thumbnail_history", "alt_text", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	// variant A is the video's own thumbnail, B the one under test
+	thumbnailExperimentTable := `
+	CREATE TABLE IF NOT EXISTS thumbnail_experiments (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		completed_at TIMESTAMP,
+		status TEXT NOT NULL,
+		sample_size INTEGER NOT NULL,
+		thumbnail_url TEXT NOT NULL,
+		thumbnail_size INTEGER,
+		alt_text TEXT NOT NULL DEFAULT '',
+		impressions_a INTEGER NOT NULL DEFAULT 0,
+		clicks_a INTEGER NOT NULL DEFAULT 0,
+		impressions_b INTEGER NOT NULL DEFAULT 0,
+		clicks_b INTEGER NOT NULL DEFAULT 0,
+		winner TEXT
+	);
+	`
+	_, err = c.exec(thumbnailExperimentTable)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_thumbnail_experiments_running ON thumbnail_experiments(video_id) WHERE status = 'running'")
+	if err != nil {
+		return err
+	}
+
+	liveStreamTable := `
+	CREATE TABLE IF NOT EXISTS live_streams (
+		video_id TEXT PRIMARY KEY,
+		stream_key TEXT NOT NULL UNIQUE,
+		status TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		started_at TIMESTAMP,
+		ended_at TIMESTAMP,
+		error TEXT
+	);
+	`
+	_, err = c.exec(liveStreamTable)
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("live_streams", "low_latency", "BOOLEAN NOT NULL DEFAULT FALSE")
+	if err != nil {
+		return err
+	}
+	err = c.addColumnIfNotExists("live_streams", "part_target", "REAL NOT NULL DEFAULT 0.5")
+	if err != nil {
+		return err
+	}
+
+	streamKeyTable := `
+	CREATE TABLE IF NOT EXISTS stream_keys (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		key TEXT NOT NULL UNIQUE,
+		label TEXT NOT NULL DEFAULT '',
+		visibility TEXT NOT NULL,
+		low_latency BOOLEAN NOT NULL DEFAULT FALSE,
+		part_target REAL NOT NULL DEFAULT 0.5,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		rotated_at TIMESTAMP,
+		last_used_at TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.exec(streamKeyTable)
+	if err != nil {
+		return err
+	}
+
+	followTable := `
+	CREATE TABLE IF NOT EXISTS follows (
+		follower_id TEXT NOT NULL,
+		followee_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (follower_id, followee_id),
+		FOREIGN KEY(follower_id) REFERENCES users(id),
+		FOREIGN KEY(followee_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.exec(followTable)
+	if err != nil {
+		return err
+	}
+
+	trendingVideoTable := `
+	CREATE TABLE IF NOT EXISTS trending_videos (
+		video_id TEXT PRIMARY KEY,
+		score REAL NOT NULL,
+		ranked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err = c.exec(trendingVideoTable)
+	if err != nil {
+		return err
+	}
+
+	emailDigestTable := `
+	CREATE TABLE IF NOT EXISTS email_digests (
+		user_id TEXT PRIMARY KEY,
+		enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		timezone TEXT NOT NULL DEFAULT 'UTC',
+		last_sent_at TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.exec(emailDigestTable)
+	if err != nil {
+		return err
+	}
+
+	notificationTable := `
+	CREATE TABLE IF NOT EXISTS notifications (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		type TEXT NOT NULL,
+		video_id TEXT,
+		actor_id TEXT,
+		read_at TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.exec(notificationTable)
+	if err != nil {
+		return err
+	}
+
+	eventTable := `
+	CREATE TABLE IF NOT EXISTS events (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_error TEXT,
+		published_at TIMESTAMP
+	);
+	`
+	_, err = c.exec(eventTable)
+	if err != nil {
+		return err
+	}
+
+	processingJobTable := `
+	CREATE TABLE IF NOT EXISTS processing_jobs (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		locked_until TIMESTAMP,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		source_key TEXT NOT NULL,
+		source_size INTEGER NOT NULL,
+		content_type TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.exec(processingJobTable)
+	if err != nil {
+		return err
+	}
+
+	leaseTable := `
+	CREATE TABLE IF NOT EXISTS leases (
+		name TEXT PRIMARY KEY,
+		holder TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);
+	`
+	_, err = c.exec(leaseTable)
+	if err != nil {
+		return err
+	}
+
+	heartbeatTable := `
+	CREATE TABLE IF NOT EXISTS replication_heartbeat (
+		id INTEGER PRIMARY KEY,
+		beat_at TIMESTAMP NOT NULL
+	);
+	`
+	_, err = c.exec(heartbeatTable)
+	if err != nil {
+		return err
+	}
+
+	featureFlagTable := `
+	CREATE TABLE IF NOT EXISTS feature_flags (
+		name TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		rollout_percentage INTEGER NOT NULL DEFAULT 0
+	);
+	`
+	_, err = c.exec(featureFlagTable)
+	if err != nil {
+		return err
+	}
+
+	featureFlagUserTable := `
+	CREATE TABLE IF NOT EXISTS feature_flag_users (
+		flag_name TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		PRIMARY KEY (flag_name, user_id),
+		FOREIGN KEY(flag_name) REFERENCES feature_flags(name) ON DELETE CASCADE,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.exec(featureFlagUserTable)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.exec(fmt.Sprintf("PRAGMA user_version = %d", CurrentSchemaVersion))
+	return err
+}
+
+// SchemaVersion returns the version recorded by the last migration, so
+// deploys can tell whether the database matches this build.
+func (c Client) SchemaVersion() (int, error) {
+	var version int
+	err := c.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// addColumnIfNotExists brings tables created by older versions up to date,
+// since CREATE TABLE IF NOT EXISTS won't touch an existing table.
+func (c *Client) addColumnIfNotExists(table, column, definition string) error {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = c.exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
 	return nil
 }
 
 func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
+	if _, err := c.exec("DELETE FROM archived_objects"); err != nil {
+		return fmt.Errorf("failed to reset table archived_objects: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM audit_log"); err != nil {
+		return fmt.Errorf("failed to reset table audit_log: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM bucket_migration_objects"); err != nil {
+		return fmt.Errorf("failed to reset table bucket_migration_objects: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM chapters"); err != nil {
+		return fmt.Errorf("failed to reset table chapters: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM events"); err != nil {
+		return fmt.Errorf("failed to reset table events: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM video_translations"); err != nil {
+		return fmt.Errorf("failed to reset table video_translations: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM thumbnail_history"); err != nil {
+		return fmt.Errorf("failed to reset table thumbnail_history: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM upload_presets"); err != nil {
+		return fmt.Errorf("failed to reset table upload_presets: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM folders"); err != nil {
+		return fmt.Errorf("failed to reset table folders: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM share_links"); err != nil {
+		return fmt.Errorf("failed to reset table share_links: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM saved_videos"); err != nil {
+		return fmt.Errorf("failed to reset table saved_videos: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM watch_progress"); err != nil {
+		return fmt.Errorf("failed to reset table watch_progress: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM notifications"); err != nil {
+		return fmt.Errorf("failed to reset table notifications: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM follows"); err != nil {
+		return fmt.Errorf("failed to reset table follows: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM integrity_failures"); err != nil {
+		return fmt.Errorf("failed to reset table integrity_failures: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM feature_flag_users"); err != nil {
+		return fmt.Errorf("failed to reset table feature_flag_users: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM video_egress"); err != nil {
+		return fmt.Errorf("failed to reset table video_egress: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM access_log_files"); err != nil {
+		return fmt.Errorf("failed to reset table access_log_files: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM email_digests"); err != nil {
+		return fmt.Errorf("failed to reset table email_digests: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM stream_keys"); err != nil {
+		return fmt.Errorf("failed to reset table stream_keys: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM live_streams"); err != nil {
+		return fmt.Errorf("failed to reset table live_streams: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM thumbnail_experiments"); err != nil {
+		return fmt.Errorf("failed to reset table thumbnail_experiments: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM playback_spans"); err != nil {
+		return fmt.Errorf("failed to reset table playback_spans: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM replay_heatmaps"); err != nil {
+		return fmt.Errorf("failed to reset table replay_heatmaps: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM playback_sessions"); err != nil {
+		return fmt.Errorf("failed to reset table playback_sessions: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM playback_restrictions"); err != nil {
+		return fmt.Errorf("failed to reset table playback_restrictions: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM processing_jobs"); err != nil {
+		return fmt.Errorf("failed to reset table processing_jobs: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM reencode_campaigns"); err != nil {
+		return fmt.Errorf("failed to reset table reencode_campaigns: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM replicated_objects"); err != nil {
+		return fmt.Errorf("failed to reset table replicated_objects: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM reports"); err != nil {
+		return fmt.Errorf("failed to reset table reports: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM takedowns"); err != nil {
+		return fmt.Errorf("failed to reset table takedowns: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM trending_videos"); err != nil {
+		return fmt.Errorf("failed to reset table trending_videos: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
 	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
+	if _, err := c.exec("DELETE FROM users"); err != nil {
 		return fmt.Errorf("failed to reset table users: %w", err)
 	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
+	if _, err := c.exec("DELETE FROM video_versions"); err != nil {
+		return fmt.Errorf("failed to reset table video_versions: %w", err)
+	}
+	if _, err := c.exec("DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
 	return nil
 }
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EgressDay is what was served of a video on one day, by the bucket or the
+// CDN in front of it.
+type EgressDay struct {
+	VideoID  uuid.UUID
+	Day      time.Time
+	Bytes    int64
+	Requests int
+}
+
+// LastImportedAccessLog returns the last access log file imported under
+// prefix in key order, "" when none was.
+func (c Client) LastImportedAccessLog(prefix string) (string, error) {
+	var key sql.NullString
+	err := c.reader().QueryRow("SELECT MAX(key) FROM access_log_files WHERE key >= ? AND key < ?", prefix, prefix+"\xff").Scan(&key)
+	if err != nil {
+		return "", err
+	}
+	return key.String, nil
+}
+
+// RecordAccessLog adds the egress counted in an access log file to its
+// videos and marks the file imported, both or neither. A file that was
+// already imported is left alone, so it's never counted twice.
+func (c Client) RecordAccessLog(key string, lines int, egress []EgressDay) (bool, error) {
+	imported := false
+	err := c.writeTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec("INSERT INTO access_log_files (key, lines) VALUES (?, ?) ON CONFLICT(key) DO NOTHING", key, lines)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		for _, e := range egress {
+			_, err := tx.Exec(`
+			INSERT INTO video_egress (video_id, day, bytes, requests) VALUES (?, ?, ?, ?)
+			ON CONFLICT(video_id, day) DO UPDATE SET
+				bytes = bytes + excluded.bytes,
+				requests = requests + excluded.requests
+			`, e.VideoID, e.Day.Format(time.DateOnly), e.Bytes, e.Requests)
+			if err != nil {
+				return err
+			}
+		}
+		imported = true
+		return nil
+	})
+	return imported, err
+}
+
+// GetVideoEgress returns what was served of a video each day since since,
+// oldest first. Days nothing was served are left out.
+func (c Client) GetVideoEgress(videoID uuid.UUID, since time.Time) ([]EgressDay, error) {
+	rows, err := c.reader().Query(`
+	SELECT day, bytes, requests FROM video_egress
+	WHERE video_id = ? AND day >= ?
+	ORDER BY day
+	`, videoID, since.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []EgressDay{}
+	for rows.Next() {
+		e := EgressDay{VideoID: videoID}
+		if err := rows.Scan(&e.Day, &e.Bytes, &e.Requests); err != nil {
+			return nil, err
+		}
+		days = append(days, e)
+	}
+	return days, rows.Err()
+}
+
+// GetVideoIDByObjectURL returns the video whose current or an earlier
+// version is stored at objectURL, uuid.Nil when none is.
+func (c Client) GetVideoIDByObjectURL(objectURL string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := c.reader().QueryRow(`
+	SELECT id FROM videos WHERE video_url = ?
+	UNION
+	SELECT video_id FROM video_versions WHERE video_url = ?
+	LIMIT 1
+	`, objectURL, objectURL).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil
+	}
+	return id, err
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DigestSettings is whether a user gets the weekly email digest, and the
+// time zone it's scheduled in.
+type DigestSettings struct {
+	UserID   uuid.UUID `json:"-"`
+	Enabled  bool      `json:"enabled"`
+	Timezone string    `json:"timezone"`
+	// LastSentAt is when the last digest went out, or when the user opted
+	// in, so the first one doesn't cover a week before it
+	LastSentAt *time.Time `json:"last_sent_at"`
+}
+
+// DigestRecipient is a user who opted into the digest.
+type DigestRecipient struct {
+	DigestSettings
+	Email string
+}
+
+// DigestVideo is how one of the owner's videos did over a digest's period.
+type DigestVideo struct {
+	VideoID        uuid.UUID
+	Title          string
+	Sessions       int
+	WatchedSeconds float64
+}
+
+// DigestStats sums up the playback sessions of a user's videos over a
+// digest's period.
+type DigestStats struct {
+	Sessions       int
+	WatchedSeconds float64
+	// most watched first
+	TopVideos []DigestVideo
+}
+
+// GetDigestSettings returns the user's settings, disabled in UTC when they
+// never set any.
+func (c Client) GetDigestSettings(userID uuid.UUID) (DigestSettings, error) {
+	settings := DigestSettings{UserID: userID, Timezone: "UTC"}
+	err := c.reader().QueryRow("SELECT enabled, timezone, last_sent_at FROM email_digests WHERE user_id = ?", userID).Scan(&settings.Enabled, &settings.Timezone, &settings.LastSentAt)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	return settings, err
+}
+
+func (c Client) SetDigestSettings(settings DigestSettings) error {
+	_, err := c.exec(`
+	INSERT INTO email_digests (user_id, enabled, timezone, last_sent_at) VALUES (?, ?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		enabled = excluded.enabled,
+		timezone = excluded.timezone,
+		last_sent_at = excluded.last_sent_at
+	`, settings.UserID, settings.Enabled, settings.Timezone, timestampArg(settings.LastSentAt))
+	return err
+}
+
+// GetDigestRecipients returns the users who opted into the digest.
+func (c Client) GetDigestRecipients() ([]DigestRecipient, error) {
+	rows, err := c.reader().Query(`
+	SELECT users.id, users.email, email_digests.timezone, email_digests.last_sent_at
+	FROM email_digests
+	JOIN users ON users.id = email_digests.user_id
+	WHERE email_digests.enabled
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []DigestRecipient{}
+	for rows.Next() {
+		r := DigestRecipient{DigestSettings: DigestSettings{Enabled: true}}
+		if err := rows.Scan(&r.UserID, &r.Email, &r.Timezone, &r.LastSentAt); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+func (c Client) MarkDigestSent(userID uuid.UUID, at time.Time) error {
+	_, err := c.exec("UPDATE email_digests SET last_sent_at = ? WHERE user_id = ?", timestampArg(&at), userID)
+	return err
+}
+
+// GetDigestStats sums up the playback sessions of the user's videos that
+// started in [since, until), with the limit most watched videos.
+func (c Client) GetDigestStats(userID uuid.UUID, since, until time.Time, limit int) (DigestStats, error) {
+	query := `
+	SELECT videos.id, videos.title, COUNT(*), SUM(playback_sessions.watched_seconds) AS watched
+	FROM playback_sessions
+	JOIN videos ON videos.id = playback_sessions.video_id
+	WHERE videos.user_id = ? AND playback_sessions.started_at >= ? AND playback_sessions.started_at < ?
+	GROUP BY videos.id
+	ORDER BY watched DESC, videos.id
+	`
+	// compared as text, so the format must match CURRENT_TIMESTAMP's
+	rows, err := c.reader().Query(query, userID, since.UTC().Format(time.DateTime), until.UTC().Format(time.DateTime))
+	if err != nil {
+		return DigestStats{}, err
+	}
+	defer rows.Close()
+
+	stats := DigestStats{TopVideos: []DigestVideo{}}
+	for rows.Next() {
+		var v DigestVideo
+		if err := rows.Scan(&v.VideoID, &v.Title, &v.Sessions, &v.WatchedSeconds); err != nil {
+			return DigestStats{}, err
+		}
+		stats.Sessions += v.Sessions
+		stats.WatchedSeconds += v.WatchedSeconds
+		if len(stats.TopVideos) < limit {
+			stats.TopVideos = append(stats.TopVideos, v)
+		}
+	}
+	return stats, rows.Err()
+}
+
+// timestampArg formats t like CURRENT_TIMESTAMP, so it compares as text
+// with the timestamps SQLite fills in.
+func timestampArg(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.DateTime)
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Event struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Type      string    `json:"type"`
+	Payload   string    `json:"payload"`
+	Attempts  int       `json:"attempts"`
+}
+
+// CreateEvent adds an event to the outbox. It stays there until a publisher
+// confirms delivery with MarkEventPublished.
+func (c Client) CreateEvent(eventType, payload string) (uuid.UUID, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO events (
+		id,
+		created_at,
+		type,
+		payload,
+		next_attempt_at
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err := c.exec(query, id, eventType, payload)
+	return id, err
+}
+
+// GetPendingEvents returns unpublished events that are due for a delivery
+// attempt, oldest first.
+func (c Client) GetPendingEvents(limit int) ([]Event, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		type,
+		payload,
+		attempts
+	FROM events
+	WHERE published_at IS NULL AND next_attempt_at <= ?
+	ORDER BY created_at
+	LIMIT ?
+	`
+
+	rows, err := c.db.Query(query, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Type, &e.Payload, &e.Attempts); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (c Client) MarkEventPublished(id uuid.UUID) error {
+	_, err := c.exec("UPDATE events SET published_at = CURRENT_TIMESTAMP, last_error = NULL WHERE id = ?", id)
+	return err
+}
+
+func (c Client) MarkEventFailed(id uuid.UUID, nextAttemptAt time.Time, lastError string) error {
+	query := `
+	UPDATE events
+	SET
+		attempts = attempts + 1,
+		next_attempt_at = ?,
+		last_error = ?
+	WHERE id = ?
+	`
+	_, err := c.exec(query, nextAttemptAt.UTC(), lastError, id)
+	return err
+}
+
+// DeletePublishedEvents prunes delivered events older than before.
+func (c Client) DeletePublishedEvents(before time.Time) error {
+	_, err := c.exec("DELETE FROM events WHERE published_at IS NOT NULL AND published_at < ?", before.UTC())
+	return err
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type FeatureFlag struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpsertFeatureFlagParams
+}
+
+type UpsertFeatureFlagParams struct {
+	Name              string      `json:"name"`
+	Enabled           bool        `json:"enabled"`
+	RolloutPercentage int         `json:"rollout_percentage"`
+	UserIDs           []uuid.UUID `json:"user_ids"`
+}
+
+func (c Client) UpsertFeatureFlag(params UpsertFeatureFlagParams) (FeatureFlag, error) {
+	err := c.writeTx(func(tx *sql.Tx) error {
+		query := `
+		INSERT INTO feature_flags (
+			name,
+			created_at,
+			updated_at,
+			enabled,
+			rollout_percentage
+		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			updated_at = CURRENT_TIMESTAMP,
+			enabled = excluded.enabled,
+			rollout_percentage = excluded.rollout_percentage
+		`
+		_, err := tx.Exec(query, params.Name, params.Enabled, params.RolloutPercentage)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM feature_flag_users WHERE flag_name = ?", params.Name)
+		if err != nil {
+			return err
+		}
+		for _, userID := range params.UserIDs {
+			_, err = tx.Exec("INSERT OR IGNORE INTO feature_flag_users (flag_name, user_id) VALUES (?, ?)", params.Name, userID.String())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return FeatureFlag{}, err
+	}
+
+	return c.GetFeatureFlag(params.Name)
+}
+
+func (c Client) GetFeatureFlag(name string) (FeatureFlag, error) {
+	query := `
+	SELECT
+		name,
+		created_at,
+		updated_at,
+		enabled,
+		rollout_percentage
+	FROM feature_flags
+	WHERE name = ?
+	`
+
+	var flag FeatureFlag
+	err := c.db.QueryRow(query, name).Scan(
+		&flag.Name,
+		&flag.CreatedAt,
+		&flag.UpdatedAt,
+		&flag.Enabled,
+		&flag.RolloutPercentage,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return FeatureFlag{}, nil
+		}
+		return FeatureFlag{}, err
+	}
+
+	flag.UserIDs, err = c.getFeatureFlagUsers(name)
+	if err != nil {
+		return FeatureFlag{}, err
+	}
+	return flag, nil
+}
+
+func (c Client) GetFeatureFlags() ([]FeatureFlag, error) {
+	query := `
+	SELECT
+		name,
+		created_at,
+		updated_at,
+		enabled,
+		rollout_percentage
+	FROM feature_flags
+	ORDER BY name
+	`
+
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []FeatureFlag{}
+	for rows.Next() {
+		var flag FeatureFlag
+		if err := rows.Scan(
+			&flag.Name,
+			&flag.CreatedAt,
+			&flag.UpdatedAt,
+			&flag.Enabled,
+			&flag.RolloutPercentage,
+		); err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range flags {
+		flags[i].UserIDs, err = c.getFeatureFlagUsers(flags[i].Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return flags, nil
+}
+
+func (c Client) getFeatureFlagUsers(name string) ([]uuid.UUID, error) {
+	rows, err := c.db.Query("SELECT user_id FROM feature_flag_users WHERE flag_name = ? ORDER BY user_id", name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := []uuid.UUID{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+func (c Client) DeleteFeatureFlag(name string) error {
+	_, err := c.exec("DELETE FROM feature_flag_users WHERE flag_name = ?", name)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM feature_flags WHERE name = ?", name)
+	return err
+}
@@ -0,0 +1,298 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrFolderNameTaken is returned when the parent already has a folder with
+// the name.
+var ErrFolderNameTaken = errors.New("folder name is already in use")
+
+// Folder groups a user's videos, ParentID is nil for top-level folders.
+type Folder struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ParentID  *uuid.UUID `json:"parent_id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	FolderSettings
+}
+
+// FolderSettings are defaults for the videos in a folder. Zero values are
+// inherited from the parent folder, an empty VideoCodec inherits the whole
+// encoding profile.
+type FolderSettings struct {
+	DefaultVisibility string `json:"default_visibility"`
+	EncodingProfile
+}
+
+// Inherit fills the settings left unset from parent's.
+func (s FolderSettings) Inherit(parent FolderSettings) FolderSettings {
+	if s.DefaultVisibility == "" {
+		s.DefaultVisibility = parent.DefaultVisibility
+	}
+	if s.VideoCodec == "" {
+		s.EncodingProfile = parent.EncodingProfile
+	}
+	return s
+}
+
+func (c Client) CreateFolder(userID uuid.UUID, parentID *uuid.UUID, name string) (Folder, error) {
+	id := uuid.New()
+	err := c.writeTx(func(tx *sql.Tx) error {
+		if err := checkFolderName(tx, userID, parentID, name, uuid.Nil); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+		INSERT INTO folders (id, user_id, parent_id, name, created_at, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		`, id, userID, parentID, name)
+		return err
+	})
+	if err != nil {
+		return Folder{}, err
+	}
+	return c.GetFolder(id)
+}
+
+// checkFolderName returns ErrFolderNameTaken if a folder other than
+// excludeID has name under parentID. Names are compared ignoring case.
+func checkFolderName(tx *sql.Tx, userID uuid.UUID, parentID *uuid.UUID, name string, excludeID uuid.UUID) error {
+	var n int
+	err := tx.QueryRow(`
+	SELECT COUNT(*) FROM folders
+	WHERE user_id = ? AND parent_id IS ? AND name = ? COLLATE NOCASE AND id != ?
+	`, userID, parentID, name, excludeID).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrFolderNameTaken
+	}
+	return nil
+}
+
+// GetFolder returns a zero Folder if there is no such folder.
+func (c Client) GetFolder(id uuid.UUID) (Folder, error) {
+	folders, err := c.queryFolders("WHERE id = ?", id)
+	if err != nil || len(folders) == 0 {
+		return Folder{}, err
+	}
+	return folders[0], nil
+}
+
+// GetFolders returns the folders in parentID, or the user's top-level
+// folders when it is nil, by name.
+func (c Client) GetFolders(userID uuid.UUID, parentID *uuid.UUID) ([]Folder, error) {
+	return c.queryFolders("WHERE user_id = ? AND parent_id IS ? ORDER BY name COLLATE NOCASE, id", userID, parentID)
+}
+
+// GetFolderPath returns the folder and its ancestors, top-level folder
+// first, or nothing if there is no such folder.
+func (c Client) GetFolderPath(id uuid.UUID) ([]Folder, error) {
+	query := `
+	WITH RECURSIVE path(id, depth) AS (
+		SELECT id, 0 FROM folders WHERE id = ?
+		UNION ALL
+		SELECT folders.parent_id, path.depth + 1
+		FROM folders JOIN path ON folders.id = path.id
+		WHERE folders.parent_id IS NOT NULL
+	)
+	SELECT` + folderColumns + `
+	FROM folders
+	WHERE id IN (SELECT id FROM path)
+	`
+	folders, err := c.scanFolders(c.reader().Query(query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	// walk down from the top-level folder, the rows come in no order
+	byParent := map[uuid.UUID]Folder{}
+	var path []Folder
+	for _, f := range folders {
+		if f.ParentID == nil {
+			path = append(path, f)
+		} else {
+			byParent[*f.ParentID] = f
+		}
+	}
+	for len(path) > 0 {
+		child, ok := byParent[path[len(path)-1].ID]
+		if !ok {
+			break
+		}
+		path = append(path, child)
+	}
+	return path, nil
+}
+
+// GetFolderDepth returns how many levels of folders are below id, 0 if it
+// has no subfolders.
+func (c Client) GetFolderDepth(id uuid.UUID) (int, error) {
+	query := `
+	WITH RECURSIVE tree(id, depth) AS (
+		SELECT id, 0 FROM folders WHERE id = ?
+		UNION ALL
+		SELECT folders.id, tree.depth + 1
+		FROM folders JOIN tree ON folders.parent_id = tree.id
+	)
+	SELECT COALESCE(MAX(depth), 0) FROM tree
+	`
+	var depth int
+	err := c.reader().QueryRow(query, id).Scan(&depth)
+	return depth, err
+}
+
+const folderColumns = `
+		id,
+		user_id,
+		parent_id,
+		name,
+		created_at,
+		updated_at,
+		default_visibility,
+		video_codec,
+		max_height,
+		crf`
+
+func (c Client) queryFolders(where string, args ...any) ([]Folder, error) {
+	query := `
+	SELECT` + folderColumns + `
+	FROM folders
+	` + where
+	return c.scanFolders(c.reader().Query(query, args...))
+}
+
+func (c Client) scanFolders(rows *sql.Rows, err error) ([]Folder, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []Folder{}
+	for rows.Next() {
+		var f Folder
+		err := rows.Scan(
+			&f.ID,
+			&f.UserID,
+			&f.ParentID,
+			&f.Name,
+			&f.CreatedAt,
+			&f.UpdatedAt,
+			&f.DefaultVisibility,
+			&f.VideoCodec,
+			&f.MaxHeight,
+			&f.CRF,
+		)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, f)
+	}
+	return folders, rows.Err()
+}
+
+// UpdateFolder saves the folder's name and parent, which renames and moves
+// it. Cycles are the caller's to check.
+func (c Client) UpdateFolder(folder Folder) error {
+	return c.writeTx(func(tx *sql.Tx) error {
+		if err := checkFolderName(tx, folder.UserID, folder.ParentID, folder.Name, folder.ID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+		UPDATE folders
+		SET name = ?, parent_id = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+		`, folder.Name, folder.ParentID, folder.ID)
+		return err
+	})
+}
+
+func (c Client) UpdateFolderSettings(id uuid.UUID, settings FolderSettings) error {
+	query := `
+	UPDATE folders
+	SET
+		default_visibility = ?,
+		video_codec = ?,
+		max_height = ?,
+		crf = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.exec(query, settings.DefaultVisibility, settings.VideoCodec, settings.MaxHeight, settings.CRF, id)
+	return err
+}
+
+// IsFolderEmpty reports whether the folder has no videos or subfolders.
+func (c Client) IsFolderEmpty(id uuid.UUID) (bool, error) {
+	query := `
+	SELECT
+		NOT EXISTS (SELECT 1 FROM folders WHERE parent_id = ?)
+		AND NOT EXISTS (SELECT 1 FROM videos WHERE folder_id = ?)
+	`
+	var empty bool
+	err := c.reader().QueryRow(query, id, id).Scan(&empty)
+	return empty, err
+}
+
+func (c Client) DeleteFolder(id uuid.UUID) error {
+	_, err := c.exec("DELETE FROM folders WHERE id = ?", id)
+	return err
+}
+
+// SetVideoFolder moves a video into folderID, or out of any folder when it
+// is nil.
+func (c Client) SetVideoFolder(video Video, folderID *uuid.UUID) error {
+	_, err := c.exec("UPDATE videos SET folder_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", folderID, video.ID)
+	c.invalidateVideo(video.ID, video.UserID)
+	return err
+}
+
+// GetFolderVideosPage returns up to limit of the videos in a folder after
+// cursor, newest first like GetVideosPage.
+func (c Client) GetFolderVideosPage(folderID uuid.UUID, cursor *VideoCursor, limit int) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE folder_id = ?
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?
+	`
+	args := []any{folderID, limit}
+	if cursor != nil {
+		query = `
+		SELECT` + videoColumns + `
+		FROM videos
+		WHERE folder_id = ? AND (
+			created_at < ?
+			OR (created_at = ? AND id < ?)
+		)
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+		`
+		createdAt := cursor.CreatedAt.UTC().Format(time.DateTime)
+		args = []any{folderID, createdAt, createdAt, cursor.ID, limit}
+	}
+
+	rows, err := c.reader().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	IntegrityMissing          = "missing"
+	IntegrityETagMismatch     = "etag_mismatch"
+	IntegrityChecksumMismatch = "checksum_mismatch"
+)
+
+// IntegrityFailure is a stored object that no longer matches what was
+// recorded when it was stored. It is kept until a later check passes.
+type IntegrityFailure struct {
+	ID         uuid.UUID `json:"id"`
+	DetectedAt time.Time `json:"detected_at"`
+	VideoID    uuid.UUID `json:"video_id"`
+	ObjectKey  string    `json:"object_key"`
+	Problem    string    `json:"problem"`
+	Expected   *string   `json:"expected"`
+	Actual     *string   `json:"actual"`
+}
+
+// StoredObject is a video object along with the checksums recorded for it.
+type StoredObject struct {
+	VideoID          uuid.UUID
+	VideoURL         string
+	EncryptionKeyMD5 *string
+	ContentSHA256    *string
+	ObjectETag       *string
+}
+
+// GetChecksummedObjects returns the current media and every version of all
+// videos that have checksums recorded. An object shared by a video and its
+// version is returned once.
+func (c Client) GetChecksummedObjects() ([]StoredObject, error) {
+	query := `
+	SELECT id, video_url, encryption_key_md5, content_sha256, object_etag
+	FROM videos
+	WHERE video_url IS NOT NULL AND (content_sha256 IS NOT NULL OR object_etag IS NOT NULL)
+	UNION
+	SELECT video_id, video_url, encryption_key_md5, content_sha256, object_etag
+	FROM video_versions
+	WHERE content_sha256 IS NOT NULL OR object_etag IS NOT NULL
+	`
+
+	rows, err := c.reader().Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := []StoredObject{}
+	for rows.Next() {
+		var o StoredObject
+		if err := rows.Scan(&o.VideoID, &o.VideoURL, &o.EncryptionKeyMD5, &o.ContentSHA256, &o.ObjectETag); err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	return objects, rows.Err()
+}
+
+// RecordIntegrityFailure stores a failure, refreshing it when the same
+// problem was already known for the object.
+func (c Client) RecordIntegrityFailure(videoID uuid.UUID, objectKey, problem string, expected, actual *string) error {
+	query := `
+	INSERT INTO integrity_failures (
+		id,
+		detected_at,
+		video_id,
+		object_key,
+		problem,
+		expected,
+		actual
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+	ON CONFLICT(object_key, problem) DO UPDATE SET
+		detected_at = CURRENT_TIMESTAMP,
+		expected = excluded.expected,
+		actual = excluded.actual
+	`
+	_, err := c.exec(query, uuid.New(), videoID, objectKey, problem, expected, actual)
+	return err
+}
+
+// ClearIntegrityFailures forgets the failures of an object that passed.
+func (c Client) ClearIntegrityFailures(objectKey string) error {
+	_, err := c.exec("DELETE FROM integrity_failures WHERE object_key = ?", objectKey)
+	return err
+}
+
+// GetIntegrityFailures returns the most recently detected failures first.
+func (c Client) GetIntegrityFailures(limit int) ([]IntegrityFailure, error) {
+	query := `
+	SELECT id, detected_at, video_id, object_key, problem, expected, actual
+	FROM integrity_failures
+	ORDER BY detected_at DESC, rowid DESC
+	LIMIT ?
+	`
+
+	rows, err := c.reader().Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []IntegrityFailure{}
+	for rows.Next() {
+		var f IntegrityFailure
+		if err := rows.Scan(&f.ID, &f.DetectedAt, &f.VideoID, &f.ObjectKey, &f.Problem, &f.Expected, &f.Actual); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
@@ -0,0 +1,23 @@
+package database
+
+import "time"
+
+// AcquireLease takes or renews the named lease for holder until ttl from
+// now. It reports false while another holder's lease is still valid.
+func (c Client) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	query := `
+	INSERT INTO leases (name, holder, expires_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(name) DO UPDATE SET
+		holder = excluded.holder,
+		expires_at = excluded.expires_at
+	WHERE leases.holder = excluded.holder OR leases.expires_at < ?
+	`
+	res, err := c.exec(query, name, holder, now.Add(ttl), now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// waiting for the broadcaster to connect
+	LiveStreamIdle = "idle"
+	LiveStreamLive = "live"
+	// the broadcast ended and its recording is being stored as the video
+	LiveStreamProcessing = "processing"
+	LiveStreamEnded      = "ended"
+	LiveStreamFailed     = "failed"
+)
+
+// LiveStream is the RTMP ingest of a video. Broadcasting to its stream key
+// plays live over HLS, and when the broadcast ends its recording becomes
+// the next version of the video.
+type LiveStream struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	StreamKey string    `json:"stream_key"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	// of the last broadcast
+	StartedAt *time.Time `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	// why the last recording couldn't be stored
+	Error *string `json:"error"`
+	// packaged as LL-HLS with partial segments of PartTarget seconds
+	LowLatency bool    `json:"low_latency"`
+	PartTarget float64 `json:"part_target"`
+}
+
+// CreateLiveStream gives the video a new stream key, replacing any it had.
+func (c Client) CreateLiveStream(videoID uuid.UUID, streamKey string) (LiveStream, error) {
+	_, err := c.exec(`
+	INSERT INTO live_streams (video_id, stream_key, status) VALUES (?, ?, ?)
+	ON CONFLICT(video_id) DO UPDATE SET stream_key = excluded.stream_key
+	`, videoID, streamKey, LiveStreamIdle)
+	if err != nil {
+		return LiveStream{}, err
+	}
+	return c.GetLiveStream(videoID)
+}
+
+// GetLiveStream returns the video's live stream, with a nil video ID when
+// it has none.
+func (c Client) GetLiveStream(videoID uuid.UUID) (LiveStream, error) {
+	return c.queryLiveStream("WHERE video_id = ?", videoID)
+}
+
+// GetLiveStreamByKey returns the live stream with the stream key, with a
+// nil video ID when there is none.
+func (c Client) GetLiveStreamByKey(streamKey string) (LiveStream, error) {
+	return c.queryLiveStream("WHERE stream_key = ?", streamKey)
+}
+
+func (c Client) queryLiveStream(where string, arg any) (LiveStream, error) {
+	query := `
+	SELECT video_id, stream_key, status, created_at, started_at, ended_at, error, low_latency, part_target
+	FROM live_streams
+	` + where
+	var s LiveStream
+	// the primary, streams are looked up by key right after it changes
+	err := c.db.QueryRow(query, arg).Scan(&s.VideoID, &s.StreamKey, &s.Status, &s.CreatedAt, &s.StartedAt, &s.EndedAt, &s.Error, &s.LowLatency, &s.PartTarget)
+	if err == sql.ErrNoRows {
+		return LiveStream{}, nil
+	}
+	return s, err
+}
+
+// SetLiveStreamLatency changes how the stream is packaged, from its next
+// broadcast on.
+func (c Client) SetLiveStreamLatency(videoID uuid.UUID, lowLatency bool, partTarget float64) error {
+	_, err := c.exec("UPDATE live_streams SET low_latency = ?, part_target = ? WHERE video_id = ?", lowLatency, partTarget, videoID)
+	return err
+}
+
+func (c Client) DeleteLiveStream(videoID uuid.UUID) error {
+	_, err := c.exec("DELETE FROM live_streams WHERE video_id = ?", videoID)
+	return err
+}
+
+// StartLiveStream marks the stream live, returning false when it already
+// is or its recording is still being processed.
+func (c Client) StartLiveStream(videoID uuid.UUID) (bool, error) {
+	res, err := c.exec(`
+	UPDATE live_streams
+	SET status = ?, started_at = CURRENT_TIMESTAMP, ended_at = NULL, error = NULL
+	WHERE video_id = ? AND status NOT IN (?, ?)
+	`, LiveStreamLive, videoID, LiveStreamLive, LiveStreamProcessing)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// EndLiveStream records that the broadcast ended, the recording now being
+// processed.
+func (c Client) EndLiveStream(videoID uuid.UUID) error {
+	_, err := c.exec("UPDATE live_streams SET status = ?, ended_at = CURRENT_TIMESTAMP WHERE video_id = ?", LiveStreamProcessing, videoID)
+	return err
+}
+
+// FinishLiveStream records how storing the recording went, a nil errMsg
+// meaning it is now the video.
+func (c Client) FinishLiveStream(videoID uuid.UUID, errMsg *string) error {
+	status := LiveStreamEnded
+	if errMsg != nil {
+		status = LiveStreamFailed
+	}
+	_, err := c.exec("UPDATE live_streams SET status = ?, error = ? WHERE video_id = ?", status, errMsg, videoID)
+	return err
+}
+
+// ResetInterruptedLiveStreams fails the streams a previous run left live or
+// processing, their recordings went with it.
+func (c Client) ResetInterruptedLiveStreams() error {
+	_, err := c.exec(`
+	UPDATE live_streams
+	SET status = ?, error = 'interrupted by a server restart', ended_at = COALESCE(ended_at, CURRENT_TIMESTAMP)
+	WHERE status IN (?, ?)
+	`, LiveStreamFailed, LiveStreamLive, LiveStreamProcessing)
+	return err
+}
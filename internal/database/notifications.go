@@ -0,0 +1,109 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	NotificationProcessingFinished = "processing_finished"
+	NotificationProcessingFailed   = "processing_failed"
+	NotificationNewFollower        = "new_follower"
+)
+
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Type      string     `json:"type"`
+	VideoID   *uuid.UUID `json:"video_id,omitempty"`
+	// the user whose action caused the notification, like the new follower
+	ActorID *uuid.UUID `json:"actor_id,omitempty"`
+	ReadAt  *time.Time `json:"read_at"`
+}
+
+type CreateNotificationParams struct {
+	UserID  uuid.UUID
+	Type    string
+	VideoID *uuid.UUID
+	ActorID *uuid.UUID
+}
+
+func (c Client) CreateNotification(params CreateNotificationParams) error {
+	query := `
+	INSERT INTO notifications (
+		id,
+		user_id,
+		created_at,
+		type,
+		video_id,
+		actor_id
+	) VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?, ?)
+	`
+	_, err := c.exec(query, uuid.New(), params.UserID, params.Type, params.VideoID, params.ActorID)
+	return err
+}
+
+// GetNotifications returns the user's newest notifications, only unread ones
+// if unreadOnly is set.
+func (c Client) GetNotifications(userID uuid.UUID, unreadOnly bool, limit int) ([]Notification, error) {
+	query := `
+	SELECT id, created_at, type, video_id, actor_id, read_at
+	FROM notifications
+	WHERE user_id = ?
+	`
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+	query += `
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?
+	`
+
+	rows, err := c.reader().Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.CreatedAt, &n.Type, &n.VideoID, &n.ActorID, &n.ReadAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (c Client) CountUnreadNotifications(userID uuid.UUID) (int, error) {
+	var count int
+	err := c.reader().QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationRead returns false if the user has no such notification.
+// Marking one that is already read keeps its original read time.
+func (c Client) MarkNotificationRead(userID, id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE notifications
+	SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+	WHERE id = ? AND user_id = ?
+	`
+	res, err := c.exec(query, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// MarkAllNotificationsRead returns how many notifications it marked.
+func (c Client) MarkAllNotificationsRead(userID uuid.UUID) (int64, error) {
+	res, err := c.exec("UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL", userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// PlaybackBatch is what one batch of player heartbeats adds to a playback
+// session.
+type PlaybackBatch struct {
+	SessionID        uuid.UUID
+	VideoID          uuid.UUID
+	MaxPosition      float64
+	LastPosition     float64
+	WatchedSeconds   float64
+	BufferingSeconds float64
+	QualitySwitches  int
+	// stretches of the video watched, for the replay heatmap
+	Spans []PlaybackSpan
+}
+
+// PlaybackSpan is a stretch of a video a session watched, in seconds.
+type PlaybackSpan struct {
+	ID      int64
+	VideoID uuid.UUID
+	Start   float64
+	End     float64
+}
+
+// PlaybackDropOffBuckets is how many slices of the video's duration sessions
+// are bucketed in by how far they got.
+const PlaybackDropOffBuckets = 10
+
+type PlaybackStats struct {
+	Sessions         int
+	WatchedSeconds   float64
+	BufferingSeconds float64
+	QualitySwitches  int
+	// sessions by the slice of the video they got furthest into, the last
+	// one is for sessions that reached the end
+	FurthestBuckets [PlaybackDropOffBuckets + 1]int
+}
+
+// GetPlaybackLastPosition returns where the session's previous batch ended,
+// and false for a new session.
+func (c Client) GetPlaybackLastPosition(videoID, sessionID uuid.UUID) (float64, bool, error) {
+	var position float64
+	err := c.db.QueryRow("SELECT last_position FROM playback_sessions WHERE video_id = ? AND id = ?", videoID, sessionID).Scan(&position)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return position, true, nil
+}
+
+// RecordPlaybackBatch adds a batch to its session, creating the session on
+// its first batch, and queues its spans for the replay heatmap.
+func (c Client) RecordPlaybackBatch(batch PlaybackBatch) error {
+	query := `
+	INSERT INTO playback_sessions (
+		video_id,
+		id,
+		started_at,
+		last_seen_at,
+		max_position,
+		last_position,
+		watched_seconds,
+		buffering_seconds,
+		quality_switches
+	) VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+	ON CONFLICT(video_id, id) DO UPDATE SET
+		last_seen_at = CURRENT_TIMESTAMP,
+		max_position = MAX(max_position, excluded.max_position),
+		last_position = excluded.last_position,
+		watched_seconds = watched_seconds + excluded.watched_seconds,
+		buffering_seconds = buffering_seconds + excluded.buffering_seconds,
+		quality_switches = quality_switches + excluded.quality_switches
+	`
+	return c.writeTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query,
+			batch.VideoID,
+			batch.SessionID,
+			batch.MaxPosition,
+			batch.LastPosition,
+			batch.WatchedSeconds,
+			batch.BufferingSeconds,
+			batch.QualitySwitches,
+		)
+		if err != nil {
+			return err
+		}
+		for _, span := range batch.Spans {
+			_, err := tx.Exec("INSERT INTO playback_spans (video_id, start_position, end_position) VALUES (?, ?, ?)", batch.VideoID, span.Start, span.End)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetPlaybackStats sums up the playback sessions of a video that is
+// durationSeconds long.
+func (c Client) GetPlaybackStats(videoID uuid.UUID, durationSeconds float64) (PlaybackStats, error) {
+	query := `
+	SELECT
+		MIN(CAST(max_position / ? * ? AS INTEGER), ?) AS bucket,
+		COUNT(*),
+		SUM(watched_seconds),
+		SUM(buffering_seconds),
+		SUM(quality_switches)
+	FROM playback_sessions
+	WHERE video_id = ?
+	GROUP BY bucket
+	`
+	rows, err := c.reader().Query(query, durationSeconds, PlaybackDropOffBuckets, PlaybackDropOffBuckets, videoID)
+	if err != nil {
+		return PlaybackStats{}, err
+	}
+	defer rows.Close()
+
+	var stats PlaybackStats
+	for rows.Next() {
+		var bucket, sessions, switches int
+		var watched, buffering float64
+		if err := rows.Scan(&bucket, &sessions, &watched, &buffering, &switches); err != nil {
+			return PlaybackStats{}, err
+		}
+		stats.Sessions += sessions
+		stats.WatchedSeconds += watched
+		stats.BufferingSeconds += buffering
+		stats.QualitySwitches += switches
+		stats.FurthestBuckets[max(bucket, 0)] += sessions
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PlaybackRestrictions limit who may be handed a video's media. Empty lists
+// don't restrict anything.
+type PlaybackRestrictions struct {
+	VideoID          uuid.UUID  `json:"video_id"`
+	UpdatedAt        *time.Time `json:"updated_at"`
+	AllowedCountries []string   `json:"allowed_countries"`
+	AllowedCIDRs     []string   `json:"allowed_cidrs"`
+	DeniedCIDRs      []string   `json:"denied_cidrs"`
+}
+
+func (p PlaybackRestrictions) IsEmpty() bool {
+	return len(p.AllowedCountries) == 0 && len(p.AllowedCIDRs) == 0 && len(p.DeniedCIDRs) == 0
+}
+
+// the lists hold country codes and CIDRs, neither contains commas
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// GetPlaybackRestrictions returns the video's restrictions, with empty lists
+// when it has none.
+func (c Client) GetPlaybackRestrictions(videoID uuid.UUID) (PlaybackRestrictions, error) {
+	query := `
+	SELECT updated_at, allowed_countries, allowed_cidrs, denied_cidrs
+	FROM playback_restrictions
+	WHERE video_id = ?
+	`
+
+	restrictions := PlaybackRestrictions{VideoID: videoID}
+	var updatedAt time.Time
+	var countries, allowed, denied string
+	err := c.reader().QueryRow(query, videoID).Scan(&updatedAt, &countries, &allowed, &denied)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return PlaybackRestrictions{}, err
+	}
+	if err == nil {
+		restrictions.UpdatedAt = &updatedAt
+	}
+	restrictions.AllowedCountries = splitList(countries)
+	restrictions.AllowedCIDRs = splitList(allowed)
+	restrictions.DeniedCIDRs = splitList(denied)
+	return restrictions, nil
+}
+
+// SetPlaybackRestrictions replaces the video's restrictions. Setting empty
+// restrictions removes them.
+func (c Client) SetPlaybackRestrictions(params PlaybackRestrictions) error {
+	if params.IsEmpty() {
+		_, err := c.exec("DELETE FROM playback_restrictions WHERE video_id = ?", params.VideoID)
+		return err
+	}
+
+	query := `
+	INSERT INTO playback_restrictions (video_id, updated_at, allowed_countries, allowed_cidrs, denied_cidrs)
+	VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?)
+	ON CONFLICT(video_id) DO UPDATE SET
+		updated_at = CURRENT_TIMESTAMP,
+		allowed_countries = excluded.allowed_countries,
+		allowed_cidrs = excluded.allowed_cidrs,
+		denied_cidrs = excluded.denied_cidrs
+	`
+	_, err := c.exec(
+		query,
+		params.VideoID,
+		strings.Join(params.AllowedCountries, ","),
+		strings.Join(params.AllowedCIDRs, ","),
+		strings.Join(params.DeniedCIDRs, ","),
+	)
+	return err
+}
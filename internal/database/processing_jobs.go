@@ -0,0 +1,248 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusDone      = "done"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+type ProcessingJob struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   *string    `json:"last_error"`
+	LockedUntil *time.Time `json:"-"`
+	CreateProcessingJobParams
+}
+
+type CreateProcessingJobParams struct {
+	VideoID     uuid.UUID `json:"video_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	SourceKey   string    `json:"-"`
+	SourceSize  int64     `json:"source_size"`
+	ContentType string    `json:"content_type"`
+	Filename    string    `json:"filename"`
+}
+
+const processingJobColumns = `
+		id,
+		created_at,
+		updated_at,
+		status,
+		attempts,
+		last_error,
+		locked_until,
+		video_id,
+		user_id,
+		source_key,
+		source_size,
+		content_type,
+		filename`
+
+func scanProcessingJob(row rowScanner) (ProcessingJob, error) {
+	var j ProcessingJob
+	err := row.Scan(
+		&j.ID,
+		&j.CreatedAt,
+		&j.UpdatedAt,
+		&j.Status,
+		&j.Attempts,
+		&j.LastError,
+		&j.LockedUntil,
+		&j.VideoID,
+		&j.UserID,
+		&j.SourceKey,
+		&j.SourceSize,
+		&j.ContentType,
+		&j.Filename,
+	)
+	return j, err
+}
+
+// queryProcessingJob runs a query returning at most one job, with a zero job
+// meaning no row matched.
+func (c Client) queryProcessingJob(query string, args ...any) (ProcessingJob, error) {
+	job, err := scanProcessingJob(c.db.QueryRow(query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ProcessingJob{}, nil
+		}
+		return ProcessingJob{}, err
+	}
+	return job, nil
+}
+
+func (c Client) CreateProcessingJob(params CreateProcessingJobParams) (ProcessingJob, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO processing_jobs (
+		id,
+		created_at,
+		updated_at,
+		status,
+		video_id,
+		user_id,
+		source_key,
+		source_size,
+		content_type,
+		filename
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.exec(query, id, JobStatusPending, params.VideoID, params.UserID, params.SourceKey, params.SourceSize, params.ContentType, params.Filename)
+	if err != nil {
+		return ProcessingJob{}, err
+	}
+
+	return c.GetProcessingJob(id)
+}
+
+func (c Client) GetProcessingJob(id uuid.UUID) (ProcessingJob, error) {
+	query := `SELECT` + processingJobColumns + `
+	FROM processing_jobs
+	WHERE id = ?
+	`
+	return c.queryProcessingJob(query, id)
+}
+
+// ClaimNextProcessingJob hands the oldest runnable job to the caller for
+// lease. Jobs whose worker stopped renewing the lease become runnable again.
+// It returns a zero job when there is nothing to do.
+func (c Client) ClaimNextProcessingJob(lease time.Duration) (ProcessingJob, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	now := time.Now().UTC()
+	query := `
+	UPDATE processing_jobs
+	SET
+		status = ?,
+		attempts = attempts + 1,
+		locked_until = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = (
+		SELECT id FROM processing_jobs
+		WHERE status = ? OR (status = ? AND locked_until < ?)
+		ORDER BY created_at
+		LIMIT 1
+	)
+	RETURNING` + processingJobColumns
+	return c.queryProcessingJob(query, JobStatusRunning, now.Add(lease), JobStatusPending, JobStatusRunning, now)
+}
+
+// ClaimProcessingJob is ClaimNextProcessingJob for a specific job, used when
+// a queue already told the worker which one to run.
+func (c Client) ClaimProcessingJob(id uuid.UUID, lease time.Duration) (ProcessingJob, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	now := time.Now().UTC()
+	query := `
+	UPDATE processing_jobs
+	SET
+		status = ?,
+		attempts = attempts + 1,
+		locked_until = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND (status = ? OR (status = ? AND locked_until < ?))
+	RETURNING` + processingJobColumns
+	return c.queryProcessingJob(query, JobStatusRunning, now.Add(lease), id, JobStatusPending, JobStatusRunning, now)
+}
+
+// RenewProcessingJobLease extends the lease of a job the caller is running.
+// attempts identifies the claim, it reports false when the job was taken
+// over by another worker or isn't running anymore.
+func (c Client) RenewProcessingJobLease(id uuid.UUID, attempts int, lease time.Duration) (bool, error) {
+	query := `
+	UPDATE processing_jobs
+	SET
+		locked_until = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND attempts = ?
+	`
+	res, err := c.exec(query, time.Now().UTC().Add(lease), id, JobStatusRunning, attempts)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CompleteProcessingJob marks the job done, unless it was cancelled or
+// claimed again since the claim identified by attempts.
+func (c Client) CompleteProcessingJob(id uuid.UUID, attempts int) error {
+	query := `
+	UPDATE processing_jobs
+	SET
+		status = ?,
+		locked_until = NULL,
+		last_error = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND attempts = ?
+	`
+	_, err := c.exec(query, JobStatusDone, id, JobStatusRunning, attempts)
+	return err
+}
+
+// FailProcessingJob records why a job failed. When retry is set the job goes
+// back to pending for another worker to pick up. Like CompleteProcessingJob
+// it leaves jobs that were cancelled or claimed again in the meantime alone.
+func (c Client) FailProcessingJob(id uuid.UUID, attempts int, lastError string, retry bool) error {
+	status := JobStatusFailed
+	if retry {
+		status = JobStatusPending
+	}
+	query := `
+	UPDATE processing_jobs
+	SET
+		status = ?,
+		locked_until = NULL,
+		last_error = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND attempts = ?
+	`
+	_, err := c.exec(query, status, lastError, id, JobStatusRunning, attempts)
+	return err
+}
+
+// CancelProcessingJob stops a job that hasn't finished. It reports false when
+// the job was already done, failed or cancelled. A worker running the job
+// notices on its next status check.
+func (c Client) CancelProcessingJob(id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE processing_jobs
+	SET
+		status = ?,
+		locked_until = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status IN (?, ?)
+	`
+	res, err := c.exec(query, JobStatusCancelled, id, JobStatusPending, JobStatusRunning)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetPendingUploadBytes sums the sources of a user's uploads that are still
+// waiting to be processed.
+func (c Client) GetPendingUploadBytes(userID uuid.UUID) (int64, error) {
+	var total int64
+	err := c.reader().QueryRow(
+		"SELECT COALESCE(SUM(source_size), 0) FROM processing_jobs WHERE user_id = ? AND status IN (?, ?)",
+		userID, JobStatusPending, JobStatusRunning,
+	).Scan(&total)
+	return total, err
+}
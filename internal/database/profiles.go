@@ -0,0 +1,151 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Profile is the public side of a user, what their channel page shows.
+type Profile struct {
+	UserID         uuid.UUID `json:"user_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	AvatarURL      *string   `json:"avatar_url"`
+	FollowerCount  int       `json:"follower_count"`
+	FollowingCount int       `json:"following_count"`
+}
+
+// GetProfile returns the user's profile, or a zero Profile if there is no
+// such user.
+func (c Client) GetProfile(userID uuid.UUID) (Profile, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		display_name,
+		bio,
+		avatar_url,
+		(SELECT COUNT(*) FROM follows WHERE followee_id = users.id),
+		(SELECT COUNT(*) FROM follows WHERE follower_id = users.id)
+	FROM users
+	WHERE id = ?
+	`
+	var p Profile
+	err := c.reader().QueryRow(query, userID).Scan(
+		&p.UserID,
+		&p.CreatedAt,
+		&p.DisplayName,
+		&p.Bio,
+		&p.AvatarURL,
+		&p.FollowerCount,
+		&p.FollowingCount,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Profile{}, nil
+	}
+	return p, err
+}
+
+func (c Client) UpdateProfile(userID uuid.UUID, displayName, bio string) error {
+	query := `
+	UPDATE users
+	SET updated_at = CURRENT_TIMESTAMP, display_name = ?, bio = ?
+	WHERE id = ?
+	`
+	_, err := c.exec(query, displayName, bio, userID)
+	return err
+}
+
+func (c Client) SetAvatarURL(userID uuid.UUID, avatarURL string) error {
+	query := `
+	UPDATE users
+	SET updated_at = CURRENT_TIMESTAMP, avatar_url = ?
+	WHERE id = ?
+	`
+	_, err := c.exec(query, avatarURL, userID)
+	return err
+}
+
+// Follow subscribes follower to followee's videos, returning false if they
+// already followed them.
+func (c Client) Follow(followerID, followeeID uuid.UUID) (bool, error) {
+	query := `
+	INSERT INTO follows (follower_id, followee_id, created_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT DO NOTHING
+	`
+	res, err := c.exec(query, followerID, followeeID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Unfollow returns false if follower didn't follow followee.
+func (c Client) Unfollow(followerID, followeeID uuid.UUID) (bool, error) {
+	res, err := c.exec("DELETE FROM follows WHERE follower_id = ? AND followee_id = ?", followerID, followeeID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (c Client) IsFollowing(followerID, followeeID uuid.UUID) (bool, error) {
+	var exists bool
+	err := c.reader().QueryRow("SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = ? AND followee_id = ?)", followerID, followeeID).Scan(&exists)
+	return exists, err
+}
+
+// getListableVideosPage pages through listable videos, newest first, of the
+// users matched by userFilter, a condition on videos.user_id.
+func (c Client) getListableVideosPage(userFilter string, filterArg uuid.UUID, cursor *VideoCursor, limit int) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE ` + userFilter + ` AND` + listableVideo
+	args := []any{filterArg}
+	if cursor != nil {
+		// compared as text, so the format must match CURRENT_TIMESTAMP's
+		query += ` AND (created_at < ? OR (created_at = ? AND id < ?))`
+		createdAt := cursor.CreatedAt.UTC().Format(time.DateTime)
+		args = append(args, createdAt, createdAt, cursor.ID)
+	}
+	query += `
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?
+	`
+	args = append(args, limit)
+
+	rows, err := c.reader().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// GetChannelVideosPage returns a page of the videos a user lists publicly.
+func (c Client) GetChannelVideosPage(userID uuid.UUID, cursor *VideoCursor, limit int) ([]Video, error) {
+	return c.getListableVideosPage("user_id = ?", userID, cursor, limit)
+}
+
+// GetSubscriptionVideosPage returns a page of the videos of everyone the
+// follower follows.
+func (c Client) GetSubscriptionVideosPage(followerID uuid.UUID, cursor *VideoCursor, limit int) ([]Video, error) {
+	return c.getListableVideosPage("user_id IN (SELECT followee_id FROM follows WHERE follower_id = ?)", followerID, cursor, limit)
+}
@@ -0,0 +1,266 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CampaignStatusRunning = "running"
+	CampaignStatusPaused  = "paused"
+	CampaignStatusDone    = "done"
+)
+
+// ReencodeCampaign re-transcodes every video that existed when it was
+// created to a new encoding profile. Videos are worked through in ID order
+// and Cursor is the last one handled, so a paused or interrupted campaign
+// picks up where it stopped.
+type ReencodeCampaign struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Status    string     `json:"status"`
+	Total     int        `json:"total"`
+	Processed int        `json:"processed"`
+	Failed    int        `json:"failed"`
+	Skipped   int        `json:"skipped"`
+	Cursor    *uuid.UUID `json:"cursor"`
+	LastError *string    `json:"last_error"`
+	CreateReencodeCampaignParams
+}
+
+type CreateReencodeCampaignParams struct {
+	EncodingProfile
+}
+
+// EncodingProfile is how videos are re-encoded, see encodeWithProfile.
+type EncodingProfile struct {
+	VideoCodec string `json:"video_codec"`
+	// 0 keeps the source height
+	MaxHeight int `json:"max_height"`
+	// 0 is the codec's default
+	CRF int `json:"crf"`
+}
+
+// Outcomes of re-encoding one video, see AdvanceReencodeCampaign.
+const (
+	CampaignVideoProcessed = "processed"
+	CampaignVideoFailed    = "failed"
+	CampaignVideoSkipped   = "skipped"
+)
+
+const reencodeCampaignColumns = `
+		id,
+		created_at,
+		updated_at,
+		status,
+		total,
+		processed,
+		failed,
+		skipped,
+		cursor,
+		last_error,
+		video_codec,
+		max_height,
+		crf`
+
+func scanReencodeCampaign(row rowScanner) (ReencodeCampaign, error) {
+	var rc ReencodeCampaign
+	err := row.Scan(
+		&rc.ID,
+		&rc.CreatedAt,
+		&rc.UpdatedAt,
+		&rc.Status,
+		&rc.Total,
+		&rc.Processed,
+		&rc.Failed,
+		&rc.Skipped,
+		&rc.Cursor,
+		&rc.LastError,
+		&rc.VideoCodec,
+		&rc.MaxHeight,
+		&rc.CRF,
+	)
+	return rc, err
+}
+
+func (c Client) CreateReencodeCampaign(params CreateReencodeCampaignParams) (ReencodeCampaign, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO reencode_campaigns (
+		id,
+		created_at,
+		updated_at,
+		status,
+		total,
+		video_codec,
+		max_height,
+		crf
+	) VALUES (
+		?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?,
+		(SELECT COUNT(*) FROM videos WHERE video_url IS NOT NULL),
+		?, ?, ?
+	)
+	`
+	_, err := c.exec(query, id, CampaignStatusRunning, params.VideoCodec, params.MaxHeight, params.CRF)
+	if err != nil {
+		return ReencodeCampaign{}, err
+	}
+	return c.GetReencodeCampaign(id)
+}
+
+// GetReencodeCampaign returns a zero ReencodeCampaign when there is none.
+func (c Client) GetReencodeCampaign(id uuid.UUID) (ReencodeCampaign, error) {
+	row := c.db.QueryRow(`SELECT`+reencodeCampaignColumns+` FROM reencode_campaigns WHERE id = ?`, id)
+	rc, err := scanReencodeCampaign(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ReencodeCampaign{}, nil
+	}
+	return rc, err
+}
+
+// GetReencodeCampaigns returns all campaigns, newest first.
+func (c Client) GetReencodeCampaigns() ([]ReencodeCampaign, error) {
+	return c.queryReencodeCampaigns(`SELECT` + reencodeCampaignColumns + ` FROM reencode_campaigns ORDER BY created_at DESC`)
+}
+
+// GetRunningReencodeCampaigns returns the campaigns to work on, oldest
+// first.
+func (c Client) GetRunningReencodeCampaigns() ([]ReencodeCampaign, error) {
+	return c.queryReencodeCampaigns(`SELECT`+reencodeCampaignColumns+` FROM reencode_campaigns WHERE status = ? ORDER BY created_at`, CampaignStatusRunning)
+}
+
+func (c Client) queryReencodeCampaigns(query string, args ...any) ([]ReencodeCampaign, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []ReencodeCampaign{}
+	for rows.Next() {
+		rc, err := scanReencodeCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, rc)
+	}
+	return campaigns, rows.Err()
+}
+
+// SetReencodeCampaignStatus moves a campaign to status if it is currently in
+// from. It returns false when it wasn't.
+func (c Client) SetReencodeCampaignStatus(id uuid.UUID, from, status string) (bool, error) {
+	result, err := c.exec(
+		"UPDATE reencode_campaigns SET updated_at = CURRENT_TIMESTAMP, status = ? WHERE id = ? AND status = ?",
+		status, id, from,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetNextCampaignVideo returns the video after the campaign's cursor, or a
+// zero Video when the campaign went through all of them.
+func (c Client) GetNextCampaignVideo(campaign ReencodeCampaign) (Video, error) {
+	cursor := ""
+	if campaign.Cursor != nil {
+		cursor = campaign.Cursor.String()
+	}
+	// videos uploaded since are already processed the current way
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE video_url IS NOT NULL
+		AND created_at <= (SELECT created_at FROM reencode_campaigns WHERE id = ?)
+		AND id > ?
+	ORDER BY id
+	LIMIT 1
+	`
+	video, err := scanVideo(c.db.QueryRow(query, campaign.ID, cursor))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Video{}, nil
+	}
+	return video, err
+}
+
+// AdvanceReencodeCampaign records the outcome of re-encoding videoID and
+// moves the cursor past it.
+func (c Client) AdvanceReencodeCampaign(id, videoID uuid.UUID, outcome string, errMsg *string) error {
+	query := `
+	UPDATE reencode_campaigns
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		cursor = ?,
+		processed = processed + ?,
+		failed = failed + ?,
+		skipped = skipped + ?,
+		last_error = COALESCE(?, last_error)
+	WHERE id = ?
+	`
+	count := func(o string) int {
+		if o == outcome {
+			return 1
+		}
+		return 0
+	}
+	_, err := c.exec(query, videoID, count(CampaignVideoProcessed), count(CampaignVideoFailed), count(CampaignVideoSkipped), errMsg, id)
+	return err
+}
+
+// ReplaceVideoMedia points a video at a new version of its media, unless the
+// video moved on from oldURL in the meantime, e.g. because its owner
+// uploaded a new version. It returns false then and stores nothing.
+func (c Client) ReplaceVideoMedia(oldURL string, params CreateVideoVersionParams) (bool, error) {
+	replaced := false
+	err := c.writeTx(func(tx *sql.Tx) error {
+		query := `
+		UPDATE videos
+		SET
+			updated_at = CURRENT_TIMESTAMP,
+			video_url = ?,
+			video_size = ?,
+			encryption_key_md5 = ?,
+			content_sha256 = ?,
+			object_etag = ?
+		WHERE id = ? AND video_url = ?
+		`
+		result, err := tx.Exec(query, params.VideoURL, params.VideoSize, params.EncryptionKeyMD5, params.ContentSHA256, params.ObjectETag, params.VideoID, oldURL)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+
+		query = `
+		INSERT INTO video_versions (
+			id,
+			created_at,
+			video_id,
+			version,
+			video_url,
+			video_size,
+			encryption_key_md5,
+			content_sha256,
+			object_etag
+		) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?)
+		`
+		_, err = tx.Exec(query, uuid.New(), params.VideoID, params.Version, params.VideoURL, params.VideoSize, params.EncryptionKeyMD5, params.ContentSHA256, params.ObjectETag)
+		if err != nil {
+			return err
+		}
+		replaced = true
+		return nil
+	})
+	if replaced {
+		c.invalidateVideo(params.VideoID, uuid.Nil)
+	}
+	return replaced, err
+}
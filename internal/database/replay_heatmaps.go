@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReplayHeatmapBuckets is how many equal slices of a video the heatmap
+// counts views of.
+const ReplayHeatmapBuckets = 100
+
+// ReplayHeatmap is how often each slice of a video was watched, replays by
+// the same session included.
+type ReplayHeatmap struct {
+	VideoID   uuid.UUID
+	UpdatedAt time.Time
+	// duration the slices were cut for, the counts start over when the
+	// video's media changes length
+	DurationSeconds float64
+	Views           [ReplayHeatmapBuckets]int
+}
+
+// GetPlaybackSpans returns up to limit spans not yet counted in a heatmap,
+// oldest first.
+func (c Client) GetPlaybackSpans(limit int) ([]PlaybackSpan, error) {
+	rows, err := c.db.Query("SELECT id, video_id, start_position, end_position FROM playback_spans ORDER BY id LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spans []PlaybackSpan
+	for rows.Next() {
+		var span PlaybackSpan
+		if err := rows.Scan(&span.ID, &span.VideoID, &span.Start, &span.End); err != nil {
+			return nil, err
+		}
+		spans = append(spans, span)
+	}
+	return spans, rows.Err()
+}
+
+// GetReplayHeatmap returns a video's heatmap, false when nothing was
+// counted for it yet.
+func (c Client) GetReplayHeatmap(videoID uuid.UUID) (ReplayHeatmap, bool, error) {
+	heatmap := ReplayHeatmap{VideoID: videoID}
+	var views string
+	err := c.reader().QueryRow("SELECT updated_at, duration_seconds, views FROM replay_heatmaps WHERE video_id = ?", videoID).Scan(&heatmap.UpdatedAt, &heatmap.DurationSeconds, &views)
+	if err == sql.ErrNoRows {
+		return heatmap, false, nil
+	}
+	if err != nil {
+		return ReplayHeatmap{}, false, err
+	}
+	if err := json.Unmarshal([]byte(views), &heatmap.Views); err != nil {
+		return ReplayHeatmap{}, false, err
+	}
+	return heatmap, true, nil
+}
+
+// SaveReplayHeatmap stores a heatmap along with deleting the spans counted
+// in it, so none is counted twice.
+func (c Client) SaveReplayHeatmap(heatmap ReplayHeatmap, spanIDs []int64) error {
+	views, err := json.Marshal(heatmap.Views)
+	if err != nil {
+		return err
+	}
+	return c.writeTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		INSERT INTO replay_heatmaps (video_id, updated_at, duration_seconds, views)
+		VALUES (?, CURRENT_TIMESTAMP, ?, ?)
+		ON CONFLICT(video_id) DO UPDATE SET
+			updated_at = CURRENT_TIMESTAMP,
+			duration_seconds = excluded.duration_seconds,
+			views = excluded.views
+		`, heatmap.VideoID, heatmap.DurationSeconds, string(views))
+		if err != nil {
+			return err
+		}
+		for _, id := range spanIDs {
+			if _, err := tx.Exec("DELETE FROM playback_spans WHERE id = ?", id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeletePlaybackSpans drops spans that can't be counted, like those of
+// videos that are gone.
+func (c Client) DeletePlaybackSpans(spanIDs []int64) error {
+	return c.writeTx(func(tx *sql.Tx) error {
+		for _, id := range spanIDs {
+			if _, err := tx.Exec("DELETE FROM playback_spans WHERE id = ?", id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// how often a replica's lag is re-measured, reads in between trust the last
+// measurement
+const replicaLagCheckInterval = time.Second
+
+type replica struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	lag       time.Duration
+	healthy   bool
+}
+
+// fresh reports whether the replica is within maxLag of the primary, going by
+// the last heartbeat it has received.
+func (r *replica) fresh(maxLag time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) > replicaLagCheckInterval {
+		var beatAt time.Time
+		err := r.db.QueryRow("SELECT beat_at FROM replication_heartbeat WHERE id = 1").Scan(&beatAt)
+		r.checkedAt = time.Now()
+		r.healthy = err == nil
+		r.lag = time.Since(beatAt)
+	}
+	return r.healthy && r.lag <= maxLag
+}
+
+type replicaSet struct {
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+}
+
+// AddReadReplicas opens read-only copies of the database, kept up to date by
+// external replication, and routes listing queries to them. Replicas more
+// than maxLag behind the primary are skipped until they catch up.
+func (c *Client) AddReadReplicas(paths []string, maxLag time.Duration) error {
+	set := &replicaSet{maxLag: maxLag}
+	for _, path := range paths {
+		db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_busy_timeout=5000", path))
+		if err != nil {
+			return fmt.Errorf("couldn't open replica %s: %w", path, err)
+		}
+		set.replicas = append(set.replicas, &replica{db: db})
+	}
+	c.replicas = set
+	return nil
+}
+
+// reader returns a connection for queries that tolerate slightly stale data,
+// falling back to the primary when no replica is fresh enough.
+func (c Client) reader() *sql.DB {
+	if c.replicas == nil || len(c.replicas.replicas) == 0 {
+		return c.db
+	}
+
+	n := uint64(len(c.replicas.replicas))
+	start := c.replicas.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		r := c.replicas.replicas[(start+i)%n]
+		if r.fresh(c.replicas.maxLag) {
+			return r.db
+		}
+	}
+	return c.db
+}
+
+// WriteReplicationHeartbeat records the current time on the primary. Replicas
+// measure their lag by how old their copy of it is.
+func (c Client) WriteReplicationHeartbeat() error {
+	query := `
+	INSERT INTO replication_heartbeat (id, beat_at)
+	VALUES (1, ?)
+	ON CONFLICT(id) DO UPDATE SET beat_at = excluded.beat_at
+	`
+	_, err := c.exec(query, time.Now().UTC())
+	return err
+}
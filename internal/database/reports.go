@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+type Report struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Status    string    `json:"status"`
+	CreateReportParams
+}
+
+type CreateReportParams struct {
+	VideoID       uuid.UUID `json:"video_id"`
+	Reason        string    `json:"reason"`
+	Details       string    `json:"details"`
+	ReporterEmail string    `json:"reporter_email"`
+	ReporterIP    string    `json:"reporter_ip"`
+}
+
+const reportColumns = `
+		id,
+		created_at,
+		updated_at,
+		status,
+		video_id,
+		reason,
+		details,
+		reporter_email,
+		reporter_ip`
+
+func scanReport(row rowScanner) (Report, error) {
+	var report Report
+	err := row.Scan(
+		&report.ID,
+		&report.CreatedAt,
+		&report.UpdatedAt,
+		&report.Status,
+		&report.VideoID,
+		&report.Reason,
+		&report.Details,
+		&report.ReporterEmail,
+		&report.ReporterIP,
+	)
+	return report, err
+}
+
+func (c Client) CreateReport(params CreateReportParams) (Report, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO reports (
+		id,
+		created_at,
+		updated_at,
+		status,
+		video_id,
+		reason,
+		details,
+		reporter_email,
+		reporter_ip
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.exec(query, id, ReportStatusOpen, params.VideoID, params.Reason, params.Details, params.ReporterEmail, params.ReporterIP)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return c.GetReport(id)
+}
+
+func (c Client) GetReport(id uuid.UUID) (Report, error) {
+	query := `
+	SELECT` + reportColumns + `
+	FROM reports
+	WHERE id = ?
+	`
+
+	report, err := scanReport(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Report{}, nil
+		}
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// GetReports lists reports with the given status, oldest first so the
+// moderation queue is worked in order.
+func (c Client) GetReports(status string) ([]Report, error) {
+	query := `
+	SELECT` + reportColumns + `
+	FROM reports
+	WHERE status = ?
+	ORDER BY created_at ASC
+	`
+
+	rows, err := c.reader().Query(query, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+// SetReportStatus moves an open report to status, returning false if it
+// wasn't open anymore.
+func (c Client) SetReportStatus(id uuid.UUID, status string) (bool, error) {
+	query := `
+	UPDATE reports
+	SET updated_at = CURRENT_TIMESTAMP, status = ?
+	WHERE id = ? AND status = ?
+	`
+	res, err := c.exec(query, status, id, ReportStatusOpen)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ResolveVideoReports closes all open reports about a video once a
+// moderator acted on it, returning how many were closed.
+func (c Client) ResolveVideoReports(videoID uuid.UUID) (int64, error) {
+	query := `
+	UPDATE reports
+	SET updated_at = CURRENT_TIMESTAMP, status = ?
+	WHERE video_id = ? AND status = ?
+	`
+	res, err := c.exec(query, ReportStatusResolved, videoID, ReportStatusOpen)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
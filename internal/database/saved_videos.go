@@ -0,0 +1,69 @@
+package database
+
+import "github.com/google/uuid"
+
+// The lists every user has built in.
+const (
+	ListWatchLater = "watch_later"
+	ListFavorites  = "favorites"
+)
+
+// SaveVideo adds a video to one of the user's lists, returning false if it
+// was on it already.
+func (c Client) SaveVideo(userID uuid.UUID, list string, videoID uuid.UUID) (bool, error) {
+	query := `
+	INSERT INTO saved_videos (user_id, list, video_id, added_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT DO NOTHING
+	`
+	res, err := c.exec(query, userID, list, videoID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UnsaveVideo returns false if the video wasn't on the list.
+func (c Client) UnsaveVideo(userID uuid.UUID, list string, videoID uuid.UUID) (bool, error) {
+	res, err := c.exec("DELETE FROM saved_videos WHERE user_id = ? AND list = ? AND video_id = ?", userID, list, videoID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetSavedVideos returns up to limit videos of a list, last added first.
+// Videos the user can no longer watch, because their owner made them
+// private or they were taken down, stay on the list but aren't returned.
+func (c Client) GetSavedVideos(userID uuid.UUID, list string, limit int) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	JOIN (
+		SELECT video_id, added_at FROM saved_videos WHERE user_id = ? AND list = ?
+	) AS saved ON saved.video_id = videos.id
+	WHERE (videos.visibility != 'private' OR videos.user_id = ?)
+		AND videos.id NOT IN (
+			SELECT video_id FROM takedowns WHERE status IN ('taken_down', 'appealed', 'upheld')
+		)
+	ORDER BY saved.added_at DESC, videos.id DESC
+	LIMIT ?
+	`
+	rows, err := c.reader().Query(query, userID, list, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
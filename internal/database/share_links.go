@@ -0,0 +1,93 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLink is a link to a video its owner handed to someone. Views are
+// only counted, nothing is kept about who opened it.
+type ShareLink struct {
+	ID           uuid.UUID  `json:"id"`
+	VideoID      uuid.UUID  `json:"video_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Label        string     `json:"label"`
+	ViewCount    int64      `json:"view_count"`
+	LastViewedAt *time.Time `json:"last_viewed_at"`
+}
+
+func (c Client) CreateShareLink(videoID uuid.UUID, label string) (ShareLink, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO share_links (id, video_id, created_at, label)
+	VALUES (?, ?, CURRENT_TIMESTAMP, ?)
+	`
+	_, err := c.exec(query, id, videoID, label)
+	if err != nil {
+		return ShareLink{}, err
+	}
+	return c.GetShareLink(id)
+}
+
+// GetShareLink returns a zero ShareLink if there is no such link.
+func (c Client) GetShareLink(id uuid.UUID) (ShareLink, error) {
+	links, err := c.queryShareLinks("WHERE id = ?", id)
+	if err != nil || len(links) == 0 {
+		return ShareLink{}, err
+	}
+	return links[0], nil
+}
+
+// GetShareLinks returns a video's share links, oldest first.
+func (c Client) GetShareLinks(videoID uuid.UUID) ([]ShareLink, error) {
+	return c.queryShareLinks("WHERE video_id = ? ORDER BY created_at, id", videoID)
+}
+
+func (c Client) queryShareLinks(where string, arg any) ([]ShareLink, error) {
+	query := `
+	SELECT id, video_id, created_at, label, view_count, last_viewed_at
+	FROM share_links
+	` + where
+	rows, err := c.db.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		var l ShareLink
+		if err := rows.Scan(&l.ID, &l.VideoID, &l.CreatedAt, &l.Label, &l.ViewCount, &l.LastViewedAt); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// RecordShareLinkView counts a view of the video through the link. It
+// returns false if the link doesn't exist or is for another video.
+func (c Client) RecordShareLinkView(id, videoID uuid.UUID) (bool, error) {
+	query := `
+	UPDATE share_links
+	SET view_count = view_count + 1, last_viewed_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND video_id = ?
+	`
+	res, err := c.exec(query, id, videoID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteShareLink returns false if the video has no such link.
+func (c Client) DeleteShareLink(id, videoID uuid.UUID) (bool, error) {
+	res, err := c.exec("DELETE FROM share_links WHERE id = ? AND video_id = ?", id, videoID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"github.com/google/uuid"
+)
+
+type VideoStorage struct {
+	VideoID        uuid.UUID `json:"video_id"`
+	Title          string    `json:"title"`
+	VideoBytes     int64     `json:"video_bytes"`
+	ThumbnailBytes int64     `json:"thumbnail_bytes"`
+	// previous versions kept around for rollback
+	VersionBytes int64 `json:"version_bytes"`
+}
+
+func (c Client) GetVideoStorage(userID uuid.UUID) ([]VideoStorage, error) {
+	query := `
+	SELECT
+		v.id,
+		v.title,
+		COALESCE(v.video_size, 0),
+		COALESCE(v.thumbnail_size, 0),
+		COALESCE((
+			SELECT SUM(vv.video_size)
+			FROM video_versions vv
+			WHERE vv.video_id = v.id AND vv.video_url IS NOT v.video_url
+		), 0)
+	FROM videos v
+	WHERE v.user_id = ?
+	ORDER BY v.created_at DESC
+	`
+
+	rows, err := c.reader().Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []VideoStorage{}
+	for rows.Next() {
+		var vs VideoStorage
+		if err := rows.Scan(
+			&vs.VideoID,
+			&vs.Title,
+			&vs.VideoBytes,
+			&vs.ThumbnailBytes,
+			&vs.VersionBytes,
+		); err != nil {
+			return nil, err
+		}
+		usage = append(usage, vs)
+	}
+
+	return usage, rows.Err()
+}
+
+// GetVideosMissingSizes returns videos with media or thumbnails whose size
+// was never recorded, e.g. because they were uploaded before sizes were tracked.
+func (c Client) GetVideosMissingSizes() ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE (video_url IS NOT NULL AND video_size IS NULL)
+		OR (thumbnail_url IS NOT NULL AND thumbnail_size IS NULL)
+	`
+
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+
+	return videos, rows.Err()
+}
+
+// UpdateVideoSizes records sizes without touching updated_at, since the
+// video itself didn't change.
+func (c Client) UpdateVideoSizes(id uuid.UUID, videoSize, thumbnailSize *int64) error {
+	query := `
+	UPDATE videos
+	SET
+		video_size = ?,
+		thumbnail_size = ?
+	WHERE id = ?
+	`
+	_, err := c.exec(query, videoSize, thumbnailSize, id)
+	c.invalidateVideo(id, uuid.Nil)
+	return err
+}
+
+func (c Client) GetVideoVersionsMissingSize() ([]VideoVersion, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		video_id,
+		version,
+		video_url,
+		video_size
+	FROM video_versions
+	WHERE video_size IS NULL
+	`
+
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []VideoVersion{}
+	for rows.Next() {
+		var v VideoVersion
+		if err := rows.Scan(
+			&v.ID,
+			&v.CreatedAt,
+			&v.VideoID,
+			&v.Version,
+			&v.VideoURL,
+			&v.VideoSize,
+		); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+func (c Client) UpdateVideoVersionSize(id uuid.UUID, size int64) error {
+	_, err := c.exec("UPDATE video_versions SET video_size = ? WHERE id = ?", size, id)
+	return err
+}
+
+type VideoUsage struct {
+	VideoID           uuid.UUID `json:"video_id"`
+	UserID            uuid.UUID `json:"user_id"`
+	Title             string    `json:"title"`
+	StorageBytes      int64     `json:"storage_bytes"`
+	VideoBytes        int64     `json:"video_bytes"`
+	ProcessingSeconds float64   `json:"processing_seconds"`
+	ViewCount         int64     `json:"view_count"`
+}
+
+// GetVideoUsage returns the raw usage numbers of every video for cost reporting.
+func (c Client) GetVideoUsage() ([]VideoUsage, error) {
+	query := `
+	SELECT
+		v.id,
+		v.user_id,
+		v.title,
+		COALESCE(v.video_size, 0) + COALESCE(v.thumbnail_size, 0) + COALESCE((
+			SELECT SUM(vv.video_size)
+			FROM video_versions vv
+			WHERE vv.video_id = v.id AND vv.video_url IS NOT v.video_url
+		), 0),
+		COALESCE(v.video_size, 0),
+		v.processing_seconds,
+		v.view_count
+	FROM videos v
+	`
+
+	rows, err := c.reader().Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []VideoUsage{}
+	for rows.Next() {
+		var vu VideoUsage
+		if err := rows.Scan(
+			&vu.VideoID,
+			&vu.UserID,
+			&vu.Title,
+			&vu.StorageBytes,
+			&vu.VideoBytes,
+			&vu.ProcessingSeconds,
+			&vu.ViewCount,
+		); err != nil {
+			return nil, err
+		}
+		usage = append(usage, vu)
+	}
+
+	return usage, rows.Err()
+}
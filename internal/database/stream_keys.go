@@ -0,0 +1,109 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StreamKey lets a user broadcast without setting up a video first, each
+// broadcast to it becomes a new video of theirs.
+type StreamKey struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Key    string    `json:"key"`
+	Label  string    `json:"label"`
+	// of the videos broadcasts create, and how they're packaged
+	Visibility string     `json:"visibility"`
+	LowLatency bool       `json:"low_latency"`
+	PartTarget float64    `json:"part_target"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type CreateStreamKeyParams struct {
+	UserID     uuid.UUID
+	Key        string
+	Label      string
+	Visibility string
+	LowLatency bool
+	PartTarget float64
+}
+
+func (c Client) CreateStreamKey(params CreateStreamKeyParams) (StreamKey, error) {
+	id := uuid.New()
+	_, err := c.exec(`
+	INSERT INTO stream_keys (id, user_id, key, label, visibility, low_latency, part_target)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, id, params.UserID, params.Key, params.Label, params.Visibility, params.LowLatency, params.PartTarget)
+	if err != nil {
+		return StreamKey{}, err
+	}
+	return c.GetStreamKey(id)
+}
+
+// GetStreamKey returns the stream key, with a nil ID when it doesn't exist.
+func (c Client) GetStreamKey(id uuid.UUID) (StreamKey, error) {
+	keys, err := c.queryStreamKeys("WHERE id = ?", id)
+	if err != nil || len(keys) == 0 {
+		return StreamKey{}, err
+	}
+	return keys[0], nil
+}
+
+// GetStreamKeyByKey returns the stream key with the key, with a nil ID when
+// there is none.
+func (c Client) GetStreamKeyByKey(key string) (StreamKey, error) {
+	keys, err := c.queryStreamKeys("WHERE key = ?", key)
+	if err != nil || len(keys) == 0 {
+		return StreamKey{}, err
+	}
+	return keys[0], nil
+}
+
+// GetStreamKeys returns a user's stream keys, oldest first.
+func (c Client) GetStreamKeys(userID uuid.UUID) ([]StreamKey, error) {
+	return c.queryStreamKeys("WHERE user_id = ? ORDER BY created_at, rowid", userID)
+}
+
+func (c Client) queryStreamKeys(where string, arg any) ([]StreamKey, error) {
+	query := `
+	SELECT id, user_id, key, label, visibility, low_latency, part_target, created_at, rotated_at, last_used_at
+	FROM stream_keys
+	` + where
+	// the primary, a replica lagging behind would still accept a rotated
+	// or revoked key
+	rows, err := c.db.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []StreamKey{}
+	for rows.Next() {
+		var k StreamKey
+		err := rows.Scan(&k.ID, &k.UserID, &k.Key, &k.Label, &k.Visibility, &k.LowLatency, &k.PartTarget, &k.CreatedAt, &k.RotatedAt, &k.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RotateStreamKey replaces the key, the old one stops working.
+func (c Client) RotateStreamKey(id uuid.UUID, key string) error {
+	_, err := c.exec("UPDATE stream_keys SET key = ?, rotated_at = CURRENT_TIMESTAMP WHERE id = ?", key, id)
+	return err
+}
+
+func (c Client) DeleteStreamKey(id uuid.UUID) error {
+	_, err := c.exec("DELETE FROM stream_keys WHERE id = ?", id)
+	return err
+}
+
+func (c Client) MarkStreamKeyUsed(id uuid.UUID) error {
+	_, err := c.exec("UPDATE stream_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	return err
+}
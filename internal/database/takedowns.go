@@ -0,0 +1,83 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TakedownStatusFlagged    = "flagged"
+	TakedownStatusTakenDown  = "taken_down"
+	TakedownStatusAppealed   = "appealed"
+	TakedownStatusReinstated = "reinstated"
+	TakedownStatusUpheld     = "upheld"
+)
+
+// Takedown is the moderation state of a video. Videos that were never
+// flagged have none.
+type Takedown struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason"`
+	Appeal    *string   `json:"appeal"`
+}
+
+// GetTakedown returns a zero Takedown when the video was never flagged.
+func (c Client) GetTakedown(videoID uuid.UUID) (Takedown, error) {
+	query := `
+	SELECT video_id, created_at, updated_at, status, reason, appeal
+	FROM takedowns
+	WHERE video_id = ?
+	`
+
+	var t Takedown
+	err := c.db.QueryRow(query, videoID).Scan(&t.VideoID, &t.CreatedAt, &t.UpdatedAt, &t.Status, &t.Reason, &t.Appeal)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Takedown{}, nil
+		}
+		return Takedown{}, err
+	}
+	return t, nil
+}
+
+// SetTakedownStatus moves the video to status if it is currently in one of
+// from, where "" stands for a video without takedown. It returns false when
+// the video was in another state, e.g. because a concurrent request moved
+// it first.
+func (c Client) SetTakedownStatus(videoID uuid.UUID, from []string, status, reason string, appeal *string) (bool, error) {
+	ok := false
+	err := c.writeTx(func(tx *sql.Tx) error {
+		var current string
+		err := tx.QueryRow("SELECT status FROM takedowns WHERE video_id = ?", videoID).Scan(&current)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		for _, s := range from {
+			if s == current {
+				ok = true
+			}
+		}
+		if !ok {
+			return nil
+		}
+
+		query := `
+		INSERT INTO takedowns (video_id, created_at, updated_at, status, reason, appeal)
+		VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+		ON CONFLICT(video_id) DO UPDATE SET
+			updated_at = CURRENT_TIMESTAMP,
+			status = excluded.status,
+			reason = CASE WHEN excluded.reason = '' THEN takedowns.reason ELSE excluded.reason END,
+			appeal = COALESCE(excluded.appeal, takedowns.appeal)
+		`
+		_, err = tx.Exec(query, videoID, status, reason, appeal)
+		return err
+	})
+	return ok, err
+}
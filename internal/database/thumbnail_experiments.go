@@ -0,0 +1,221 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ThumbnailExperimentRunning   = "running"
+	ThumbnailExperimentCompleted = "completed"
+	ThumbnailExperimentStopped   = "stopped"
+)
+
+// ErrThumbnailExperimentRunning is returned when a video already has an
+// experiment running.
+var ErrThumbnailExperimentRunning = errors.New("video already has a thumbnail experiment running")
+
+// ThumbnailVariantStats is how viewers responded to one of the thumbnails
+// of an experiment.
+type ThumbnailVariantStats struct {
+	Impressions int `json:"impressions"`
+	Clicks      int `json:"clicks"`
+}
+
+// ThumbnailExperiment pits the video's thumbnail (A) against another one
+// (B). Viewers are split between them until SampleSize impressions are
+// collected, then the thumbnail that got more clicks per impression wins.
+type ThumbnailExperiment struct {
+	ID            uuid.UUID             `json:"id"`
+	VideoID       uuid.UUID             `json:"video_id"`
+	CreatedAt     time.Time             `json:"created_at"`
+	CompletedAt   *time.Time            `json:"completed_at"`
+	Status        string                `json:"status"`
+	SampleSize    int                   `json:"sample_size"`
+	ThumbnailURL  string                `json:"thumbnail_url"`
+	ThumbnailSize *int64                `json:"thumbnail_size"`
+	AltText       string                `json:"alt_text"`
+	A             ThumbnailVariantStats `json:"a"`
+	B             ThumbnailVariantStats `json:"b"`
+	// "a" or "b" once completed
+	Winner *string `json:"winner"`
+}
+
+type CreateThumbnailExperimentParams struct {
+	VideoID       uuid.UUID
+	SampleSize    int
+	ThumbnailURL  string
+	ThumbnailSize *int64
+	AltText       string
+}
+
+func (c Client) CreateThumbnailExperiment(params CreateThumbnailExperimentParams) (ThumbnailExperiment, error) {
+	id := uuid.New()
+	_, err := c.exec(`
+	INSERT INTO thumbnail_experiments (id, video_id, status, sample_size, thumbnail_url, thumbnail_size, alt_text)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, id, params.VideoID, ThumbnailExperimentRunning, params.SampleSize, params.ThumbnailURL, params.ThumbnailSize, params.AltText)
+	if isUniqueViolation(err) {
+		return ThumbnailExperiment{}, ErrThumbnailExperimentRunning
+	}
+	if err != nil {
+		return ThumbnailExperiment{}, err
+	}
+	return c.GetThumbnailExperiment(id)
+}
+
+// GetThumbnailExperiment returns the experiment, with a nil ID when it
+// doesn't exist.
+func (c Client) GetThumbnailExperiment(id uuid.UUID) (ThumbnailExperiment, error) {
+	experiments, err := c.queryThumbnailExperiments("WHERE id = ?", id)
+	if err != nil || len(experiments) == 0 {
+		return ThumbnailExperiment{}, err
+	}
+	return experiments[0], nil
+}
+
+// GetThumbnailExperiments returns a video's experiments, newest first.
+func (c Client) GetThumbnailExperiments(videoID uuid.UUID) ([]ThumbnailExperiment, error) {
+	return c.queryThumbnailExperiments("WHERE video_id = ? ORDER BY created_at DESC, rowid DESC", videoID)
+}
+
+// GetRunningThumbnailExperiments returns the experiments running on any of
+// the videos, by video.
+func (c Client) GetRunningThumbnailExperiments(videoIDs []uuid.UUID) (map[uuid.UUID]ThumbnailExperiment, error) {
+	running := map[uuid.UUID]ThumbnailExperiment{}
+	if len(videoIDs) == 0 {
+		return running, nil
+	}
+	args := []any{ThumbnailExperimentRunning}
+	for _, id := range videoIDs {
+		args = append(args, id)
+	}
+	experiments, err := c.queryThumbnailExperiments("WHERE status = ? AND video_id IN (?"+strings.Repeat(", ?", len(videoIDs)-1)+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range experiments {
+		running[e.VideoID] = e
+	}
+	return running, nil
+}
+
+// GetAllRunningThumbnailExperiments returns every running experiment.
+func (c Client) GetAllRunningThumbnailExperiments() ([]ThumbnailExperiment, error) {
+	return c.queryThumbnailExperiments("WHERE status = ?", ThumbnailExperimentRunning)
+}
+
+func (c Client) queryThumbnailExperiments(where string, args ...any) ([]ThumbnailExperiment, error) {
+	query := `
+	SELECT
+		id, video_id, created_at, completed_at, status, sample_size,
+		thumbnail_url, thumbnail_size, alt_text,
+		impressions_a, clicks_a, impressions_b, clicks_b, winner
+	FROM thumbnail_experiments
+	` + where
+	rows, err := c.reader().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	experiments := []ThumbnailExperiment{}
+	for rows.Next() {
+		var e ThumbnailExperiment
+		err := rows.Scan(
+			&e.ID, &e.VideoID, &e.CreatedAt, &e.CompletedAt, &e.Status, &e.SampleSize,
+			&e.ThumbnailURL, &e.ThumbnailSize, &e.AltText,
+			&e.A.Impressions, &e.A.Clicks, &e.B.Impressions, &e.B.Clicks, &e.Winner,
+		)
+		if err != nil {
+			return nil, err
+		}
+		experiments = append(experiments, e)
+	}
+	return experiments, rows.Err()
+}
+
+// RecordThumbnailImpressions counts impressions of running experiments,
+// variant "a" or "b" of each.
+func (c Client) RecordThumbnailImpressions(variants map[uuid.UUID]string) error {
+	return c.writeTx(func(tx *sql.Tx) error {
+		for id, variant := range variants {
+			column := "impressions_a"
+			if variant == "b" {
+				column = "impressions_b"
+			}
+			_, err := tx.Exec("UPDATE thumbnail_experiments SET "+column+" = "+column+" + 1 WHERE id = ? AND status = ?", id, ThumbnailExperimentRunning)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RecordThumbnailClick counts a click on variant "a" or "b" of a running
+// experiment.
+func (c Client) RecordThumbnailClick(id uuid.UUID, variant string) error {
+	column := "clicks_a"
+	if variant == "b" {
+		column = "clicks_b"
+	}
+	_, err := c.exec("UPDATE thumbnail_experiments SET "+column+" = "+column+" + 1 WHERE id = ? AND status = ?", id, ThumbnailExperimentRunning)
+	return err
+}
+
+// FinishThumbnailExperiment ends a running experiment with status. When B
+// won, the video switches to it and its own thumbnail goes to its history;
+// otherwise B goes to the history, where the owner can still revert to it
+// and the thumbnail GC eventually deletes it. video is the experiment's
+// video, or has a nil ID when it's gone.
+func (c Client) FinishThumbnailExperiment(experiment ThumbnailExperiment, video Video, status string, winner *string) error {
+	err := c.writeTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+		UPDATE thumbnail_experiments
+		SET status = ?, winner = ?, completed_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?
+		`, status, winner, experiment.ID, ThumbnailExperimentRunning)
+		if err != nil {
+			return err
+		}
+		// already finished by someone else
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+
+		if winner == nil || *winner != "b" || video.ID == uuid.Nil {
+			return addThumbnailHistory(tx.Exec, Video{
+				ID:               experiment.VideoID,
+				ThumbnailURL:     &experiment.ThumbnailURL,
+				ThumbnailSize:    experiment.ThumbnailSize,
+				ThumbnailAltText: experiment.AltText,
+			})
+		}
+		if video.ThumbnailURL != nil {
+			if err := addThumbnailHistory(tx.Exec, video); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(`
+		UPDATE videos
+		SET
+			thumbnail_url = ?,
+			thumbnail_size = ?,
+			thumbnail_focus_x = NULL,
+			thumbnail_focus_y = NULL,
+			thumbnail_alt_text = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+		`, experiment.ThumbnailURL, experiment.ThumbnailSize, experiment.AltText, video.ID)
+		return err
+	})
+	if video.ID != uuid.Nil {
+		c.invalidateVideo(video.ID, video.UserID)
+	}
+	return err
+}
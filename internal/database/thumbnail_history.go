@@ -0,0 +1,130 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ThumbnailHistoryEntry is a thumbnail a video had before it was replaced.
+type ThumbnailHistoryEntry struct {
+	ID            uuid.UUID `json:"id"`
+	VideoID       uuid.UUID `json:"video_id"`
+	ThumbnailURL  string    `json:"thumbnail_url"`
+	ThumbnailSize *int64    `json:"thumbnail_size"`
+	// Focus is the focus point the thumbnail had, restored on revert
+	Focus      *FocusPoint `json:"focus"`
+	AltText    string      `json:"alt_text"`
+	ReplacedAt time.Time   `json:"replaced_at"`
+}
+
+// AddThumbnailHistory records the thumbnail the video had, which it no
+// longer uses.
+func (c Client) AddThumbnailHistory(video Video) error {
+	return addThumbnailHistory(c.exec, video)
+}
+
+func addThumbnailHistory(exec func(query string, args ...any) (sql.Result, error), video Video) error {
+	focusX, focusY := focusArgs(video.ThumbnailFocus)
+	query := `
+	INSERT INTO thumbnail_history (id, video_id, thumbnail_url, thumbnail_size, focus_x, focus_y, alt_text, replaced_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err := exec(query, uuid.New(), video.ID, *video.ThumbnailURL, video.ThumbnailSize, focusX, focusY, video.ThumbnailAltText)
+	return err
+}
+
+// GetThumbnailHistory returns up to limit of a video's previous
+// thumbnails, most recently replaced first.
+func (c Client) GetThumbnailHistory(videoID uuid.UUID, limit int) ([]ThumbnailHistoryEntry, error) {
+	return c.queryThumbnailHistory("WHERE video_id = ? ORDER BY replaced_at DESC, rowid DESC LIMIT ?", videoID, limit)
+}
+
+// GetPurgeableThumbnails returns up to limit entries whose files can go:
+// those past the keep most recent of their video, and all of videos that
+// were deleted or expired.
+func (c Client) GetPurgeableThumbnails(keep, limit int) ([]ThumbnailHistoryEntry, error) {
+	query := `
+	SELECT id, video_id, thumbnail_url, thumbnail_size, focus_x, focus_y, alt_text, replaced_at
+	FROM (
+		SELECT
+			thumbnail_history.*,
+			ROW_NUMBER() OVER (
+				PARTITION BY thumbnail_history.video_id
+				ORDER BY thumbnail_history.replaced_at DESC, thumbnail_history.rowid DESC
+			) AS n,
+			videos.id AS existing_video_id,
+			videos.expired_at
+		FROM thumbnail_history
+		LEFT JOIN videos ON videos.id = thumbnail_history.video_id
+	)
+	WHERE n > ? OR existing_video_id IS NULL OR expired_at IS NOT NULL
+	LIMIT ?
+	`
+	return c.scanThumbnailHistory(c.reader().Query(query, keep, limit))
+}
+
+func (c Client) queryThumbnailHistory(where string, args ...any) ([]ThumbnailHistoryEntry, error) {
+	query := `
+	SELECT id, video_id, thumbnail_url, thumbnail_size, focus_x, focus_y, alt_text, replaced_at
+	FROM thumbnail_history
+	` + where
+	return c.scanThumbnailHistory(c.reader().Query(query, args...))
+}
+
+func (c Client) scanThumbnailHistory(rows *sql.Rows, err error) ([]ThumbnailHistoryEntry, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ThumbnailHistoryEntry{}
+	for rows.Next() {
+		var e ThumbnailHistoryEntry
+		var focusX, focusY sql.NullFloat64
+		err := rows.Scan(&e.ID, &e.VideoID, &e.ThumbnailURL, &e.ThumbnailSize, &focusX, &focusY, &e.AltText, &e.ReplacedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.Focus = focusColumns(focusX, focusY)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// RevertThumbnail makes entry the video's thumbnail again, moving the one
+// it replaces into the history.
+func (c Client) RevertThumbnail(video Video, entry ThumbnailHistoryEntry) error {
+	err := c.writeTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM thumbnail_history WHERE id = ?", entry.ID)
+		if err != nil {
+			return err
+		}
+		if video.ThumbnailURL != nil {
+			if err := addThumbnailHistory(tx.Exec, video); err != nil {
+				return err
+			}
+		}
+		focusX, focusY := focusArgs(entry.Focus)
+		_, err = tx.Exec(`
+		UPDATE videos
+		SET
+			thumbnail_url = ?,
+			thumbnail_size = ?,
+			thumbnail_focus_x = ?,
+			thumbnail_focus_y = ?,
+			thumbnail_alt_text = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+		`, entry.ThumbnailURL, entry.ThumbnailSize, focusX, focusY, entry.AltText, video.ID)
+		return err
+	})
+	c.invalidateVideo(video.ID, video.UserID)
+	return err
+}
+
+func (c Client) DeleteThumbnailHistoryEntry(id uuid.UUID) error {
+	_, err := c.exec("DELETE FROM thumbnail_history WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// listableVideo matches videos that may show up in lists of other people's
+// videos: public, with media that hasn't expired, and not taken down.
+const listableVideo = `
+	videos.visibility = 'public' AND videos.video_url IS NOT NULL AND videos.expired_at IS NULL
+	AND videos.id NOT IN (
+		SELECT video_id FROM takedowns WHERE status IN ('taken_down', 'appealed', 'upheld')
+	)`
+
+type TrendingCandidate struct {
+	VideoID        uuid.UUID
+	CreatedAt      time.Time
+	ViewCount      int64
+	RecentSessions int
+}
+
+// GetTrendingCandidates returns every listable video with the number of
+// playback sessions started since since.
+func (c Client) GetTrendingCandidates(since time.Time) ([]TrendingCandidate, error) {
+	query := `
+	SELECT videos.id, videos.created_at, videos.view_count, COUNT(playback_sessions.id)
+	FROM videos
+	LEFT JOIN playback_sessions
+		ON playback_sessions.video_id = videos.id AND playback_sessions.started_at >= ?
+	WHERE` + listableVideo + `
+	GROUP BY videos.id
+	`
+	// compared as text, so the format must match CURRENT_TIMESTAMP's
+	rows, err := c.reader().Query(query, since.UTC().Format(time.DateTime))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []TrendingCandidate{}
+	for rows.Next() {
+		var cand TrendingCandidate
+		if err := rows.Scan(&cand.VideoID, &cand.CreatedAt, &cand.ViewCount, &cand.RecentSessions); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, cand)
+	}
+	return candidates, rows.Err()
+}
+
+type TrendingScore struct {
+	VideoID uuid.UUID
+	Score   float64
+}
+
+// ReplaceTrendingRanking swaps the stored ranking for scores in one
+// transaction, so readers never see it half built.
+func (c Client) ReplaceTrendingRanking(scores []TrendingScore) error {
+	return c.writeTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM trending_videos"); err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare("INSERT INTO trending_videos (video_id, score, ranked_at) VALUES (?, ?, CURRENT_TIMESTAMP)")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, s := range scores {
+			if _, err := stmt.Exec(s.VideoID, s.Score); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetTrendingVideos returns up to limit videos from the stored ranking, best
+// first. Videos that stopped being listable since it was built are skipped.
+func (c Client) GetTrendingVideos(limit int) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM trending_videos
+	JOIN videos ON videos.id = trending_videos.video_id
+	WHERE` + listableVideo + `
+	ORDER BY trending_videos.score DESC
+	LIMIT ?
+	`
+	rows, err := c.reader().Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UploadPreset is a named set of settings a user applies to uploads, so
+// they don't have to set them on every video afterwards.
+type UploadPreset struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UploadPresetParams
+}
+
+type UploadPresetParams struct {
+	Name string `json:"name"`
+	// Visibility is given to uploaded videos, empty leaves theirs alone
+	Visibility string `json:"visibility"`
+	// ExpiresInSeconds makes uploaded videos expire that long after the
+	// upload, 0 leaves their expiry alone
+	ExpiresInSeconds int64 `json:"expires_in_seconds"`
+	// an empty VideoCodec leaves the encoding to the video's folder
+	EncodingProfile
+}
+
+func (c Client) CreateUploadPreset(userID uuid.UUID, params UploadPresetParams) (UploadPreset, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO upload_presets (
+		id,
+		user_id,
+		created_at,
+		updated_at,
+		name,
+		visibility,
+		expires_in_seconds,
+		video_codec,
+		max_height,
+		crf
+	) VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.exec(query, id, userID, params.Name, params.Visibility, params.ExpiresInSeconds, params.VideoCodec, params.MaxHeight, params.CRF)
+	if err != nil {
+		return UploadPreset{}, err
+	}
+	return c.GetUploadPreset(id)
+}
+
+// GetUploadPreset returns a zero UploadPreset if there is no such preset.
+func (c Client) GetUploadPreset(id uuid.UUID) (UploadPreset, error) {
+	presets, err := c.queryUploadPresets("WHERE id = ?", id)
+	if err != nil || len(presets) == 0 {
+		return UploadPreset{}, err
+	}
+	return presets[0], nil
+}
+
+// GetUploadPresets returns a user's presets by name.
+func (c Client) GetUploadPresets(userID uuid.UUID) ([]UploadPreset, error) {
+	return c.queryUploadPresets("WHERE user_id = ? ORDER BY name COLLATE NOCASE, id", userID)
+}
+
+func (c Client) queryUploadPresets(where string, arg any) ([]UploadPreset, error) {
+	query := `
+	SELECT
+		id,
+		user_id,
+		created_at,
+		updated_at,
+		name,
+		visibility,
+		expires_in_seconds,
+		video_codec,
+		max_height,
+		crf
+	FROM upload_presets
+	` + where
+	rows, err := c.reader().Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	presets := []UploadPreset{}
+	for rows.Next() {
+		var p UploadPreset
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.Name,
+			&p.Visibility,
+			&p.ExpiresInSeconds,
+			&p.VideoCodec,
+			&p.MaxHeight,
+			&p.CRF,
+		)
+		if err != nil {
+			return nil, err
+		}
+		presets = append(presets, p)
+	}
+	return presets, rows.Err()
+}
+
+func (c Client) UpdateUploadPreset(id uuid.UUID, params UploadPresetParams) error {
+	query := `
+	UPDATE upload_presets
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		name = ?,
+		visibility = ?,
+		expires_in_seconds = ?,
+		video_codec = ?,
+		max_height = ?,
+		crf = ?
+	WHERE id = ?
+	`
+	_, err := c.exec(query, params.Name, params.Visibility, params.ExpiresInSeconds, params.VideoCodec, params.MaxHeight, params.CRF, id)
+	return err
+}
+
+func (c Client) DeleteUploadPreset(id uuid.UUID) error {
+	_, err := c.exec("DELETE FROM upload_presets WHERE id = ?", id)
+	return err
+}
@@ -107,7 +107,7 @@ func (c Client) CreateUser(params CreateUserParams) (*User, error) {
 		VALUES
 		    (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
 	`
-	_, err := c.db.Exec(query, id.String(), params.Email, params.Password)
+	_, err := c.exec(query, id.String(), params.Email, params.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -142,6 +142,22 @@ func (c Client) DeleteUser(id uuid.UUID) error {
 		DELETE FROM users
 		WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id.String())
+	_, err := c.exec(query, id.String())
+	return err
+}
+
+// GetUserPlan returns the plan an admin put the user on, empty for users on
+// the default plan.
+func (c Client) GetUserPlan(id uuid.UUID) (string, error) {
+	var plan string
+	err := c.reader().QueryRow("SELECT plan FROM users WHERE id = ?", id.String()).Scan(&plan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return plan, err
+}
+
+func (c Client) SetUserPlan(id uuid.UUID, plan string) error {
+	_, err := c.exec("UPDATE users SET plan = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", plan, id.String())
 	return err
 }
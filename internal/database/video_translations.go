@@ -0,0 +1,88 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoTranslation is a video's title and description in another language.
+type VideoTranslation struct {
+	VideoID     uuid.UUID `json:"video_id"`
+	Language    string    `json:"language"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SetVideoTranslation creates or replaces the translation into language.
+func (c Client) SetVideoTranslation(videoID uuid.UUID, language, title, description string) (VideoTranslation, error) {
+	query := `
+	INSERT INTO video_translations (video_id, language, title, description, created_at, updated_at)
+	VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	ON CONFLICT (video_id, language) DO UPDATE SET
+		title = excluded.title,
+		description = excluded.description,
+		updated_at = CURRENT_TIMESTAMP
+	`
+	_, err := c.exec(query, videoID, language, title, description)
+	if err != nil {
+		return VideoTranslation{}, err
+	}
+	return c.GetVideoTranslation(videoID, language)
+}
+
+// GetVideoTranslation returns a zero VideoTranslation if the video has no
+// translation into language.
+func (c Client) GetVideoTranslation(videoID uuid.UUID, language string) (VideoTranslation, error) {
+	query := `
+	SELECT video_id, language, title, description, created_at, updated_at
+	FROM video_translations
+	WHERE video_id = ? AND language = ?
+	`
+	var t VideoTranslation
+	err := c.reader().QueryRow(query, videoID, language).Scan(&t.VideoID, &t.Language, &t.Title, &t.Description, &t.CreatedAt, &t.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return VideoTranslation{}, nil
+	}
+	return t, err
+}
+
+// GetVideoTranslations returns a video's translations by language.
+func (c Client) GetVideoTranslations(videoID uuid.UUID) ([]VideoTranslation, error) {
+	query := `
+	SELECT video_id, language, title, description, created_at, updated_at
+	FROM video_translations
+	WHERE video_id = ?
+	ORDER BY language
+	`
+	rows, err := c.reader().Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []VideoTranslation{}
+	for rows.Next() {
+		var t VideoTranslation
+		err := rows.Scan(&t.VideoID, &t.Language, &t.Title, &t.Description, &t.CreatedAt, &t.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, t)
+	}
+	return translations, rows.Err()
+}
+
+// DeleteVideoTranslation reports whether there was a translation to delete.
+func (c Client) DeleteVideoTranslation(videoID uuid.UUID, language string) (bool, error) {
+	res, err := c.exec("DELETE FROM video_translations WHERE video_id = ? AND language = ?", videoID, language)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoVersion struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreateVideoVersionParams
+}
+
+type CreateVideoVersionParams struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	Version   int       `json:"version"`
+	VideoURL  string    `json:"video_url"`
+	VideoSize *int64    `json:"video_size"`
+	// EncryptionKeyMD5 identifies the customer-provided key of the version
+	EncryptionKeyMD5 *string `json:"encryption_key_md5"`
+	ContentSHA256    *string `json:"content_sha256"`
+	ObjectETag       *string `json:"object_etag"`
+}
+
+func (c Client) CreateVideoVersion(params CreateVideoVersionParams) (VideoVersion, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO video_versions (
+		id,
+		created_at,
+		video_id,
+		version,
+		video_url,
+		video_size,
+		encryption_key_md5,
+		content_sha256,
+		object_etag
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.exec(query, id, params.VideoID, params.Version, params.VideoURL, params.VideoSize, params.EncryptionKeyMD5, params.ContentSHA256, params.ObjectETag)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+
+	return c.GetVideoVersion(params.VideoID, params.Version)
+}
+
+// GetNextVideoVersion returns the version number after the newest recorded
+// one. Uploads reserve theirs with AllocateVideoVersion instead.
+func (c Client) GetNextVideoVersion(videoID uuid.UUID) (int, error) {
+	var version int
+	err := c.db.QueryRow("SELECT COALESCE(MAX(version), 0) + 1 FROM video_versions WHERE video_id = ?", videoID).Scan(&version)
+	return version, err
+}
+
+// AllocateVideoVersion reserves the version number for a new upload of a
+// video. Numbers are never handed out twice, so uploads running at the same
+// time store their media under different keys. Versions recorded without
+// an allocation, like a copy's first, are counted too.
+func (c Client) AllocateVideoVersion(videoID uuid.UUID) (int, error) {
+	var version int
+	err := c.writeTx(func(tx *sql.Tx) error {
+		query := `
+		UPDATE videos
+		SET last_version = MAX(
+			last_version,
+			(SELECT COALESCE(MAX(version), 0) FROM video_versions WHERE video_id = videos.id)
+		) + 1
+		WHERE id = ?
+		`
+		_, err := tx.Exec(query, videoID)
+		if err != nil {
+			return err
+		}
+		return tx.QueryRow("SELECT last_version FROM videos WHERE id = ?", videoID).Scan(&version)
+	})
+	return version, err
+}
+
+func (c Client) GetVideoVersion(videoID uuid.UUID, version int) (VideoVersion, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		video_id,
+		version,
+		video_url,
+		video_size,
+		encryption_key_md5,
+		content_sha256,
+		object_etag
+	FROM video_versions
+	WHERE video_id = ? AND version = ?
+	`
+
+	var v VideoVersion
+	err := c.db.QueryRow(query, videoID, version).Scan(
+		&v.ID,
+		&v.CreatedAt,
+		&v.VideoID,
+		&v.Version,
+		&v.VideoURL,
+		&v.VideoSize,
+		&v.EncryptionKeyMD5,
+		&v.ContentSHA256,
+		&v.ObjectETag,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoVersion{}, nil
+		}
+		return VideoVersion{}, err
+	}
+	return v, nil
+}
+
+func (c Client) GetVideoVersions(videoID uuid.UUID) ([]VideoVersion, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		video_id,
+		version,
+		video_url,
+		video_size,
+		encryption_key_md5,
+		content_sha256,
+		object_etag
+	FROM video_versions
+	WHERE video_id = ?
+	ORDER BY version DESC
+	`
+
+	rows, err := c.reader().Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []VideoVersion{}
+	for rows.Next() {
+		var v VideoVersion
+		if err := rows.Scan(
+			&v.ID,
+			&v.CreatedAt,
+			&v.VideoID,
+			&v.Version,
+			&v.VideoURL,
+			&v.VideoSize,
+			&v.EncryptionKeyMD5,
+			&v.ContentSHA256,
+			&v.ObjectETag,
+		); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// UpdateVideoVersionMedia records the size and checksums of media replaced
+// in place, on the versions pointing at it, so rolling back to them restores
+// what is actually stored.
+func (c Client) UpdateVideoVersionMedia(videoID uuid.UUID, videoURL string, videoSize *int64, contentSHA256, objectETag *string) error {
+	_, err := c.exec(
+		"UPDATE video_versions SET video_size = ?, content_sha256 = ?, object_etag = ? WHERE video_id = ? AND video_url = ?",
+		videoSize, contentSHA256, objectETag, videoID, videoURL,
+	)
+	return err
+}
@@ -8,24 +8,88 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	VisibilityPrivate  = "private"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPublic   = "public"
+)
+
+// ErrSlugTaken is returned when a user already has a video with the slug.
+var ErrSlugTaken = errors.New("slug is already in use")
+
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	ThumbnailURL  *string   `json:"thumbnail_url"`
+	VideoURL      *string   `json:"video_url"`
+	VideoSize     *int64    `json:"video_size"`
+	ThumbnailSize *int64    `json:"thumbnail_size"`
+	// ThumbnailFocus is the point of the thumbnail crops keep in view, nil
+	// for its center
+	ThumbnailFocus *FocusPoint `json:"thumbnail_focus"`
+	// ThumbnailAltText describes the thumbnail for screen readers
+	ThumbnailAltText string `json:"thumbnail_alt_text"`
+	// AudioDescriptionURL is an audio track narrating the video for blind
+	// and low-vision viewers, nil when it has none
+	AudioDescriptionURL *string `json:"audio_description_url"`
+	ViewCount           int64   `json:"view_count"`
+	Slug                *string `json:"slug"`
+	// DurationSeconds is probed on upload, nil for videos without media or
+	// uploaded before durations were recorded.
+	DurationSeconds *float64 `json:"duration_seconds"`
+	// ExpiredAt is set once the media of an expiring video was deleted
+	ExpiredAt *time.Time `json:"expired_at"`
+	// RetainedUntil is a retention lock set by admins, the video can't be
+	// deleted before then
+	RetainedUntil *time.Time `json:"retained_until"`
+	// EncryptionKeyMD5 identifies the customer-provided key the media is
+	// encrypted with, nil for unencrypted media. The key itself isn't stored.
+	EncryptionKeyMD5 *string `json:"encryption_key_md5"`
+	// ContentSHA256 is the hex SHA-256 of the stored media and ObjectETag
+	// the ETag S3 gave it, both recorded when it was stored so the
+	// integrity check can detect later changes. The hash is nil for media
+	// transcoded remotely or stored before hashes were recorded.
+	ContentSHA256 *string `json:"content_sha256"`
+	ObjectETag    *string `json:"object_etag"`
 	CreateVideoParams
 }
 
+// FocusPoint is a point in an image as fractions of its width and height,
+// from the top left.
+type FocusPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// focusColumns maps a nullable pair of columns to a focus point.
+func focusColumns(x, y sql.NullFloat64) *FocusPoint {
+	if !x.Valid || !y.Valid {
+		return nil
+	}
+	return &FocusPoint{X: x.Float64, Y: y.Float64}
+}
+
+// focusArgs are the column values for focus, NULL for none.
+func focusArgs(focus *FocusPoint) (x, y *float64) {
+	if focus == nil {
+		return nil, nil
+	}
+	return &focus.X, &focus.Y
+}
+
 type CreateVideoParams struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	UserID      uuid.UUID `json:"user_id"`
+	Visibility  string    `json:"visibility"`
+	// ExpiresAt is when the video's media is deleted, nil keeps it forever
+	ExpiresAt *time.Time `json:"expires_at"`
+	// FolderID is the folder the owner filed the video in, nil for none
+	FolderID *uuid.UUID `json:"folder_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
@@ -33,40 +97,180 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
+		user_id,
+		visibility,
+		video_size,
+		thumbnail_size,
+		view_count,
+		slug,
+		duration_seconds,
+		expires_at,
+		expired_at,
+		retained_until,
+		encryption_key_md5,
+		content_sha256,
+		object_etag,
+		folder_id,
+		thumbnail_focus_x,
+		thumbnail_focus_y,
+		thumbnail_alt_text,
+		audio_description_url`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	var focusX, focusY sql.NullFloat64
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.UserID,
+		&video.Visibility,
+		&video.VideoSize,
+		&video.ThumbnailSize,
+		&video.ViewCount,
+		&video.Slug,
+		&video.DurationSeconds,
+		&video.ExpiresAt,
+		&video.ExpiredAt,
+		&video.RetainedUntil,
+		&video.EncryptionKeyMD5,
+		&video.ContentSHA256,
+		&video.ObjectETag,
+		&video.FolderID,
+		&focusX,
+		&focusY,
+		&video.ThumbnailAltText,
+		&video.AudioDescriptionURL,
+	)
+	video.ThumbnailFocus = focusColumns(focusX, focusY)
+	return video, err
+}
+
+func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
+	videos := []Video{}
+	if c.cacheGet(userVideosCacheKey(userID), &videos) {
+		return videos, nil
+	}
+
+	query := `
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE user_id = ?
 	ORDER BY created_at DESC
 	`
 
-	rows, err := c.db.Query(query, userID)
+	rows, err := c.reader().Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
 
+	c.cacheSet(userVideosCacheKey(userID), videos)
 	return videos, nil
 }
 
+// VideoCursor marks a position in a user's listing, which is ordered newest
+// first with the ID breaking ties between videos created in the same second.
+type VideoCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// GetVideosPage returns up to limit of a user's videos after cursor, or from
+// the start when cursor is nil. Unlike offsets, a cursor keeps its place when
+// videos are added while the client is paging.
+func (c Client) GetVideosPage(userID uuid.UUID, cursor *VideoCursor, limit int) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ?
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?
+	`
+	args := []any{userID, limit}
+	if cursor != nil {
+		// compared as text, so the format must match CURRENT_TIMESTAMP's
+		query = `
+		SELECT` + videoColumns + `
+		FROM videos
+		WHERE user_id = ? AND (
+			created_at < ?
+			OR (created_at = ? AND id < ?)
+		)
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+		`
+		createdAt := cursor.CreatedAt.UTC().Format(time.DateTime)
+		args = []any{userID, createdAt, createdAt, cursor.ID, limit}
+	}
+
+	rows, err := c.reader().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+
+	return videos, rows.Err()
+}
+
+// GetPublicVideos returns a user's most recent listable videos.
+func (c Client) GetPublicVideos(userID uuid.UUID, limit int) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND` + listableVideo + `
+	ORDER BY created_at DESC
+	LIMIT ?
+	`
+
+	rows, err := c.reader().Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+
+	return videos, rows.Err()
+}
+
 func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
+	if params.Visibility == "" {
+		params.Visibility = VisibilityPrivate
+	}
+
 	id := uuid.New()
 	query := `
 	INSERT INTO videos (
@@ -75,42 +279,34 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
-		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+		user_id,
+		visibility,
+		expires_at,
+		folder_id
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	_, err := c.exec(query, id, params.Title, params.Description, params.UserID, params.Visibility, utcTime(params.ExpiresAt), params.FolderID)
 	if err != nil {
 		return Video{}, err
 	}
+	c.invalidateVideo(id, params.UserID)
 
 	return c.GetVideo(id)
 }
 
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+	var cached Video
+	if c.cacheGet(videoCacheKey(id), &cached) {
+		return cached, nil
+	}
+
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -118,6 +314,26 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 		return Video{}, err
 	}
 
+	c.cacheSet(videoCacheKey(id), video)
+	return video, nil
+}
+
+// GetVideoBySlug finds the user's video with the given slug, returning a
+// zero Video when there is none.
+func (c Client) GetVideoBySlug(userID uuid.UUID, slug string) (Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND slug = ?
+	`
+
+	video, err := scanVideo(c.reader().QueryRow(query, userID, slug))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Video{}, nil
+		}
+		return Video{}, err
+	}
 	return video, nil
 }
 
@@ -125,31 +341,254 @@ func (c Client) UpdateVideo(video Video) error {
 	query := `
 	UPDATE videos
 	SET
+		updated_at = CURRENT_TIMESTAMP,
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
-		user_id = ?
+		user_id = ?,
+		visibility = ?,
+		video_size = ?,
+		thumbnail_size = ?,
+		slug = ?,
+		duration_seconds = ?,
+		expires_at = ?,
+		encryption_key_md5 = ?,
+		content_sha256 = ?,
+		object_etag = ?,
+		thumbnail_focus_x = ?,
+		thumbnail_focus_y = ?,
+		thumbnail_alt_text = ?,
+		audio_description_url = ?
 	WHERE id = ?
 	`
 
-	_, err := c.db.Exec(
+	focusX, focusY := focusArgs(video.ThumbnailFocus)
+	_, err := c.exec(
 		query,
 		video.Title,
 		video.Description,
 		&video.ThumbnailURL,
 		&video.VideoURL,
 		video.UserID,
+		video.Visibility,
+		video.VideoSize,
+		video.ThumbnailSize,
+		video.Slug,
+		video.DurationSeconds,
+		utcTime(video.ExpiresAt),
+		video.EncryptionKeyMD5,
+		video.ContentSHA256,
+		video.ObjectETag,
+		focusX,
+		focusY,
+		video.ThumbnailAltText,
+		video.AudioDescriptionURL,
 		video.ID,
 	)
+	if isUniqueViolation(err) {
+		return ErrSlugTaken
+	}
+	c.invalidateVideo(video.ID, video.UserID)
+	return err
+}
+
+func (c Client) IncrementVideoViews(id uuid.UUID) error {
+	_, err := c.exec("UPDATE videos SET view_count = view_count + 1 WHERE id = ?", id)
+	return err
+}
+
+// AddVideoProcessingTime accumulates time spent running ffmpeg/ffprobe on a
+// video, used for cost reporting.
+func (c Client) AddVideoProcessingTime(id uuid.UUID, seconds float64) error {
+	_, err := c.exec("UPDATE videos SET processing_seconds = processing_seconds + ? WHERE id = ?", seconds, id)
 	return err
 }
 
 func (c Client) DeleteVideo(id uuid.UUID) error {
+	// while the row still exists to find the owner's listing
+	c.invalidateVideo(id, uuid.Nil)
+
+	_, err := c.exec("DELETE FROM video_versions WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM chapters WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM playback_restrictions WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM playback_sessions WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM trending_videos WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM video_egress WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM playback_spans WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM replay_heatmaps WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM live_streams WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM reports WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM takedowns WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM processing_jobs WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM integrity_failures WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM notifications WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM watch_progress WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM saved_videos WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM share_links WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec("DELETE FROM video_translations WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
+	_, err = c.exec(query, id)
+	return err
+}
+
+// CountVideosWithTitle counts the user's videos with the given title,
+// ignoring case and the video with excludeID.
+func (c Client) CountVideosWithTitle(userID uuid.UUID, title string, excludeID uuid.UUID) (int, error) {
+	query := `
+	SELECT COUNT(*) FROM videos
+	WHERE user_id = ? AND title = ? COLLATE NOCASE AND id != ?
+	`
+	var count int
+	err := c.reader().QueryRow(query, userID, title, excludeID).Scan(&count)
+	return count, err
+}
+
+// stored times are compared as strings, so they must share a time zone
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// GetExpiredVideos returns videos whose expiry passed but whose media
+// hasn't been deleted yet, those due first. Videos under a retention lock are
+// left until it ends.
+func (c Client) GetExpiredVideos(now time.Time, limit int) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE expires_at IS NOT NULL AND expires_at <= ? AND expired_at IS NULL
+		AND (retained_until IS NULL OR retained_until <= ?)
+	ORDER BY expires_at ASC
+	LIMIT ?
+	`
+
+	rows, err := c.db.Query(query, now.UTC(), now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+// MarkVideoExpired drops the references to a video's media, which the
+// caller already deleted, and keeps the record as expired.
+func (c Client) MarkVideoExpired(id uuid.UUID) error {
+	err := c.writeTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM video_versions WHERE video_id = ?", id)
+		if err != nil {
+			return err
+		}
+		query := `
+		UPDATE videos
+		SET
+			updated_at = CURRENT_TIMESTAMP,
+			expired_at = ?,
+			video_url = NULL,
+			video_size = NULL,
+			encryption_key_md5 = NULL,
+			content_sha256 = NULL,
+			object_etag = NULL,
+			thumbnail_url = NULL,
+			thumbnail_size = NULL,
+			thumbnail_focus_x = NULL,
+			thumbnail_focus_y = NULL,
+			thumbnail_alt_text = '',
+			audio_description_url = NULL
+		WHERE id = ?
+		`
+		_, err = tx.Exec(query, time.Now().UTC(), id)
+		return err
+	})
+	c.invalidateVideo(id, uuid.Nil)
+	return err
+}
+
+// SetVideoRetention sets or, with nil, lifts the video's retention lock.
+func (c Client) SetVideoRetention(id uuid.UUID, until *time.Time) error {
+	_, err := c.exec("UPDATE videos SET updated_at = CURRENT_TIMESTAMP, retained_until = ? WHERE id = ?", utcTime(until), id)
+	c.invalidateVideo(id, uuid.Nil)
+	return err
+}
+
+// SetThumbnailFocus saves where crops of the video's thumbnail center, nil
+// for the middle.
+func (c Client) SetThumbnailFocus(video Video, focus *FocusPoint) error {
+	focusX, focusY := focusArgs(focus)
+	_, err := c.exec(
+		"UPDATE videos SET thumbnail_focus_x = ?, thumbnail_focus_y = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		focusX, focusY, video.ID,
+	)
+	c.invalidateVideo(video.ID, video.UserID)
 	return err
 }
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WatchProgress is how far a user got into a video, for resuming playback.
+type WatchProgress struct {
+	UserID    uuid.UUID `json:"-"`
+	VideoID   uuid.UUID `json:"video_id"`
+	Position  float64   `json:"position"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SaveWatchProgress stores a batch of positions in one transaction. A
+// position older than the stored one is dropped, so a late flush from
+// another instance can't rewind the user.
+func (c Client) SaveWatchProgress(batch []WatchProgress) error {
+	return c.writeTx(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`
+		INSERT INTO watch_progress (user_id, video_id, position, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, video_id) DO UPDATE SET
+			position = excluded.position,
+			updated_at = excluded.updated_at
+		WHERE excluded.updated_at >= watch_progress.updated_at
+		`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, p := range batch {
+			// compared as text, so the format must match across instances
+			updatedAt := p.UpdatedAt.UTC().Format(time.DateTime)
+			if _, err := stmt.Exec(p.UserID, p.VideoID, p.Position, updatedAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetWatchProgress returns a zero WatchProgress if the user never watched
+// the video.
+func (c Client) GetWatchProgress(userID, videoID uuid.UUID) (WatchProgress, error) {
+	p := WatchProgress{UserID: userID}
+	err := c.reader().QueryRow(
+		"SELECT video_id, position, updated_at FROM watch_progress WHERE user_id = ? AND video_id = ?",
+		userID, videoID,
+	).Scan(&p.VideoID, &p.Position, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return WatchProgress{}, nil
+	}
+	return p, err
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// sqliteDSN turns on WAL so readers aren't blocked by a writer, and a busy
+// timeout so a connection waits for the write lock instead of failing with
+// "database is locked". Transactions take the write lock up front, since
+// upgrading a read lock mid-transaction can't wait on the timeout.
+func sqliteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+}
+
+// exec runs a write statement. SQLite allows a single writer at a time, so
+// writes from this process queue up here rather than contend for the lock.
+func (c Client) exec(query string, args ...any) (sql.Result, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.db.Exec(query, args...)
+}
+
+// writeTx runs fn in a transaction while holding the write lock. The
+// transaction is committed when fn returns nil and rolled back otherwise.
+func (c Client) writeTx(fn func(tx *sql.Tx) error) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
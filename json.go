@@ -6,18 +6,28 @@ import (
 	"net/http"
 )
 
-func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
+// respondWithError reports an error with the code clients branch on and a
+// message for people, translated when the client's language has a
+// translation for the code.
+func respondWithError(w http.ResponseWriter, status int, code errorCode, msg string, err error) {
 	if err != nil {
 		log.Println(err)
 	}
-	if code > 499 {
+	if status > 499 {
 		log.Printf("Responding with 5XX error: %s", msg)
 	}
 	type errorResponse struct {
-		Error string `json:"error"`
+		Error string    `json:"error"`
+		Code  errorCode `json:"code"`
 	}
-	respondWithJSON(w, code, errorResponse{
-		Error: msg,
+	localized := localizeError(w, code, msg)
+	if errorPrefsOf(w).problem {
+		respondWithProblem(w, status, code, localized, nil)
+		return
+	}
+	respondWithJSON(w, status, errorResponse{
+		Error: localized,
+		Code:  code,
 	})
 }
 
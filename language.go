@@ -0,0 +1,111 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxLanguageTagLength = 35
+
+// normalizeLanguageTag checks tag is shaped like a BCP 47 language tag,
+// e.g. "de", "pt-BR" or "zh-Hant-TW", and returns it in its conventional
+// case. Tags are compared case-insensitively, so they're stored that way.
+func normalizeLanguageTag(tag string) (string, bool) {
+	if tag == "" || len(tag) > maxLanguageTagLength {
+		return "", false
+	}
+	subtags := strings.Split(tag, "-")
+	for i, subtag := range subtags {
+		if len(subtag) == 0 || len(subtag) > 8 {
+			return "", false
+		}
+		for _, c := range subtag {
+			isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+			if !isLetter && (i == 0 || c < '0' || c > '9') {
+				return "", false
+			}
+		}
+		switch {
+		case i == 0:
+			if len(subtag) < 2 || len(subtag) > 3 {
+				return "", false
+			}
+			subtags[i] = strings.ToLower(subtag)
+		case len(subtag) == 2:
+			subtags[i] = strings.ToUpper(subtag)
+		case len(subtag) == 4:
+			subtags[i] = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		default:
+			subtags[i] = strings.ToLower(subtag)
+		}
+	}
+	return strings.Join(subtags, "-"), true
+}
+
+// parseAcceptLanguage returns the languages of an Accept-Language header,
+// most preferred first. The wildcard and unparsable tags are dropped, the
+// wildcard stands for the original language anyway.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag, ok := normalizeLanguageTag(strings.TrimSpace(tag))
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		langs = append(langs, weighted{tag, q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+// negotiateLanguage picks the available language that best matches the
+// accepted ones, "" when none does. For each accepted language, more
+// specific tags are tried by removing subtags from the end, "de-AT" falls
+// back to "de", and then any available tag of the same language.
+func negotiateLanguage(accepted, available []string) string {
+	has := map[string]bool{}
+	for _, tag := range available {
+		has[tag] = true
+	}
+	for _, tag := range accepted {
+		for candidate := tag; ; {
+			if has[candidate] {
+				return candidate
+			}
+			i := strings.LastIndex(candidate, "-")
+			if i < 0 {
+				break
+			}
+			candidate = candidate[:i]
+		}
+		primary, _, _ := strings.Cut(tag, "-")
+		for _, avail := range available {
+			if availPrimary, _, _ := strings.Cut(avail, "-"); availPrimary == primary {
+				return avail
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,643 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	eventVideoLiveStarted = "video.live_started"
+	eventVideoLiveEnded   = "video.live_ended"
+
+	// seconds, segments are cut on keyframes so this is only a target
+	liveSegmentDuration = 4
+	liveSegmentCount    = 6
+	// how long ffmpeg gets to write out the last segment
+	liveStopTimeout = 10 * time.Second
+)
+
+var liveFilePattern = regexp.MustCompile(`^(index\.m3u8|init\.mp4|(segment|part)[0-9]+\.(ts|m4s))$`)
+
+// liveIngest records the broadcasts to the stream keys of live streams
+// while ffmpeg packages them as HLS for viewers. A finished recording is
+// stored as the next version of its video like an upload.
+type liveIngest struct {
+	addr string
+	// what broadcasters are told to connect to
+	ingestURL string
+
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*liveSession
+}
+
+// liveSession is a broadcast in progress.
+type liveSession struct {
+	cfg     *apiConfig
+	video   database.Video
+	hlsDir  string
+	release func()
+
+	recording *os.File
+	recorded  int64
+
+	// nil once ffmpeg stopped taking input, the broadcast is still
+	// recorded then
+	hls     io.WriteCloser
+	hlsCmd  *exec.Cmd
+	hlsDone chan error
+	// nil unless the stream is low latency
+	ll *llhlsPackager
+}
+
+// liveIngestFromEnv returns the ingest LIVE_RTMP_ADDR configures, nil when
+// live streaming is off.
+func liveIngestFromEnv() (*liveIngest, error) {
+	addr := os.Getenv("LIVE_RTMP_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LIVE_RTMP_ADDR %q, it must be host:port", addr)
+	}
+	ingestURL := os.Getenv("LIVE_INGEST_URL")
+	if ingestURL == "" {
+		ingestURL = "rtmp://localhost:" + port + "/live"
+	}
+	return &liveIngest{addr: addr, ingestURL: ingestURL, sessions: map[uuid.UUID]*liveSession{}}, nil
+}
+
+// startLiveIngest accepts broadcasts when live streaming is set up.
+func (cfg *apiConfig) startLiveIngest() {
+	if cfg.live == nil {
+		return
+	}
+	addr := cfg.live.addr
+	// broadcasts of a previous run are gone with their recordings
+	if err := cfg.db.ResetInterruptedLiveStreams(); err != nil {
+		log.Printf("Couldn't reset interrupted live streams: %v", err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Couldn't listen for RTMP on %s: %v", addr, err)
+	}
+	server := &rtmpServer{publish: cfg.startLiveSession}
+	go func() {
+		log.Printf("Accepting RTMP broadcasts on %s", addr)
+		if err := server.serve(ln); err != nil {
+			log.Printf("RTMP listener stopped: %v", err)
+		}
+	}()
+}
+
+func (cfg *apiConfig) startLiveSession(streamKey string) (io.WriteCloser, error) {
+	// the recording, the MP4 it's remuxed into and the pipeline's copy.
+	// Reserved first so a broadcast that can't be recorded creates no
+	// video.
+	release, err := cfg.tempStore.reserve(3 * maxVideoSize)
+	if err != nil {
+		return nil, errors.New("not enough temporary storage to record the broadcast")
+	}
+	stream, err := cfg.liveStreamForKey(streamKey)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	video, err := cfg.db.GetVideo(stream.VideoID)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("couldn't get video: %w", err)
+	}
+	if video.ID == uuid.Nil || video.ExpiredAt != nil || cfg.isTakenDown(video.ID) {
+		release()
+		return nil, errors.New("this video can't be broadcast to")
+	}
+
+	started, err := cfg.db.StartLiveStream(video.ID)
+	if err != nil || !started {
+		release()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't start live stream: %w", err)
+		}
+		return nil, errors.New("this stream is already live or still processing")
+	}
+
+	session, err := cfg.newLiveSession(video, stream, release)
+	if err != nil {
+		cfg.failLiveStream(video.ID, err)
+		release()
+		return nil, err
+	}
+	cfg.live.mu.Lock()
+	cfg.live.sessions[video.ID] = session
+	cfg.live.mu.Unlock()
+
+	log.Printf("Live broadcast of video %s started", video.ID)
+	cfg.publishEvent(eventVideoLiveStarted, video)
+	return session, nil
+}
+
+// liveStreamForKey finds the live stream a broadcast to streamKey goes to.
+// That's a video's own, or for a user's stream key that of a new video of
+// theirs.
+func (cfg *apiConfig) liveStreamForKey(streamKey string) (database.LiveStream, error) {
+	stream, err := cfg.db.GetLiveStreamByKey(streamKey)
+	if err != nil {
+		return database.LiveStream{}, fmt.Errorf("couldn't get live stream: %w", err)
+	}
+	if stream.VideoID != uuid.Nil {
+		return stream, nil
+	}
+
+	key, err := cfg.db.GetStreamKeyByKey(streamKey)
+	if err != nil {
+		return database.LiveStream{}, fmt.Errorf("couldn't get stream key: %w", err)
+	}
+	if key.ID == uuid.Nil {
+		return database.LiveStream{}, errors.New("unknown stream key")
+	}
+
+	title := key.Label
+	if title == "" {
+		title = "Live broadcast"
+	}
+	video, err := cfg.db.CreateVideo(database.CreateVideoParams{
+		Title:      title + " " + cfg.clock.Now().UTC().Format("2006-01-02 15:04 UTC"),
+		UserID:     key.UserID,
+		Visibility: key.Visibility,
+	})
+	if err != nil {
+		return database.LiveStream{}, fmt.Errorf("couldn't create video: %w", err)
+	}
+	cfg.publishEvent(eventVideoCreated, video)
+
+	// the video gets a key of its own, the owner can broadcast to it again
+	// to replace the recording
+	videoKey, err := newStreamKey()
+	if err != nil {
+		return database.LiveStream{}, err
+	}
+	stream, err = cfg.db.CreateLiveStream(video.ID, videoKey)
+	if err != nil {
+		return database.LiveStream{}, fmt.Errorf("couldn't create live stream: %w", err)
+	}
+	err = cfg.db.SetLiveStreamLatency(video.ID, key.LowLatency, key.PartTarget)
+	if err != nil {
+		return database.LiveStream{}, fmt.Errorf("couldn't set live stream latency: %w", err)
+	}
+	stream.LowLatency = key.LowLatency
+	stream.PartTarget = key.PartTarget
+
+	if err := cfg.db.MarkStreamKeyUsed(key.ID); err != nil {
+		log.Printf("Couldn't mark stream key %s used: %v", key.ID, err)
+	}
+	log.Printf("Broadcast to stream key %s created video %s", key.ID, video.ID)
+	return stream, nil
+}
+
+func (cfg *apiConfig) newLiveSession(video database.Video, stream database.LiveStream, release func()) (*liveSession, error) {
+	hlsDir, err := os.MkdirTemp(cfg.tempStore.dir, "tubely-live-")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create live dir: %w", err)
+	}
+	recording, err := cfg.tempStore.createTemp("tubely-live-*.flv")
+	if err != nil {
+		os.RemoveAll(hlsDir)
+		return nil, fmt.Errorf("couldn't create recording: %w", err)
+	}
+
+	// the broadcast is copied as is, encoders send H.264 and AAC which
+	// HLS plays everywhere
+	args := []string{"-v", "error", "-f", "flv", "-i", "pipe:0", "-c", "copy"}
+	if stream.LowLatency {
+		args = append(args, llhlsArgs(hlsDir, stream.PartTarget)...)
+	} else {
+		args = append(args,
+			"-f", "hls",
+			"-hls_time", strconv.Itoa(liveSegmentDuration),
+			"-hls_list_size", strconv.Itoa(liveSegmentCount),
+			"-hls_flags", "delete_segments+independent_segments",
+			"-hls_segment_filename", filepath.Join(hlsDir, "segment%d.ts"),
+			filepath.Join(hlsDir, "index.m3u8"),
+		)
+	}
+	cmd := exec.Command("ffmpeg", args...)
+	stdin, err := cmd.StdinPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		recording.Close()
+		os.Remove(recording.Name())
+		os.RemoveAll(hlsDir)
+		return nil, fmt.Errorf("couldn't start ffmpeg: %w", err)
+	}
+	hlsDone := make(chan error, 1)
+	go func() { hlsDone <- cmd.Wait() }()
+
+	session := &liveSession{
+		cfg:       cfg,
+		video:     video,
+		hlsDir:    hlsDir,
+		release:   release,
+		recording: recording,
+		hls:       stdin,
+		hlsCmd:    cmd,
+		hlsDone:   hlsDone,
+	}
+	if stream.LowLatency {
+		session.ll = newLLHLSPackager(hlsDir, stream.PartTarget)
+	}
+	return session, nil
+}
+
+// Write records FLV from the broadcaster and passes it on to ffmpeg.
+func (s *liveSession) Write(p []byte) (int, error) {
+	if s.recorded+int64(len(p)) > maxVideoSize {
+		return 0, fmt.Errorf("broadcast is over the %s limit", formatBytes(maxVideoSize))
+	}
+	n, err := s.recording.Write(p)
+	s.recorded += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("couldn't record broadcast: %w", err)
+	}
+	if s.hls != nil {
+		if _, err := s.hls.Write(p); err != nil {
+			log.Printf("Live playback of video %s stopped: %v", s.video.ID, err)
+			s.hls.Close()
+			s.hls = nil
+		}
+	}
+	return n, nil
+}
+
+// Close ends the broadcast and stores its recording in the background.
+func (s *liveSession) Close() error {
+	cfg := s.cfg
+	if s.hls != nil {
+		s.hls.Close()
+	}
+	select {
+	case err := <-s.hlsDone:
+		if err != nil {
+			log.Printf("ffmpeg packaging video %s for live playback failed: %v", s.video.ID, err)
+		}
+	case <-time.After(liveStopTimeout):
+		log.Printf("ffmpeg packaging video %s for live playback didn't stop, killing it", s.video.ID)
+		s.hlsCmd.Process.Kill()
+	}
+
+	if s.ll != nil {
+		s.ll.close()
+	}
+	cfg.live.mu.Lock()
+	delete(cfg.live.sessions, s.video.ID)
+	cfg.live.mu.Unlock()
+	os.RemoveAll(s.hlsDir)
+
+	err := s.recording.Close()
+	if err == nil {
+		err = cfg.db.EndLiveStream(s.video.ID)
+	}
+	if err != nil {
+		os.Remove(s.recording.Name())
+		s.release()
+		cfg.failLiveStream(s.video.ID, err)
+		return err
+	}
+	log.Printf("Live broadcast of video %s ended after %s", s.video.ID, formatBytes(s.recorded))
+	cfg.publishEvent(eventVideoLiveEnded, s.video)
+
+	go func() {
+		defer s.release()
+		defer os.Remove(s.recording.Name())
+		err := cfg.storeLiveRecording(context.Background(), s.video.ID, s.recording.Name())
+		if err != nil {
+			log.Printf("Couldn't store recording of video %s: %v", s.video.ID, err)
+			cfg.failLiveStream(s.video.ID, err)
+			return
+		}
+		if err := cfg.db.FinishLiveStream(s.video.ID, nil); err != nil {
+			log.Printf("Couldn't finish live stream of video %s: %v", s.video.ID, err)
+		}
+	}()
+	return nil
+}
+
+func (cfg *apiConfig) failLiveStream(videoID uuid.UUID, cause error) {
+	msg := cause.Error()
+	if err := cfg.db.FinishLiveStream(videoID, &msg); err != nil {
+		log.Printf("Couldn't fail live stream of video %s: %v", videoID, err)
+	}
+}
+
+// storeLiveRecording remuxes a recorded broadcast into an MP4 and stores it
+// as the next version of the video, queued like an upload when there's a
+// job queue.
+func (cfg *apiConfig) storeLiveRecording(ctx context.Context, videoID uuid.UUID, recordingPath string) error {
+	mp4Path := recordingPath + ".mp4"
+	defer os.Remove(mp4Path)
+	err := cfg.commands.Run(ctx, nil, nil, "ffmpeg", "-v", "error", "-f", "flv", "-i", recordingPath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", mp4Path)
+	if err != nil {
+		return fmt.Errorf("couldn't remux recording: %w", err)
+	}
+	file, err := os.Open(mp4Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the video may have changed while it was live
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		return fmt.Errorf("couldn't get video: %w", err)
+	}
+	if video.ID == uuid.Nil {
+		return errVideoNotFound
+	}
+	hookEvent := uploadEvent{
+		Kind:        "video",
+		VideoID:     video.ID,
+		UserID:      video.UserID,
+		Title:       video.Title,
+		Filename:    "live.mp4",
+		ContentType: "video/mp4",
+	}
+	buffered, err := cfg.bufferVideoUpload(file, info.Size())
+	if err != nil {
+		return err
+	}
+	defer buffered.cleanup()
+
+	hookEvent.Size = buffered.size
+	if err := cfg.runPreUploadHooks(ctx, hookEvent); err != nil {
+		return err
+	}
+
+	if cfg.jobQueue != nil {
+		_, err := cfg.enqueueVideoJob(ctx, video, &buffered, "video/mp4", hookEvent.Filename)
+		return err
+	}
+	video, err = cfg.storeVideoUpload(ctx, video, buffered, "video/mp4", nil, nil)
+	if err != nil {
+		return err
+	}
+	hookEvent.Size = *video.VideoSize
+	hookEvent.URL = *video.VideoURL
+	cfg.runPostUploadHooks(hookEvent)
+	return nil
+}
+
+func newStreamKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+type liveStreamResponse struct {
+	database.LiveStream
+	IngestURL   string `json:"ingest_url"`
+	PlaybackURL string `json:"playback_url"`
+}
+
+func (cfg *apiConfig) liveStreamResponse(stream database.LiveStream) liveStreamResponse {
+	return liveStreamResponse{
+		LiveStream:  stream,
+		IngestURL:   cfg.live.ingestURL,
+		PlaybackURL: fmt.Sprintf("/api/videos/%s/live/index.m3u8", stream.VideoID),
+	}
+}
+
+// handlerLiveStreamCreate gives a video a stream key to broadcast to,
+// replacing the one it had.
+func (cfg *apiConfig) handlerLiveStreamCreate(w http.ResponseWriter, r *http.Request) {
+	if cfg.live == nil {
+		respondWithError(w, http.StatusConflict, codeLiveStreamingIsntSetUpOnThisServer, "Live streaming isn't set up on this server", nil)
+		return
+	}
+	video, ok := cfg.ownedVideo(w, r, "stream to")
+	if !ok {
+		return
+	}
+	if video.ExpiredAt != nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasExpired, "Video has expired", nil)
+		return
+	}
+	stream, err := cfg.db.GetLiveStream(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetLiveStream, "Couldn't get live stream", err)
+		return
+	}
+	if stream.Status == database.LiveStreamLive {
+		respondWithError(w, http.StatusConflict, codeVideoIsLive, "Video is live", nil)
+		return
+	}
+
+	key, err := newStreamKey()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateStreamKey, "Couldn't create stream key", err)
+		return
+	}
+	stream, err = cfg.db.CreateLiveStream(video.ID, key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateLiveStream, "Couldn't create live stream", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, cfg.liveStreamResponse(stream))
+}
+
+func (cfg *apiConfig) handlerLiveStreamGet(w http.ResponseWriter, r *http.Request) {
+	if cfg.live == nil {
+		respondWithError(w, http.StatusNotFound, codeVideoHasNoLiveStream, "Video has no live stream", nil)
+		return
+	}
+	video, ok := cfg.ownedVideo(w, r, "see the live stream")
+	if !ok {
+		return
+	}
+	stream, err := cfg.db.GetLiveStream(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetLiveStream, "Couldn't get live stream", err)
+		return
+	}
+	if stream.VideoID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeVideoHasNoLiveStream, "Video has no live stream", nil)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.liveStreamResponse(stream))
+}
+
+// handlerLiveStreamSettings changes how a stream is packaged. A broadcast in
+// progress keeps its packaging, the change applies from the next one on.
+func (cfg *apiConfig) handlerLiveStreamSettings(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		LowLatency bool `json:"low_latency"`
+		// seconds, defaultPartTarget when left out
+		PartTarget float64 `json:"part_target"`
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeCouldntDecodeParameters, "Couldn't decode parameters", err)
+		return
+	}
+	if params.PartTarget == 0 {
+		params.PartTarget = defaultPartTarget
+	}
+	if params.PartTarget < minPartTarget || params.PartTarget > maxPartTarget {
+		respondWithFieldErrors(w, codeInvalidLiveStreamSettings, "Invalid live stream settings", []fieldError{{
+			Field:   "part_target",
+			Message: fmt.Sprintf("must be between %g and %g seconds", minPartTarget, maxPartTarget),
+		}})
+		return
+	}
+
+	video, ok := cfg.ownedVideo(w, r, "change the live stream")
+	if !ok {
+		return
+	}
+	stream, err := cfg.db.GetLiveStream(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetLiveStream, "Couldn't get live stream", err)
+		return
+	}
+	if stream.VideoID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeVideoHasNoLiveStream, "Video has no live stream", nil)
+		return
+	}
+	err = cfg.db.SetLiveStreamLatency(video.ID, params.LowLatency, params.PartTarget)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntSaveLiveStreamSettings, "Couldn't save live stream settings", err)
+		return
+	}
+	stream.LowLatency = params.LowLatency
+	stream.PartTarget = params.PartTarget
+	respondWithJSON(w, http.StatusOK, cfg.liveStreamResponse(stream))
+}
+
+// handlerLiveStreamDelete revokes a video's stream key. A broadcast in
+// progress has to end first.
+func (cfg *apiConfig) handlerLiveStreamDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r, "delete the live stream")
+	if !ok {
+		return
+	}
+	stream, err := cfg.db.GetLiveStream(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetLiveStream, "Couldn't get live stream", err)
+		return
+	}
+	if stream.VideoID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeVideoHasNoLiveStream, "Video has no live stream", nil)
+		return
+	}
+	if stream.Status == database.LiveStreamLive {
+		respondWithError(w, http.StatusConflict, codeVideoIsLive, "Video is live", nil)
+		return
+	}
+	if err := cfg.db.DeleteLiveStream(video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntDeleteLiveStream, "Couldn't delete live stream", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerLivePlayback serves the HLS playlist and segments of a broadcast in
+// progress to whoever may watch the video.
+func (cfg *apiConfig) handlerLivePlayback(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+	file := r.PathValue("file")
+	if !liveFilePattern.MatchString(file) {
+		respondWithError(w, http.StatusNotFound, codeNotFound, "Not found", nil)
+		return
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || video.Visibility == database.VisibilityPrivate {
+		respondWithError(w, http.StatusNotFound, codeVideoNotFound, "Video not found", nil)
+		return
+	}
+	if cfg.isTakenDown(video.ID) {
+		respondWithError(w, http.StatusUnavailableForLegalReasons, codeThisVideoHasBeenTakenDown, "This video has been taken down", nil)
+		return
+	}
+	restrictions, err := cfg.db.GetPlaybackRestrictions(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackRestrictions, "Couldn't get playback restrictions", err)
+		return
+	}
+	if !cfg.playbackAllowed(r, restrictions) {
+		respondWithError(w, http.StatusForbidden, codeThisVideoIsntAvailableInYourLocation, "This video isn't available in your location", nil)
+		return
+	}
+
+	var session *liveSession
+	if cfg.live != nil {
+		cfg.live.mu.Lock()
+		session = cfg.live.sessions[videoID]
+		cfg.live.mu.Unlock()
+	}
+	if session == nil {
+		respondWithError(w, http.StatusNotFound, codeVideoIsntLive, "Video isn't live", nil)
+		return
+	}
+	if session.ll != nil {
+		serveLowLatencyHLS(w, r, session.ll, file)
+		return
+	}
+
+	if file == "index.m3u8" {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		// players poll it for new segments
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "video/mp2t")
+		w.Header().Set("Cache-Control", "public, max-age=60")
+	}
+	f, err := os.Open(filepath.Join(session.hlsDir, file))
+	if err != nil {
+		// ffmpeg hasn't written the first segment yet, or already deleted
+		// an old one
+		respondWithError(w, http.StatusNotFound, codeNotFound, "Not found", nil)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntReadLiveStream, "Couldn't read live stream", err)
+		return
+	}
+	http.ServeContent(w, r, file, info.ModTime(), f)
+}
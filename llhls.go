@@ -0,0 +1,612 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Low-latency broadcasts are packaged as LL-HLS. ffmpeg can't write partial
+// segments, so it is told to cut fMP4 fragments of the part target without
+// waiting for keyframes, and llhlsPackager groups those parts into segments
+// that start on keyframes. A segment is its parts one after the other.
+
+const (
+	llhlsPollInterval   = 20 * time.Millisecond
+	llhlsSourcePlaylist = "parts.m3u8"
+	defaultPartTarget   = 0.5
+	minPartTarget       = 0.1
+	maxPartTarget       = 2.0
+)
+
+// llhlsPart is a fragment ffmpeg wrote, part<index>.m4s.
+type llhlsPart struct {
+	index    int
+	duration float64
+	// starts with a keyframe, so playback can start there
+	independent bool
+}
+
+type llhlsSegment struct {
+	msn   int
+	parts []llhlsPart
+}
+
+func (s llhlsSegment) duration() float64 {
+	var d float64
+	for _, p := range s.parts {
+		d += p.duration
+	}
+	return d
+}
+
+type llhlsPackager struct {
+	dir        string
+	partTarget float64
+	stop       chan struct{}
+
+	mu sync.Mutex
+	// closed and replaced whenever a part is added or the broadcast ends,
+	// waking blocked playlist and part requests
+	changed chan struct{}
+	ended   bool
+	init    *fmp4Init
+	// the last one is still growing
+	segments       []llhlsSegment
+	nextPart       int
+	targetDuration int
+	lastSource     []byte
+}
+
+func newLLHLSPackager(dir string, partTarget float64) *llhlsPackager {
+	p := &llhlsPackager{
+		dir:            dir,
+		partTarget:     partTarget,
+		stop:           make(chan struct{}),
+		changed:        make(chan struct{}),
+		targetDuration: liveSegmentDuration,
+	}
+	go p.run()
+	return p
+}
+
+// llhlsArgs are the ffmpeg arguments that cut a broadcast into parts.
+func llhlsArgs(dir string, partTarget float64) []string {
+	// enough parts for the playlist's segments even when keyframes are
+	// further apart than the segment duration
+	listSize := 4 * liveSegmentCount * int(math.Ceil(liveSegmentDuration/partTarget))
+	return []string{
+		"-f", "hls",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", "init.mp4",
+		"-hls_time", strconv.FormatFloat(partTarget, 'f', -1, 64),
+		"-hls_list_size", strconv.Itoa(listSize),
+		"-hls_flags", "split_by_time+delete_segments+temp_file",
+		"-hls_segment_filename", filepath.Join(dir, "part%d.m4s"),
+		filepath.Join(dir, llhlsSourcePlaylist),
+	}
+}
+
+func (p *llhlsPackager) run() {
+	ticker := time.NewTicker(llhlsPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := p.update(); err != nil {
+			log.Printf("Couldn't package parts in %s: %v", p.dir, err)
+		}
+	}
+}
+
+// close ends the broadcast, answering requests still waiting for parts.
+func (p *llhlsPackager) close() {
+	close(p.stop)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ended = true
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// update picks up the parts ffmpeg listed since the last call.
+func (p *llhlsPackager) update() error {
+	source, err := os.ReadFile(filepath.Join(p.dir, llhlsSourcePlaylist))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(source, p.lastSource) {
+		return nil
+	}
+
+	if p.init == nil {
+		data, err := os.ReadFile(filepath.Join(p.dir, "init.mp4"))
+		if err != nil {
+			return fmt.Errorf("couldn't read init segment: %w", err)
+		}
+		init, err := parseFMP4Init(data)
+		if err != nil {
+			return fmt.Errorf("couldn't parse init segment: %w", err)
+		}
+		p.init = &init
+	}
+
+	listed := parseHLSParts(source)
+	var added []llhlsPart
+	for _, part := range listed {
+		if part.index < p.nextPart {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(p.dir, fmt.Sprintf("part%d.m4s", part.index)))
+		if err != nil {
+			return err
+		}
+		part.independent, err = fragmentStartsWithKeyframe(data, *p.init)
+		if err != nil {
+			return fmt.Errorf("couldn't parse part %d: %w", part.index, err)
+		}
+		added = append(added, part)
+	}
+	p.lastSource = source
+	if len(added) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, part := range added {
+		p.addPart(part)
+	}
+	// ffmpeg deletes the parts that fell out of its playlist
+	oldest := listed[0].index
+	for len(p.segments) > 1 && (p.segments[0].parts[0].index < oldest || len(p.segments) > liveSegmentCount+1) {
+		p.segments = p.segments[1:]
+	}
+	close(p.changed)
+	p.changed = make(chan struct{})
+	return nil
+}
+
+// addPart starts a new segment with the part when it's independent and the
+// current segment is long enough, within half a part.
+func (p *llhlsPackager) addPart(part llhlsPart) {
+	p.nextPart = part.index + 1
+	n := len(p.segments)
+	if n == 0 || (part.independent && p.segments[n-1].duration() >= liveSegmentDuration-p.partTarget/2) {
+		msn := 0
+		if n > 0 {
+			msn = p.segments[n-1].msn + 1
+		}
+		p.segments = append(p.segments, llhlsSegment{msn: msn})
+		n++
+	}
+	p.segments[n-1].parts = append(p.segments[n-1].parts, part)
+	// EXTINF durations rounded must never exceed the target duration
+	if d := int(math.Round(p.segments[n-1].duration())); d > p.targetDuration {
+		p.targetDuration = d
+	}
+}
+
+// parseHLSParts lists the parts of ffmpeg's playlist. A line ffmpeg is still
+// writing doesn't parse and is picked up on the next read.
+func parseHLSParts(playlist []byte) []llhlsPart {
+	var parts []llhlsPart
+	duration := -1.0
+	for _, line := range strings.Split(string(playlist), "\n") {
+		if v, ok := strings.CutPrefix(line, "#EXTINF:"); ok {
+			v, _, _ = strings.Cut(v, ",")
+			d, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return parts
+			}
+			duration = d
+			continue
+		}
+		if strings.HasPrefix(line, "#") || line == "" || duration < 0 {
+			continue
+		}
+		v, hasPrefix := strings.CutPrefix(line, "part")
+		v, hasSuffix := strings.CutSuffix(v, ".m4s")
+		if !hasPrefix || !hasSuffix {
+			return parts
+		}
+		index, err := strconv.Atoi(v)
+		if err != nil {
+			return parts
+		}
+		parts = append(parts, llhlsPart{index: index, duration: duration})
+		duration = -1
+	}
+	return parts
+}
+
+// playlist renders the LL-HLS playlist, or returns nil before the first
+// part. The caller must hold p.mu.
+func (p *llhlsPackager) playlist() []byte {
+	if len(p.segments) == 0 {
+		return nil
+	}
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:9\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", p.targetDuration)
+	// players stay three parts behind the live edge
+	fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*p.partTarget)
+	fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", p.partTarget)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", p.segments[0].msn)
+	b.WriteString("#EXT-X-MAP:URI=\"init.mp4\"\n")
+
+	// parts are only listed for the segments within three target durations
+	// of the live edge
+	partsFrom := len(p.segments)
+	var fromEnd float64
+	for i := len(p.segments) - 1; i >= 0 && fromEnd <= 3*float64(p.targetDuration); i-- {
+		partsFrom = i
+		fromEnd += p.segments[i].duration()
+	}
+	for i, seg := range p.segments {
+		if i >= partsFrom {
+			for _, part := range seg.parts {
+				fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"part%d.m4s\"", part.duration, part.index)
+				if part.independent {
+					b.WriteString(",INDEPENDENT=YES")
+				}
+				b.WriteString("\n")
+			}
+		}
+		if i < len(p.segments)-1 {
+			fmt.Fprintf(&b, "#EXTINF:%.3f,\nsegment%d.m4s\n", seg.duration(), seg.msn)
+		}
+	}
+	fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part%d.m4s\"\n", p.nextPart)
+	return b.Bytes()
+}
+
+// waitFor blocks until ready, which is called with p.mu held, returns true
+// or the request gives up. It returns whether ready did.
+func (p *llhlsPackager) waitFor(ctx context.Context, ready func() bool) bool {
+	for {
+		p.mu.Lock()
+		if ready() {
+			p.mu.Unlock()
+			return true
+		}
+		changed, ended := p.changed, p.ended
+		p.mu.Unlock()
+		if ended {
+			return false
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// serveLowLatencyHLS serves a file of an LL-HLS broadcast. Playlist requests
+// with _HLS_msn, and requests for the hinted next part, block until it's
+// there.
+func serveLowLatencyHLS(w http.ResponseWriter, r *http.Request, p *llhlsPackager, file string) {
+	p.mu.Lock()
+	targetDuration := p.targetDuration
+	p.mu.Unlock()
+	// the longest the spec lets a request block
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Duration(targetDuration)*time.Second)
+	defer cancel()
+
+	switch {
+	case file == "index.m3u8":
+		msn, part := -1, -1
+		if v := r.URL.Query().Get("_HLS_msn"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				respondWithError(w, http.StatusBadRequest, codeInvalidHLSMSN, "Invalid _HLS_msn", err)
+				return
+			}
+			msn = n
+		}
+		if v := r.URL.Query().Get("_HLS_part"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || msn < 0 {
+				respondWithError(w, http.StatusBadRequest, codeInvalidHLSPart, "Invalid _HLS_part", err)
+				return
+			}
+			part = n
+		}
+
+		var playlist []byte
+		tooFar := false
+		ok := p.waitFor(ctx, func() bool {
+			if len(p.segments) == 0 {
+				return false
+			}
+			last := p.segments[len(p.segments)-1]
+			if msn > last.msn+2 {
+				tooFar = true
+				return true
+			}
+			if msn < last.msn || (msn == last.msn && part >= 0 && part < len(last.parts)) {
+				playlist = p.playlist()
+				return true
+			}
+			return false
+		})
+		switch {
+		case tooFar:
+			respondWithError(w, http.StatusBadRequest, codeHLSMSNIsTooFarAheadOfTheLiveEdge, "_HLS_msn is too far ahead of the live edge", nil)
+		case !ok:
+			respondWithError(w, http.StatusServiceUnavailable, codeLiveStreamDidntAdvance, "Live stream didn't advance", nil)
+		default:
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(playlist)
+		}
+
+	case strings.HasPrefix(file, "segment") && strings.HasSuffix(file, ".m4s"):
+		msn, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(file, "segment"), ".m4s"))
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, codeNotFound, "Not found", nil)
+			return
+		}
+		var parts []llhlsPart
+		p.mu.Lock()
+		// the last segment is still growing
+		for _, seg := range p.segments[:max(len(p.segments)-1, 0)] {
+			if seg.msn == msn {
+				parts = seg.parts
+			}
+		}
+		p.mu.Unlock()
+		if parts == nil {
+			respondWithError(w, http.StatusNotFound, codeNotFound, "Not found", nil)
+			return
+		}
+		var segment bytes.Buffer
+		for _, part := range parts {
+			data, err := os.ReadFile(filepath.Join(p.dir, fmt.Sprintf("part%d.m4s", part.index)))
+			if err != nil {
+				respondWithError(w, http.StatusNotFound, codeNotFound, "Not found", nil)
+				return
+			}
+			segment.Write(data)
+		}
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		http.ServeContent(w, r, file, time.Time{}, bytes.NewReader(segment.Bytes()))
+
+	default:
+		if index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(file, "part"), ".m4s")); err == nil {
+			// a player fetching the preload hint gets it as soon as ffmpeg
+			// wrote it
+			p.mu.Lock()
+			hinted := index == p.nextPart
+			p.mu.Unlock()
+			if hinted && !p.waitFor(ctx, func() bool { return p.nextPart > index }) {
+				respondWithError(w, http.StatusServiceUnavailable, codeLiveStreamDidntAdvance, "Live stream didn't advance", nil)
+				return
+			}
+		}
+		f, err := os.Open(filepath.Join(p.dir, file))
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, codeNotFound, "Not found", nil)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, codeCouldntReadLiveStream, "Couldn't read live stream", err)
+			return
+		}
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		http.ServeContent(w, r, file, info.ModTime(), f)
+	}
+}
+
+// fmp4Init is what an fMP4 init segment says about the video track that
+// its fragments may leave out.
+type fmp4Init struct {
+	// 0 without video, every fragment is independent then
+	videoTrack   uint32
+	defaultFlags uint32
+}
+
+const (
+	// sample flags
+	mp4SampleIsNonSync = 0x10000
+
+	// tfhd flags
+	tfhdBaseDataOffset  = 0x1
+	tfhdSampleDescIndex = 0x2
+	tfhdDefaultDuration = 0x8
+	tfhdDefaultSize     = 0x10
+	tfhdDefaultFlags    = 0x20
+	// trun flags
+	trunDataOffset       = 0x1
+	trunFirstSampleFlags = 0x4
+	trunSampleDuration   = 0x100
+	trunSampleSize       = 0x200
+	trunSampleFlags      = 0x400
+)
+
+func parseFMP4Init(data []byte) (fmp4Init, error) {
+	r := bytes.NewReader(data)
+	top, err := readMP4Boxes(r, 0, int64(len(data)))
+	if err != nil {
+		return fmp4Init{}, err
+	}
+	moov, ok := findMP4Box(top, "moov")
+	if !ok {
+		return fmp4Init{}, errors.New("no moov box")
+	}
+	children, err := mp4Children(r, moov)
+	if err != nil {
+		return fmp4Init{}, err
+	}
+
+	var init fmp4Init
+	for _, trak := range children {
+		if trak.kind != "trak" {
+			continue
+		}
+		trakChildren, err := mp4Children(r, trak)
+		if err != nil {
+			return fmp4Init{}, err
+		}
+		tkhd, ok := findMP4Box(trakChildren, "tkhd")
+		mdia, ok2 := findMP4Box(trakChildren, "mdia")
+		if !ok || !ok2 {
+			continue
+		}
+		mdiaChildren, err := mp4Children(r, mdia)
+		if err != nil {
+			return fmp4Init{}, err
+		}
+		hdlr, ok := findMP4Box(mdiaChildren, "hdlr")
+		if !ok {
+			continue
+		}
+		if handler := mp4Payload(data, hdlr); len(handler) < 12 || string(handler[8:12]) != "vide" {
+			continue
+		}
+		header := mp4Payload(data, tkhd)
+		// the version decides whether the times before the ID are 32 or
+		// 64 bits
+		offset := 12
+		if len(header) > 0 && header[0] == 1 {
+			offset = 20
+		}
+		id, ok := mp4Uint32(header, offset)
+		if !ok {
+			return fmp4Init{}, errors.New("short tkhd box")
+		}
+		init.videoTrack = id
+	}
+
+	if mvex, ok := findMP4Box(children, "mvex"); ok && init.videoTrack != 0 {
+		mvexChildren, err := mp4Children(r, mvex)
+		if err != nil {
+			return fmp4Init{}, err
+		}
+		for _, trex := range mvexChildren {
+			payload := mp4Payload(data, trex)
+			if id, _ := mp4Uint32(payload, 4); trex.kind == "trex" && id == init.videoTrack {
+				init.defaultFlags, _ = mp4Uint32(payload, 20)
+			}
+		}
+	}
+	return init, nil
+}
+
+// fragmentStartsWithKeyframe tells whether the first video sample of an
+// fMP4 fragment is a sync sample.
+func fragmentStartsWithKeyframe(data []byte, init fmp4Init) (bool, error) {
+	if init.videoTrack == 0 {
+		return true, nil
+	}
+	r := bytes.NewReader(data)
+	top, err := readMP4Boxes(r, 0, int64(len(data)))
+	if err != nil {
+		return false, err
+	}
+	moof, ok := findMP4Box(top, "moof")
+	if !ok {
+		return false, errors.New("no moof box")
+	}
+	trafs, err := mp4Children(r, moof)
+	if err != nil {
+		return false, err
+	}
+	for _, traf := range trafs {
+		if traf.kind != "traf" {
+			continue
+		}
+		children, err := mp4Children(r, traf)
+		if err != nil {
+			return false, err
+		}
+		tfhd, ok := findMP4Box(children, "tfhd")
+		trun, ok2 := findMP4Box(children, "trun")
+		if !ok || !ok2 {
+			continue
+		}
+
+		header := mp4Payload(data, tfhd)
+		tfhdFlags, _ := mp4Uint32(header, 0)
+		if id, _ := mp4Uint32(header, 4); id != init.videoTrack {
+			continue
+		}
+		flags := init.defaultFlags
+		offset := 8
+		for _, field := range []struct {
+			flag uint32
+			size int
+		}{{tfhdBaseDataOffset, 8}, {tfhdSampleDescIndex, 4}, {tfhdDefaultDuration, 4}, {tfhdDefaultSize, 4}} {
+			if tfhdFlags&field.flag != 0 {
+				offset += field.size
+			}
+		}
+		if tfhdFlags&tfhdDefaultFlags != 0 {
+			if flags, ok = mp4Uint32(header, offset); !ok {
+				return false, errors.New("short tfhd box")
+			}
+		}
+
+		run := mp4Payload(data, trun)
+		trunFlags, _ := mp4Uint32(run, 0)
+		offset = 8
+		if trunFlags&trunDataOffset != 0 {
+			offset += 4
+		}
+		switch {
+		case trunFlags&trunFirstSampleFlags != 0:
+			flags, ok = mp4Uint32(run, offset)
+		case trunFlags&trunSampleFlags != 0:
+			if trunFlags&trunSampleDuration != 0 {
+				offset += 4
+			}
+			if trunFlags&trunSampleSize != 0 {
+				offset += 4
+			}
+			flags, ok = mp4Uint32(run, offset)
+		}
+		if !ok {
+			return false, errors.New("short trun box")
+		}
+		return flags&mp4SampleIsNonSync == 0, nil
+	}
+	// no video in this fragment to start from
+	return false, nil
+}
+
+func mp4Children(r *bytes.Reader, box mp4Box) ([]mp4Box, error) {
+	return readMP4Boxes(r, box.offset+box.headerSize, box.offset+box.size)
+}
+
+func mp4Payload(data []byte, box mp4Box) []byte {
+	return data[box.offset+box.headerSize : box.offset+box.size]
+}
+
+func mp4Uint32(b []byte, offset int) (uint32, bool) {
+	if offset < 0 || len(b) < offset+4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(b[offset:]), true
+}
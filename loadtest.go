@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// length of every synthetic clip, the bitrate is derived from the target size
+const syntheticVideoSeconds = 10
+
+type loadTestResult struct {
+	size     int64
+	duration time.Duration
+	err      error
+}
+
+func runLoadTest(args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	target := fs.String("target", "http://localhost:8091", "base URL of the server to test")
+	email := fs.String("email", "", "email of the account used for uploads")
+	password := fs.String("password", "", "password of the account used for uploads")
+	sizesFlag := fs.String("sizes", "1MB,10MB", "comma separated list of synthetic video sizes")
+	concurrency := fs.Int("concurrency", 4, "number of concurrent uploads")
+	requests := fs.Int("requests", 20, "total number of uploads to perform")
+	fs.Parse(args)
+
+	if *email == "" || *password == "" {
+		return fmt.Errorf("-email and -password are required")
+	}
+	if *concurrency < 1 || *requests < 1 {
+		return fmt.Errorf("-concurrency and -requests must be positive")
+	}
+
+	sizes, err := parseSizes(*sizesFlag)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tubely-loadtest")
+	if err != nil {
+		return fmt.Errorf("couldn't create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := make([]string, len(sizes))
+	for i, size := range sizes {
+		path := filepath.Join(tmpDir, fmt.Sprintf("synthetic-%d.mp4", size))
+		fmt.Printf("generating %s synthetic video\n", formatBytes(size))
+		if err := generateSyntheticVideo(path, size); err != nil {
+			return err
+		}
+		files[i] = path
+	}
+
+	token, err := loadTestLogin(*target, *email, *password)
+	if err != nil {
+		return err
+	}
+
+	jobs := make(chan string)
+	results := make(chan loadTestResult, *requests)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				results <- loadTestUpload(*target, token, path)
+			}
+		}()
+	}
+
+	start := time.Now()
+	for i := 0; i < *requests; i++ {
+		jobs <- files[i%len(files)]
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+	elapsed := time.Since(start)
+
+	var durations []time.Duration
+	var totalBytes int64
+	failures := 0
+	for res := range results {
+		if res.err != nil {
+			failures++
+			fmt.Println("upload failed:", res.err)
+			continue
+		}
+		durations = append(durations, res.duration)
+		totalBytes += res.size
+	}
+
+	fmt.Printf("\nuploads:     %d ok, %d failed\n", len(durations), failures)
+	fmt.Printf("elapsed:     %s\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("throughput:  %s/s\n", formatBytes(int64(float64(totalBytes)/elapsed.Seconds())))
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		fmt.Printf("latency p50: %s\n", percentile(durations, 50).Round(time.Millisecond))
+		fmt.Printf("latency p90: %s\n", percentile(durations, 90).Round(time.Millisecond))
+		fmt.Printf("latency p99: %s\n", percentile(durations, 99).Round(time.Millisecond))
+		fmt.Printf("latency max: %s\n", durations[len(durations)-1].Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+// generateSyntheticVideo encodes random noise so the encoder can't compress
+// below the requested bitrate, which keeps the output close to size bytes.
+func generateSyntheticVideo(path string, size int64) error {
+	bitrate := size * 8 / syntheticVideoSeconds
+	cmd := exec.Command("ffmpeg",
+		"-y", "-v", "error",
+		"-f", "lavfi", "-i", "testsrc2=size=1280x720:rate=30",
+		"-t", strconv.Itoa(syntheticVideoSeconds),
+		"-vf", "noise=alls=100:allf=t+u",
+		"-c:v", "mpeg4",
+		"-b:v", strconv.FormatInt(bitrate, 10),
+		"-minrate", strconv.FormatInt(bitrate, 10),
+		"-maxrate", strconv.FormatInt(bitrate, 10),
+		"-bufsize", strconv.FormatInt(bitrate, 10),
+		"-f", "mp4", path,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to generate synthetic video: %w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+func loadTestLogin(target, email, password string) (string, error) {
+	body, err := json.Marshal(map[string]string{"email": email, "password": password})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.Post(target+"/api/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("couldn't log in: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't log in: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("couldn't decode login response: %w", err)
+	}
+	return result.Token, nil
+}
+
+func loadTestUpload(target, token, path string) loadTestResult {
+	start := time.Now()
+
+	videoID, err := loadTestCreateVideo(target, token, filepath.Base(path))
+	if err != nil {
+		return loadTestResult{err: err}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return loadTestResult{err: err}
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return loadTestResult{err: err}
+	}
+
+	// stream the multipart body so large files aren't held in memory
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="video"; filename="%s"`, filepath.Base(path)))
+		header.Set("Content-Type", "video/mp4")
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, file); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/video_upload/%s", target, videoID), pr)
+	if err != nil {
+		return loadTestResult{err: err}
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return loadTestResult{err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return loadTestResult{err: fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))}
+	}
+
+	return loadTestResult{size: info.Size(), duration: time.Since(start)}
+}
+
+func loadTestCreateVideo(target, token, title string) (string, error) {
+	body, err := json.Marshal(map[string]string{"title": title, "description": "synthetic load test upload"})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target+"/api/videos", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create video: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("couldn't create video: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("couldn't decode video response: %w", err)
+	}
+	return result.ID, nil
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	idx := (len(sorted)*p + 99) / 100
+	if idx > 0 {
+		idx--
+	}
+	return sorted[idx]
+}
+
+func parseSizes(s string) ([]int64, error) {
+	var sizes []int64
+	for _, field := range strings.Split(s, ",") {
+		size, err := parseByteSize(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+func parseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	upper := strings.ToUpper(s)
+	for _, unit := range units {
+		if strings.HasSuffix(upper, unit.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(upper, unit.suffix), 64)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid size %q", s)
+			}
+			return int64(n * float64(unit.mult)), nil
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n, nil
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.2f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.2f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
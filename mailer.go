@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"time"
+)
+
+// mailer sends plain text email to users.
+type mailer interface {
+	send(to, subject, body string) error
+}
+
+// smtpMailer sends through an SMTP relay, upgrading to TLS when the relay
+// offers STARTTLS.
+type smtpMailer struct {
+	addr string
+	from mail.Address
+	auth smtp.Auth
+}
+
+// mailerFromEnv returns the mailer SMTP_ADDR configures, nil when email
+// is off.
+func mailerFromEnv() (mailer, error) {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_ADDR %q, it must be host:port", addr)
+	}
+	from, err := mail.ParseAddress(os.Getenv("SMTP_FROM"))
+	if err != nil {
+		return nil, errors.New("SMTP_FROM must be set to the address email is sent from")
+	}
+	m := &smtpMailer{addr: addr, from: *from}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		// net/smtp refuses to send the password without TLS, except to
+		// localhost
+		m.auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return m, nil
+}
+
+func (m *smtpMailer) send(to, subject, body string) error {
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", rcpt.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.Write(bytes.ReplaceAll([]byte(body), []byte("\n"), []byte("\r\n")))
+
+	return smtp.SendMail(m.addr, m.auth, m.from.Address, []string{rcpt.Address}, msg.Bytes())
+}
@@ -2,9 +2,15 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 
@@ -15,31 +21,117 @@ import (
 )
 
 type apiConfig struct {
-	db               database.Client
-	jwtSecret        string
-	platform         string
-	filepathRoot     string
-	assetsRoot       string
-	s3Bucket         string
-	s3Region         string
+	db           database.Client
+	jwtSecret    string
+	platform     string
+	filepathRoot string
+	assetsRoot   string
+	assetBaseURL string
+	s3Bucket     string
+	s3Region     string
+	s3Endpoint   s3EndpointSettings
+	// role S3 is accessed as, "" for the default credentials
+	s3RoleARN        string
 	s3CfDistribution string
 	port             string
+	// nil when email isn't configured
+	mailer mailer
+	// nil when live streaming isn't configured
+	live             *liveIngest
 	s3Client         *s3.Client
+	tempStore        *tempStore
+	uploadThrottle   *uploadThrottle
+	uploads          *uploadTracker
+	adminAPIKey      string
+	maintenance      *maintenanceState
+	readOnly         *readOnlyState
+	userStorageQuota int64
+	planMaxDurations map[string]time.Duration
+	costRates        costRates
+	uploadHooks      []uploadHook
+	eventPublisher   eventPublisher
+
+	remoteTranscoder       transcoder
+	remoteTranscodeMinSize int64
+	jobQueue               jobQueue
+	instanceID             string
+	assetVariants          *variantStore
+	imageFormats           *imageFormats
+	hotlink                *hotlinkPolicy
+	geoIP                  geoIPLookup
+	objectLock             *objectLockSupport
+	archive                archiveTarget
+	replica                *bucketReplica
+	watchProgress          *watchProgressBuffer
+	commands               commandRunner
+	clock                  clock
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "loadtest" {
+		if err := runLoadTest(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	checkOnly := false
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		fs := flag.NewFlagSet("serve", flag.ExitOnError)
+		check := fs.Bool("check", false, "validate configuration and dependencies, print a readiness report and exit")
+		fs.Parse(os.Args[2:])
+		checkOnly = *check
+	}
+
 	godotenv.Load(".env")
 
+	if v := os.Getenv("UMASK"); v != "" {
+		mask, err := strconv.ParseUint(v, 8, 32)
+		if err != nil || mask > 0777 {
+			log.Fatalf("Invalid UMASK: %q", v)
+		}
+		setUmask(int(mask))
+	}
+
 	pathToDB := os.Getenv("DB_PATH")
 	if pathToDB == "" {
 		log.Fatal("DB_URL must be set")
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "restore-db" {
+		if err := runDBRestore(os.Args[2:], pathToDB); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	db, err := database.NewClient(pathToDB)
 	if err != nil {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
 
+	if v := os.Getenv("DB_READ_REPLICAS"); v != "" {
+		maxLag := defaultReplicaMaxLag
+		if v := os.Getenv("DB_REPLICA_MAX_LAG"); v != "" {
+			maxLag, err = time.ParseDuration(v)
+			if err != nil || maxLag <= 0 {
+				log.Fatalf("Invalid DB_REPLICA_MAX_LAG: %q", v)
+			}
+		}
+		err = db.AddReadReplicas(strings.Split(v, ","), maxLag)
+		if err != nil {
+			log.Fatalf("Couldn't set up read replicas: %v", err)
+		}
+	}
+
+	cache, cacheTTL, err := cacheFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cache != nil {
+		db.SetCache(cache, cacheTTL)
+	}
+
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		log.Fatal("JWT_SECRET environment variable is not set")
@@ -60,6 +152,11 @@ func main() {
 		log.Fatal("ASSETS_ROOT environment variable is not set")
 	}
 
+	assetBaseURL, err := parseAssetBaseURL(os.Getenv("ASSET_BASE_URL"))
+	if err != nil {
+		log.Fatalf("Invalid ASSET_BASE_URL: %v", err)
+	}
+
 	s3Bucket := os.Getenv("S3_BUCKET")
 	if s3Bucket == "" {
 		log.Fatal("S3_BUCKET environment variable is not set")
@@ -80,54 +177,499 @@ func main() {
 		log.Fatal("PORT environment variable is not set")
 	}
 
+	tempRoot := os.Getenv("TEMP_ROOT")
+	if tempRoot == "" {
+		tempRoot = filepath.Join(os.TempDir(), "tubely")
+	}
+
+	var tempMaxSize int64
+	if v := os.Getenv("TEMP_MAX_SIZE"); v != "" {
+		tempMaxSize, err = parseByteSize(v)
+		if err != nil {
+			log.Fatalf("Invalid TEMP_MAX_SIZE: %v", err)
+		}
+	}
+
+	tempStore, err := newTempStore(tempRoot, tempMaxSize)
+	if err != nil {
+		log.Fatalf("Couldn't set up temp storage: %v", err)
+	}
+
+	assetVariantDir := os.Getenv("ASSET_VARIANT_DIR")
+	if assetVariantDir == "" {
+		assetVariantDir = filepath.Join(os.TempDir(), "tubely-variants")
+	}
+
+	assetVariantWorkers := runtime.NumCPU()
+	if v := os.Getenv("ASSET_VARIANT_WORKERS"); v != "" {
+		assetVariantWorkers, err = strconv.Atoi(v)
+		if err != nil || assetVariantWorkers < 1 {
+			log.Fatalf("Invalid ASSET_VARIANT_WORKERS: %q", v)
+		}
+	}
+
+	assetVariants, err := newVariantStore(assetVariantDir, assetVariantWorkers)
+	if err != nil {
+		log.Fatalf("Couldn't set up asset variants: %v", err)
+	}
+
+	imageFormatList, ok := os.LookupEnv("ASSET_IMAGE_FORMATS")
+	if !ok {
+		imageFormatList = defaultImageFormats
+	}
+	imageFormats, err := parseImageFormats(imageFormatList)
+	if err != nil {
+		log.Fatalf("Invalid ASSET_IMAGE_FORMATS: %v", err)
+	}
+
+	var hotlink *hotlinkPolicy
+	if v := os.Getenv("HOTLINK_PROTECTION"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid HOTLINK_PROTECTION: %q", v)
+		}
+		if enabled {
+			hotlink, err = parseHotlinkPolicy(
+				os.Getenv("HOTLINK_ALLOWED_HOSTS"),
+				os.Getenv("HOTLINK_ALLOW_EMPTY_REFERER"),
+				os.Getenv("ASSET_TOKEN_SECRET"),
+				os.Getenv("ASSET_TOKEN_TTL"),
+			)
+			if err != nil {
+				log.Fatalf("Invalid hotlink protection settings: %v", err)
+			}
+		}
+	}
+
+	var geoIP geoIPLookup
+	if v := os.Getenv("GEOIP_CSV"); v != "" {
+		geoIP, err = loadCSVGeoIP(v)
+		if err != nil {
+			log.Fatalf("Couldn't load GEOIP_CSV: %v", err)
+		}
+	}
+
+	var uploadRateLimit int64
+	if v := os.Getenv("UPLOAD_RATE_LIMIT"); v != "" {
+		uploadRateLimit, err = parseByteSize(v)
+		if err != nil {
+			log.Fatalf("Invalid UPLOAD_RATE_LIMIT: %v", err)
+		}
+	}
+
+	var uploadUserRateLimit int64
+	if v := os.Getenv("UPLOAD_USER_RATE_LIMIT"); v != "" {
+		uploadUserRateLimit, err = parseByteSize(v)
+		if err != nil {
+			log.Fatalf("Invalid UPLOAD_USER_RATE_LIMIT: %v", err)
+		}
+	}
+
+	compressMinSize := defaultCompressMinSize
+	if v := os.Getenv("COMPRESS_MIN_SIZE"); v != "" {
+		size, err := parseByteSize(v)
+		if err != nil {
+			log.Fatalf("Invalid COMPRESS_MIN_SIZE: %v", err)
+		}
+		compressMinSize = int(size)
+	}
+
+	var userStorageQuota int64
+	if v := os.Getenv("USER_STORAGE_QUOTA"); v != "" {
+		userStorageQuota, err = parseByteSize(v)
+		if err != nil {
+			log.Fatalf("Invalid USER_STORAGE_QUOTA: %v", err)
+		}
+	}
+
+	planMaxDurations, err := parsePlanDurations(os.Getenv("PLAN_MAX_DURATIONS"))
+	if err != nil {
+		log.Fatalf("Invalid PLAN_MAX_DURATIONS: %v", err)
+	}
+
+	storageRefreshInterval := defaultStorageRefreshInterval
+	if v := os.Getenv("STORAGE_REFRESH_INTERVAL"); v != "" {
+		storageRefreshInterval, err = time.ParseDuration(v)
+		if err != nil || storageRefreshInterval <= 0 {
+			log.Fatalf("Invalid STORAGE_REFRESH_INTERVAL: %q", v)
+		}
+	}
+
+	costRates, err := costRatesFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	uploadHooks := compiledUploadHooks
+	videoExpiryInterval := defaultVideoExpiryInterval
+	if v := os.Getenv("VIDEO_EXPIRY_INTERVAL"); v != "" {
+		videoExpiryInterval, err = time.ParseDuration(v)
+		if err != nil || videoExpiryInterval <= 0 {
+			log.Fatalf("Invalid VIDEO_EXPIRY_INTERVAL: %q", v)
+		}
+	}
+	thumbnailGCInterval := defaultThumbnailGCInterval
+	if v := os.Getenv("THUMBNAIL_GC_INTERVAL"); v != "" {
+		thumbnailGCInterval, err = time.ParseDuration(v)
+		if err != nil || thumbnailGCInterval <= 0 {
+			log.Fatalf("Invalid THUMBNAIL_GC_INTERVAL: %q", v)
+		}
+	}
+	integrityCheckInterval := defaultIntegrityCheckInterval
+	if v := os.Getenv("INTEGRITY_CHECK_INTERVAL"); v != "" {
+		integrityCheckInterval, err = time.ParseDuration(v)
+		if err != nil || integrityCheckInterval <= 0 {
+			log.Fatalf("Invalid INTEGRITY_CHECK_INTERVAL: %q", v)
+		}
+	}
+
+	dbBackupBucket := os.Getenv("DB_BACKUP_BUCKET")
+	dbBackupInterval := defaultDBBackupInterval
+	if v := os.Getenv("DB_BACKUP_INTERVAL"); v != "" {
+		dbBackupInterval, err = time.ParseDuration(v)
+		if err != nil || dbBackupInterval <= 0 {
+			log.Fatalf("Invalid DB_BACKUP_INTERVAL: %q", v)
+		}
+	}
+	dbBackupRetention := defaultDBBackupRetention
+	if v := os.Getenv("DB_BACKUP_RETENTION"); v != "" {
+		dbBackupRetention, err = time.ParseDuration(v)
+		if err != nil || dbBackupRetention <= 0 {
+			log.Fatalf("Invalid DB_BACKUP_RETENTION: %q", v)
+		}
+	}
+	if dbBackupBucket != "" && dbBackupBucket == s3Bucket {
+		log.Fatal("DB_BACKUP_BUCKET must not be the media bucket, backups hold password hashes and tokens")
+	}
+
+	var archive archiveTarget
+	archiveInterval := defaultArchiveInterval
+	if v := os.Getenv("ARCHIVE_TARGET"); v != "" {
+		archive, err = newArchiveTarget(v, os.Getenv("ARCHIVE_SFTP_KEY_FILE"), os.Getenv("ARCHIVE_SFTP_KNOWN_HOSTS"))
+		if err != nil {
+			log.Fatalf("Invalid ARCHIVE_TARGET: %v", err)
+		}
+		if v := os.Getenv("ARCHIVE_INTERVAL"); v != "" {
+			archiveInterval, err = time.ParseDuration(v)
+			if err != nil || archiveInterval <= 0 {
+				log.Fatalf("Invalid ARCHIVE_INTERVAL: %q", v)
+			}
+		}
+	}
+
+	if hookCommand := os.Getenv("UPLOAD_HOOK_COMMAND"); hookCommand != "" {
+		hookTimeout := defaultUploadHookTimeout
+		if v := os.Getenv("UPLOAD_HOOK_TIMEOUT"); v != "" {
+			hookTimeout, err = time.ParseDuration(v)
+			if err != nil || hookTimeout <= 0 {
+				log.Fatalf("Invalid UPLOAD_HOOK_TIMEOUT: %q", v)
+			}
+		}
+		uploadHooks = append(uploadHooks, commandHook{path: hookCommand, timeout: hookTimeout})
+	}
+
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	awsConfig, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(s3Region))
 	if err != nil {
 		log.Fatalf("unable to load SDK config, %v", err)
 	}
 
+	eventPublisher, err := newEventPublisher(awsConfig)
+	if err != nil {
+		log.Fatalf("Couldn't set up event bus: %v", err)
+	}
+
+	s3Endpoint, err := s3EndpointSettingsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	s3Credentials, err := s3CredentialSettingsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	s3Config := s3Credentials.config(awsConfig)
+	s3Client := s3.NewFromConfig(s3Config, s3Endpoint.apply)
+
+	var replica *bucketReplica
+	if v := os.Getenv("REPLICA_BUCKET"); v != "" {
+		replicaRegion := os.Getenv("REPLICA_REGION")
+		if replicaRegion == "" {
+			log.Fatal("REPLICA_REGION must be set along with REPLICA_BUCKET")
+		}
+		failover := false
+		if v := os.Getenv("STORAGE_FAILOVER"); v != "" {
+			failover, err = strconv.ParseBool(v)
+			if err != nil {
+				log.Fatalf("Invalid STORAGE_FAILOVER: %q", v)
+			}
+		}
+		replica = &bucketReplica{
+			client: s3.NewFromConfig(s3Config, s3Endpoint.apply, func(o *s3.Options) {
+				o.Region = replicaRegion
+			}),
+			bucket:   v,
+			region:   replicaRegion,
+			endpoint: s3Endpoint,
+			failover: failover,
+		}
+		if failover {
+			log.Printf("Failed over, serving media from %s in %s", v, replicaRegion)
+		}
+	}
+	replicaInterval := defaultReplicaInterval
+	if v := os.Getenv("REPLICA_INTERVAL"); v != "" {
+		replicaInterval, err = time.ParseDuration(v)
+		if err != nil || replicaInterval <= 0 {
+			log.Fatalf("Invalid REPLICA_INTERVAL: %q", v)
+		}
+	}
+
+	trendingInterval := defaultTrendingInterval
+	if v := os.Getenv("TRENDING_INTERVAL"); v != "" {
+		trendingInterval, err = time.ParseDuration(v)
+		if err != nil || trendingInterval <= 0 {
+			log.Fatalf("Invalid TRENDING_INTERVAL: %q", v)
+		}
+	}
+
+	accessLogs := accessLogSource{
+		bucket: s3Bucket,
+		prefix: os.Getenv("ACCESS_LOG_PREFIX"),
+		format: accessLogS3,
+	}
+	if v := os.Getenv("ACCESS_LOG_BUCKET"); v != "" {
+		accessLogs.bucket = v
+	}
+	if v := os.Getenv("ACCESS_LOG_FORMAT"); v != "" {
+		accessLogs.format = accessLogFormat(v)
+		if accessLogs.format != accessLogS3 && accessLogs.format != accessLogCloudFront {
+			log.Fatalf("Invalid ACCESS_LOG_FORMAT: %q", v)
+		}
+	}
+	accessLogInterval := defaultAccessLogInterval
+	if v := os.Getenv("ACCESS_LOG_INTERVAL"); v != "" {
+		accessLogInterval, err = time.ParseDuration(v)
+		if err != nil || accessLogInterval <= 0 {
+			log.Fatalf("Invalid ACCESS_LOG_INTERVAL: %q", v)
+		}
+	}
+
+	replayHeatmapInterval := defaultReplayHeatmapInterval
+	if v := os.Getenv("REPLAY_HEATMAP_INTERVAL"); v != "" {
+		replayHeatmapInterval, err = time.ParseDuration(v)
+		if err != nil || replayHeatmapInterval <= 0 {
+			log.Fatalf("Invalid REPLAY_HEATMAP_INTERVAL: %q", v)
+		}
+	}
+
+	thumbnailExperimentInterval := defaultThumbnailExperimentInterval
+	if v := os.Getenv("THUMBNAIL_EXPERIMENT_INTERVAL"); v != "" {
+		thumbnailExperimentInterval, err = time.ParseDuration(v)
+		if err != nil || thumbnailExperimentInterval <= 0 {
+			log.Fatalf("Invalid THUMBNAIL_EXPERIMENT_INTERVAL: %q", v)
+		}
+	}
+
+	mailer, err := mailerFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	live, err := liveIngestFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	watchProgressFlushInterval := defaultWatchProgressFlushInterval
+	if v := os.Getenv("WATCH_PROGRESS_FLUSH_INTERVAL"); v != "" {
+		watchProgressFlushInterval, err = time.ParseDuration(v)
+		if err != nil || watchProgressFlushInterval <= 0 {
+			log.Fatalf("Invalid WATCH_PROGRESS_FLUSH_INTERVAL: %q", v)
+		}
+	}
+
+	remoteTranscoder, err := newRemoteTranscoder(awsConfig, s3Client, s3Bucket)
+	if err != nil {
+		log.Fatalf("Couldn't set up transcoder: %v", err)
+	}
+
+	remoteTranscodeMinSize := int64(defaultRemoteTranscodeMinSize)
+	if v := os.Getenv("TRANSCODER_MIN_SIZE"); v != "" {
+		remoteTranscodeMinSize, err = parseByteSize(v)
+		if err != nil {
+			log.Fatalf("Invalid TRANSCODER_MIN_SIZE: %v", err)
+		}
+	}
+
+	jobQueue, err := newJobQueue(awsConfig, db)
+	if err != nil {
+		log.Fatalf("Couldn't set up processing queue: %v", err)
+	}
+
+	readOnly := false
+	if v := os.Getenv("READ_ONLY"); v != "" {
+		readOnly, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid READ_ONLY: %q", v)
+		}
+	}
+
 	cfg := apiConfig{
 		db:               db,
 		jwtSecret:        jwtSecret,
 		platform:         platform,
 		filepathRoot:     filepathRoot,
 		assetsRoot:       assetsRoot,
+		assetBaseURL:     assetBaseURL,
 		s3Bucket:         s3Bucket,
 		s3Region:         s3Region,
+		s3Endpoint:       s3Endpoint,
+		s3RoleARN:        s3Credentials.roleARN,
 		s3CfDistribution: s3CfDistribution,
 		port:             port,
-		s3Client:         s3.NewFromConfig(awsConfig),
+		s3Client:         s3Client,
+		mailer:           mailer,
+		live:             live,
+		tempStore:        tempStore,
+		uploadThrottle:   newUploadThrottle(uploadRateLimit, uploadUserRateLimit),
+		uploads:          newUploadTracker(),
+		adminAPIKey:      os.Getenv("ADMIN_API_KEY"),
+		maintenance:      &maintenanceState{retryAfter: defaultMaintenanceRetryAfter},
+		readOnly:         &readOnlyState{enabled: readOnly, retryAfter: defaultMaintenanceRetryAfter},
+		userStorageQuota: userStorageQuota,
+		planMaxDurations: planMaxDurations,
+		costRates:        costRates,
+		uploadHooks:      uploadHooks,
+		eventPublisher:   eventPublisher,
+
+		remoteTranscoder:       remoteTranscoder,
+		remoteTranscodeMinSize: remoteTranscodeMinSize,
+		jobQueue:               jobQueue,
+		instanceID:             newInstanceID(),
+		assetVariants:          assetVariants,
+		hotlink:                hotlink,
+		geoIP:                  geoIP,
+		objectLock:             &objectLockSupport{},
+		archive:                archive,
+		replica:                replica,
+		imageFormats:           imageFormats,
+		watchProgress:          newWatchProgressBuffer(),
+		commands:               execRunner{},
+		clock:                  systemClock{},
+	}
+
+	if checkOnly {
+		if !cfg.runSelfCheck(tempRoot) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if s3Credentials.startupCheck {
+		ctx, cancel := context.WithTimeout(context.Background(), selfCheckTimeout)
+		_, err := cfg.checkBucket(ctx)
+		cancel()
+		if err != nil {
+			log.Fatalf("S3 startup check failed, set S3_STARTUP_CHECK=false to skip it: %v", err)
+		}
 	}
 
 	err = cfg.ensureAssetsDir()
 	if err != nil {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
+	err = checkNotWorldWritable(assetsRoot)
+	if err != nil {
+		log.Fatalf("Unsafe assets directory: %v", err)
+	}
+
+	if v := os.Getenv("RUN_AS_UID"); v != "" {
+		uid, err := strconv.Atoi(v)
+		if err != nil || uid < 0 {
+			log.Fatalf("Invalid RUN_AS_UID: %q", v)
+		}
+		gid := uid
+		if v := os.Getenv("RUN_AS_GID"); v != "" {
+			gid, err = strconv.Atoi(v)
+			if err != nil || gid < 0 {
+				log.Fatalf("Invalid RUN_AS_GID: %q", v)
+			}
+		}
+		err = dropPrivileges(uid, gid, assetsRoot, tempRoot, assetVariantDir, pathToDB, pathToDB+"-wal", pathToDB+"-shm")
+		if err != nil {
+			log.Fatalf("Couldn't drop privileges: %v", err)
+		}
+		log.Printf("Running as uid %d, gid %d", uid, gid)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		if err := cfg.runWorker(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate-bucket" {
+		if err := cfg.runBucketMigration(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if os.Getenv("DB_READ_REPLICAS") != "" {
+		cfg.startReplicationHeartbeat()
+	}
+	cfg.startStorageRefresher(storageRefreshInterval)
+	cfg.startVideoExpiry(videoExpiryInterval)
+	cfg.startThumbnailGC(thumbnailGCInterval)
+	cfg.startIntegrityCheck(integrityCheckInterval)
+	cfg.startReencodeCampaigns()
+	cfg.startArchiveMirror(archiveInterval)
+	cfg.startDBBackups(dbBackupBucket, dbBackupInterval, dbBackupRetention)
+	cfg.startBucketReplication(replicaInterval)
+	cfg.startTrendingRanking(trendingInterval)
+	cfg.startAccessLogImport(accessLogs, accessLogInterval)
+	cfg.startReplayHeatmaps(replayHeatmapInterval)
+	cfg.startThumbnailExperiments(thumbnailExperimentInterval)
+	cfg.startEmailDigests()
+	cfg.startLiveIngest()
+	cfg.startEventDispatcher()
+	cfg.startWatchProgressFlusher(watchProgressFlushInterval)
 
 	mux := http.NewServeMux()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
-	mux.Handle("/app/", appHandler)
+	mux.Handle("/app/", acceptClientHintsMiddleware(appHandler))
 
 	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
-	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
+	mux.Handle("/assets/", noCacheMiddleware(cfg.hotlinkMiddleware(cfg.assetVariantMiddleware(assetsHandler))))
 
-	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
-	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
-	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	cfg.registerRoutes(mux, cfg.routes())
 
-	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
-
-	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
-	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
-	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
-	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
-	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
-	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
-
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	if addr := os.Getenv("DEBUG_ADDR"); addr != "" {
+		cfg.serveDiagnostics(addr)
+	}
 
+	timeouts, err := httpTimeoutsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
 	srv := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: recoveryMiddleware(proxyMiddleware(trustedProxies, compressMiddleware(compressMinSize, cfg.readOnlyMiddleware(timeoutMiddleware(timeouts, mux))))),
+	}
+	timeouts.apply(srv)
+
+	tlsSettings := tlsSettingsFromEnv()
+	if err := tlsSettings.validate(); err != nil {
+		log.Fatal(err)
+	}
+	if tlsSettings.enabled() {
+		log.Printf("Serving on: https://localhost:%s/app/\n", port)
+		log.Fatal(serveTLS(srv, tlsSettings))
 	}
 
 	log.Printf("Serving on: http://localhost:%s/app/\n", port)
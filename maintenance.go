@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultMaintenanceRetryAfter = 5 * time.Minute
+
+type maintenanceState struct {
+	mu         sync.RWMutex
+	enabled    bool
+	retryAfter time.Duration
+	message    string
+}
+
+func (m *maintenanceState) set(enabled bool, retryAfter time.Duration, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = enabled
+	m.retryAfter = retryAfter
+	m.message = message
+}
+
+func (m *maintenanceState) get() (bool, time.Duration, string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled, m.retryAfter, m.message
+}
+
+// maintenanceMiddleware rejects requests with 503 while maintenance mode is on.
+// It's only applied to upload endpoints so reads keep working.
+func (cfg *apiConfig) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enabled, retryAfter, message := cfg.maintenance.get()
+		if enabled {
+			if message == "" {
+				message = "Uploads are temporarily disabled for maintenance"
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			respondWithError(w, http.StatusServiceUnavailable, codeMaintenance, message, nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
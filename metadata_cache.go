@@ -0,0 +1,169 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultCacheTTL     = time.Minute
+	defaultCacheEntries = 10000
+	redisCacheTimeout   = 100 * time.Millisecond
+)
+
+type memoryCacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// memoryCache is an LRU cache local to this instance.
+type memoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+func newMemoryCache(maxEntries int) *memoryCache {
+	return &memoryCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *memoryCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*memoryCacheEntry)
+		entry.value = value
+		entry.expiresAt = time.Now().Add(ttl)
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryCacheEntry{
+		key:       key,
+		value:     value,
+		expiresAt: time.Now().Add(ttl),
+	})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
+
+func (c *memoryCache) Delete(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := c.entries[key]; ok {
+			c.order.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// redisCache is shared by all instances, so an invalidation on one is seen
+// by the others. Errors are treated as misses, the database is still there.
+type redisCache struct {
+	client *redis.Client
+}
+
+func (c redisCache) Get(key string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCacheTimeout)
+	defer cancel()
+
+	value, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Couldn't read %s from redis: %v", key, err)
+		}
+		return nil, false
+	}
+	return value, true
+}
+
+func (c redisCache) Set(key string, value []byte, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCacheTimeout)
+	defer cancel()
+
+	if err := c.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		log.Printf("Couldn't write %s to redis: %v", key, err)
+	}
+}
+
+func (c redisCache) Delete(keys ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCacheTimeout)
+	defer cancel()
+
+	if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("Couldn't delete %v from redis: %v", keys, err)
+	}
+}
+
+// cacheFromEnv returns the configured metadata cache and how long entries
+// live, or a nil cache when caching is off.
+func cacheFromEnv() (cache database.Cache, ttl time.Duration, err error) {
+	ttl = defaultCacheTTL
+	if v := os.Getenv("CACHE_TTL"); v != "" {
+		ttl, err = time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return nil, 0, fmt.Errorf("invalid CACHE_TTL %q", v)
+		}
+	}
+
+	switch backend := os.Getenv("CACHE"); backend {
+	case "":
+		return nil, 0, nil
+	case "memory":
+		entries := defaultCacheEntries
+		if v := os.Getenv("CACHE_MAX_ENTRIES"); v != "" {
+			entries, err = strconv.Atoi(v)
+			if err != nil || entries <= 0 {
+				return nil, 0, fmt.Errorf("invalid CACHE_MAX_ENTRIES %q", v)
+			}
+		}
+		return newMemoryCache(entries), ttl, nil
+	case "redis":
+		opts, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		return redisCache{client: redis.NewClient(opts)}, ttl, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown CACHE %q", backend)
+	}
+}
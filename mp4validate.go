@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// longer than any recording we expect, anything beyond is a broken header
+const maxSaneVideoDuration = 24 * 60 * 60
+
+// invalidVideoError is an upload players couldn't handle. Its reason is
+// shown to the uploader, so it says what is wrong with the file.
+type invalidVideoError struct {
+	reason string
+}
+
+func (e *invalidVideoError) Error() string {
+	return "invalid video: " + e.reason
+}
+
+func invalidVideo(format string, args ...any) error {
+	return &invalidVideoError{reason: fmt.Sprintf(format, args...)}
+}
+
+// respondWithVideoError reports why an uploaded video was rejected, or a
+// server error for failures that aren't about the file.
+func respondWithVideoError(w http.ResponseWriter, err error) {
+	var invalid *invalidVideoError
+	if errors.As(err, &invalid) {
+		respondWithFieldErrors(w, codeInvalidVideoFile, "Invalid video file", []fieldError{{Field: "video", Message: invalid.reason}})
+		return
+	}
+	var truncated *truncatedUploadError
+	if errors.As(err, &truncated) {
+		respondWithError(w, http.StatusBadRequest, codeUploadTruncated, "Upload was cut off: "+truncated.Error(), err)
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, codeFileSizeTooBig, "File size too big", err)
+		return
+	}
+	var mismatch *checksumMismatchError
+	if errors.As(err, &mismatch) {
+		respondWithFieldErrors(w, codeUploadWasCorruptedOrIncomplete, "Upload was corrupted or incomplete", []fieldError{{Field: "video", Message: mismatch.Error()}})
+		return
+	}
+	var malformed *multipartError
+	if errors.As(err, &malformed) {
+		respondWithError(w, http.StatusBadRequest, codeMalformedUpload, "Malformed upload", err)
+		return
+	}
+	respondWithStorageError(w, http.StatusInternalServerError, codeErrorProcessingVideo, "Error processing video", err)
+}
+
+type mp4Box struct {
+	kind   string
+	offset int64
+	// of the whole box, header included
+	size       int64
+	headerSize int64
+}
+
+// readMP4Boxes lists the boxes between start and end, checking each fits.
+func readMP4Boxes(r io.ReaderAt, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for offset := start; offset < end; {
+		if end-offset < 8 {
+			return nil, invalidVideo("trailing %d bytes after the last box", end-offset)
+		}
+		var header [16]byte
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("couldn't read box header: %w", err)
+		}
+		box := mp4Box{
+			kind:       string(header[4:8]),
+			offset:     offset,
+			size:       int64(binary.BigEndian.Uint32(header[:4])),
+			headerSize: 8,
+		}
+		switch box.size {
+		case 0:
+			// the box runs to the end of the file
+			box.size = end - offset
+		case 1:
+			if end-offset < 16 {
+				return nil, invalidVideo("box %q is truncated", box.kind)
+			}
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("couldn't read box header: %w", err)
+			}
+			largeSize := binary.BigEndian.Uint64(header[8:16])
+			if largeSize > math.MaxInt64 {
+				return nil, invalidVideo("box %q has an impossible size", box.kind)
+			}
+			box.size = int64(largeSize)
+			box.headerSize = 16
+		}
+		if box.size < box.headerSize {
+			return nil, invalidVideo("box %q has an impossible size", box.kind)
+		}
+		if box.size > end-offset {
+			return nil, invalidVideo("box %q is truncated, the file is probably incomplete", box.kind)
+		}
+		boxes = append(boxes, box)
+		offset += box.size
+	}
+	return boxes, nil
+}
+
+func findMP4Box(boxes []mp4Box, kind string) (mp4Box, bool) {
+	for _, box := range boxes {
+		if box.kind == kind {
+			return box, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+// validateMP4Structure walks the top level boxes and the movie header. A
+// file without a complete moov box can't be played at all, and ffprobe is
+// lenient enough to accept some of those.
+func validateMP4Structure(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// checked first so other files aren't reported as broken MP4s
+	var header [8]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil || string(header[4:]) != "ftyp" {
+		return invalidVideo("not an MP4 file, it doesn't start with an ftyp box")
+	}
+
+	boxes, err := readMP4Boxes(f, 0, info.Size())
+	if err != nil {
+		return err
+	}
+	if _, ok := findMP4Box(boxes, "mdat"); !ok {
+		return invalidVideo("the file has no media data (mdat box)")
+	}
+	moov, ok := findMP4Box(boxes, "moov")
+	if !ok {
+		return invalidVideo("the file has no movie header (moov box), it was probably not finalized by the recorder")
+	}
+
+	children, err := readMP4Boxes(f, moov.offset+moov.headerSize, moov.offset+moov.size)
+	if err != nil {
+		return err
+	}
+	if _, ok := findMP4Box(children, "mvhd"); !ok {
+		return invalidVideo("the movie header has no mvhd box")
+	}
+	if _, ok := findMP4Box(children, "trak"); !ok {
+		return invalidVideo("the file has no tracks")
+	}
+	return nil
+}
+
+func validateDuration(duration float64) error {
+	if math.IsNaN(duration) || math.IsInf(duration, 0) || duration <= 0 {
+		return invalidVideo("the video has no duration")
+	}
+	if duration > maxSaneVideoDuration {
+		return invalidVideo("the video claims to be %.0f hours long, its header is probably corrupt", duration/3600)
+	}
+	return nil
+}
+
+// validateProbe rejects files ffprobe shows to be empty, before anything
+// is stored.
+func validateProbe(probe videoProbe) error {
+	if err := validateDuration(probe.duration); err != nil {
+		return err
+	}
+	if probe.bitRate == 0 {
+		return invalidVideo("the video has a bit rate of zero, it holds no media data")
+	}
+	return nil
+}
+
+// checkFirstKeyframe decodes the first video frame, catching files whose
+// container is fine but whose video stream players can't start.
+func (cfg *apiConfig) checkFirstKeyframe(filePath string) error {
+	var stderr bytes.Buffer
+	err := cfg.commands.Run(context.Background(), nil, &stderr, "ffmpeg", "-v", "error", "-xerror", "-i", filePath, "-map", "0:v:0", "-frames:v", "1", "-f", "null", "-")
+	var exitErr *commandExitError
+	if errors.As(err, &exitErr) {
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.LastIndexByte(msg, '\n'); i >= 0 {
+			msg = msg[i+1:]
+		}
+		if msg == "" {
+			msg = exitErr.Error()
+		}
+		return invalidVideo("the first video frame can't be decoded: %s", msg)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run ffmpeg: %w", err)
+	}
+	return nil
+}
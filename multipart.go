@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+const (
+	// parts read before and after the file, uploads send little else
+	maxMultipartParts = 8
+	// size of each non-file part; they are read and thrown away
+	maxMultipartFieldSize = 64 << 10
+	// total size of the other files sent before the streamed one, they
+	// are kept in memory
+	maxMultipartAttachmentSize = maxMemory
+)
+
+// multipartError is a malformed or oversized multipart body, the uploader's
+// fault rather than ours.
+type multipartError struct {
+	err error
+}
+
+func (e *multipartError) Error() string {
+	return "invalid multipart body: " + e.err.Error()
+}
+
+func (e *multipartError) Unwrap() error {
+	return e.err
+}
+
+// respondWithFormError reports a failed ParseMultipartForm: 413 when the
+// body was over its limit, 400 when it wasn't a valid form.
+func respondWithFormError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, codeFileSizeTooBig, "File size too big", err)
+		return
+	}
+	respondWithError(w, http.StatusBadRequest, codeMalformedUpload, "Malformed upload", err)
+}
+
+// multipartFile is a file part being streamed from a multipart body.
+// Reading more than its size limit fails with an *http.MaxBytesError.
+type multipartFile struct {
+	mr        *multipart.Reader
+	part      *multipart.Part
+	remaining int64
+	limit     int64
+	// fields and other files sent before the file, by name
+	fields      map[string]string
+	attachments map[string]attachedFile
+}
+
+// attachedFile is a small file sent before the streamed one, like a
+// thumbnail with its video.
+type attachedFile struct {
+	filename    string
+	contentType string
+	data        []byte
+}
+
+// filePart streams the part named field from r's multipart body without
+// buffering it, unlike ParseMultipartForm which keeps fields and, with a
+// large memory limit, files in memory. Fields before it are limited to
+// maxMultipartFieldSize and other files to maxMultipartAttachmentSize; the
+// file is limited to maxSize bytes.
+func filePart(r *http.Request, field string, maxSize int64) (*multipartFile, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, &multipartError{err}
+	}
+	file, err := nextFilePart(mr, field, maxSize)
+	if err == io.EOF {
+		return nil, &multipartError{fmt.Errorf("no %q part", field)}
+	}
+	return file, err
+}
+
+// nextFilePart skips to the next file part named field. Whatever was left
+// of the previous file is skipped. io.EOF means the body has no more parts.
+func nextFilePart(mr *multipart.Reader, field string, maxSize int64) (*multipartFile, error) {
+	fields := map[string]string{}
+	attachments := map[string]attachedFile{}
+	var attachedSize int64
+	for i := 0; i < maxMultipartParts; i++ {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, &multipartError{err}
+		}
+
+		if part.FormName() == field && part.FileName() != "" {
+			return &multipartFile{
+				mr:          mr,
+				part:        part,
+				remaining:   maxSize,
+				limit:       maxSize,
+				fields:      fields,
+				attachments: attachments,
+			}, nil
+		}
+		if part.FileName() != "" {
+			data, err := io.ReadAll(io.LimitReader(part, maxMultipartAttachmentSize-attachedSize+1))
+			if err != nil {
+				return nil, &multipartError{err}
+			}
+			attachedSize += int64(len(data))
+			if attachedSize > maxMultipartAttachmentSize {
+				return nil, &multipartError{fmt.Errorf("files sent before %q are over %d bytes", field, maxMultipartAttachmentSize)}
+			}
+			attachments[part.FormName()] = attachedFile{
+				filename:    part.FileName(),
+				contentType: part.Header.Get("Content-Type"),
+				data:        data,
+			}
+			continue
+		}
+		value, err := readField(part)
+		if err != nil {
+			return nil, err
+		}
+		fields[part.FormName()] = value
+	}
+	return nil, &multipartError{fmt.Errorf("no %q part in the first %d parts", field, maxMultipartParts)}
+}
+
+func readField(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, maxMultipartFieldSize+1))
+	if err != nil {
+		return "", &multipartError{err}
+	}
+	if len(value) > maxMultipartFieldSize {
+		return "", &multipartError{fmt.Errorf("part %q is over %d bytes", part.FormName(), maxMultipartFieldSize)}
+	}
+	return string(value), nil
+}
+
+func (f *multipartFile) FileName() string {
+	return f.part.FileName()
+}
+
+// Field returns the value of the field named name sent before the file, or
+// "" when there is none.
+func (f *multipartFile) Field(name string) string {
+	return f.fields[name]
+}
+
+// Attachment returns the file named name sent before the file, false when
+// there is none.
+func (f *multipartFile) Attachment(name string) (attachedFile, bool) {
+	a, ok := f.attachments[name]
+	return a, ok
+}
+
+func (f *multipartFile) ContentType() string {
+	return f.part.Header.Get("Content-Type")
+}
+
+func (f *multipartFile) Read(b []byte) (int, error) {
+	if f.remaining <= 0 {
+		// only an error if there is more to come
+		var probe [1]byte
+		if n, _ := f.part.Read(probe[:]); n > 0 {
+			return 0, &http.MaxBytesError{Limit: f.limit}
+		}
+		return 0, io.EOF
+	}
+	if int64(len(b)) > f.remaining {
+		b = b[:f.remaining]
+	}
+	n, err := f.part.Read(b)
+	f.remaining -= int64(n)
+	if err != nil && err != io.EOF {
+		var tooLarge *http.MaxBytesError
+		if !errors.As(err, &tooLarge) {
+			err = &multipartError{err}
+		}
+	}
+	return n, err
+}
+
+// trailingField returns the value of the field named name sent after the
+// file, or "" when there is none. Whatever is left of the file is skipped.
+func (f *multipartFile) trailingField(name string) (string, error) {
+	for i := 0; i < maxMultipartParts; i++ {
+		part, err := f.mr.NextPart()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", &multipartError{err}
+		}
+		value, err := readField(part)
+		if err != nil {
+			return "", err
+		}
+		if part.FormName() == name {
+			return value, nil
+		}
+	}
+	return "", &multipartError{fmt.Errorf("more than %d parts after the file", maxMultipartParts)}
+}
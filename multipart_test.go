@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// multipartRequest builds an upload request from the parts write adds,
+// with the last cut bytes of the body dropped.
+func multipartRequest(t *testing.T, write func(mw *multipart.Writer), cut int) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	write(mw)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := body.Bytes()[:body.Len()-cut]
+	r := httptest.NewRequest(http.MethodPost, "/api/videos/upload", bytes.NewReader(data))
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func writeField(t *testing.T, mw *multipart.Writer, name, value string) {
+	t.Helper()
+	if err := mw.WriteField(name, value); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFile(t *testing.T, mw *multipart.Writer, name, filename string, data []byte) {
+	t.Helper()
+	fw, err := mw.CreateFormFile(name, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func isMultipartError(err error) bool {
+	var malformed *multipartError
+	return errors.As(err, &malformed)
+}
+
+func isMaxBytesError(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+func TestFilePart(t *testing.T) {
+	const maxSize = 1 << 10
+	video := bytes.Repeat([]byte("v"), 512)
+
+	tests := []struct {
+		name  string
+		parts func(t *testing.T, mw *multipart.Writer)
+		// bytes dropped from the end of the body
+		cut     int
+		wantErr func(error) bool
+		// what the file and trailing checksum read as when there is no error
+		wantData     []byte
+		wantTitle    string
+		wantChecksum string
+	}{
+		{
+			name: "fields, attachment and trailing field",
+			parts: func(t *testing.T, mw *multipart.Writer) {
+				writeField(t, mw, "title", "Boots")
+				writeFile(t, mw, "thumbnail", "thumb.png", []byte("png"))
+				writeFile(t, mw, "video", "boots.mp4", video)
+				writeField(t, mw, uploadChecksumField, "abc")
+			},
+			wantData:     video,
+			wantTitle:    "Boots",
+			wantChecksum: "abc",
+		},
+		{
+			name: "file exactly at the limit",
+			parts: func(t *testing.T, mw *multipart.Writer) {
+				writeFile(t, mw, "video", "boots.mp4", bytes.Repeat([]byte("v"), maxSize))
+			},
+			wantData: bytes.Repeat([]byte("v"), maxSize),
+		},
+		{
+			name: "field over the limit",
+			parts: func(t *testing.T, mw *multipart.Writer) {
+				writeField(t, mw, "title", strings.Repeat("a", maxMultipartFieldSize+1))
+				writeFile(t, mw, "video", "boots.mp4", video)
+			},
+			wantErr: isMultipartError,
+		},
+		{
+			name: "too many parts before the file",
+			parts: func(t *testing.T, mw *multipart.Writer) {
+				for i := 0; i < maxMultipartParts; i++ {
+					writeField(t, mw, fmt.Sprintf("padding%d", i), "x")
+				}
+				writeFile(t, mw, "video", "boots.mp4", video)
+			},
+			wantErr: isMultipartError,
+		},
+		{
+			name: "too many parts after the file",
+			parts: func(t *testing.T, mw *multipart.Writer) {
+				writeFile(t, mw, "video", "boots.mp4", video)
+				for i := 0; i <= maxMultipartParts; i++ {
+					writeField(t, mw, fmt.Sprintf("padding%d", i), "x")
+				}
+			},
+			wantErr: isMultipartError,
+		},
+		{
+			name: "no video part",
+			parts: func(t *testing.T, mw *multipart.Writer) {
+				writeField(t, mw, "title", "Boots")
+				writeFile(t, mw, "thumbnail", "thumb.png", []byte("png"))
+			},
+			wantErr: isMultipartError,
+		},
+		{
+			name: "video sent as a field",
+			parts: func(t *testing.T, mw *multipart.Writer) {
+				writeField(t, mw, "video", string(video))
+			},
+			wantErr: isMultipartError,
+		},
+		{
+			name: "body truncated in the file",
+			parts: func(t *testing.T, mw *multipart.Writer) {
+				writeFile(t, mw, "video", "boots.mp4", video)
+			},
+			// the closing boundary and the end of the file
+			cut:     100,
+			wantErr: isMultipartError,
+		},
+		{
+			name: "body truncated before the file",
+			parts: func(t *testing.T, mw *multipart.Writer) {
+				writeField(t, mw, "title", strings.Repeat("a", 600))
+				writeFile(t, mw, "video", "boots.mp4", video)
+			},
+			cut:     800,
+			wantErr: isMultipartError,
+		},
+		{
+			name: "file over the limit",
+			parts: func(t *testing.T, mw *multipart.Writer) {
+				writeFile(t, mw, "video", "boots.mp4", bytes.Repeat([]byte("v"), maxSize+1))
+			},
+			wantErr: isMaxBytesError,
+		},
+		{
+			name: "attachments over the limit",
+			parts: func(t *testing.T, mw *multipart.Writer) {
+				half := bytes.Repeat([]byte("t"), maxMultipartAttachmentSize/2+1)
+				writeFile(t, mw, "thumbnail", "a.png", half)
+				writeFile(t, mw, "captions", "b.vtt", half)
+				writeFile(t, mw, "video", "boots.mp4", video)
+			},
+			wantErr: isMultipartError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := multipartRequest(t, func(mw *multipart.Writer) { tt.parts(t, mw) }, tt.cut)
+
+			data, title, checksum, err := readUpload(r, maxSize)
+			if tt.wantErr != nil {
+				if err == nil || !tt.wantErr(err) {
+					t.Fatalf("got error %v (%T)", err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(data, tt.wantData) {
+				t.Errorf("read %d bytes of the file, want %d", len(data), len(tt.wantData))
+			}
+			if title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", title, tt.wantTitle)
+			}
+			if checksum != tt.wantChecksum {
+				t.Errorf("checksum = %q, want %q", checksum, tt.wantChecksum)
+			}
+		})
+	}
+}
+
+// readUpload reads an upload the way the handlers do: the video, the fields
+// before it and the checksum after it.
+func readUpload(r *http.Request, maxSize int64) ([]byte, string, string, error) {
+	file, err := filePart(r, "video", maxSize)
+	if err != nil {
+		return nil, "", "", err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", "", err
+	}
+	checksum, err := file.trailingField(uploadChecksumField)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return data, file.Field("title"), checksum, nil
+}
+
+func TestFilePartAttachment(t *testing.T) {
+	r := multipartRequest(t, func(mw *multipart.Writer) {
+		writeFile(t, mw, "thumbnail", "thumb.png", []byte("png"))
+		writeFile(t, mw, "video", "boots.mp4", []byte("mp4"))
+	}, 0)
+
+	file, err := filePart(r, "video", 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbnail, ok := file.Attachment("thumbnail")
+	if !ok {
+		t.Fatal("thumbnail attachment missing")
+	}
+	if thumbnail.filename != "thumb.png" || string(thumbnail.data) != "png" {
+		t.Errorf("got attachment %q with %q", thumbnail.filename, thumbnail.data)
+	}
+	if _, ok := file.Attachment("captions"); ok {
+		t.Error("got an attachment that wasn't sent")
+	}
+	if file.FileName() != "boots.mp4" {
+		t.Errorf("FileName() = %q", file.FileName())
+	}
+}
+
+func TestRespondWithFormError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"over the limit", &http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge},
+		{"over the limit while reading a part", &multipartError{fmt.Errorf("reading part: %w", &http.MaxBytesError{Limit: 10})}, http.StatusRequestEntityTooLarge},
+		{"malformed", &multipartError{errors.New("bad boundary")}, http.StatusBadRequest},
+		{"not a form", http.ErrNotMultipart, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			respondWithFormError(w, tt.err)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
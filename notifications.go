@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type followEvent struct {
+	FollowerID uuid.UUID `json:"follower_id"`
+	FolloweeID uuid.UUID `json:"followee_id"`
+}
+
+type processingFailedEvent struct {
+	JobID   uuid.UUID `json:"job_id"`
+	VideoID uuid.UUID `json:"video_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	Error   string    `json:"error"`
+}
+
+// notifyForEvent turns the events users care about into inbox
+// notifications. It sees every event publishEvent does, whether or not an
+// event bus is configured.
+func (cfg *apiConfig) notifyForEvent(eventType string, data any) {
+	var params database.CreateNotificationParams
+	switch e := data.(type) {
+	case database.Video:
+		if eventType != eventVideoUploaded {
+			return
+		}
+		params = database.CreateNotificationParams{
+			UserID:  e.UserID,
+			Type:    database.NotificationProcessingFinished,
+			VideoID: &e.ID,
+		}
+	case processingFailedEvent:
+		params = database.CreateNotificationParams{
+			UserID:  e.UserID,
+			Type:    database.NotificationProcessingFailed,
+			VideoID: &e.VideoID,
+		}
+	case followEvent:
+		params = database.CreateNotificationParams{
+			UserID:  e.FolloweeID,
+			Type:    database.NotificationNewFollower,
+			ActorID: &e.FollowerID,
+		}
+	default:
+		return
+	}
+
+	if err := cfg.db.CreateNotification(params); err != nil {
+		log.Printf("Couldn't store %s notification for %s: %v", params.Type, params.UserID, err)
+	}
+}
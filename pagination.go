@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// encodeVideoCursor makes an opaque cursor pointing just past video.
+func encodeVideoCursor(video database.Video) string {
+	raw := fmt.Sprintf("%d|%s", video.CreatedAt.Unix(), video.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeVideoCursor(s string) (database.VideoCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return database.VideoCursor{}, fmt.Errorf("malformed cursor: %w", err)
+	}
+	secs, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return database.VideoCursor{}, fmt.Errorf("malformed cursor")
+	}
+	unix, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return database.VideoCursor{}, fmt.Errorf("malformed cursor: %w", err)
+	}
+	videoID, err := uuid.Parse(id)
+	if err != nil {
+		return database.VideoCursor{}, fmt.Errorf("malformed cursor: %w", err)
+	}
+	return database.VideoCursor{CreatedAt: time.Unix(unix, 0), ID: videoID}, nil
+}
+
+// pageParams reads the limit and cursor query parameters.
+func pageParams(r *http.Request) (limit int, cursor *database.VideoCursor, err error) {
+	limit = defaultPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, nil, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		c, err := decodeVideoCursor(v)
+		if err != nil {
+			return 0, nil, err
+		}
+		cursor = &c
+	}
+	return limit, cursor, nil
+}
+
+// setNextPageLink points clients at the page following the one being served.
+func setNextPageLink(w http.ResponseWriter, r *http.Request, cursor string) {
+	next := url.URL{Path: r.URL.Path}
+	q := r.URL.Query()
+	q.Set("cursor", cursor)
+	next.RawQuery = q.Encode()
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+}
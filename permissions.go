@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	// assets are only read by this server, which serves them itself
+	assetFileMode = 0640
+	assetDirMode  = 0750
+	// temp files hold uploads that aren't public yet
+	privateDirMode = 0700
+)
+
+func createAssetFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, assetFileMode)
+}
+
+// checkNotWorldWritable refuses directories anyone could drop files into,
+// since whatever lands in the assets dir gets served.
+func checkNotWorldWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0002 != 0 {
+		return fmt.Errorf("%s is world-writable (mode %o), run chmod o-w on it", dir, info.Mode().Perm())
+	}
+	return nil
+}
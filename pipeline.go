@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+// probeVideo runs the slow checks on a buffered upload: decoding the first
+// keyframe and the owner's plan limits.
+func (cfg *apiConfig) probeVideo(buffered *bufferedVideo, userID uuid.UUID) error {
+	if err := cfg.checkFirstKeyframe(buffered.path); err != nil {
+		return err
+	}
+	return cfg.checkVideoDuration(userID, buffered.duration)
+}
+
+// uploadWhileValidating runs upload, which stores an object and returns its
+// key, at the same time as validate, so probing the temp file doesn't hold
+// up the S3 upload. A failed validation cancels the upload, or deletes the
+// object when it already finished, and its error wins over the upload's:
+// it says what is wrong with the file.
+func (cfg *apiConfig) uploadWhileValidating(ctx context.Context, validate func() error, upload func(ctx context.Context) (string, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type uploadResult struct {
+		key string
+		err error
+	}
+	uploaded := make(chan uploadResult, 1)
+	go func() {
+		key, err := upload(ctx)
+		uploaded <- uploadResult{key: key, err: err}
+	}()
+
+	validateErr := validate()
+	if validateErr != nil {
+		cancel()
+	}
+	result := <-uploaded
+	if validateErr == nil {
+		return result.err
+	}
+
+	if result.err == nil {
+		_, err := cfg.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String(cfg.s3Bucket),
+			Key:    aws.String(result.key),
+		})
+		if err != nil {
+			log.Printf("Couldn't delete object %s of rejected upload: %v", result.key, err)
+		}
+	}
+	return validateErr
+}
+
+// transcodeWhileValidating transcodes an upload while it is probed.
+func (cfg *apiConfig) transcodeWhileValidating(ctx context.Context, job transcodeJob, buffered *bufferedVideo, userID uuid.UUID) (transcodeResult, error) {
+	var transcoded transcodeResult
+	err := cfg.uploadWhileValidating(ctx,
+		func() error { return cfg.probeVideo(buffered, userID) },
+		func(ctx context.Context) (string, error) {
+			result, processingTime, err := cfg.transcodeVideo(ctx, job)
+			if err != nil {
+				return "", err
+			}
+			transcoded = result
+			if err := cfg.db.AddVideoProcessingTime(job.videoID, processingTime.Seconds()); err != nil {
+				log.Printf("Couldn't record processing time for video %s: %v", job.videoID, err)
+			}
+			return result.key, nil
+		},
+	)
+	if err != nil {
+		return transcodeResult{}, fmt.Errorf("couldn't process video: %w", err)
+	}
+	return transcoded, nil
+}
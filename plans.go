@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultPlan applies to users who weren't put on a plan by an admin.
+const defaultPlan = "default"
+
+// parsePlanDurations reads "plan=duration" pairs, e.g. "default=10m,pro=2h".
+// Plans that aren't listed have no duration limit.
+func parsePlanDurations(s string) (map[string]time.Duration, error) {
+	limits := map[string]time.Duration{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		plan, limit, ok := strings.Cut(pair, "=")
+		plan = strings.TrimSpace(plan)
+		if !ok || plan == "" {
+			return nil, fmt.Errorf("expected plan=duration, got %q", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(limit))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration for plan %q: %q", plan, limit)
+		}
+		limits[plan] = d
+	}
+	return limits, nil
+}
+
+func (cfg *apiConfig) userPlan(userID uuid.UUID) (string, error) {
+	plan, err := cfg.db.GetUserPlan(userID)
+	if err != nil {
+		return "", err
+	}
+	if plan == "" {
+		return defaultPlan, nil
+	}
+	return plan, nil
+}
+
+// checkVideoDuration rejects videos longer than the owner's plan allows.
+// It runs once the upload was probed, and nothing of a rejected upload is
+// kept, so it never counts against the storage quota.
+func (cfg *apiConfig) checkVideoDuration(userID uuid.UUID, duration float64) error {
+	if len(cfg.planMaxDurations) == 0 {
+		return nil
+	}
+	plan, err := cfg.userPlan(userID)
+	if err != nil {
+		return fmt.Errorf("couldn't get plan: %w", err)
+	}
+	limit, ok := cfg.planMaxDurations[plan]
+	if !ok {
+		return nil
+	}
+	if length := time.Duration(duration * float64(time.Second)); length > limit {
+		return invalidVideo("the video is %s long, the %s plan allows at most %s", length.Round(time.Second), plan, limit)
+	}
+	return nil
+}
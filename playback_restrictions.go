@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// parseCIDR accepts a prefix or a single address and returns it normalized,
+// so stored rules compare and print consistently.
+func parseCIDR(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+func containsIP(cidrs []string, ip netip.Addr) bool {
+	for _, cidr := range cidrs {
+		prefix, err := parseCIDR(cidr)
+		if err == nil && prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// playbackAllowed applies the video's restrictions to the client. Denied
+// ranges win over allowed ones, and a country allowlist only passes clients
+// the GeoIP lookup places in one of the countries.
+func (cfg *apiConfig) playbackAllowed(r *http.Request, restrictions database.PlaybackRestrictions) bool {
+	if restrictions.IsEmpty() {
+		return true
+	}
+
+	ip, err := netip.ParseAddr(clientIP(r))
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+
+	if containsIP(restrictions.DeniedCIDRs, ip) {
+		return false
+	}
+	if len(restrictions.AllowedCIDRs) > 0 && !containsIP(restrictions.AllowedCIDRs, ip) {
+		return false
+	}
+	if len(restrictions.AllowedCountries) == 0 {
+		return true
+	}
+
+	if cfg.geoIP == nil {
+		log.Printf("Video %s has country restrictions but no GeoIP database is configured", restrictions.VideoID)
+		return false
+	}
+	country, err := cfg.geoIP.Country(ip)
+	if err != nil {
+		log.Printf("Couldn't look up country of %s: %v", ip, err)
+		return false
+	}
+	for _, allowed := range restrictions.AllowedCountries {
+		if country == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPlaybackPage enforces takedowns, encryption and playback restrictions
+// on the HTML player pages, which hand out the video URL to anyone who can
+// load them.
+func (cfg *apiConfig) checkPlaybackPage(w http.ResponseWriter, r *http.Request, video database.Video) bool {
+	if cfg.isTakenDown(video.ID) {
+		http.Error(w, "This video has been taken down", http.StatusUnavailableForLegalReasons)
+		return false
+	}
+	// the pages can't ask for the key, the media URL they'd hand out is useless
+	if video.EncryptionKeyMD5 != nil {
+		http.Error(w, "This video is encrypted and can only be played with its key", http.StatusForbidden)
+		return false
+	}
+
+	restrictions, err := cfg.db.GetPlaybackRestrictions(video.ID)
+	if err != nil {
+		log.Printf("Couldn't get playback restrictions of video %s: %v", video.ID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return false
+	}
+	if !cfg.playbackAllowed(r, restrictions) {
+		http.Error(w, "This video isn't available in your location", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// videoPlaybackAllowed is playbackAllowed for the restrictions of video.
+// The public metadata endpoints use it to keep the video URL from clients
+// the restrictions exclude.
+func (cfg *apiConfig) videoPlaybackAllowed(r *http.Request, video database.Video) (bool, error) {
+	restrictions, err := cfg.db.GetPlaybackRestrictions(video.ID)
+	if err != nil {
+		return false, err
+	}
+	return cfg.playbackAllowed(r, restrictions), nil
+}
+
+// withoutRestrictedMedia drops the video URL of the listed videos whose
+// restrictions exclude the client. The list is copied, it may be shared with
+// other requests.
+func (cfg *apiConfig) withoutRestrictedMedia(r *http.Request, videos []database.Video) ([]database.Video, error) {
+	filtered := make([]database.Video, len(videos))
+	for i, video := range videos {
+		if video.VideoURL != nil {
+			allowed, err := cfg.videoPlaybackAllowed(r, video)
+			if err != nil {
+				return nil, err
+			}
+			if !allowed {
+				video.VideoURL = nil
+			}
+		}
+		filtered[i] = video
+	}
+	return filtered, nil
+}
+
+// normalizePlaybackRestrictions validates the lists a client sent and
+// rewrites them in canonical form.
+func (cfg *apiConfig) normalizePlaybackRestrictions(restrictions *database.PlaybackRestrictions) []fieldError {
+	var errs []fieldError
+
+	countries := make([]string, 0, len(restrictions.AllowedCountries))
+	for _, country := range restrictions.AllowedCountries {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+			errs = append(errs, fieldError{Field: "allowed_countries", Message: fmt.Sprintf("%q is not a two-letter country code", country)})
+			continue
+		}
+		countries = append(countries, country)
+	}
+	if len(countries) > 0 && cfg.geoIP == nil {
+		errs = append(errs, fieldError{Field: "allowed_countries", Message: "country restrictions need a GeoIP database, set GEOIP_CSV"})
+	}
+	restrictions.AllowedCountries = countries
+
+	for _, list := range []struct {
+		field string
+		cidrs *[]string
+	}{
+		{"allowed_cidrs", &restrictions.AllowedCIDRs},
+		{"denied_cidrs", &restrictions.DeniedCIDRs},
+	} {
+		normalized := make([]string, 0, len(*list.cidrs))
+		for _, cidr := range *list.cidrs {
+			prefix, err := parseCIDR(cidr)
+			if err != nil {
+				errs = append(errs, fieldError{Field: list.field, Message: fmt.Sprintf("%q is not an IP address or CIDR range", cidr)})
+				continue
+			}
+			normalized = append(normalized, prefix.String())
+		}
+		*list.cidrs = normalized
+	}
+	return errs
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+func preallocateFile(f *os.File, size int64) error {
+	return nil
+}
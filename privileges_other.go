@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import "errors"
+
+func setUmask(mask int) {}
+
+func dropPrivileges(uid, gid int, paths ...string) error {
+	return errors.New("switching users isn't supported on this platform")
+}
@@ -0,0 +1,49 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+func setUmask(mask int) {
+	syscall.Umask(mask)
+}
+
+// dropPrivileges hands the given paths to uid:gid and switches the process
+// to that user. It's meant for containers that start as root.
+func dropPrivileges(uid, gid int, paths ...string) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("switching to uid %d requires running as root", uid)
+	}
+
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			return os.Lchown(path, uid, gid)
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't change owner of %s: %w", root, err)
+		}
+	}
+
+	if err := syscall.Setgroups([]int{}); err != nil {
+		return fmt.Errorf("couldn't clear supplementary groups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("couldn't switch to gid %d: %w", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("couldn't switch to uid %d: %w", uid, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const problemContentType = "application/problem+json"
+
+// problemTypes documents the error classes problem details point to with
+// their type URI, /api/problems/<class>. Each status is its own class, the
+// code extension member tells errors of a class apart.
+var problemTypes = map[int]string{
+	http.StatusBadRequest:                 "The request was malformed or failed validation. The fields member, when present, says which inputs to fix.",
+	http.StatusUnauthorized:               "The request carried no credentials, or ones that didn't check out. Log in again or send the admin API key.",
+	http.StatusForbidden:                  "The caller is authenticated but not allowed to do this, usually because the resource belongs to someone else.",
+	http.StatusNotFound:                   "The resource doesn't exist, or isn't visible to the caller.",
+	http.StatusRequestTimeout:             "The request body arrived too slowly. Retry, on a faster connection if possible.",
+	http.StatusConflict:                   "The request conflicts with the resource's state, such as changing a video that has expired.",
+	http.StatusRequestEntityTooLarge:      "The body is larger than the endpoint accepts. Send a smaller file.",
+	http.StatusUnsupportedMediaType:       "The uploaded file isn't of a type the endpoint accepts.",
+	http.StatusUnprocessableEntity:        "The upload was well formed but rejected, by an upload hook or while processing it. The detail member says why.",
+	http.StatusLocked:                     "The resource is under a retention lock and can't be changed until it ends.",
+	http.StatusTooManyRequests:            "The caller sent too many requests. Retry after the delay in Retry-After.",
+	http.StatusUnavailableForLegalReasons: "The video was taken down, or is under appeal, and can't be played or changed.",
+	http.StatusInternalServerError:        "The server failed to handle the request. Retrying may help; the X-Request-ID header identifies it in the logs.",
+	http.StatusNotImplemented:             "The endpoint doesn't support what was asked of it, such as an oEmbed format other than json.",
+	http.StatusBadGateway:                 "Storage refused the server's request. The hint member says what the operator should check.",
+	http.StatusServiceUnavailable:         "The service is in maintenance, read-only or throttled. Retry after the delay in Retry-After.",
+	http.StatusGatewayTimeout:             "Storage took too long to answer. Retry, on a faster connection if possible.",
+	http.StatusInsufficientStorage:        "The server is out of temporary space for uploads. Retry later.",
+}
+
+// problemClass is the last segment of the type URI of status, e.g.
+// "not-found" for 404.
+func problemClass(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "-")
+}
+
+// problemType is the type URI of status, "about:blank" for undocumented
+// statuses as RFC 9457 suggests.
+func problemType(status int) string {
+	if _, ok := problemTypes[status]; !ok {
+		return "about:blank"
+	}
+	return "/api/problems/" + problemClass(status)
+}
+
+// acceptsProblemJSON reports whether an Accept header lists
+// application/problem+json. Wildcards don't count, clients that don't ask
+// keep the plain JSON errors they were written against.
+func acceptsProblemJSON(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != problemContentType {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// respondWithProblem writes an RFC 9457 problem. extensions are added as
+// members next to the standard ones.
+func respondWithProblem(w http.ResponseWriter, status int, code errorCode, detail string, extensions map[string]any) {
+	problem := map[string]any{}
+	for k, v := range extensions {
+		problem[k] = v
+	}
+	problem["type"] = problemType(status)
+	problem["title"] = http.StatusText(status)
+	problem["status"] = status
+	problem["detail"] = detail
+	problem["code"] = code
+
+	w.Header().Set("Content-Type", problemContentType)
+	dat, err := json.Marshal(problem)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.WriteHeader(status)
+	w.Write(dat)
+}
+
+// handlerProblemType documents the error class a problem's type URI names.
+func (cfg *apiConfig) handlerProblemType(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Type        string `json:"type"`
+		Title       string `json:"title"`
+		Status      int    `json:"status"`
+		Description string `json:"description"`
+	}
+
+	for status, description := range problemTypes {
+		if problemClass(status) == r.PathValue("class") {
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+			respondWithJSON(w, http.StatusOK, response{
+				Type:        problemType(status),
+				Title:       http.StatusText(status),
+				Status:      status,
+				Description: description,
+			})
+			return
+		}
+	}
+	respondWithError(w, http.StatusNotFound, codeProblemTypeNotFound, "Problem type not found", nil)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// packageFiles parses the package's non-test files.
+func packageFiles(t *testing.T) (*token.FileSet, []*ast.File) {
+	t.Helper()
+	names, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	return fset, files
+}
+
+// errorStatusOf returns the value of expr when it names one of the
+// http.Status constants for 4xx and 5xx, 0 otherwise.
+func errorStatusOf(expr ast.Expr) int {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return 0
+	}
+	if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "http" {
+		return 0
+	}
+	for status := 400; status < 600; status++ {
+		text := http.StatusText(status)
+		if text != "" && sel.Sel.Name == "Status"+strings.NewReplacer(" ", "", "-", "", "'", "").Replace(text) {
+			return status
+		}
+	}
+	return 0
+}
+
+// errorStatuses returns the 4xx and 5xx statuses named anywhere in the
+// package's non-test files, by file and line.
+func errorStatuses(t *testing.T) map[int]string {
+	t.Helper()
+	fset, files := packageFiles(t)
+	found := map[int]string{}
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			expr, ok := n.(ast.Expr)
+			if !ok {
+				return true
+			}
+			if status := errorStatusOf(expr); status != 0 {
+				if _, seen := found[status]; !seen {
+					found[status] = fset.Position(expr.Pos()).String()
+				}
+			}
+			return true
+		})
+	}
+	return found
+}
+
+// TestProblemTypesCoverStatuses keeps problem details from falling back to
+// about:blank for a status some handler answers with.
+func TestProblemTypesCoverStatuses(t *testing.T) {
+	for status, where := range errorStatuses(t) {
+		if _, ok := problemTypes[status]; !ok {
+			t.Errorf("%d %s, used at %s, has no entry in problemTypes", status, http.StatusText(status), where)
+		}
+	}
+}
+
+func TestHandlerProblemType(t *testing.T) {
+	cfg := &apiConfig{}
+	for status := range problemTypes {
+		class := problemClass(status)
+		r := httptest.NewRequest(http.MethodGet, "/api/problems/"+class, nil)
+		r.SetPathValue("class", class)
+		w := httptest.NewRecorder()
+
+		cfg.handlerProblemType(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("GET /api/problems/%s = %d, want 200", class, w.Code)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientInfoKey struct{}
+
+type clientInfo struct {
+	IP     string
+	Scheme string
+}
+
+type trustedProxies []netip.Prefix
+
+func parseTrustedProxies(s string) (trustedProxies, error) {
+	var proxies trustedProxies
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+func (tp trustedProxies) contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range tp {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyMiddleware resolves the real client IP and scheme. Forwarding headers
+// are only honored when the direct peer is a trusted proxy.
+func proxyMiddleware(proxies trustedProxies, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := clientInfo{
+			IP:     remoteIP(r.RemoteAddr),
+			Scheme: "http",
+		}
+		if r.TLS != nil {
+			info.Scheme = "https"
+		}
+
+		if proxies.contains(info.IP) {
+			hops, proto := forwardedHops(r.Header)
+			// walk back from the nearest hop, the first untrusted address is the client
+			for i := len(hops) - 1; i >= 0; i-- {
+				info.IP = hops[i]
+				if !proxies.contains(hops[i]) {
+					break
+				}
+			}
+			if proto == "http" || proto == "https" {
+				info.Scheme = proto
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), clientInfoKey{}, info)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// forwardedHops returns the client chain and original protocol, preferring
+// the standard Forwarded header over the X-Forwarded-* ones.
+func forwardedHops(h http.Header) ([]string, string) {
+	var hops []string
+	var proto string
+
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				switch strings.ToLower(key) {
+				case "for":
+					hops = append(hops, remoteIP(value))
+				case "proto":
+					proto = strings.ToLower(value)
+				}
+			}
+		}
+		return hops, proto
+	}
+
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, remoteIP(hop))
+			}
+		}
+	}
+	proto = strings.ToLower(strings.TrimSpace(h.Get("X-Forwarded-Proto")))
+	return hops, proto
+}
+
+// remoteIP strips the port and IPv6 brackets from an address.
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
+
+func clientIP(r *http.Request) string {
+	if info, ok := r.Context().Value(clientInfoKey{}).(clientInfo); ok {
+		return info.IP
+	}
+	return remoteIP(r.RemoteAddr)
+}
+
+func requestScheme(r *http.Request) string {
+	if info, ok := r.Context().Value(clientInfoKey{}).(clientInfo); ok {
+		return info.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type readOnlyState struct {
+	mu         sync.RWMutex
+	enabled    bool
+	retryAfter time.Duration
+	message    string
+}
+
+func (s *readOnlyState) set(enabled bool, retryAfter time.Duration, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enabled = enabled
+	s.retryAfter = retryAfter
+	s.message = message
+}
+
+func (s *readOnlyState) get() (bool, time.Duration, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enabled, s.retryAfter, s.message
+}
+
+func (s *readOnlyState) isEnabled() bool {
+	enabled, _, _ := s.get()
+	return enabled
+}
+
+// readOnlyExempt are API calls that don't change videos or users even though
+// they aren't GETs. Logging in keeps working so playback of private videos
+// does too.
+var readOnlyExempt = map[string]bool{
+	"POST /api/login":              true,
+	"POST /api/refresh":            true,
+	"POST /api/revoke":             true,
+	"POST /api/videos/signed-urls": true,
+}
+
+// readOnlyMiddleware rejects every API mutation with 503 while read-only mode
+// is on, e.g. during a database restore or a bucket migration. Reads,
+// playback and the admin endpoints, so it can be turned off again, keep
+// working.
+func (cfg *apiConfig) readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/api/") || readOnlyExempt[r.Method+" "+r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		enabled, retryAfter, message := cfg.readOnly.get()
+		if enabled {
+			if message == "" {
+				message = "Changes are temporarily disabled, the service is read-only"
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			respondWithError(w, http.StatusServiceUnavailable, codeReadOnly, message, nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
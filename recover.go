@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+)
+
+type requestStateKey struct{}
+
+// requestState is attached to every request by recoveryMiddleware.
+type requestState struct {
+	id string
+
+	mu       sync.Mutex
+	cleanups []func()
+}
+
+func requestID(r *http.Request) string {
+	if state, ok := r.Context().Value(requestStateKey{}).(*requestState); ok {
+		return state.id
+	}
+	return ""
+}
+
+// registerRequestCleanup arranges for fn to run once the request is done,
+// including when the handler panics.
+func registerRequestCleanup(r *http.Request, fn func()) {
+	state, ok := r.Context().Value(requestStateKey{}).(*requestState)
+	if !ok {
+		return
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.cleanups = append(state.cleanups, fn)
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recoveryMiddleware tags each request with an ID, returned in X-Request-ID,
+// runs the request's registered cleanups when it's done and turns handler
+// panics into a logged stack trace and a JSON 500 instead of a dropped
+// connection.
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := &requestState{id: newRequestID()}
+		w.Header().Set("X-Request-ID", state.id)
+		rw := &headerTracker{ResponseWriter: w}
+
+		defer func() {
+			rec := recover()
+
+			state.mu.Lock()
+			cleanups := state.cleanups
+			state.mu.Unlock()
+			for i := len(cleanups) - 1; i >= 0; i-- {
+				cleanups[i]()
+			}
+
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			log.Printf("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, state.id, rec, debug.Stack())
+
+			if rw.wroteHeader {
+				// the client already got a status, all we can do is cut it off
+				panic(http.ErrAbortHandler)
+			}
+			respondWithJSON(w, http.StatusInternalServerError, struct {
+				Error     string `json:"error"`
+				RequestID string `json:"request_id"`
+			}{"Internal server error", state.id})
+		}()
+
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), requestStateKey{}, state)))
+	})
+}
+
+// headerTracker records whether a response has been started.
+type headerTracker struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (t *headerTracker) WriteHeader(code int) {
+	t.wroteHeader = true
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *headerTracker) Write(p []byte) (int, error) {
+	t.wroteHeader = true
+	return t.ResponseWriter.Write(p)
+}
+
+func (t *headerTracker) Flush() {
+	t.wroteHeader = true
+	http.NewResponseController(t.ResponseWriter).Flush()
+}
+
+func (t *headerTracker) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
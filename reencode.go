@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// the lease outlives a few intervals, long encodes can run past one
+const reencodeCampaignInterval = 5 * time.Minute
+
+// ffmpeg encoder and default quality of each codec a campaign can target
+var reencodeCodecs = map[string]struct {
+	encoder string
+	crf     int
+}{
+	"h264": {encoder: "libx264", crf: 23},
+	"hevc": {encoder: "libx265", crf: 28},
+	"av1":  {encoder: "libsvtav1", crf: 35},
+}
+
+// errReencodeSkipped marks videos a campaign leaves alone.
+var errReencodeSkipped = errors.New("video skipped")
+
+func (cfg *apiConfig) startReencodeCampaigns() {
+	cfg.startScheduledTask("reencode_campaigns", reencodeCampaignInterval, func(ctx context.Context) {
+		// stop picking up videos in time for the next tick to renew the lease
+		ctx, cancel := context.WithTimeout(ctx, reencodeCampaignInterval)
+		defer cancel()
+		cfg.runReencodeCampaigns(ctx)
+	})
+}
+
+// runReencodeCampaigns works through the running campaigns one video at a
+// time. Each video is finished before the deadline is checked, so every
+// campaign's cursor always points past a fully handled video.
+func (cfg *apiConfig) runReencodeCampaigns(ctx context.Context) {
+	campaigns, err := cfg.db.GetRunningReencodeCampaigns()
+	if err != nil {
+		log.Printf("Couldn't load re-encode campaigns: %v", err)
+		return
+	}
+
+	for _, campaign := range campaigns {
+		for ctx.Err() == nil {
+			// pick up pauses made since the last video
+			current, err := cfg.db.GetReencodeCampaign(campaign.ID)
+			if err != nil {
+				log.Printf("Couldn't load re-encode campaign %s: %v", campaign.ID, err)
+				break
+			}
+			if current.Status != database.CampaignStatusRunning {
+				break
+			}
+			if !cfg.advanceReencodeCampaign(current) {
+				break
+			}
+		}
+	}
+}
+
+// advanceReencodeCampaign re-encodes the campaign's next video. It returns
+// false once there is nothing more to do for now.
+func (cfg *apiConfig) advanceReencodeCampaign(campaign database.ReencodeCampaign) bool {
+	video, err := cfg.db.GetNextCampaignVideo(campaign)
+	if err != nil {
+		log.Printf("Couldn't get next video of re-encode campaign %s: %v", campaign.ID, err)
+		return false
+	}
+	if video.ID == uuid.Nil {
+		if _, err := cfg.db.SetReencodeCampaignStatus(campaign.ID, database.CampaignStatusRunning, database.CampaignStatusDone); err != nil {
+			log.Printf("Couldn't finish re-encode campaign %s: %v", campaign.ID, err)
+		}
+		return false
+	}
+
+	// not bound to the task's deadline, an encode cut short is wasted work
+	outcome := database.CampaignVideoProcessed
+	var errMsg *string
+	err = cfg.reencodeVideo(context.Background(), campaign, video)
+	if errors.Is(err, errReencodeSkipped) {
+		outcome = database.CampaignVideoSkipped
+	} else if err != nil {
+		log.Printf("Couldn't re-encode video %s for campaign %s: %v", video.ID, campaign.ID, err)
+		outcome = database.CampaignVideoFailed
+		errMsg = aws.String(fmt.Sprintf("video %s: %v", video.ID, err))
+	}
+
+	if err := cfg.db.AdvanceReencodeCampaign(campaign.ID, video.ID, outcome, errMsg); err != nil {
+		log.Printf("Couldn't record progress of re-encode campaign %s: %v", campaign.ID, err)
+		return false
+	}
+	return true
+}
+
+// reencodeVideo transcodes a video's current media with the campaign's
+// profile and stores the result as a new version. The video is switched
+// over in one statement, so it plays the old file right up until the new
+// one is in place.
+func (cfg *apiConfig) reencodeVideo(ctx context.Context, campaign database.ReencodeCampaign, video database.Video) error {
+	// encrypted media can't be read without its owner's key
+	if video.EncryptionKeyMD5 != nil || video.VideoURL == nil {
+		return errReencodeSkipped
+	}
+	if video.ExpiresAt != nil && video.ExpiresAt.Before(cfg.clock.Now()) {
+		return errReencodeSkipped
+	}
+
+	oldURL := *video.VideoURL
+	oldKey, err := cfg.getS3KeyFromURL(oldURL)
+	if err != nil {
+		return fmt.Errorf("couldn't determine object key: %w", err)
+	}
+
+	var size int64
+	if video.VideoSize != nil {
+		size = *video.VideoSize
+	}
+	// the download and the encoded copy both live in temp storage
+	release, err := cfg.tempStore.reserve(2 * size)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	obj, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(oldKey),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't download video: %w", err)
+	}
+	buffered, err := cfg.bufferVideoUpload(obj.Body, size)
+	obj.Body.Close()
+	if err != nil {
+		return err
+	}
+	defer buffered.cleanup()
+
+	encodedPath, err := encodeWithProfile(ctx, cfg.commands, buffered.path, campaign.EncodingProfile)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(encodedPath)
+
+	version, err := cfg.nextVideoVersion(video)
+	if err != nil {
+		return fmt.Errorf("couldn't determine video version: %w", err)
+	}
+	// the encode already placed the moov atom up front, this only uploads
+	start := time.Now()
+	transcoded, err := localTranscoder{s3Client: cfg.s3Client, bucket: cfg.s3Bucket, commands: cfg.commands}.Transcode(ctx, transcodeJob{
+		videoID:     video.ID,
+		sourcePath:  encodedPath,
+		contentType: "video/mp4",
+		destKey:     videoObjectKey(getAspectFromKey(oldKey), video.ID, version),
+	})
+	if err != nil {
+		return err
+	}
+	if err := cfg.db.AddVideoProcessingTime(video.ID, time.Since(start).Seconds()); err != nil {
+		log.Printf("Couldn't record processing time for video %s: %v", video.ID, err)
+	}
+
+	videoURL := cfg.getS3ObjectURL(transcoded.key)
+	contentSHA256, objectETag := transcoded.checksums()
+	replaced, err := cfg.db.ReplaceVideoMedia(oldURL, database.CreateVideoVersionParams{
+		VideoID:       video.ID,
+		Version:       version,
+		VideoURL:      videoURL,
+		VideoSize:     &transcoded.size,
+		ContentSHA256: contentSHA256,
+		ObjectETag:    objectETag,
+	})
+	if err != nil || !replaced {
+		// when not replaced, the owner uploaded new media while this was
+		// encoding and theirs wins
+		_, delErr := cfg.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String(cfg.s3Bucket),
+			Key:    aws.String(transcoded.key),
+		})
+		if delErr != nil {
+			log.Printf("Couldn't delete unused re-encode %s: %v", transcoded.key, delErr)
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't switch video to re-encoded media: %w", err)
+		}
+		return errReencodeSkipped
+	}
+	cfg.retainNewObject(ctx, video, transcoded.key)
+
+	video.VideoURL = &videoURL
+	video.VideoSize = &transcoded.size
+	video.ContentSHA256 = contentSHA256
+	video.ObjectETag = objectETag
+	cfg.publishEvent(eventVideoUpdated, video)
+	return nil
+}
+
+// encodeWithProfile re-encodes the video at path and returns the path of
+// the result, which the caller must remove.
+func encodeWithProfile(ctx context.Context, commands commandRunner, path string, profile database.EncodingProfile) (string, error) {
+	codec := reencodeCodecs[profile.VideoCodec]
+	crf := profile.CRF
+	if crf == 0 {
+		crf = codec.crf
+	}
+
+	outputPath := path + ".reencode.mp4"
+	args := []string{"-i", path, "-c:v", codec.encoder, "-crf", strconv.Itoa(crf)}
+	if profile.MaxHeight > 0 {
+		// only ever scale down, the width follows and stays even
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", profile.MaxHeight))
+	}
+	args = append(args, "-c:a", "aac", "-movflags", "+faststart", "-f", "mp4", outputPath)
+
+	if err := commands.Run(ctx, nil, nil, "ffmpeg", args...); err != nil {
+		os.Remove(outputPath)
+		return "", fmt.Errorf("failed to run ffmpeg command on file: %w", err)
+	}
+	return outputPath, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultReplayHeatmapInterval = 10 * time.Minute
+	replayHeatmapBatch           = 1000
+)
+
+func (cfg *apiConfig) startReplayHeatmaps(interval time.Duration) {
+	cfg.startScheduledTask("replay_heatmaps", interval, cfg.aggregateReplayHeatmaps)
+}
+
+// aggregateReplayHeatmaps counts the spans recorded since the last run into
+// the heatmaps of their videos. Folding them on every heartbeat batch would
+// rewrite a video's heatmap for each viewer.
+func (cfg *apiConfig) aggregateReplayHeatmaps(ctx context.Context) {
+	for ctx.Err() == nil {
+		spans, err := cfg.db.GetPlaybackSpans(replayHeatmapBatch)
+		if err != nil {
+			log.Printf("Couldn't load playback spans: %v", err)
+			return
+		}
+		if len(spans) == 0 {
+			return
+		}
+
+		byVideo := map[uuid.UUID][]database.PlaybackSpan{}
+		for _, span := range spans {
+			byVideo[span.VideoID] = append(byVideo[span.VideoID], span)
+		}
+		for videoID, spans := range byVideo {
+			if err := cfg.addToReplayHeatmap(videoID, spans); err != nil {
+				log.Printf("Couldn't update replay heatmap of video %s: %v", videoID, err)
+				return
+			}
+		}
+		if len(spans) < replayHeatmapBatch {
+			return
+		}
+	}
+}
+
+func (cfg *apiConfig) addToReplayHeatmap(videoID uuid.UUID, spans []database.PlaybackSpan) error {
+	ids := make([]int64, 0, len(spans))
+	for _, span := range spans {
+		ids = append(ids, span.ID)
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		return err
+	}
+	if video.ID == uuid.Nil || video.DurationSeconds == nil || *video.DurationSeconds <= 0 {
+		return cfg.db.DeletePlaybackSpans(ids)
+	}
+	duration := *video.DurationSeconds
+
+	heatmap, _, err := cfg.db.GetReplayHeatmap(videoID)
+	if err != nil {
+		return err
+	}
+	// the slices of other media don't line up with this one
+	if heatmap.DurationSeconds != duration {
+		heatmap = database.ReplayHeatmap{VideoID: videoID, DurationSeconds: duration}
+	}
+	for _, span := range spans {
+		addSpanToHeatmap(&heatmap, span)
+	}
+	return cfg.db.SaveReplayHeatmap(heatmap, ids)
+}
+
+// addSpanToHeatmap counts a view of every slice the span covers at least
+// half of, so a span that just touches a slice doesn't count for it.
+func addSpanToHeatmap(heatmap *database.ReplayHeatmap, span database.PlaybackSpan) {
+	slice := heatmap.DurationSeconds / database.ReplayHeatmapBuckets
+	for i := range heatmap.Views {
+		start, end := float64(i)*slice, float64(i+1)*slice
+		if covered := min(span.End, end) - max(span.Start, start); covered >= slice/2 {
+			heatmap.Views[i]++
+		}
+	}
+}
+
+// handlerReplayHeatmapGet shows a video's owner which parts of it are
+// watched and rewatched the most. The heatmap is as of its last
+// aggregation, not live.
+func (cfg *apiConfig) handlerReplayHeatmapGet(w http.ResponseWriter, r *http.Request) {
+	type bucket struct {
+		StartSeconds float64 `json:"start_seconds"`
+		EndSeconds   float64 `json:"end_seconds"`
+		Views        int     `json:"views"`
+		// views relative to the most watched slice, 0 to 1
+		Intensity float64 `json:"intensity"`
+	}
+	type response struct {
+		UpdatedAt *time.Time `json:"updated_at"`
+		Buckets   []bucket   `json:"buckets"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+	video, err := cfg.authorizeVideoAccess(videoID, requestUserID(r))
+	if err != nil {
+		respondWithVideoAccessError(w, err, "view analytics of this video")
+		return
+	}
+	if video.DurationSeconds == nil || *video.DurationSeconds <= 0 {
+		respondWithError(w, http.StatusConflict, codeVideoHasNoMediaYet, "Video has no media yet", nil)
+		return
+	}
+
+	heatmap, ok, err := cfg.db.GetReplayHeatmap(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetReplayHeatmap, "Couldn't get replay heatmap", err)
+		return
+	}
+	resp := response{Buckets: make([]bucket, 0, database.ReplayHeatmapBuckets)}
+	if !ok || heatmap.DurationSeconds != *video.DurationSeconds {
+		// nothing counted for the current media yet
+		heatmap = database.ReplayHeatmap{DurationSeconds: *video.DurationSeconds}
+	} else {
+		resp.UpdatedAt = &heatmap.UpdatedAt
+	}
+
+	peak := 0
+	for _, views := range heatmap.Views {
+		peak = max(peak, views)
+	}
+	slice := heatmap.DurationSeconds / database.ReplayHeatmapBuckets
+	for i, views := range heatmap.Views {
+		b := bucket{
+			StartSeconds: float64(i) * slice,
+			EndSeconds:   float64(i+1) * slice,
+			Views:        views,
+		}
+		if peak > 0 {
+			b.Intensity = float64(views) / float64(peak)
+		}
+		resp.Buckets = append(resp.Buckets, b)
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	defaultReplicaMaxLag         = 5 * time.Second
+	replicationHeartbeatInterval = time.Second
+)
+
+// startReplicationHeartbeat keeps a timestamp on the primary fresh, so read
+// replicas can tell how far behind they are.
+func (cfg *apiConfig) startReplicationHeartbeat() {
+	cfg.startScheduledTask("replication_heartbeat", replicationHeartbeatInterval, func(ctx context.Context) {
+		if err := cfg.db.WriteReplicationHeartbeat(); err != nil {
+			log.Printf("Couldn't write replication heartbeat: %v", err)
+		}
+	})
+}
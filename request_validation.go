@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// pathParamSchemas checks path parameters by name before a request reaches
+// its handler, returning what's wrong with a value or "". Handlers still
+// parse the values they use, the checks here make every route answer a
+// malformed parameter the same way.
+var pathParamSchemas = map[string]func(string) string{
+	"videoID":        uuidParam,
+	"userID":         uuidParam,
+	"user":           uuidParam,
+	"folderID":       uuidParam,
+	"campaignID":     uuidParam,
+	"chapterID":      uuidParam,
+	"experimentID":   uuidParam,
+	"jobID":          uuidParam,
+	"keyID":          uuidParam,
+	"linkID":         uuidParam,
+	"notificationID": uuidParam,
+	"presetID":       uuidParam,
+	"reportID":       uuidParam,
+	"thumbnailID":    uuidParam,
+	"uploadID":       uuidParam,
+	"language": func(v string) string {
+		if _, ok := normalizeLanguageTag(v); !ok {
+			return "must be a language tag like en or pt-BR"
+		}
+		return ""
+	},
+}
+
+func uuidParam(v string) string {
+	if _, err := uuid.Parse(v); err != nil {
+		return "must be a UUID"
+	}
+	return ""
+}
+
+// requestValidationMiddleware answers 400 with the offending fields when
+// a path parameter of the route doesn't fit its schema.
+func requestValidationMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		var errs []fieldError
+		for name, value := range patternPathValues(pattern, r.URL.EscapedPath()) {
+			check, ok := pathParamSchemas[name]
+			if !ok {
+				continue
+			}
+			if msg := check(value); msg != "" {
+				errs = append(errs, fieldError{Field: name, Message: msg})
+			}
+		}
+		if len(errs) > 0 {
+			sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+			respondWithFieldErrors(w, codeInvalidPathParameters, "Invalid path parameters", errs)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// patternPathValues pairs the wildcards of a mux pattern with the segments
+// of path, the way the mux does before it sets r.PathValue. Patterns
+// without wildcards, and "..." wildcards, give nothing to check.
+func patternPathValues(pattern, path string) map[string]string {
+	if _, p, ok := strings.Cut(pattern, " "); ok {
+		pattern = p
+	}
+	if i := strings.Index(pattern, "/"); i > 0 {
+		pattern = pattern[i:] // drop the host
+	}
+	patternSegs := strings.Split(pattern, "/")
+	pathSegs := strings.Split(path, "/")
+	values := map[string]string{}
+	for i, seg := range patternSegs {
+		if i >= len(pathSegs) {
+			break
+		}
+		name, ok := strings.CutPrefix(seg, "{")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSuffix(name, "}")
+		if name == "$" || strings.HasSuffix(name, "...") {
+			continue
+		}
+		value, err := url.PathUnescape(pathSegs[i])
+		if err != nil {
+			value = pathSegs[i]
+		}
+		values[name] = value
+	}
+	return values
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// objectLockSupport finds out once whether the bucket has S3 Object Lock
+// enabled, which can only be switched on when it's created.
+type objectLockSupport struct {
+	once    sync.Once
+	enabled bool
+	err     error
+}
+
+func (cfg *apiConfig) bucketHasObjectLock(ctx context.Context) (bool, error) {
+	cfg.objectLock.once.Do(func() {
+		out, err := cfg.s3Client.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{
+			Bucket: aws.String(cfg.s3Bucket),
+		})
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ObjectLockConfigurationNotFoundError" {
+			return
+		}
+		if err != nil {
+			cfg.objectLock.err = err
+			return
+		}
+		cfg.objectLock.enabled = out.ObjectLockConfiguration != nil &&
+			out.ObjectLockConfiguration.ObjectLockEnabled == s3types.ObjectLockEnabledEnabled
+	})
+	return cfg.objectLock.enabled, cfg.objectLock.err
+}
+
+// isRetained reports whether the video's retention lock is still in force.
+func (cfg *apiConfig) isRetained(video database.Video) bool {
+	return video.RetainedUntil != nil && video.RetainedUntil.After(cfg.clock.Now())
+}
+
+// videoObjectKeys returns the keys of every stored version of the video and
+// of its audio description.
+func (cfg *apiConfig) videoObjectKeys(video database.Video) ([]string, error) {
+	versions, err := cfg.db.GetVideoVersions(video.ID)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var keys []string
+	add := func(u string) {
+		key, err := cfg.getS3KeyFromURL(u)
+		if err == nil && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, v := range versions {
+		add(v.VideoURL)
+	}
+	if video.VideoURL != nil {
+		add(*video.VideoURL)
+	}
+	if video.AudioDescriptionURL != nil {
+		add(*video.AudioDescriptionURL)
+	}
+	return keys, nil
+}
+
+// applyObjectRetention mirrors a retention lock onto the objects in S3 as
+// governance mode retention, so the objects are protected from deletion
+// outside of this server too. Buckets without Object Lock are skipped, the
+// lock is then only enforced here.
+func (cfg *apiConfig) applyObjectRetention(ctx context.Context, keys []string, until *time.Time) error {
+	enabled, err := cfg.bucketHasObjectLock(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't check bucket object lock support: %w", err)
+	}
+	if !enabled {
+		return nil
+	}
+
+	retention := &s3types.ObjectLockRetention{}
+	if until != nil {
+		retention.Mode = s3types.ObjectLockRetentionModeGovernance
+		retention.RetainUntilDate = aws.Time(*until)
+	}
+	for _, key := range keys {
+		_, err := cfg.s3Client.PutObjectRetention(ctx, &s3.PutObjectRetentionInput{
+			Bucket:    aws.String(cfg.s3Bucket),
+			Key:       aws.String(key),
+			Retention: retention,
+			// shortening or lifting governance retention needs the bypass
+			BypassGovernanceRetention: aws.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't set retention on %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// retainNewObject extends a video's retention lock to a newly stored object.
+func (cfg *apiConfig) retainNewObject(ctx context.Context, video database.Video, key string) {
+	if !cfg.isRetained(video) {
+		return
+	}
+	if err := cfg.applyObjectRetention(ctx, []string{key}, video.RetainedUntil); err != nil {
+		log.Printf("Couldn't apply retention lock of video %s to new object: %v", video.ID, err)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// routeAuth is who may call a route. The check runs before the handler,
+// so handlers of authUser routes read the caller with requestUserID.
+type routeAuth int
+
+const (
+	authPublic routeAuth = iota
+	authUser
+	authAdmin
+)
+
+// route is one entry of the API. Everything a request goes through before
+// its handler is declared here rather than repeated in handlers.
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+	auth    routeAuth
+	// uploads are turned away in maintenance mode
+	maintenance bool
+	// moves media, see longRunningRoutes
+	longRunning bool
+}
+
+func (cfg *apiConfig) routes() []route {
+	return []route{
+		{pattern: "GET /embed/{videoID}", handler: cfg.handlerEmbed},
+		{pattern: "GET /oembed", handler: cfg.handlerOEmbed},
+		{pattern: "GET /share/{videoID}", handler: cfg.handlerShare},
+		{pattern: "GET /feeds/users/{file}", handler: cfg.handlerUserFeed},
+
+		{pattern: "POST /api/login", handler: cfg.handlerLogin},
+		{pattern: "POST /api/refresh", handler: cfg.handlerRefresh},
+		{pattern: "POST /api/revoke", handler: cfg.handlerRevoke},
+
+		{pattern: "POST /api/users", handler: cfg.handlerUsersCreate},
+		{pattern: "GET /api/users/me/storage", handler: cfg.handlerUserStorage, auth: authUser},
+		{pattern: "GET /api/users/me/subscriptions/videos", handler: cfg.handlerSubscriptionVideos, auth: authUser},
+		{pattern: "PUT /api/users/me/profile", handler: cfg.handlerProfileUpdate, auth: authUser},
+		{pattern: "GET /api/users/me/digest", handler: cfg.handlerDigestSettingsGet, auth: authUser},
+		{pattern: "PUT /api/users/me/digest", handler: cfg.handlerDigestSettingsSet, auth: authUser},
+		{pattern: "GET /api/users/me/lists/{list}", handler: cfg.handlerSavedVideosList, auth: authUser},
+		{pattern: "PUT /api/users/me/lists/{list}/{videoID}", handler: cfg.handlerSavedVideoAdd, auth: authUser},
+		{pattern: "DELETE /api/users/me/lists/{list}/{videoID}", handler: cfg.handlerSavedVideoRemove, auth: authUser},
+		{pattern: "POST /api/users/me/avatar", handler: cfg.handlerAvatarUpload, auth: authUser, maintenance: true},
+		{pattern: "GET /api/users/{userID}/profile", handler: cfg.handlerProfileGet},
+		{pattern: "GET /api/users/{userID}/videos", handler: cfg.handlerChannelVideos},
+		{pattern: "GET /api/users/{userID}/videos/by-slug/{slug}", handler: cfg.handlerVideoGetBySlug},
+		{pattern: "PUT /api/users/{userID}/follow", handler: cfg.handlerFollow, auth: authUser},
+		{pattern: "DELETE /api/users/{userID}/follow", handler: cfg.handlerUnfollow, auth: authUser},
+
+		{pattern: "GET /api/folders", handler: cfg.handlerFoldersList, auth: authUser},
+		{pattern: "POST /api/folders", handler: cfg.handlerFolderCreate, auth: authUser},
+		{pattern: "GET /api/folders/{folderID}", handler: cfg.handlerFolderGet, auth: authUser},
+		{pattern: "PATCH /api/folders/{folderID}", handler: cfg.handlerFolderRename, auth: authUser},
+		{pattern: "PUT /api/folders/{folderID}/settings", handler: cfg.handlerFolderSettingsSet, auth: authUser},
+		{pattern: "POST /api/folders/{folderID}/move", handler: cfg.handlerFolderMove, auth: authUser},
+		{pattern: "DELETE /api/folders/{folderID}", handler: cfg.handlerFolderDelete, auth: authUser},
+		{pattern: "GET /api/folders/{folderID}/videos", handler: cfg.handlerFolderVideos, auth: authUser},
+
+		{pattern: "GET /api/upload-presets", handler: cfg.handlerUploadPresetsList, auth: authUser},
+		{pattern: "POST /api/upload-presets", handler: cfg.handlerUploadPresetCreate, auth: authUser},
+		{pattern: "PUT /api/upload-presets/{presetID}", handler: cfg.handlerUploadPresetUpdate, auth: authUser},
+		{pattern: "DELETE /api/upload-presets/{presetID}", handler: cfg.handlerUploadPresetDelete, auth: authUser},
+		{pattern: "GET /api/stream-keys", handler: cfg.handlerStreamKeysList, auth: authUser},
+		{pattern: "POST /api/stream-keys", handler: cfg.handlerStreamKeyCreate, auth: authUser},
+		{pattern: "POST /api/stream-keys/{keyID}/rotate", handler: cfg.handlerStreamKeyRotate, auth: authUser},
+		{pattern: "DELETE /api/stream-keys/{keyID}", handler: cfg.handlerStreamKeyDelete, auth: authUser},
+
+		{pattern: "POST /api/videos", handler: cfg.handlerVideoMetaCreate, auth: authUser},
+		{pattern: "POST /api/thumbnail_upload/{videoID}", handler: cfg.handlerUploadThumbnail, auth: authUser, maintenance: true, longRunning: true},
+		{pattern: "POST /api/video_upload/{videoID}", handler: cfg.handlerUploadVideo, auth: authUser, maintenance: true, longRunning: true},
+		{pattern: "POST /api/videos/{videoID}/upload-policy", handler: cfg.handlerUploadPolicy, auth: authUser, maintenance: true},
+		{pattern: "POST /api/videos/{videoID}/upload-policy/complete", handler: cfg.handlerUploadPolicyComplete, auth: authUser, maintenance: true, longRunning: true},
+		{pattern: "POST /api/videos/batch", handler: cfg.handlerBatchUpload, auth: authUser, maintenance: true, longRunning: true},
+		{pattern: "PUT /api/videos/{videoID}/media", handler: cfg.handlerVideoMediaReplace, auth: authUser, maintenance: true, longRunning: true},
+		{pattern: "GET /api/videos", handler: cfg.handlerVideosRetrieve, auth: authUser},
+		{pattern: "POST /api/videos/signed-urls", handler: cfg.handlerSignedURLs, auth: authUser},
+		{pattern: "GET /api/videos/trending", handler: cfg.handlerVideosTrending},
+		{pattern: "GET /api/videos/{videoID}", handler: cfg.handlerVideoGet},
+		{pattern: "GET /api/videos/{videoID}/related", handler: cfg.handlerVideosRelated},
+		{pattern: "PATCH /api/videos/{videoID}", handler: cfg.handlerVideoMetaUpdate, auth: authUser},
+		{pattern: "PUT /api/videos/{videoID}/folder", handler: cfg.handlerVideoFolderSet, auth: authUser},
+		{pattern: "DELETE /api/videos/{videoID}", handler: cfg.handlerVideoMetaDelete, auth: authUser},
+		{pattern: "GET /api/jobs/{jobID}", handler: cfg.handlerProcessingJobGet, auth: authUser},
+		{pattern: "DELETE /api/uploads/{uploadID}", handler: cfg.handlerUploadCancel, auth: authUser},
+		{pattern: "POST /api/videos/{videoID}/copy", handler: cfg.handlerVideoCopy, auth: authUser, longRunning: true},
+		{pattern: "GET /api/problems/{class}", handler: cfg.handlerProblemType},
+		{pattern: "GET /api/thumbnails/placeholder.svg", handler: cfg.handlerPlaceholderThumbnail},
+		{pattern: "GET /api/videos/{videoID}/thumbnails", handler: cfg.handlerThumbnailHistoryList, auth: authUser},
+		{pattern: "POST /api/videos/{videoID}/thumbnails/{thumbnailID}/revert", handler: cfg.handlerThumbnailRevert, auth: authUser},
+		{pattern: "GET /api/videos/{videoID}/thumbnail-experiments", handler: cfg.handlerThumbnailExperimentsList, auth: authUser},
+		{pattern: "POST /api/videos/{videoID}/thumbnail-experiments", handler: cfg.handlerThumbnailExperimentCreate, auth: authUser, maintenance: true},
+		{pattern: "DELETE /api/videos/{videoID}/thumbnail-experiments/{experimentID}", handler: cfg.handlerThumbnailExperimentStop, auth: authUser},
+		{pattern: "PUT /api/videos/{videoID}/thumbnail/focus", handler: cfg.handlerThumbnailFocusSet, auth: authUser},
+		{pattern: "DELETE /api/videos/{videoID}/thumbnail/focus", handler: cfg.handlerThumbnailFocusDelete, auth: authUser},
+		{pattern: "PUT /api/videos/{videoID}/audio-description", handler: cfg.handlerAudioDescriptionUpload, auth: authUser, maintenance: true, longRunning: true},
+		{pattern: "DELETE /api/videos/{videoID}/audio-description", handler: cfg.handlerAudioDescriptionDelete, auth: authUser},
+		{pattern: "GET /api/videos/{videoID}/playback-restrictions", handler: cfg.handlerPlaybackRestrictionsGet, auth: authUser},
+		{pattern: "PUT /api/videos/{videoID}/playback-restrictions", handler: cfg.handlerPlaybackRestrictionsSet, auth: authUser},
+		{pattern: "POST /api/videos/{videoID}/reports", handler: cfg.handlerReportCreate},
+		{pattern: "GET /api/videos/{videoID}/takedown", handler: cfg.handlerTakedownGet, auth: authUser},
+		{pattern: "POST /api/videos/{videoID}/takedown/appeal", handler: cfg.handlerTakedownAppeal, auth: authUser},
+		{pattern: "GET /api/videos/{videoID}/stream", handler: cfg.handlerVideoStream, longRunning: true},
+		{pattern: "GET /api/videos/{videoID}/live", handler: cfg.handlerLiveStreamGet, auth: authUser},
+		{pattern: "POST /api/videos/{videoID}/live", handler: cfg.handlerLiveStreamCreate, auth: authUser, maintenance: true},
+		{pattern: "PUT /api/videos/{videoID}/live", handler: cfg.handlerLiveStreamSettings, auth: authUser},
+		{pattern: "DELETE /api/videos/{videoID}/live", handler: cfg.handlerLiveStreamDelete, auth: authUser},
+		// LL-HLS playlist and part requests block until the part is there
+		{pattern: "GET /api/videos/{videoID}/live/{file}", handler: cfg.handlerLivePlayback, longRunning: true},
+		{pattern: "GET /api/videos/{videoID}/versions", handler: cfg.handlerVideoVersionsList, auth: authUser},
+		{pattern: "GET /api/videos/{videoID}/translations", handler: cfg.handlerVideoTranslationsList},
+		{pattern: "PUT /api/videos/{videoID}/translations/{language}", handler: cfg.handlerVideoTranslationSet, auth: authUser},
+		{pattern: "DELETE /api/videos/{videoID}/translations/{language}", handler: cfg.handlerVideoTranslationDelete, auth: authUser},
+		{pattern: "GET /api/videos/{videoID}/chapters", handler: cfg.handlerChaptersList},
+		{pattern: "GET /api/videos/{videoID}/chapters.vtt", handler: cfg.handlerChaptersVTT},
+		{pattern: "POST /api/videos/{videoID}/chapters", handler: cfg.handlerChapterCreate, auth: authUser},
+		{pattern: "PATCH /api/videos/{videoID}/chapters/{chapterID}", handler: cfg.handlerChapterUpdate, auth: authUser},
+		{pattern: "DELETE /api/videos/{videoID}/chapters/{chapterID}", handler: cfg.handlerChapterDelete, auth: authUser},
+		{pattern: "POST /api/videos/{videoID}/versions/{version}/rollback", handler: cfg.handlerVideoVersionRollback, auth: authUser},
+		{pattern: "GET /api/videos/{videoID}/analytics", handler: cfg.handlerPlaybackAnalyticsGet, auth: authUser},
+		{pattern: "GET /api/videos/{videoID}/analytics/heatmap", handler: cfg.handlerReplayHeatmapGet, auth: authUser},
+		{pattern: "GET /api/videos/{videoID}/progress", handler: cfg.handlerWatchProgressGet, auth: authUser},
+		{pattern: "GET /api/videos/{videoID}/share-links", handler: cfg.handlerShareLinksList, auth: authUser},
+		{pattern: "POST /api/videos/{videoID}/share-links", handler: cfg.handlerShareLinkCreate, auth: authUser},
+		{pattern: "DELETE /api/videos/{videoID}/share-links/{linkID}", handler: cfg.handlerShareLinkDelete, auth: authUser},
+		{pattern: "PUT /api/videos/{videoID}/progress", handler: cfg.handlerWatchProgressSet, auth: authUser},
+		{pattern: "POST /api/analytics/playback", handler: cfg.handlerPlaybackAnalytics},
+		{pattern: "GET /api/notifications", handler: cfg.handlerNotificationsList, auth: authUser},
+		{pattern: "GET /api/notifications/unread-count", handler: cfg.handlerNotificationsUnreadCount, auth: authUser},
+		{pattern: "POST /api/notifications/{notificationID}/read", handler: cfg.handlerNotificationRead, auth: authUser},
+		{pattern: "POST /api/notifications/read-all", handler: cfg.handlerNotificationsReadAll, auth: authUser},
+
+		{pattern: "POST /admin/reset", handler: cfg.handlerReset},
+		{pattern: "GET /admin/maintenance", handler: cfg.handlerMaintenanceGet, auth: authAdmin},
+		{pattern: "PUT /admin/maintenance", handler: cfg.handlerMaintenanceSet, auth: authAdmin},
+		{pattern: "GET /admin/read-only", handler: cfg.handlerReadOnlyGet, auth: authAdmin},
+		{pattern: "PUT /admin/read-only", handler: cfg.handlerReadOnlySet, auth: authAdmin},
+		{pattern: "GET /admin/feature_flags", handler: cfg.handlerFeatureFlagsList, auth: authAdmin},
+		{pattern: "PUT /admin/feature_flags/{name}", handler: cfg.handlerFeatureFlagSet, auth: authAdmin},
+		{pattern: "DELETE /admin/feature_flags/{name}", handler: cfg.handlerFeatureFlagDelete, auth: authAdmin},
+		{pattern: "GET /admin/costs", handler: cfg.handlerCostReport, auth: authAdmin},
+		{pattern: "GET /admin/reports", handler: cfg.handlerReportsList, auth: authAdmin},
+		{pattern: "POST /admin/reports/{reportID}/dismiss", handler: cfg.handlerReportDismiss, auth: authAdmin},
+		{pattern: "PUT /admin/videos/{videoID}/takedown", handler: cfg.handlerTakedownSet, auth: authAdmin},
+		{pattern: "PUT /admin/videos/{videoID}/retention", handler: cfg.handlerRetentionSet, auth: authAdmin},
+		{pattern: "PUT /admin/users/{userID}/plan", handler: cfg.handlerUserPlanSet, auth: authAdmin},
+		{pattern: "GET /admin/audit-log", handler: cfg.handlerAuditLog, auth: authAdmin},
+		{pattern: "POST /admin/integrity-check", handler: cfg.handlerIntegrityCheck, auth: authAdmin},
+		{pattern: "GET /admin/integrity-failures", handler: cfg.handlerIntegrityFailures, auth: authAdmin},
+		{pattern: "GET /admin/archive", handler: cfg.handlerArchiveReport, auth: authAdmin},
+		{pattern: "GET /admin/replication", handler: cfg.handlerReplicationStatus, auth: authAdmin},
+		{pattern: "POST /admin/reencode-campaigns", handler: cfg.handlerReencodeCampaignCreate, auth: authAdmin},
+		{pattern: "GET /admin/reencode-campaigns", handler: cfg.handlerReencodeCampaignsList, auth: authAdmin},
+		{pattern: "GET /admin/reencode-campaigns/{campaignID}", handler: cfg.handlerReencodeCampaignGet, auth: authAdmin},
+		{pattern: "POST /admin/reencode-campaigns/{campaignID}/pause", handler: cfg.handlerReencodeCampaignPause, auth: authAdmin},
+		{pattern: "POST /admin/reencode-campaigns/{campaignID}/resume", handler: cfg.handlerReencodeCampaignResume, auth: authAdmin},
+	}
+}
+
+// registerRoutes adds routes to mux behind the middleware each declares.
+// Middlewares for every request, like recovery and timeouts, wrap the mux
+// in main instead.
+func (cfg *apiConfig) registerRoutes(mux *http.ServeMux, routes []route) {
+	for _, rt := range routes {
+		var h http.Handler = rt.handler
+		if rt.maintenance {
+			h = cfg.maintenanceMiddleware(h)
+		}
+		switch rt.auth {
+		case authUser:
+			h = cfg.userAuthMiddleware(h)
+		case authAdmin:
+			h = cfg.adminAuthMiddleware(h)
+		}
+		if rt.longRunning {
+			longRunningRoutes[rt.pattern] = true
+		}
+		mux.Handle(rt.pattern, h)
+	}
+}
+
+type userIDKey struct{}
+
+// userAuthMiddleware answers 401 unless the request carries a valid JWT,
+// and passes its user on to requestUserID.
+func (cfg *apiConfig) userAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, codeCouldntFindJWT, "Couldn't find JWT", err)
+			return
+		}
+		userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, codeCouldntValidateJWT, "Couldn't validate JWT", err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userIDKey{}, userID)))
+	})
+}
+
+// requestUserID is the user whose JWT authenticated the request. Only
+// authUser routes have one, asking on any other route is a bug.
+func requestUserID(r *http.Request) uuid.UUID {
+	userID, ok := r.Context().Value(userIDKey{}).(uuid.UUID)
+	if !ok {
+		panic("requestUserID called on a route that isn't registered with authUser")
+	}
+	return userID
+}
+
+// optionalUserID is the user whose JWT came with a request to a public
+// route. ok is false for anonymous requests and invalid tokens alike.
+func (cfg *apiConfig) optionalUserID(r *http.Request) (userID uuid.UUID, ok bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// adminAuthMiddleware answers 401 unless the request carries the admin
+// API key.
+func (cfg *apiConfig) adminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := cfg.authorizeAdmin(r)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, codeCouldntValidateAdminAPIKey, "Couldn't validate admin API key", err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRegisterRoutes catches patterns that conflict, which ServeMux only
+// reports by panicking when the server starts.
+func TestRegisterRoutes(t *testing.T) {
+	cfg := &apiConfig{}
+	defer func() {
+		if err := recover(); err != nil {
+			t.Fatalf("registering routes panicked: %v", err)
+		}
+	}()
+	cfg.registerRoutes(http.NewServeMux(), cfg.routes())
+}
+
+func TestRouteResolution(t *testing.T) {
+	cfg := &apiConfig{}
+	mux := http.NewServeMux()
+	cfg.registerRoutes(mux, cfg.routes())
+
+	tests := []struct {
+		method      string
+		path        string
+		wantPattern string
+	}{
+		{http.MethodGet, "/api/videos/0b7a3c9e-94d4-4c8e-9d0a-8c9f2f1f7d11", "GET /api/videos/{videoID}"},
+		{http.MethodGet, "/api/videos/trending", "GET /api/videos/trending"},
+		{http.MethodGet, "/api/videos/0b7a3c9e-94d4-4c8e-9d0a-8c9f2f1f7d11/analytics/heatmap", "GET /api/videos/{videoID}/analytics/heatmap"},
+		{http.MethodGet, "/api/videos/0b7a3c9e-94d4-4c8e-9d0a-8c9f2f1f7d11/live", "GET /api/videos/{videoID}/live"},
+		{http.MethodGet, "/api/videos/0b7a3c9e-94d4-4c8e-9d0a-8c9f2f1f7d11/live/index.m3u8", "GET /api/videos/{videoID}/live/{file}"},
+		{http.MethodGet, "/api/users/0b7a3c9e-94d4-4c8e-9d0a-8c9f2f1f7d11/videos/by-slug/boots", "GET /api/users/{userID}/videos/by-slug/{slug}"},
+		{http.MethodGet, "/api/users/me/lists/watch-later", "GET /api/users/me/lists/{list}"},
+	}
+
+	for _, tt := range tests {
+		_, pattern := mux.Handler(httptest.NewRequest(tt.method, tt.path, nil))
+		if pattern != tt.wantPattern {
+			t.Errorf("%s %s matched %q, want %q", tt.method, tt.path, pattern, tt.wantPattern)
+		}
+	}
+}
@@ -0,0 +1,588 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"time"
+)
+
+// rtmpServer accepts broadcasts over RTMP. It speaks just enough of the
+// protocol for encoders like OBS and ffmpeg to publish: the plain
+// handshake, chunking, and the connect, createStream and publish
+// commands. Published audio and video are passed on as FLV.
+type rtmpServer struct {
+	// publish authorizes a stream key, returning where its FLV goes. It is
+	// closed when the broadcast ends.
+	publish func(streamKey string) (io.WriteCloser, error)
+}
+
+const (
+	rtmpHandshakeSize = 1536
+	// an encoder that sends nothing for this long is gone
+	rtmpIdleTimeout = 30 * time.Second
+	rtmpChunkSize   = 4096
+	rtmpWindowSize  = 2500000
+	// the 3 byte message length allows 16 MiB, no sane frame needs that
+	rtmpMaxMessageSize = 8 << 20
+
+	rtmpMsgSetChunkSize     = 1
+	rtmpMsgAbort            = 2
+	rtmpMsgAck              = 3
+	rtmpMsgWindowAckSize    = 5
+	rtmpMsgSetPeerBandwidth = 6
+	rtmpMsgAudio            = 8
+	rtmpMsgVideo            = 9
+	rtmpMsgDataAMF3         = 15
+	rtmpMsgCommandAMF3      = 17
+	rtmpMsgDataAMF0         = 18
+	rtmpMsgCommandAMF0      = 20
+
+	// the message stream createStream hands out, there's only ever one
+	rtmpPublishStreamID = 1
+)
+
+func (s *rtmpServer) serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := s.handle(conn); err != nil && !errors.Is(err, io.EOF) {
+				log.Printf("RTMP connection from %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// rtmpChunkStream is what a chunk stream's last header said, which the
+// compressed headers of later chunks leave out.
+type rtmpChunkStream struct {
+	timestamp uint32
+	delta     uint32
+	length    uint32
+	typeID    byte
+	streamID  uint32
+	extended  bool
+	payload   []byte
+	inMessage bool
+}
+
+type rtmpMessage struct {
+	typeID    byte
+	streamID  uint32
+	timestamp uint32
+	payload   []byte
+}
+
+type rtmpConn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	w         *bufio.Writer
+	inChunk   uint32
+	streams   map[uint32]*rtmpChunkStream
+	bytesRead uint32
+	// the peer wants an acknowledgement every window bytes, 0 for never
+	window  uint32
+	lastAck uint32
+
+	sink io.WriteCloser
+}
+
+func (s *rtmpServer) handle(conn net.Conn) error {
+	c := &rtmpConn{
+		conn:    conn,
+		r:       bufio.NewReaderSize(conn, 64<<10),
+		w:       bufio.NewWriter(conn),
+		inChunk: 128,
+		streams: map[uint32]*rtmpChunkStream{},
+	}
+	defer func() {
+		if c.sink != nil {
+			if err := c.sink.Close(); err != nil {
+				log.Printf("Couldn't finish RTMP broadcast: %v", err)
+			}
+		}
+	}()
+
+	if err := c.handshake(); err != nil {
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		done, err := s.handleMessage(c, msg)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func (c *rtmpConn) handshake() error {
+	c.conn.SetDeadline(time.Now().Add(rtmpIdleTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	c0c1 := make([]byte, 1+rtmpHandshakeSize)
+	if _, err := io.ReadFull(c.r, c0c1); err != nil {
+		return err
+	}
+	if c0c1[0] != 3 {
+		return fmt.Errorf("unsupported RTMP version %d", c0c1[0])
+	}
+
+	s1 := make([]byte, rtmpHandshakeSize)
+	if _, err := rand.Read(s1[8:]); err != nil {
+		return err
+	}
+	c.w.WriteByte(3)
+	c.w.Write(s1)
+	// S2 echoes C1
+	c.w.Write(c0c1[1:])
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	_, err := io.ReadFull(c.r, make([]byte, rtmpHandshakeSize))
+	return err
+}
+
+func (c *rtmpConn) read(p []byte) error {
+	c.conn.SetReadDeadline(time.Now().Add(rtmpIdleTimeout))
+	n, err := io.ReadFull(c.r, p)
+	c.bytesRead += uint32(n)
+	return err
+}
+
+func (c *rtmpConn) readUint(n int) (uint32, error) {
+	var buf [4]byte
+	if err := c.read(buf[4-n:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf[:]), nil
+}
+
+// readMessage reads chunks until one completes a message.
+func (c *rtmpConn) readMessage() (rtmpMessage, error) {
+	for {
+		first, err := c.readUint(1)
+		if err != nil {
+			return rtmpMessage{}, err
+		}
+		format := first >> 6
+		csid := first & 0x3f
+		switch csid {
+		case 0:
+			b, err := c.readUint(1)
+			if err != nil {
+				return rtmpMessage{}, err
+			}
+			csid = 64 + b
+		case 1:
+			b, err := c.readUint(2)
+			if err != nil {
+				return rtmpMessage{}, err
+			}
+			// little endian, unlike everything else
+			csid = 64 + b>>8 + (b&0xff)<<8
+		}
+
+		cs := c.streams[csid]
+		if cs == nil {
+			if format != 0 {
+				return rtmpMessage{}, fmt.Errorf("chunk stream %d starts without a full header", csid)
+			}
+			cs = &rtmpChunkStream{}
+			c.streams[csid] = cs
+		}
+
+		if format <= 2 {
+			ts, err := c.readUint(3)
+			if err != nil {
+				return rtmpMessage{}, err
+			}
+			if format <= 1 {
+				if cs.length, err = c.readUint(3); err != nil {
+					return rtmpMessage{}, err
+				}
+				typeID, err := c.readUint(1)
+				if err != nil {
+					return rtmpMessage{}, err
+				}
+				cs.typeID = byte(typeID)
+			}
+			if format == 0 {
+				var id [4]byte
+				if err := c.read(id[:]); err != nil {
+					return rtmpMessage{}, err
+				}
+				cs.streamID = binary.LittleEndian.Uint32(id[:])
+			}
+			cs.extended = ts == 0xffffff
+			if cs.extended {
+				if ts, err = c.readUint(4); err != nil {
+					return rtmpMessage{}, err
+				}
+			}
+			if format == 0 {
+				cs.timestamp = ts
+				cs.delta = 0
+			} else {
+				cs.delta = ts
+				cs.timestamp += ts
+			}
+		} else {
+			if cs.extended {
+				// repeated in every chunk of the message that needed it
+				if _, err := c.readUint(4); err != nil {
+					return rtmpMessage{}, err
+				}
+			}
+			// a new message that reuses the whole previous header
+			if !cs.inMessage {
+				cs.timestamp += cs.delta
+			}
+		}
+
+		if cs.length > rtmpMaxMessageSize {
+			return rtmpMessage{}, fmt.Errorf("message of %d bytes is too big", cs.length)
+		}
+		if !cs.inMessage {
+			cs.payload = make([]byte, 0, cs.length)
+			cs.inMessage = true
+		}
+		n := min(cs.length-uint32(len(cs.payload)), c.inChunk)
+		start := len(cs.payload)
+		cs.payload = cs.payload[:start+int(n)]
+		if err := c.read(cs.payload[start:]); err != nil {
+			return rtmpMessage{}, err
+		}
+		if err := c.acknowledge(); err != nil {
+			return rtmpMessage{}, err
+		}
+		if uint32(len(cs.payload)) < cs.length {
+			continue
+		}
+
+		cs.inMessage = false
+		msg := rtmpMessage{typeID: cs.typeID, streamID: cs.streamID, timestamp: cs.timestamp, payload: cs.payload}
+		cs.payload = nil
+		switch msg.typeID {
+		case rtmpMsgSetChunkSize:
+			if len(msg.payload) < 4 {
+				return rtmpMessage{}, errors.New("short set chunk size message")
+			}
+			c.inChunk = binary.BigEndian.Uint32(msg.payload) & 0x7fffffff
+			if c.inChunk == 0 || c.inChunk > rtmpMaxMessageSize {
+				return rtmpMessage{}, fmt.Errorf("invalid chunk size %d", c.inChunk)
+			}
+		case rtmpMsgAbort:
+			if len(msg.payload) >= 4 {
+				if aborted := c.streams[binary.BigEndian.Uint32(msg.payload)]; aborted != nil {
+					aborted.inMessage = false
+					aborted.payload = nil
+				}
+			}
+		case rtmpMsgWindowAckSize:
+			if len(msg.payload) >= 4 {
+				c.window = binary.BigEndian.Uint32(msg.payload)
+			}
+		default:
+			return msg, nil
+		}
+	}
+}
+
+func (c *rtmpConn) acknowledge() error {
+	if c.window == 0 || c.bytesRead-c.lastAck < c.window {
+		return nil
+	}
+	c.lastAck = c.bytesRead
+	return c.writeMessage(2, rtmpMsgAck, 0, binary.BigEndian.AppendUint32(nil, c.bytesRead))
+}
+
+// writeMessage sends a message on chunk stream csid in chunks of
+// rtmpChunkSize, which the connect response announces.
+func (c *rtmpConn) writeMessage(csid byte, typeID byte, streamID uint32, payload []byte) error {
+	header := []byte{csid, 0, 0, 0}
+	header = append(header, byte(len(payload)>>16), byte(len(payload)>>8), byte(len(payload)), typeID)
+	header = binary.LittleEndian.AppendUint32(header, streamID)
+	c.w.Write(header)
+	for len(payload) > 0 {
+		n := min(len(payload), rtmpChunkSize)
+		c.w.Write(payload[:n])
+		payload = payload[n:]
+		if len(payload) > 0 {
+			c.w.WriteByte(0xc0 | csid)
+		}
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(rtmpIdleTimeout))
+	return c.w.Flush()
+}
+
+func (c *rtmpConn) writeCommand(streamID uint32, values ...any) error {
+	var buf bytes.Buffer
+	for _, v := range values {
+		amf0Encode(&buf, v)
+	}
+	return c.writeMessage(3, rtmpMsgCommandAMF0, streamID, buf.Bytes())
+}
+
+// handleMessage acts on a message, returning true once the broadcast is
+// over.
+func (s *rtmpServer) handleMessage(c *rtmpConn, msg rtmpMessage) (bool, error) {
+	switch msg.typeID {
+	case rtmpMsgAudio, rtmpMsgVideo:
+		if c.sink == nil {
+			return false, nil
+		}
+		return false, writeFLVTag(c.sink, msg.typeID, msg.timestamp, msg.payload)
+	case rtmpMsgDataAMF0, rtmpMsgDataAMF3:
+		if c.sink == nil {
+			return false, nil
+		}
+		payload := msg.payload
+		if msg.typeID == rtmpMsgDataAMF3 && len(payload) > 0 {
+			payload = payload[1:]
+		}
+		// encoders send the metadata as @setDataFrame("onMetaData", ...),
+		// FLV files have it as onMetaData(...)
+		if name, rest, err := amf0Decode(payload); err == nil && name == "@setDataFrame" {
+			payload = rest
+		}
+		return false, writeFLVTag(c.sink, msg.typeID, msg.timestamp, payload)
+	case rtmpMsgCommandAMF0, rtmpMsgCommandAMF3:
+		payload := msg.payload
+		if msg.typeID == rtmpMsgCommandAMF3 && len(payload) > 0 {
+			payload = payload[1:]
+		}
+		return s.handleCommand(c, payload)
+	}
+	return false, nil
+}
+
+func (s *rtmpServer) handleCommand(c *rtmpConn, payload []byte) (bool, error) {
+	var args []any
+	for len(payload) > 0 {
+		v, rest, err := amf0Decode(payload)
+		if err != nil {
+			return false, fmt.Errorf("bad command: %w", err)
+		}
+		args = append(args, v)
+		payload = rest
+	}
+	name, _ := amf0Arg[string](args, 0)
+	txn, _ := amf0Arg[float64](args, 1)
+
+	switch name {
+	case "connect":
+		c.writeMessage(2, rtmpMsgWindowAckSize, 0, binary.BigEndian.AppendUint32(nil, rtmpWindowSize))
+		c.writeMessage(2, rtmpMsgSetPeerBandwidth, 0, append(binary.BigEndian.AppendUint32(nil, rtmpWindowSize), 2))
+		c.writeMessage(2, rtmpMsgSetChunkSize, 0, binary.BigEndian.AppendUint32(nil, rtmpChunkSize))
+		return false, c.writeCommand(0, "_result", txn,
+			amf0Object{{"fmsVer", "FMS/3,0,1,123"}, {"capabilities", 31.0}},
+			amf0Object{
+				{"level", "status"},
+				{"code", "NetConnection.Connect.Success"},
+				{"description", "Connection succeeded."},
+				{"objectEncoding", 0.0},
+			})
+	case "createStream":
+		return false, c.writeCommand(0, "_result", txn, nil, float64(rtmpPublishStreamID))
+	case "publish":
+		if c.sink != nil {
+			return false, errors.New("already publishing")
+		}
+		key, _ := amf0Arg[string](args, 3)
+		sink, err := s.publish(key)
+		if err != nil {
+			c.writeCommand(rtmpPublishStreamID, "onStatus", 0.0, nil, amf0Object{
+				{"level", "error"},
+				{"code", "NetStream.Publish.BadName"},
+				{"description", err.Error()},
+			})
+			return true, nil
+		}
+		c.sink = sink
+		if _, err := c.sink.Write(flvHeader); err != nil {
+			return false, err
+		}
+		return false, c.writeCommand(rtmpPublishStreamID, "onStatus", 0.0, nil, amf0Object{
+			{"level", "status"},
+			{"code", "NetStream.Publish.Start"},
+			{"description", "Publishing."},
+		})
+	case "FCUnpublish", "deleteStream", "closeStream":
+		return c.sink != nil, nil
+	}
+	// releaseStream, FCPublish and the like need no answer
+	return false, nil
+}
+
+func amf0Arg[T any](args []any, i int) (T, bool) {
+	var zero T
+	if i >= len(args) {
+		return zero, false
+	}
+	v, ok := args[i].(T)
+	return v, ok
+}
+
+// amf0Object is an AMF0 object with its properties in order.
+type amf0Object []struct {
+	name  string
+	value any
+}
+
+const (
+	amf0Number      = 0x00
+	amf0Boolean     = 0x01
+	amf0String      = 0x02
+	amf0ObjectStart = 0x03
+	amf0Null        = 0x05
+	amf0Undefined   = 0x06
+	amf0ECMAArray   = 0x08
+	amf0ObjectEnd   = 0x09
+	amf0StrictArray = 0x0a
+)
+
+func amf0Encode(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case float64:
+		buf.WriteByte(amf0Number)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case bool:
+		buf.WriteByte(amf0Boolean)
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case string:
+		buf.WriteByte(amf0String)
+		binary.Write(buf, binary.BigEndian, uint16(len(v)))
+		buf.WriteString(v)
+	case amf0Object:
+		buf.WriteByte(amf0ObjectStart)
+		for _, p := range v {
+			binary.Write(buf, binary.BigEndian, uint16(len(p.name)))
+			buf.WriteString(p.name)
+			amf0Encode(buf, p.value)
+		}
+		buf.Write([]byte{0, 0, amf0ObjectEnd})
+	default:
+		buf.WriteByte(amf0Null)
+	}
+}
+
+// amf0Decode decodes the value at the start of b, returning the rest.
+// Objects and arrays decode to map[string]any and []any.
+func amf0Decode(b []byte) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	marker, b := b[0], b[1:]
+	switch marker {
+	case amf0Number:
+		if len(b) < 8 {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), b[8:], nil
+	case amf0Boolean:
+		if len(b) < 1 {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		return b[0] != 0, b[1:], nil
+	case amf0String:
+		return amf0DecodeString(b)
+	case amf0Null, amf0Undefined:
+		return nil, b, nil
+	case amf0ObjectStart:
+		return amf0DecodeProperties(b)
+	case amf0ECMAArray:
+		// the count is only a hint, the properties end like an object's
+		if len(b) < 4 {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		return amf0DecodeProperties(b[4:])
+	case amf0StrictArray:
+		if len(b) < 4 {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		n := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		values := []any{}
+		for i := uint32(0); i < n; i++ {
+			v, rest, err := amf0Decode(b)
+			if err != nil {
+				return nil, nil, err
+			}
+			values = append(values, v)
+			b = rest
+		}
+		return values, b, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported AMF0 type %#x", marker)
+}
+
+func amf0DecodeString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+func amf0DecodeProperties(b []byte) (any, []byte, error) {
+	props := map[string]any{}
+	for {
+		name, rest, err := amf0DecodeString(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		if name == "" && len(rest) > 0 && rest[0] == amf0ObjectEnd {
+			return props, rest[1:], nil
+		}
+		v, rest, err := amf0Decode(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		props[name] = v
+		b = rest
+	}
+}
+
+// flvHeader starts an FLV file with audio and video, the size of the
+// (nonexistent) tag before the first following it.
+var flvHeader = []byte{'F', 'L', 'V', 1, 0x05, 0, 0, 0, 9, 0, 0, 0, 0}
+
+// writeFLVTag writes an RTMP audio, video or data message as an FLV tag.
+// Their type IDs and payloads are the same in both.
+func writeFLVTag(w io.Writer, typeID byte, timestamp uint32, payload []byte) error {
+	if typeID == rtmpMsgDataAMF3 {
+		typeID = rtmpMsgDataAMF0
+	}
+	size := len(payload)
+	tag := make([]byte, 0, 11+size+4)
+	tag = append(tag, typeID, byte(size>>16), byte(size>>8), byte(size))
+	// the low 24 bits of the timestamp, then the high 8
+	tag = append(tag, byte(timestamp>>16), byte(timestamp>>8), byte(timestamp), byte(timestamp>>24))
+	tag = append(tag, 0, 0, 0)
+	tag = append(tag, payload...)
+	tag = binary.BigEndian.AppendUint32(tag, uint32(11+size))
+	_, err := w.Write(tag)
+	return err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+)
+
+// credentials are refreshed this long before they expire, so requests
+// signed during a rotation don't go out with expired keys
+const s3CredentialExpiryWindow = 5 * time.Minute
+
+const defaultS3RoleSessionName = "tubely"
+
+// s3CredentialSettings is the role S3 is accessed as. The base credentials
+// come from the SDK's default chain, which already covers web identity
+// (IRSA on EKS) through AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE.
+type s3CredentialSettings struct {
+	// role to assume on top of the base credentials, "" to use them as is
+	roleARN     string
+	sessionName string
+	externalID  string
+	// check at startup that the bucket can be written to
+	startupCheck bool
+}
+
+func s3CredentialSettingsFromEnv() (s3CredentialSettings, error) {
+	s := s3CredentialSettings{
+		roleARN:      os.Getenv("S3_ROLE_ARN"),
+		sessionName:  os.Getenv("S3_ROLE_SESSION_NAME"),
+		externalID:   os.Getenv("S3_ROLE_EXTERNAL_ID"),
+		startupCheck: true,
+	}
+	if s.sessionName == "" {
+		s.sessionName = defaultS3RoleSessionName
+	}
+	if s.roleARN == "" && s.externalID != "" {
+		return s3CredentialSettings{}, errors.New("S3_ROLE_EXTERNAL_ID needs S3_ROLE_ARN")
+	}
+	if v := os.Getenv("S3_STARTUP_CHECK"); v != "" {
+		check, err := strconv.ParseBool(v)
+		if err != nil {
+			return s3CredentialSettings{}, fmt.Errorf("invalid S3_STARTUP_CHECK %q", v)
+		}
+		s.startupCheck = check
+	}
+	return s, nil
+}
+
+// config returns awsConfig with credentials for S3: the role assumed with
+// STS when one is set, refreshed before they expire.
+func (s s3CredentialSettings) config(awsConfig aws.Config) aws.Config {
+	if s.roleARN == "" {
+		return awsConfig
+	}
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsConfig), s.roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = s.sessionName
+		if s.externalID != "" {
+			o.ExternalID = aws.String(s.externalID)
+		}
+	})
+	awsConfig.Credentials = aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = s3CredentialExpiryWindow
+	})
+	return awsConfig
+}
+
+// explainS3AccessError turns a refusal by S3 into what to change, naming
+// the IAM action that's missing on which resource. Other errors are
+// returned as they are.
+func (cfg *apiConfig) explainS3AccessError(err error, action, resource string) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || storageErrors[apiErr.ErrorCode()] != storageAccessDenied {
+		return err
+	}
+	who := "the server's credentials"
+	if cfg.s3RoleARN != "" {
+		who = "role " + cfg.s3RoleARN
+	}
+	switch apiErr.ErrorCode() {
+	case "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken":
+		return fmt.Errorf("S3 rejected %s (%s), check the access keys or role the server runs with: %w", who, apiErr.ErrorCode(), err)
+	}
+	return fmt.Errorf("%s may not %s on %s, grant it in the IAM or bucket policy: %w", who, action, resource, err)
+}
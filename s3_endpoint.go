@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3EndpointSettings say how the S3 client reaches the bucket: through
+// Transfer Acceleration, over dual-stack (IPv6) endpoints, or at the
+// endpoint of an S3-compatible provider like MinIO or R2.
+type s3EndpointSettings struct {
+	accelerate bool
+	dualStack  bool
+	// custom endpoint URL, "" for AWS
+	endpoint string
+	// bucket in the path instead of the host, most S3-compatible providers
+	// need it
+	pathStyle bool
+}
+
+func s3EndpointSettingsFromEnv() (s3EndpointSettings, error) {
+	s := s3EndpointSettings{
+		endpoint: strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+	}
+	for _, setting := range []struct {
+		name string
+		dst  *bool
+	}{
+		{"S3_ACCELERATE", &s.accelerate},
+		{"S3_DUAL_STACK", &s.dualStack},
+		{"S3_FORCE_PATH_STYLE", &s.pathStyle},
+	} {
+		v := os.Getenv(setting.name)
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return s3EndpointSettings{}, fmt.Errorf("invalid %s %q", setting.name, v)
+		}
+		*setting.dst = b
+	}
+	return s, s.validate()
+}
+
+func (s s3EndpointSettings) validate() error {
+	if s.endpoint != "" {
+		u, err := url.Parse(s.endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid S3_ENDPOINT %q, it must be an http or https URL", s.endpoint)
+		}
+		if s.accelerate || s.dualStack {
+			return fmt.Errorf("S3_ACCELERATE and S3_DUAL_STACK only apply to AWS endpoints, not S3_ENDPOINT")
+		}
+	}
+	// accelerated endpoints are addressed by bucket host name only
+	if s.accelerate && s.pathStyle {
+		return fmt.Errorf("S3_ACCELERATE and S3_FORCE_PATH_STYLE are mutually exclusive")
+	}
+	return nil
+}
+
+// apply sets the endpoint options on an S3 client being built.
+func (s s3EndpointSettings) apply(o *s3.Options) {
+	o.UseAccelerate = s.accelerate
+	o.UsePathStyle = s.pathStyle
+	if s.dualStack {
+		o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+	}
+	if s.endpoint != "" {
+		o.BaseEndpoint = aws.String(s.endpoint)
+	}
+}
+
+// objectURLPrefix is what the public URL of every object in bucket starts
+// with, the object key follows. Acceleration and dual-stack only change
+// how the server reaches the bucket, stored URLs stay the regional ones.
+func (s s3EndpointSettings) objectURLPrefix(bucket, region string) string {
+	if s.endpoint == "" {
+		if s.pathStyle {
+			return fmt.Sprintf("https://s3.%s.amazonaws.com/%s/", region, bucket)
+		}
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", bucket, region)
+	}
+	if s.pathStyle {
+		return s.endpoint + "/" + bucket + "/"
+	}
+	scheme, host, _ := strings.Cut(s.endpoint, "://")
+	return scheme + "://" + bucket + "." + host + "/"
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// how many intervals a leader may miss before another instance takes over
+const scheduledTaskLeaseIntervals = 3
+
+// newInstanceID identifies this process when competing for leases.
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8])
+}
+
+// startScheduledTask runs task every interval on exactly one instance across
+// all replicas sharing the database. The instance holding the named lease
+// renews it on every tick, the others take over only once it expires.
+func (cfg *apiConfig) startScheduledTask(name string, interval time.Duration, task func(ctx context.Context)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		leader := false
+		for {
+			acquired, err := cfg.db.AcquireLease(name, cfg.instanceID, scheduledTaskLeaseIntervals*interval)
+			if err != nil {
+				log.Printf("Couldn't acquire lease for %s: %v", name, err)
+			} else if acquired != leader {
+				if acquired {
+					log.Printf("Running scheduled task %s on this instance", name)
+				} else {
+					log.Printf("Scheduled task %s taken over by another instance", name)
+				}
+				leader = acquired
+			}
+
+			// read-only mode pauses background writers too
+			if acquired && !cfg.readOnly.isEnabled() {
+				task(context.Background())
+			}
+			<-ticker.C
+		}
+	}()
+}
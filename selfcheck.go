@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const selfCheckTimeout = 30 * time.Second
+
+type selfCheck struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// runSelfCheck verifies everything the server needs beyond its configuration,
+// which was already validated while loading it, and prints a report. It
+// returns false when any check failed.
+func (cfg *apiConfig) runSelfCheck(tempRoot string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), selfCheckTimeout)
+	defer cancel()
+
+	checks := []selfCheck{
+		{"config", func(ctx context.Context) (string, error) {
+			if err := tlsSettingsFromEnv().validate(); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("platform %s, port %s", cfg.platform, cfg.port), nil
+		}},
+		{"database schema", cfg.checkSchema},
+		{"s3 bucket", cfg.checkBucket},
+		{"ffmpeg", func(ctx context.Context) (string, error) { return toolVersion(ctx, "ffmpeg") }},
+		{"ffprobe", func(ctx context.Context) (string, error) { return toolVersion(ctx, "ffprobe") }},
+		{"assets dir", func(ctx context.Context) (string, error) { return checkDir(cfg.assetsRoot, true) }},
+		{"temp dir", func(ctx context.Context) (string, error) { return checkDir(tempRoot, false) }},
+	}
+
+	ok := true
+	for _, check := range checks {
+		detail, err := check.run(ctx)
+		if err != nil {
+			ok = false
+			fmt.Printf("[FAIL] %-16s %v\n", check.name, err)
+			continue
+		}
+		fmt.Printf("[ OK ] %-16s %s\n", check.name, detail)
+	}
+
+	if ok {
+		fmt.Println("ready")
+	} else {
+		fmt.Println("not ready")
+	}
+	return ok
+}
+
+func (cfg *apiConfig) checkSchema(ctx context.Context) (string, error) {
+	version, err := cfg.db.SchemaVersion()
+	if err != nil {
+		return "", err
+	}
+	if version != database.CurrentSchemaVersion {
+		return "", fmt.Errorf("schema version %d, this build expects %d", version, database.CurrentSchemaVersion)
+	}
+	return fmt.Sprintf("version %d", version), nil
+}
+
+// checkBucket confirms the credentials can reach the bucket and that the
+// policy lets this server write and delete objects.
+func (cfg *apiConfig) checkBucket(ctx context.Context) (string, error) {
+	bucketARN := "arn:aws:s3:::" + cfg.s3Bucket
+	_, err := cfg.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(cfg.s3Bucket)})
+	if err != nil {
+		return "", fmt.Errorf("couldn't access bucket %s: %w", cfg.s3Bucket, cfg.explainS3AccessError(err, "s3:ListBucket", bucketARN))
+	}
+
+	key := fmt.Sprintf("selfcheck/%s", cfg.instanceID)
+	_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+		Body:   strings.NewReader("ok"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't write to bucket %s: %w", cfg.s3Bucket, cfg.explainS3AccessError(err, "s3:PutObject", bucketARN+"/*"))
+	}
+	_, err = cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't delete from bucket %s: %w", cfg.s3Bucket, cfg.explainS3AccessError(err, "s3:DeleteObject", bucketARN+"/*"))
+	}
+	return fmt.Sprintf("%s in %s, read/write", cfg.s3Bucket, cfg.s3Region), nil
+}
+
+func toolVersion(ctx context.Context, name string) (string, error) {
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, "-version")
+	cmd.Stdout = &stdout
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("couldn't run %s: %w", name, err)
+	}
+	firstLine, _, _ := strings.Cut(stdout.String(), "\n")
+	return firstLine, nil
+}
+
+// checkDir makes sure dir exists and is writable, and for served dirs that
+// nobody else can write to it.
+func checkDir(dir string, served bool) (string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	if served {
+		if err := checkNotWorldWritable(dir); err != nil {
+			return "", err
+		}
+	}
+
+	f, err := os.CreateTemp(dir, ".selfcheck-*")
+	if err != nil {
+		return "", fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	detail := dir
+	if free, err := diskFreeBytes(dir); err == nil && free >= 0 {
+		detail = fmt.Sprintf("%s, %s free", dir, formatBytes(free))
+	}
+	return detail, nil
+}
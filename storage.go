@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const defaultStorageRefreshInterval = time.Hour
+
+// startStorageRefresher periodically fills in sizes that weren't recorded at
+// upload time, so storage usage can be computed from the DB alone.
+func (cfg *apiConfig) startStorageRefresher(interval time.Duration) {
+	cfg.startScheduledTask("storage_refresh", interval, cfg.refreshStorageSizes)
+}
+
+func (cfg *apiConfig) refreshStorageSizes(ctx context.Context) {
+	videos, err := cfg.db.GetVideosMissingSizes()
+	if err != nil {
+		log.Printf("Couldn't load videos missing sizes: %v", err)
+		return
+	}
+
+	for _, video := range videos {
+		videoSize, thumbnailSize := video.VideoSize, video.ThumbnailSize
+		if videoSize == nil && video.VideoURL != nil {
+			size, err := cfg.getS3ObjectSize(ctx, *video.VideoURL)
+			if err != nil {
+				log.Printf("Couldn't get size of video %s: %v", video.ID, err)
+			} else {
+				videoSize = &size
+			}
+		}
+		if thumbnailSize == nil && video.ThumbnailURL != nil {
+			info, err := os.Stat(cfg.getAssetDiskPath(getAssetFromURL(*video.ThumbnailURL)))
+			if err != nil {
+				log.Printf("Couldn't get size of thumbnail for video %s: %v", video.ID, err)
+			} else {
+				size := info.Size()
+				thumbnailSize = &size
+			}
+		}
+
+		err = cfg.db.UpdateVideoSizes(video.ID, videoSize, thumbnailSize)
+		if err != nil {
+			log.Printf("Couldn't update sizes of video %s: %v", video.ID, err)
+		}
+	}
+
+	versions, err := cfg.db.GetVideoVersionsMissingSize()
+	if err != nil {
+		log.Printf("Couldn't load video versions missing sizes: %v", err)
+		return
+	}
+
+	for _, version := range versions {
+		size, err := cfg.getS3ObjectSize(ctx, version.VideoURL)
+		if err != nil {
+			log.Printf("Couldn't get size of video %s version %d: %v", version.VideoID, version.Version, err)
+			continue
+		}
+		err = cfg.db.UpdateVideoVersionSize(version.ID, size)
+		if err != nil {
+			log.Printf("Couldn't update size of video %s version %d: %v", version.VideoID, version.Version, err)
+		}
+	}
+}
+
+func (cfg *apiConfig) getS3ObjectSize(ctx context.Context, objectURL string) (int64, error) {
+	key, err := cfg.getS3KeyFromURL(objectURL)
+	if err != nil {
+		return 0, err
+	}
+
+	head, err := cfg.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return aws.ToInt64(head.ContentLength), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/aws/smithy-go"
+)
+
+// storageError is how an S3 failure is reported to API clients: a status
+// that says whose fault it was, a stable code to branch on, and a hint
+// for whoever has to fix it.
+type storageError struct {
+	status int
+	code   errorCode
+	hint   string
+}
+
+var (
+	storageAccessDenied = storageError{
+		status: http.StatusBadGateway,
+		code:   codeStorageAccessDenied,
+		hint:   "The storage bucket refused the server's credentials. The operator should check the IAM policy and keys for the bucket.",
+	}
+	storageThrottled = storageError{
+		status: http.StatusServiceUnavailable,
+		code:   codeStorageThrottled,
+		hint:   "Storage is rate limiting requests. Retry after the delay in Retry-After.",
+	}
+)
+
+// storageErrors maps S3 error codes, several codes can mean the same thing
+// to a client.
+var storageErrors = map[string]storageError{
+	"AccessDenied":          storageAccessDenied,
+	"AllAccessDisabled":     storageAccessDenied,
+	"InvalidAccessKeyId":    storageAccessDenied,
+	"SignatureDoesNotMatch": storageAccessDenied,
+	"ExpiredToken":          storageAccessDenied,
+	"NoSuchBucket": {
+		status: http.StatusBadGateway,
+		code:   codeStorageBucketMissing,
+		hint:   "The configured storage bucket doesn't exist. The operator should check S3_BUCKET and S3_REGION.",
+	},
+	"NoSuchKey": {
+		status: http.StatusNotFound,
+		code:   codeStorageObjectMissing,
+		hint:   "The file is gone from storage. Upload it again.",
+	},
+	"SlowDown":           storageThrottled,
+	"ServiceUnavailable": storageThrottled,
+	"Throttling":         storageThrottled,
+	"EntityTooLarge": {
+		status: http.StatusRequestEntityTooLarge,
+		code:   codeStorageEntityTooLarge,
+		hint:   "The file is larger than storage accepts in one object. Upload a smaller file.",
+	},
+	"RequestTimeout": {
+		status: http.StatusGatewayTimeout,
+		code:   codeStorageTimeout,
+		hint:   "Storage gave up waiting for the upload. Retry, on a faster connection if possible.",
+	},
+}
+
+// storageRetryAfter is the delay suggested to clients when storage throttles,
+// S3 asks to back off for about a second.
+const storageRetryAfter = "1"
+
+// respondWithStorageError reports err in detail if it came from S3, and as
+// a plain error with fallbackStatus otherwise.
+func respondWithStorageError(w http.ResponseWriter, fallbackStatus int, code errorCode, msg string, err error) {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		respondWithError(w, fallbackStatus, code, msg, err)
+		return
+	}
+	mapped, ok := storageErrors[apiErr.ErrorCode()]
+	if !ok {
+		respondWithError(w, fallbackStatus, code, msg, err)
+		return
+	}
+
+	log.Println(err)
+	if mapped.status > 499 {
+		log.Printf("Responding with 5XX error: %s (%s)", msg, mapped.code)
+	}
+	if mapped == storageThrottled {
+		w.Header().Set("Retry-After", storageRetryAfter)
+	}
+	type errorResponse struct {
+		Error string    `json:"error"`
+		Code  errorCode `json:"code"`
+		Hint  string    `json:"hint"`
+	}
+	localized := localizeError(w, code, msg)
+	hint := localizeError(w, mapped.code, mapped.hint)
+	if errorPrefsOf(w).problem {
+		respondWithProblem(w, mapped.status, mapped.code, localized, map[string]any{"hint": hint})
+		return
+	}
+	respondWithJSON(w, mapped.status, errorResponse{
+		Error: localized,
+		Code:  mapped.code,
+		Hint:  hint,
+	})
+}
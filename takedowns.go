@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// takedownTransitions lists, for each takedown status, the statuses a video
+// may move to it from. "" is a video that was never flagged. Only the owner
+// appeals, everything else is up to admins.
+var takedownTransitions = map[string][]string{
+	database.TakedownStatusFlagged:    {"", database.TakedownStatusReinstated},
+	database.TakedownStatusTakenDown:  {"", database.TakedownStatusFlagged, database.TakedownStatusReinstated},
+	database.TakedownStatusAppealed:   {database.TakedownStatusTakenDown},
+	database.TakedownStatusReinstated: {database.TakedownStatusFlagged, database.TakedownStatusTakenDown, database.TakedownStatusAppealed, database.TakedownStatusUpheld},
+	database.TakedownStatusUpheld:     {database.TakedownStatusAppealed},
+}
+
+// takedownHidesVideo reports whether videos in status are kept from
+// playback. Flagged videos stay up while they are reviewed.
+func takedownHidesVideo(status string) bool {
+	switch status {
+	case database.TakedownStatusTakenDown, database.TakedownStatusAppealed, database.TakedownStatusUpheld:
+		return true
+	}
+	return false
+}
+
+type takedownEvent struct {
+	VideoID uuid.UUID `json:"video_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	Status  string    `json:"status"`
+	Reason  string    `json:"reason"`
+}
+
+// transitionTakedown moves the video's takedown to status, records it in the
+// audit log and tells the owner through the event bus. It returns false if
+// the move isn't allowed from the video's current status.
+func (cfg *apiConfig) transitionTakedown(video database.Video, actor, status, reason string, appeal *string) (database.Takedown, bool, error) {
+	ok, err := cfg.db.SetTakedownStatus(video.ID, takedownTransitions[status], status, reason, appeal)
+	if err != nil || !ok {
+		return database.Takedown{}, false, err
+	}
+
+	takedown, err := cfg.db.GetTakedown(video.ID)
+	if err != nil {
+		return database.Takedown{}, false, err
+	}
+
+	cfg.recordAudit(actor, "takedown."+status, "video", video.ID.String(), map[string]any{
+		"reason": reason,
+		"appeal": appeal,
+	})
+	cfg.publishEvent(eventVideoTakedownUpdated, takedownEvent{
+		VideoID: video.ID,
+		UserID:  video.UserID,
+		Status:  takedown.Status,
+		Reason:  takedown.Reason,
+	})
+	return takedown, true, nil
+}
+
+// isTakenDown reports whether the video must be kept from playback.
+func (cfg *apiConfig) isTakenDown(videoID uuid.UUID) bool {
+	takedown, err := cfg.db.GetTakedown(videoID)
+	if err != nil {
+		// fail closed, a takedown may be a legal obligation
+		log.Printf("Couldn't get takedown status of video %s: %v", videoID, err)
+		return true
+	}
+	return takedownHidesVideo(takedown.Status)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// temp files older than this are left over from a previous run
+const staleTempFileAge = time.Hour
+
+var errInsufficientTempSpace = errors.New("not enough temporary storage available")
+
+type tempStore struct {
+	dir      string
+	maxBytes int64
+
+	mu   sync.Mutex
+	used int64
+}
+
+func newTempStore(dir string, maxBytes int64) (*tempStore, error) {
+	err := os.MkdirAll(dir, privateDirMode)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create temp dir: %w", err)
+	}
+
+	ts := &tempStore{
+		dir:      dir,
+		maxBytes: maxBytes,
+	}
+	ts.cleanStale()
+	return ts, nil
+}
+
+func (ts *tempStore) cleanStale() {
+	entries, err := os.ReadDir(ts.dir)
+	if err != nil {
+		log.Printf("Couldn't read temp dir %s: %v", ts.dir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < staleTempFileAge {
+			continue
+		}
+		path := filepath.Join(ts.dir, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("Couldn't remove stale temp file %s: %v", path, err)
+			continue
+		}
+		log.Printf("Removed stale temp file %s", path)
+	}
+}
+
+// reserve claims size bytes of temp storage, checking both the configured cap
+// and the free space on the underlying filesystem. The returned func must be
+// called once the temp files are removed.
+func (ts *tempStore) reserve(size int64) (func(), error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.maxBytes > 0 && ts.used+size > ts.maxBytes {
+		return nil, fmt.Errorf("%w: temp usage cap of %s reached", errInsufficientTempSpace, formatBytes(ts.maxBytes))
+	}
+
+	free, err := diskFreeBytes(ts.dir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't check free space in %s: %w", ts.dir, err)
+	}
+	if free >= 0 && free-ts.used < size {
+		return nil, fmt.Errorf("%w: %s free in %s", errInsufficientTempSpace, formatBytes(free), ts.dir)
+	}
+
+	ts.used += size
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ts.mu.Lock()
+			ts.used -= size
+			ts.mu.Unlock()
+		})
+	}, nil
+}
+
+func (ts *tempStore) createTemp(pattern string) (*os.File, error) {
+	return os.CreateTemp(ts.dir, pattern)
+}
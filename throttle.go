@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// largest read allowed between limiter waits, keeps the transfer rate smooth
+const throttleChunkSize = 32 << 10
+
+type rateLimiter struct {
+	rate  float64 // bytes per second
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// wait takes n tokens from the bucket, sleeping until they are paid for. The
+// balance may go negative so concurrent callers queue up fairly.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type userLimiter struct {
+	limiter *rateLimiter
+	active  int
+}
+
+// uploadThrottle limits upload bandwidth across all uploads and per user. A
+// zero limit disables that level of throttling.
+type uploadThrottle struct {
+	global    *rateLimiter
+	userLimit int64
+
+	mu    sync.Mutex
+	users map[uuid.UUID]*userLimiter
+}
+
+func newUploadThrottle(globalLimit, userLimit int64) *uploadThrottle {
+	t := &uploadThrottle{
+		userLimit: userLimit,
+		users:     map[uuid.UUID]*userLimiter{},
+	}
+	if globalLimit > 0 {
+		t.global = newRateLimiter(globalLimit)
+	}
+	return t
+}
+
+// wrap returns body rate limited for userID. Closing the returned reader
+// releases the user's limiter.
+func (t *uploadThrottle) wrap(ctx context.Context, userID uuid.UUID, body io.ReadCloser) io.ReadCloser {
+	var limiters []*rateLimiter
+	if t.global != nil {
+		limiters = append(limiters, t.global)
+	}
+
+	release := func() {}
+	if t.userLimit > 0 {
+		t.mu.Lock()
+		ul, ok := t.users[userID]
+		if !ok {
+			ul = &userLimiter{limiter: newRateLimiter(t.userLimit)}
+			t.users[userID] = ul
+		}
+		ul.active++
+		t.mu.Unlock()
+
+		limiters = append(limiters, ul.limiter)
+		var once sync.Once
+		release = func() {
+			once.Do(func() {
+				t.mu.Lock()
+				ul.active--
+				if ul.active == 0 {
+					delete(t.users, userID)
+				}
+				t.mu.Unlock()
+			})
+		}
+	}
+
+	if len(limiters) == 0 {
+		return body
+	}
+
+	return &throttledReader{
+		ctx:      ctx,
+		body:     body,
+		limiters: limiters,
+		release:  release,
+	}
+}
+
+type throttledReader struct {
+	ctx      context.Context
+	body     io.ReadCloser
+	limiters []*rateLimiter
+	release  func()
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+
+	n, err := tr.body.Read(p)
+	if n > 0 {
+		for _, l := range tr.limiters {
+			if werr := l.wait(tr.ctx, n); werr != nil {
+				return n, werr
+			}
+		}
+	}
+	return n, err
+}
+
+func (tr *throttledReader) Close() error {
+	tr.release()
+	return tr.body.Close()
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultThumbnailExperimentInterval = 10 * time.Minute
+	// impressions an experiment collects before a winner is picked
+	defaultThumbnailExperimentSample = 1000
+	minThumbnailExperimentSample     = 100
+	maxThumbnailExperimentSample     = 1_000_000
+)
+
+func (cfg *apiConfig) startThumbnailExperiments(interval time.Duration) {
+	cfg.startScheduledTask("thumbnail_experiments", interval, cfg.concludeThumbnailExperiments)
+}
+
+// concludeThumbnailExperiments picks the winners of experiments that have
+// collected their sample. Experiments of videos that are gone or expired
+// are stopped.
+func (cfg *apiConfig) concludeThumbnailExperiments(ctx context.Context) {
+	experiments, err := cfg.db.GetAllRunningThumbnailExperiments()
+	if err != nil {
+		log.Printf("Couldn't load thumbnail experiments: %v", err)
+		return
+	}
+
+	for _, experiment := range experiments {
+		if ctx.Err() != nil {
+			return
+		}
+		video, err := cfg.db.GetVideo(experiment.VideoID)
+		if err != nil {
+			log.Printf("Couldn't get video %s of thumbnail experiment %s: %v", experiment.VideoID, experiment.ID, err)
+			continue
+		}
+		if video.ID == uuid.Nil || video.ExpiredAt != nil {
+			err := cfg.db.FinishThumbnailExperiment(experiment, video, database.ThumbnailExperimentStopped, nil)
+			if err != nil {
+				log.Printf("Couldn't stop thumbnail experiment %s: %v", experiment.ID, err)
+			}
+			continue
+		}
+		if experiment.A.Impressions+experiment.B.Impressions < experiment.SampleSize {
+			continue
+		}
+
+		winner := thumbnailExperimentWinner(experiment)
+		err = cfg.db.FinishThumbnailExperiment(experiment, video, database.ThumbnailExperimentCompleted, &winner)
+		if err != nil {
+			log.Printf("Couldn't conclude thumbnail experiment %s: %v", experiment.ID, err)
+			continue
+		}
+		if winner == "b" {
+			if updated, err := cfg.db.GetVideo(video.ID); err == nil {
+				cfg.publishEvent(eventVideoThumbnailUpdated, updated)
+			}
+		}
+	}
+}
+
+// thumbnailExperimentWinner is the variant with more clicks per impression.
+// B has to do better to win, on a tie the video keeps its thumbnail.
+func thumbnailExperimentWinner(experiment database.ThumbnailExperiment) string {
+	if clickRate(experiment.B) > clickRate(experiment.A) {
+		return "b"
+	}
+	return "a"
+}
+
+func clickRate(stats database.ThumbnailVariantStats) float64 {
+	if stats.Impressions == 0 {
+		return 0
+	}
+	return float64(stats.Clicks) / float64(stats.Impressions)
+}
+
+// thumbnailVariant is the variant of an experiment the requester sees. It
+// only depends on who is asking, so a viewer keeps seeing the same one and
+// opening the video is credited to it.
+func thumbnailVariant(r *http.Request, experimentID uuid.UUID) string {
+	sum := sha256.Sum256([]byte(experimentID.String() + "|" + clientIP(r) + "|" + r.UserAgent()))
+	if sum[0]&1 == 1 {
+		return "b"
+	}
+	return "a"
+}
+
+func withThumbnailVariant(video database.Video, experiment database.ThumbnailExperiment, variant string) database.Video {
+	if variant != "b" {
+		return video
+	}
+	video.ThumbnailURL = &experiment.ThumbnailURL
+	video.ThumbnailSize = experiment.ThumbnailSize
+	video.ThumbnailFocus = nil
+	video.ThumbnailAltText = experiment.AltText
+	return video
+}
+
+// withThumbnailExperiments gives the videos under test in a listing the
+// requester's variant of their thumbnail, and counts an impression of it.
+func (cfg *apiConfig) withThumbnailExperiments(r *http.Request, videos []database.Video) []database.Video {
+	ids := make([]uuid.UUID, 0, len(videos))
+	for _, video := range videos {
+		ids = append(ids, video.ID)
+	}
+	running, err := cfg.db.GetRunningThumbnailExperiments(ids)
+	if err != nil {
+		log.Printf("Couldn't load thumbnail experiments: %v", err)
+		return videos
+	}
+	if len(running) == 0 {
+		return videos
+	}
+
+	shown := make([]database.Video, len(videos))
+	impressions := map[uuid.UUID]string{}
+	for i, video := range videos {
+		shown[i] = video
+		experiment, ok := running[video.ID]
+		if !ok {
+			continue
+		}
+		variant := thumbnailVariant(r, experiment.ID)
+		shown[i] = withThumbnailVariant(video, experiment, variant)
+		impressions[experiment.ID] = variant
+	}
+	if err := cfg.db.RecordThumbnailImpressions(impressions); err != nil {
+		log.Printf("Couldn't record thumbnail impressions: %v", err)
+	}
+	return shown
+}
+
+// thumbnailClick is a viewer opening a video under test, credited to the
+// variant they were shown.
+type thumbnailClick struct {
+	experimentID uuid.UUID
+	variant      string
+}
+
+// viewerThumbnail gives a video under test the requester's variant of its
+// thumbnail. The click is only recorded with recordThumbnailClick, once
+// the video is actually served.
+func (cfg *apiConfig) viewerThumbnail(r *http.Request, video database.Video) (database.Video, *thumbnailClick) {
+	running, err := cfg.db.GetRunningThumbnailExperiments([]uuid.UUID{video.ID})
+	if err != nil {
+		log.Printf("Couldn't load thumbnail experiment of video %s: %v", video.ID, err)
+		return video, nil
+	}
+	experiment, ok := running[video.ID]
+	if !ok {
+		return video, nil
+	}
+	variant := thumbnailVariant(r, experiment.ID)
+	return withThumbnailVariant(video, experiment, variant), &thumbnailClick{experimentID: experiment.ID, variant: variant}
+}
+
+func (cfg *apiConfig) recordThumbnailClick(click *thumbnailClick) {
+	if click == nil {
+		return
+	}
+	if err := cfg.db.RecordThumbnailClick(click.experimentID, click.variant); err != nil {
+		log.Printf("Couldn't record thumbnail click for experiment %s: %v", click.experimentID, err)
+	}
+}
+
+// handlerThumbnailExperimentCreate starts testing another thumbnail against
+// the video's own. The thumbnail under test is sent like to
+// handlerUploadThumbnail, sample_size sets how many impressions are
+// collected before the winner is picked.
+func (cfg *apiConfig) handlerThumbnailExperimentCreate(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+	userID := requestUserID(r)
+
+	r.Body = http.MaxBytesReader(w, cfg.uploads.track(r, "thumbnail", videoID, userID), maxMemory)
+	err = r.ParseMultipartForm(maxMemory)
+	if err != nil {
+		respondWithFormError(w, err)
+		return
+	}
+	registerRequestCleanup(r, func() { r.MultipartForm.RemoveAll() })
+
+	thumbnail, header, err := r.FormFile("thumbnail")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeMissingThumbnailFile, "Missing thumbnail file", err)
+		return
+	}
+	defer thumbnail.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	if !isThumbnailType(mediaType) {
+		respondWithError(w, http.StatusUnsupportedMediaType, codeWrongImageTypeForThumbnail, "wrong image type for thumbnail", nil)
+		return
+	}
+
+	var errs []fieldError
+	altText := r.FormValue("alt_text")
+	if msg := validateAltText(altText); msg != "" {
+		errs = append(errs, fieldError{Field: "alt_text", Message: msg})
+	}
+	sampleSize := defaultThumbnailExperimentSample
+	if v := r.FormValue("sample_size"); v != "" {
+		sampleSize, err = strconv.Atoi(v)
+		if err != nil || sampleSize < minThumbnailExperimentSample || sampleSize > maxThumbnailExperimentSample {
+			errs = append(errs, fieldError{Field: "sample_size", Message: fmt.Sprintf("must be between %d and %d", minThumbnailExperimentSample, maxThumbnailExperimentSample)})
+		}
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, codeInvalidThumbnailExperiment, "Invalid thumbnail experiment", errs)
+		return
+	}
+
+	video, err := cfg.authorizeVideoAccess(videoID, userID)
+	if err != nil {
+		respondWithVideoAccessError(w, err, "test thumbnails of this video")
+		return
+	}
+	if video.ExpiredAt != nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasExpired, "Video has expired", nil)
+		return
+	}
+	// the placeholder isn't worth testing against
+	if video.ThumbnailURL == nil {
+		respondWithError(w, http.StatusConflict, codeVideoNeedsAThumbnailToTestAgainst, "Video needs a thumbnail to test against", nil)
+		return
+	}
+
+	hookEvent := uploadEvent{
+		Kind:        "thumbnail",
+		VideoID:     videoID,
+		UserID:      userID,
+		Title:       video.Title,
+		Filename:    header.Filename,
+		ContentType: mediaType,
+		Size:        header.Size,
+	}
+	err = cfg.runPreUploadHooks(r.Context(), hookEvent)
+	if err != nil {
+		respondWithHookError(w, err)
+		return
+	}
+
+	thumbnailURL, thumbnailSize, err := cfg.saveThumbnail(r, mediaType, thumbnail)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeErrorSavingFile, "Error saving file", err)
+		return
+	}
+	experiment, err := cfg.db.CreateThumbnailExperiment(database.CreateThumbnailExperimentParams{
+		VideoID:       videoID,
+		SampleSize:    sampleSize,
+		ThumbnailURL:  thumbnailURL,
+		ThumbnailSize: &thumbnailSize,
+		AltText:       altText,
+	})
+	if err != nil {
+		cfg.removeThumbnail(thumbnailURL)
+		if errors.Is(err, database.ErrThumbnailExperimentRunning) {
+			respondWithError(w, http.StatusConflict, codeVideoAlreadyHasAThumbnailExperimentRunning, "Video already has a thumbnail experiment running", err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, codeCouldntCreateThumbnailExperiment, "Couldn't create thumbnail experiment", err)
+		return
+	}
+
+	hookEvent.Size = thumbnailSize
+	hookEvent.URL = thumbnailURL
+	cfg.runPostUploadHooks(hookEvent)
+
+	experiment.ThumbnailURL = cfg.stampThumbnailURL(experiment.ThumbnailURL, nil)
+	respondWithJSON(w, http.StatusCreated, experiment)
+}
+
+func (cfg *apiConfig) handlerThumbnailExperimentsList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.ownedVideo(w, r, "view thumbnail experiments")
+	if !ok {
+		return
+	}
+
+	experiments, err := cfg.db.GetThumbnailExperiments(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveThumbnailExperiments, "Couldn't retrieve thumbnail experiments", err)
+		return
+	}
+	for i := range experiments {
+		experiments[i].ThumbnailURL = cfg.stampThumbnailURL(experiments[i].ThumbnailURL, nil)
+	}
+	respondWithJSON(w, http.StatusOK, experiments)
+}
+
+// handlerThumbnailExperimentStop ends an experiment early, the video keeps
+// its thumbnail.
+func (cfg *apiConfig) handlerThumbnailExperimentStop(w http.ResponseWriter, r *http.Request) {
+	experimentID, err := uuid.Parse(r.PathValue("experimentID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidExperimentID, "Invalid experiment ID", err)
+		return
+	}
+	video, ok := cfg.ownedVideo(w, r, "stop thumbnail experiments")
+	if !ok {
+		return
+	}
+
+	experiment, err := cfg.db.GetThumbnailExperiment(experimentID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetThumbnailExperiment, "Couldn't get thumbnail experiment", err)
+		return
+	}
+	if experiment.ID == uuid.Nil || experiment.VideoID != video.ID {
+		respondWithError(w, http.StatusNotFound, codeThumbnailExperimentNotFound, "Thumbnail experiment not found", nil)
+		return
+	}
+	if experiment.Status != database.ThumbnailExperimentRunning {
+		respondWithError(w, http.StatusConflict, codeThumbnailExperimentHasAlreadyEnded, "Thumbnail experiment has already ended", nil)
+		return
+	}
+
+	err = cfg.db.FinishThumbnailExperiment(experiment, video, database.ThumbnailExperimentStopped, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntStopThumbnailExperiment, "Couldn't stop thumbnail experiment", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
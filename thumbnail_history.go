@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultThumbnailGCInterval = time.Hour
+	// how many replaced thumbnails a video keeps to revert to
+	maxThumbnailHistory = 10
+	thumbnailGCBatch    = 100
+)
+
+func (cfg *apiConfig) startThumbnailGC(interval time.Duration) {
+	cfg.startScheduledTask("thumbnail_gc", interval, cfg.purgeThumbnails)
+}
+
+// purgeThumbnails deletes the files of thumbnails that fell out of their
+// video's history, or whose video is gone.
+func (cfg *apiConfig) purgeThumbnails(ctx context.Context) {
+	for {
+		entries, err := cfg.db.GetPurgeableThumbnails(maxThumbnailHistory, thumbnailGCBatch)
+		if err != nil {
+			log.Printf("Couldn't load purgeable thumbnails: %v", err)
+			return
+		}
+
+		purged := 0
+		for _, entry := range entries {
+			if err := cfg.removeThumbnail(entry.ThumbnailURL); err != nil {
+				log.Printf("Couldn't delete old thumbnail %s of video %s: %v", entry.ThumbnailURL, entry.VideoID, err)
+				continue
+			}
+			if err := cfg.db.DeleteThumbnailHistoryEntry(entry.ID); err != nil {
+				log.Printf("Couldn't delete thumbnail history entry %s: %v", entry.ID, err)
+				continue
+			}
+			purged++
+		}
+		// stop rather than spin on entries that keep failing
+		if len(entries) < thumbnailGCBatch || purged == 0 {
+			return
+		}
+	}
+}
+
+// retireThumbnail keeps the thumbnail old had in its history once the video
+// points at a new one. The file stays until the thumbnail GC purges it.
+func (cfg *apiConfig) retireThumbnail(old database.Video) {
+	if old.ThumbnailURL == nil {
+		return
+	}
+	err := cfg.db.AddThumbnailHistory(old)
+	if err == nil {
+		return
+	}
+	log.Printf("Couldn't keep old thumbnail of video %s: %v", old.ID, err)
+	if err := cfg.removeThumbnail(*old.ThumbnailURL); err != nil {
+		log.Printf("Couldn't remove old thumbnail of video %s: %v", old.ID, err)
+	}
+}
+
+func (cfg *apiConfig) handlerThumbnailHistoryList(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Current *string                          `json:"current"`
+		History []database.ThumbnailHistoryEntry `json:"history"`
+	}
+
+	video, ok := cfg.ownedVideo(w, r, "view thumbnails")
+	if !ok {
+		return
+	}
+
+	history, err := cfg.db.GetThumbnailHistory(video.ID, maxThumbnailHistory)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveThumbnailHistory, "Couldn't retrieve thumbnail history", err)
+		return
+	}
+	for i := range history {
+		history[i].ThumbnailURL = cfg.stampThumbnailURL(history[i].ThumbnailURL, history[i].Focus)
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Current: cfg.stampAssetURLs(video).ThumbnailURL,
+		History: history,
+	})
+}
+
+func (cfg *apiConfig) handlerThumbnailRevert(w http.ResponseWriter, r *http.Request) {
+	thumbnailID, err := uuid.Parse(r.PathValue("thumbnailID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidThumbnailID, "Invalid thumbnail ID", err)
+		return
+	}
+
+	video, ok := cfg.ownedVideo(w, r, "revert the thumbnail")
+	if !ok {
+		return
+	}
+	if video.ExpiredAt != nil {
+		respondWithError(w, http.StatusConflict, codeVideoHasExpired, "Video has expired", nil)
+		return
+	}
+
+	// entries past the history's bound are waiting for the GC
+	history, err := cfg.db.GetThumbnailHistory(video.ID, maxThumbnailHistory)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveThumbnailHistory, "Couldn't retrieve thumbnail history", err)
+		return
+	}
+	var entry *database.ThumbnailHistoryEntry
+	for i := range history {
+		if history[i].ID == thumbnailID {
+			entry = &history[i]
+		}
+	}
+	if entry == nil {
+		respondWithError(w, http.StatusNotFound, codeThumbnailNotFound, "Thumbnail not found", nil)
+		return
+	}
+
+	err = cfg.db.RevertThumbnail(video, *entry)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRevertThumbnail, "Couldn't revert thumbnail", err)
+		return
+	}
+	video.ThumbnailURL = &entry.ThumbnailURL
+	video.ThumbnailSize = entry.ThumbnailSize
+
+	cfg.publishEvent(eventVideoThumbnailUpdated, video)
+
+	respondWithJSON(w, http.StatusOK, cfg.stampAssetURLs(video))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// frameThumbnailWidth caps the width of thumbnails taken from a video's
+// first frame, smaller sizes come from the asset variants.
+const frameThumbnailWidth = 1280
+
+const placeholderSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="1280" height="720" viewBox="0 0 1280 720">
+<rect width="1280" height="720" fill="%s"/>
+<text x="640" y="360" dominant-baseline="central" text-anchor="middle" font-family="sans-serif" font-size="280" font-weight="bold" fill="#ffffff">%s</text>
+</svg>
+`
+
+// placeholderThumbnailURL points at the placeholder for a video without a
+// thumbnail. It only depends on the video's ID and title, so clients can
+// cache it.
+func placeholderThumbnailURL(video database.Video) string {
+	q := url.Values{}
+	q.Set("seed", video.ID.String())
+	if initials := titleInitials(video.Title); initials != "" {
+		q.Set("text", initials)
+	}
+	return "/api/thumbnails/placeholder.svg?" + q.Encode()
+}
+
+// titleInitials returns the first letter or digit of the title's first two
+// words, upper-cased.
+func titleInitials(title string) string {
+	var initials []rune
+	for _, word := range strings.Fields(title) {
+		for _, c := range word {
+			if unicode.IsLetter(c) || unicode.IsDigit(c) {
+				initials = append(initials, unicode.ToUpper(c))
+				break
+			}
+		}
+		if len(initials) == 2 {
+			break
+		}
+	}
+	return string(initials)
+}
+
+// placeholderColor picks a background for seed that stays the same across
+// requests, from a fixed lightness so the white text stays readable.
+func placeholderColor(seed string) string {
+	h := fnv.New32a()
+	h.Write([]byte(seed))
+	return fmt.Sprintf("hsl(%d, 55%%, 40%%)", h.Sum32()%360)
+}
+
+// handlerPlaceholderThumbnail renders a solid color with up to two
+// characters on it. Nothing is looked up, the same query always gives the
+// same image.
+func (cfg *apiConfig) handlerPlaceholderThumbnail(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	text := []rune(q.Get("text"))
+	if len(text) > 2 {
+		text = text[:2]
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	fmt.Fprintf(w, placeholderSVG, placeholderColor(q.Get("seed")), html.EscapeString(string(text)))
+}
+
+// withPlaceholderThumbnail fills in the placeholder when the video has no
+// thumbnail of its own.
+func withPlaceholderThumbnail(video database.Video) database.Video {
+	if video.ThumbnailURL == nil {
+		placeholderURL := placeholderThumbnailURL(video)
+		video.ThumbnailURL = &placeholderURL
+	}
+	return video
+}
+
+// saveFrameThumbnail stores the first frame of the video at path as a
+// thumbnail and returns its URL and size. It runs outside of requests, so
+// without ASSET_BASE_URL the URL is relative to the site.
+func (cfg *apiConfig) saveFrameThumbnail(path string) (string, int64, error) {
+	randomBase64String, err := makeRandomID()
+	if err != nil {
+		return "", 0, fmt.Errorf("couldn't create thumbnail random ID: %w", err)
+	}
+	assetPath := getAssetPath(randomBase64String, "image/jpeg")
+	assetDiskPath := cfg.getAssetDiskPath(assetPath)
+
+	opts := resizeOptions{width: frameThumbnailWidth, fit: "contain", noUpscale: true}
+	err = transformImage(cfg.commands, path, assetDiskPath, opts, "")
+	if err != nil {
+		os.Remove(assetDiskPath)
+		return "", 0, err
+	}
+	info, err := os.Stat(assetDiskPath)
+	if err != nil {
+		os.Remove(assetDiskPath)
+		return "", 0, err
+	}
+
+	thumbnailURL := "/assets/" + assetPath
+	if cfg.assetBaseURL != "" {
+		thumbnailURL = strings.TrimSuffix(cfg.assetBaseURL, "/") + "/" + assetPath
+	}
+	return thumbnailURL, info.Size(), nil
+}
+
+// addFrameThumbnail gives a video without a thumbnail its first frame as
+// one. Failing to is only logged, the placeholder stands in.
+func (cfg *apiConfig) addFrameThumbnail(video *database.Video, path string) {
+	if video.ThumbnailURL != nil {
+		return
+	}
+	thumbnailURL, size, err := cfg.saveFrameThumbnail(path)
+	if err != nil {
+		log.Printf("Couldn't take a thumbnail from video %s: %v", video.ID, err)
+		return
+	}
+	video.ThumbnailURL = &thumbnailURL
+	video.ThumbnailSize = &size
+	video.ThumbnailFocus = nil
+	video.ThumbnailAltText = ""
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	// the whole request or response, sized for multi-gigabyte uploads and
+	// streams over slow connections
+	defaultReadTimeout    = time.Hour
+	defaultWriteTimeout   = time.Hour
+	defaultIdleTimeout    = 2 * time.Minute
+	defaultAPITimeout     = 30 * time.Second
+	defaultSlowRequest    = 2 * time.Second
+	defaultSlowLongRunner = 5 * time.Minute
+)
+
+// longRunningRoutes move media and aren't bound by the API timeout. They
+// are logged as slow against their own threshold. API routes are added by
+// registerRoutes from their longRunning flag.
+var longRunningRoutes = map[string]bool{
+	"/assets/": true,
+}
+
+type httpTimeouts struct {
+	// connection level, set on the http.Server
+	readHeader time.Duration
+	read       time.Duration
+	write      time.Duration
+	idle       time.Duration
+
+	// per request: the API timeout applies to /api/ routes that aren't
+	// long-running, zero turns it off
+	api         time.Duration
+	slow        time.Duration
+	slowLongRun time.Duration
+}
+
+func httpTimeoutsFromEnv() (httpTimeouts, error) {
+	t := httpTimeouts{
+		readHeader:  defaultReadHeaderTimeout,
+		read:        defaultReadTimeout,
+		write:       defaultWriteTimeout,
+		idle:        defaultIdleTimeout,
+		api:         defaultAPITimeout,
+		slow:        defaultSlowRequest,
+		slowLongRun: defaultSlowLongRunner,
+	}
+	for _, setting := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"HTTP_READ_HEADER_TIMEOUT", &t.readHeader},
+		{"HTTP_READ_TIMEOUT", &t.read},
+		{"HTTP_WRITE_TIMEOUT", &t.write},
+		{"HTTP_IDLE_TIMEOUT", &t.idle},
+		{"API_TIMEOUT", &t.api},
+		{"SLOW_REQUEST_THRESHOLD", &t.slow},
+		{"SLOW_UPLOAD_THRESHOLD", &t.slowLongRun},
+	} {
+		v := os.Getenv(setting.name)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return httpTimeouts{}, fmt.Errorf("invalid %s %q", setting.name, v)
+		}
+		*setting.dst = d
+	}
+	return t, nil
+}
+
+func (t httpTimeouts) apply(srv *http.Server) {
+	srv.ReadHeaderTimeout = t.readHeader
+	srv.ReadTimeout = t.read
+	srv.WriteTimeout = t.write
+	srv.IdleTimeout = t.idle
+}
+
+// timeoutMiddleware cuts off API requests that take longer than the API
+// timeout with a 503, and logs requests that were slower than their
+// threshold. Routes are looked up in mux so uploads and streams can be told
+// apart from regular API calls. Errors are localized inside the timeout,
+// the timeout's own response is always in English.
+func timeoutMiddleware(t httpTimeouts, mux *http.ServeMux) http.Handler {
+	localized := errorNegotiationMiddleware(requestValidationMiddleware(mux, mux))
+	limited := localized
+	if t.api > 0 {
+		limited = http.TimeoutHandler(localized, t.api, `{"error":"Request timed out","code":"request_timed_out"}`)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		longRunning := longRunningRoutes[pattern]
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		start := time.Now()
+		if longRunning || !strings.HasPrefix(r.URL.Path, "/api/") {
+			localized.ServeHTTP(rw, r)
+		} else {
+			limited.ServeHTTP(rw, r)
+		}
+		elapsed := time.Since(start)
+
+		threshold := t.slow
+		if longRunning {
+			threshold = t.slowLongRun
+		}
+		if threshold > 0 && elapsed > threshold {
+			log.Printf("Slow request %s %s (request %s): %d after %v", r.Method, r.URL.Path, requestID(r), rw.status, elapsed.Round(time.Millisecond))
+		}
+	})
+}
+
+// statusRecorder remembers the response status for logging. The timeout
+// response is the only one written without a Content-Type, it's marked as
+// JSON like every other error.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	if code == http.StatusServiceUnavailable && s.Header().Get("Content-Type") == "" {
+		s.Header().Set("Content-Type", "application/json")
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Flush() {
+	http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
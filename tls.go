@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+type tlsSettings struct {
+	certFile         string
+	keyFile          string
+	autocertDomains  []string
+	autocertCacheDir string
+	autocertEmail    string
+	// plain HTTP listener that redirects to HTTPS and answers ACME challenges
+	redirectAddr string
+}
+
+func tlsSettingsFromEnv() tlsSettings {
+	s := tlsSettings{
+		certFile:         os.Getenv("TLS_CERT_FILE"),
+		keyFile:          os.Getenv("TLS_KEY_FILE"),
+		autocertCacheDir: os.Getenv("TLS_AUTOCERT_CACHE"),
+		autocertEmail:    os.Getenv("TLS_AUTOCERT_EMAIL"),
+		redirectAddr:     os.Getenv("TLS_REDIRECT_ADDR"),
+	}
+	for _, domain := range strings.Split(os.Getenv("TLS_AUTOCERT_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			s.autocertDomains = append(s.autocertDomains, domain)
+		}
+	}
+	if s.autocertCacheDir == "" {
+		s.autocertCacheDir = "./certs"
+	}
+	// Let's Encrypt HTTP-01 challenges always arrive on port 80
+	if s.redirectAddr == "" && len(s.autocertDomains) > 0 {
+		s.redirectAddr = ":80"
+	}
+	return s
+}
+
+func (s tlsSettings) enabled() bool {
+	return s.certFile != "" || len(s.autocertDomains) > 0
+}
+
+func (s tlsSettings) validate() error {
+	if (s.certFile == "") != (s.keyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if s.certFile != "" && len(s.autocertDomains) > 0 {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS are mutually exclusive")
+	}
+	return nil
+}
+
+// serveTLS serves srv over HTTPS with HTTP/2 enabled, using either static
+// certificates or certificates obtained from Let's Encrypt.
+func serveTLS(srv *http.Server, s tlsSettings) error {
+	var redirect http.Handler = http.HandlerFunc(redirectToHTTPS(srv.Addr))
+
+	if len(s.autocertDomains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(s.autocertCacheDir),
+			HostPolicy: autocert.HostWhitelist(s.autocertDomains...),
+			Email:      s.autocertEmail,
+		}
+		srv.TLSConfig = m.TLSConfig()
+		redirect = m.HTTPHandler(redirect)
+	} else {
+		srv.TLSConfig = &tls.Config{
+			NextProtos: []string{"h2", "http/1.1"},
+		}
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+
+	if s.redirectAddr != "" {
+		go func() {
+			log.Printf("Redirecting HTTP on %s to HTTPS", s.redirectAddr)
+			redirectSrv := &http.Server{
+				Addr:    s.redirectAddr,
+				Handler: redirect,
+			}
+			log.Fatal(redirectSrv.ListenAndServe())
+		}()
+	}
+
+	return srv.ListenAndServeTLS(s.certFile, s.keyFile)
+}
+
+func redirectToHTTPS(tlsAddr string) http.HandlerFunc {
+	_, tlsPort, _ := net.SplitHostPort(tlsAddr)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/mediaconvert"
+	mctypes "github.com/aws/aws-sdk-go-v2/service/mediaconvert/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// files below this size are always processed locally, the remote job
+	// overhead isn't worth it
+	defaultRemoteTranscodeMinSize = 200 << 20
+	mediaConvertPollInterval      = 5 * time.Second
+)
+
+type transcodeJob struct {
+	videoID     uuid.UUID
+	sourcePath  string
+	sourceSize  int64
+	contentType string
+	fastStart   bool
+	// where the result should end up, backends may append an extension
+	destKey string
+	// encrypts the result with SSE-C when set
+	encryptionKey *customerKey
+	// re-encodes the upload when set, otherwise it is only remuxed
+	profile *database.EncodingProfile
+}
+
+type transcodeResult struct {
+	key  string
+	size int64
+	// hex SHA-256 of the stored object, empty when the backend can't tell
+	sha256 string
+	etag   string
+}
+
+// transcoder turns an uploaded source file into the object that gets served,
+// storing it in S3.
+type transcoder interface {
+	Transcode(ctx context.Context, job transcodeJob) (transcodeResult, error)
+}
+
+// transcodeVideo picks the remote transcoder for large files when one is
+// configured and the local one otherwise. Encrypted videos always stay
+// local, MediaConvert can't write SSE-C objects and the key must not leave
+// this server. So do uploads with an encoding profile, which only ffmpeg
+// applies. It also returns how long the work took for cost accounting.
+func (cfg *apiConfig) transcodeVideo(ctx context.Context, job transcodeJob) (transcodeResult, time.Duration, error) {
+	var t transcoder = localTranscoder{s3Client: cfg.s3Client, bucket: cfg.s3Bucket, commands: cfg.commands}
+	if cfg.remoteTranscoder != nil && job.encryptionKey == nil && job.profile == nil && job.sourceSize >= cfg.remoteTranscodeMinSize {
+		t = cfg.remoteTranscoder
+	}
+
+	start := time.Now()
+	result, err := t.Transcode(ctx, job)
+	return result, time.Since(start), err
+}
+
+// localTranscoder remuxes with ffmpeg on this machine and uploads the result.
+type localTranscoder struct {
+	s3Client *s3.Client
+	bucket   string
+	commands commandRunner
+}
+
+func (t localTranscoder) Transcode(ctx context.Context, job transcodeJob) (transcodeResult, error) {
+	path := job.sourcePath
+	switch {
+	case job.profile != nil:
+		// the encode places the moov atom up front as well
+		encodedPath, err := encodeWithProfile(ctx, t.commands, job.sourcePath, *job.profile)
+		if err != nil {
+			return transcodeResult{}, err
+		}
+		defer os.Remove(encodedPath)
+		path = encodedPath
+	case job.fastStart:
+		fastStartPath, err := processVideoForFastStart(ctx, t.commands, job.sourcePath)
+		if err != nil {
+			return transcodeResult{}, err
+		}
+		defer os.Remove(fastStartPath)
+		path = fastStartPath
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return transcodeResult{}, fmt.Errorf("couldn't open processed file: %w", err)
+	}
+	defer file.Close()
+	// the file is deleted right after, don't let it crowd the page cache
+	defer adviseDontNeed(file)
+
+	if err := adviseSequential(file); err != nil {
+		log.Printf("Couldn't set access hint on processed file: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return transcodeResult{}, fmt.Errorf("couldn't stat processed file: %w", err)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return transcodeResult{}, fmt.Errorf("couldn't hash processed file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return transcodeResult{}, fmt.Errorf("couldn't rewind processed file: %w", err)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(t.bucket),
+		Key:         aws.String(job.destKey),
+		Body:        file,
+		ContentType: aws.String(job.contentType),
+		// S3 verifies the upload against it and keeps it for later checks
+		ChecksumAlgorithm: s3types.ChecksumAlgorithmSha256,
+	}
+	job.encryptionKey.applyToPut(input)
+
+	uploader := manager.NewUploader(t.s3Client)
+	out, err := uploader.Upload(ctx, input)
+	if err != nil {
+		return transcodeResult{}, fmt.Errorf("couldn't upload video: %w", err)
+	}
+
+	return transcodeResult{
+		key:    job.destKey,
+		size:   info.Size(),
+		sha256: hex.EncodeToString(hash.Sum(nil)),
+		etag:   aws.ToString(out.ETag),
+	}, nil
+}
+
+// mediaConvertTranscoder hands the work to AWS Elemental MediaConvert. The
+// source is staged in the bucket, the job is polled until it finishes and the
+// output is written straight to the destination key.
+type mediaConvertTranscoder struct {
+	client   *mediaconvert.Client
+	s3Client *s3.Client
+	bucket   string
+	roleARN  string
+	queue    string
+}
+
+func (t mediaConvertTranscoder) Transcode(ctx context.Context, job transcodeJob) (transcodeResult, error) {
+	inputKey := fmt.Sprintf("transcode-input/%s.mp4", uuid.New())
+
+	file, err := os.Open(job.sourcePath)
+	if err != nil {
+		return transcodeResult{}, err
+	}
+	defer file.Close()
+
+	uploader := manager.NewUploader(t.s3Client)
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(t.bucket),
+		Key:         aws.String(inputKey),
+		Body:        file,
+		ContentType: aws.String(job.contentType),
+	})
+	if err != nil {
+		return transcodeResult{}, fmt.Errorf("couldn't stage transcode input: %w", err)
+	}
+	defer func() {
+		_, err := t.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String(t.bucket),
+			Key:    aws.String(inputKey),
+		})
+		if err != nil {
+			log.Printf("Couldn't delete transcode input %s: %v", inputKey, err)
+		}
+	}()
+
+	// MediaConvert names the output after the destination plus the extension
+	destBase := strings.TrimSuffix(job.destKey, ".mp4")
+	input := &mediaconvert.CreateJobInput{
+		Role: aws.String(t.roleARN),
+		Settings: &mctypes.JobSettings{
+			Inputs: []mctypes.Input{{
+				FileInput: aws.String(fmt.Sprintf("s3://%s/%s", t.bucket, inputKey)),
+				AudioSelectors: map[string]mctypes.AudioSelector{
+					"Audio Selector 1": {DefaultSelection: mctypes.AudioDefaultSelectionDefault},
+				},
+			}},
+			OutputGroups: []mctypes.OutputGroup{{
+				OutputGroupSettings: &mctypes.OutputGroupSettings{
+					Type: mctypes.OutputGroupTypeFileGroupSettings,
+					FileGroupSettings: &mctypes.FileGroupSettings{
+						Destination: aws.String(fmt.Sprintf("s3://%s/%s", t.bucket, destBase)),
+					},
+				},
+				Outputs: []mctypes.Output{{
+					ContainerSettings: &mctypes.ContainerSettings{
+						Container: mctypes.ContainerTypeMp4,
+						Mp4Settings: &mctypes.Mp4Settings{
+							MoovPlacement: mctypes.Mp4MoovPlacementProgressiveDownload,
+						},
+					},
+					VideoDescription: &mctypes.VideoDescription{
+						CodecSettings: &mctypes.VideoCodecSettings{
+							Codec: mctypes.VideoCodecH264,
+							H264Settings: &mctypes.H264Settings{
+								RateControlMode: mctypes.H264RateControlModeQvbr,
+								MaxBitrate:      aws.Int32(8_000_000),
+								QvbrSettings: &mctypes.H264QvbrSettings{
+									QvbrQualityLevel: aws.Int32(8),
+								},
+							},
+						},
+					},
+					AudioDescriptions: []mctypes.AudioDescription{{
+						CodecSettings: &mctypes.AudioCodecSettings{
+							Codec: mctypes.AudioCodecAac,
+							AacSettings: &mctypes.AacSettings{
+								Bitrate:    aws.Int32(128_000),
+								CodingMode: mctypes.AacCodingModeCodingMode20,
+								SampleRate: aws.Int32(48_000),
+							},
+						},
+					}},
+				}},
+			}},
+		},
+		UserMetadata: map[string]string{"video_id": job.videoID.String()},
+	}
+	if t.queue != "" {
+		input.Queue = aws.String(t.queue)
+	}
+
+	created, err := t.client.CreateJob(ctx, input)
+	if err != nil {
+		return transcodeResult{}, fmt.Errorf("couldn't create MediaConvert job: %w", err)
+	}
+	jobID := aws.ToString(created.Job.Id)
+
+	err = t.waitForJob(ctx, jobID)
+	if err != nil {
+		return transcodeResult{}, err
+	}
+
+	outputKey := destBase + ".mp4"
+	head, err := t.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(outputKey),
+	})
+	if err != nil {
+		return transcodeResult{}, fmt.Errorf("couldn't find MediaConvert output: %w", err)
+	}
+
+	return transcodeResult{
+		key:  outputKey,
+		size: aws.ToInt64(head.ContentLength),
+		etag: aws.ToString(head.ETag),
+	}, nil
+}
+
+func (t mediaConvertTranscoder) waitForJob(ctx context.Context, jobID string) error {
+	ticker := time.NewTicker(mediaConvertPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_, err := t.client.CancelJob(context.Background(), &mediaconvert.CancelJobInput{Id: aws.String(jobID)})
+			if err != nil {
+				log.Printf("Couldn't cancel MediaConvert job %s: %v", jobID, err)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		resp, err := t.client.GetJob(ctx, &mediaconvert.GetJobInput{Id: aws.String(jobID)})
+		if err != nil {
+			log.Printf("Couldn't poll MediaConvert job %s: %v", jobID, err)
+			continue
+		}
+
+		switch resp.Job.Status {
+		case mctypes.JobStatusComplete:
+			return nil
+		case mctypes.JobStatusError, mctypes.JobStatusCanceled:
+			return fmt.Errorf("MediaConvert job %s ended with status %s: %s", jobID, resp.Job.Status, aws.ToString(resp.Job.ErrorMessage))
+		}
+	}
+}
+
+func newRemoteTranscoder(awsConfig aws.Config, s3Client *s3.Client, bucket string) (transcoder, error) {
+	switch backend := os.Getenv("TRANSCODER"); backend {
+	case "", "local":
+		return nil, nil
+	case "mediaconvert":
+		roleARN := os.Getenv("MEDIACONVERT_ROLE_ARN")
+		if roleARN == "" {
+			return nil, fmt.Errorf("MEDIACONVERT_ROLE_ARN must be set for the mediaconvert transcoder")
+		}
+		client := mediaconvert.NewFromConfig(awsConfig, func(o *mediaconvert.Options) {
+			if endpoint := os.Getenv("MEDIACONVERT_ENDPOINT"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		})
+		return mediaConvertTranscoder{
+			client:   client,
+			s3Client: s3Client,
+			bucket:   bucket,
+			roleARN:  roleARN,
+			queue:    os.Getenv("MEDIACONVERT_QUEUE"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown TRANSCODER %q", backend)
+	}
+}
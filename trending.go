@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTrendingInterval = 10 * time.Minute
+	// playback sessions younger than this count as recent views
+	trendingWindow = 7 * 24 * time.Hour
+	// how fast age pulls a video down, as in Hacker News' ranking
+	trendingGravity = 1.5
+	// all-time views only nudge the score, recent ones drive it
+	trendingLifetimeViewWeight = 0.1
+
+	defaultTrendingLimit = 20
+	maxTrendingLimit     = 100
+	// how much of the ranking related videos are picked from
+	relatedCandidates   = 500
+	defaultRelatedLimit = 10
+	maxRelatedLimit     = 50
+)
+
+func (cfg *apiConfig) startTrendingRanking(interval time.Duration) {
+	cfg.startScheduledTask("trending_ranking", interval, cfg.rankTrendingVideos)
+}
+
+// rankTrendingVideos rebuilds the stored ranking. Scoring every video on
+// each request would mean a full scan per home page view.
+func (cfg *apiConfig) rankTrendingVideos(ctx context.Context) {
+	now := time.Now()
+	candidates, err := cfg.db.GetTrendingCandidates(now.Add(-trendingWindow))
+	if err != nil {
+		log.Printf("Couldn't load trending candidates: %v", err)
+		return
+	}
+
+	scores := make([]database.TrendingScore, 0, len(candidates))
+	for _, c := range candidates {
+		scores = append(scores, database.TrendingScore{
+			VideoID: c.VideoID,
+			Score:   trendingScore(c, now),
+		})
+	}
+	if err := cfg.db.ReplaceTrendingRanking(scores); err != nil {
+		log.Printf("Couldn't store trending ranking: %v", err)
+	}
+}
+
+func trendingScore(c database.TrendingCandidate, now time.Time) float64 {
+	views := float64(c.RecentSessions) + trendingLifetimeViewWeight*float64(c.ViewCount)
+	ageHours := max(now.Sub(c.CreatedAt).Hours(), 0)
+	return (views + 1) / math.Pow(ageHours+2, trendingGravity)
+}
+
+func limitParam(r *http.Request, def, maxLimit int) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return def, true
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxLimit {
+		return 0, false
+	}
+	return limit, true
+}
+
+func (cfg *apiConfig) handlerVideosTrending(w http.ResponseWriter, r *http.Request) {
+	limit, ok := limitParam(r, defaultTrendingLimit, maxTrendingLimit)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, codeInvalidLimit, "limit must be between 1 and "+strconv.Itoa(maxTrendingLimit), nil)
+		return
+	}
+
+	videos, err := cfg.db.GetTrendingVideos(limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveTrendingVideos, "Couldn't retrieve trending videos", err)
+		return
+	}
+	videos, err = cfg.withoutRestrictedMedia(r, videos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackRestrictions, "Couldn't get playback restrictions", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.stampVideosAssetURLs(cfg.withThumbnailExperiments(r, videos)))
+}
+
+// handlerVideosRelated suggests videos to watch after this one: trending
+// videos whose titles share words with it, favoring the same uploader.
+func (cfg *apiConfig) handlerVideosRelated(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return
+	}
+	limit, ok := limitParam(r, defaultRelatedLimit, maxRelatedLimit)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, codeInvalidLimit, "limit must be between 1 and "+strconv.Itoa(maxRelatedLimit), nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, codeVideoNotFound, "Video not found", nil)
+		return
+	}
+	if cfg.isTakenDown(video.ID) {
+		respondWithError(w, http.StatusUnavailableForLegalReasons, codeThisVideoHasBeenTakenDown, "This video has been taken down", nil)
+		return
+	}
+
+	trending, err := cfg.db.GetTrendingVideos(relatedCandidates)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveTrendingVideos, "Couldn't retrieve trending videos", err)
+		return
+	}
+	// the uploader's newest videos are related even when nobody watches them
+	sameUploader, err := cfg.db.GetChannelVideosPage(video.UserID, nil, maxRelatedLimit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntRetrieveVideos, "Couldn't retrieve videos", err)
+		return
+	}
+
+	related := rankRelated(video, trending, sameUploader, limit)
+	related, err = cfg.withoutRestrictedMedia(r, related)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetPlaybackRestrictions, "Couldn't get playback restrictions", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.stampVideosAssetURLs(cfg.withThumbnailExperiments(r, related)))
+}
+
+// rankRelated scores candidates by the title words they share with video,
+// the uploader, and their place in the trending ranking, in that order of
+// weight.
+func rankRelated(video database.Video, trending, sameUploader []database.Video, limit int) []database.Video {
+	type scored struct {
+		video database.Video
+		score float64
+	}
+	words := titleWords(video.Title)
+	byID := map[uuid.UUID]*scored{}
+	add := func(v database.Video, popularity float64) {
+		if _, seen := byID[v.ID]; seen || v.ID == video.ID {
+			return
+		}
+		score := popularity + 2*wordOverlap(words, titleWords(v.Title))
+		if v.UserID == video.UserID {
+			score += 0.5
+		}
+		byID[v.ID] = &scored{video: v, score: score}
+	}
+	for i, v := range trending {
+		add(v, 1-float64(i)/float64(len(trending)))
+	}
+	for _, v := range sameUploader {
+		add(v, 0)
+	}
+
+	ranked := make([]*scored, 0, len(byID))
+	for _, s := range byID {
+		ranked = append(ranked, s)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].video.CreatedAt.After(ranked[j].video.CreatedAt)
+	})
+
+	related := make([]database.Video, 0, min(limit, len(ranked)))
+	for _, s := range ranked[:min(limit, len(ranked))] {
+		related = append(related, s.video)
+	}
+	return related
+}
+
+func titleWords(title string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		// short words are mostly "a", "the", "of" and carry no topic
+		if len([]rune(w)) > 3 {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+// wordOverlap is the Jaccard index of two word sets.
+func wordOverlap(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range a {
+		if b[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
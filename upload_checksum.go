@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// uploadChecksumHeader and uploadChecksumField carry the hex SHA-256 of an
+// uploaded file. Browsers that can only hash while sending put it in a
+// field after the file. Both are optional.
+const (
+	uploadChecksumHeader = "X-Content-SHA256"
+	uploadChecksumField  = "sha256"
+)
+
+// checksumMismatchError means the received file isn't the one the client
+// hashed, most likely a truncated upload.
+type checksumMismatchError struct {
+	expected string
+	actual   string
+}
+
+func (e *checksumMismatchError) Error() string {
+	return fmt.Sprintf("file SHA-256 is %s, the client sent %s", e.actual, e.expected)
+}
+
+func parseUploadChecksum(source, v string) (string, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if b, err := hex.DecodeString(v); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("%s must be a hex encoded SHA-256", source)
+	}
+	return v, nil
+}
+
+// verifiedUpload returns file's contents, checked against the checksum the
+// client sent once they have all been read. A mismatch is returned instead
+// of io.EOF, so nothing is processed or stored.
+func verifiedUpload(r *http.Request, file *multipartFile) (io.Reader, error) {
+	var expected string
+	if v := r.Header.Get(uploadChecksumHeader); v != "" {
+		var err error
+		expected, err = parseUploadChecksum(uploadChecksumHeader, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &checksumReader{
+		src:  file,
+		hash: sha256.New(),
+		expected: func() (string, error) {
+			if expected != "" {
+				return expected, nil
+			}
+			v, err := file.trailingField(uploadChecksumField)
+			if err != nil || v == "" {
+				return "", err
+			}
+			v, err = parseUploadChecksum(uploadChecksumField+" field", v)
+			if err != nil {
+				return "", &multipartError{err}
+			}
+			return v, nil
+		},
+	}, nil
+}
+
+type checksumReader struct {
+	src  io.Reader
+	hash hash.Hash
+	// called at the end of src, "" skips the check
+	expected func() (string, error)
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.src.Read(p)
+	c.hash.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+
+	expected, verr := c.expected()
+	if verr != nil {
+		return n, verr
+	}
+	if actual := hex.EncodeToString(c.hash.Sum(nil)); expected != "" && actual != expected {
+		return n, &checksumMismatchError{expected: expected, actual: actual}
+	}
+	return n, io.EOF
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// checkDeclaredSize rejects a request whose Content-Length is over limit
+// before any of its body is read. Clients sending "Expect: 100-continue"
+// then never send the body at all, others are told to stop by the closed
+// connection instead of uploading it for nothing.
+func checkDeclaredSize(w http.ResponseWriter, r *http.Request, limit int64) bool {
+	if r.ContentLength <= limit {
+		return true
+	}
+	w.Header().Set("Connection", "close")
+	respondWithError(w, http.StatusRequestEntityTooLarge, codeFileSizeTooBig, fmt.Sprintf("Upload is %d bytes, the limit is %d", r.ContentLength, limit), nil)
+	return false
+}
+
+// truncatedUploadError is a body that ended before the size its
+// Content-Length declared, a dropped connection more often than not.
+type truncatedUploadError struct {
+	received int64
+	declared int64
+}
+
+func (e *truncatedUploadError) Error() string {
+	return fmt.Sprintf("upload ended after %d of %d declared bytes", e.received, e.declared)
+}
+
+// declaredSizeReader counts the body as it arrives, so a short one is
+// reported with how much of it came through.
+type declaredSizeReader struct {
+	body     io.ReadCloser
+	declared int64
+	received int64
+}
+
+func newDeclaredSizeReader(r *http.Request) io.ReadCloser {
+	if r.ContentLength < 0 {
+		return r.Body
+	}
+	return &declaredSizeReader{body: r.Body, declared: r.ContentLength}
+}
+
+func (d *declaredSizeReader) Read(p []byte) (int, error) {
+	n, err := d.body.Read(p)
+	d.received += int64(n)
+	if errors.Is(err, io.ErrUnexpectedEOF) || (err == io.EOF && d.received < d.declared) {
+		return n, &truncatedUploadError{received: d.received, declared: d.declared}
+	}
+	return n, err
+}
+
+func (d *declaredSizeReader) Close() error {
+	return d.body.Close()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	maxTitleLength       = 100
+	maxDescriptionLength = 5000
+	maxAltTextLength     = 250
+	minSlugLength        = 3
+	maxSlugLength        = 64
+)
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// videoWithWarnings is returned by the metadata endpoints when the request
+// succeeded but something looks off, like a title the user already uses.
+type videoWithWarnings struct {
+	database.Video
+	Warnings []fieldError `json:"warnings,omitempty"`
+}
+
+func respondWithFieldErrors(w http.ResponseWriter, code errorCode, msg string, fields []fieldError) {
+	type errorResponse struct {
+		Error  string       `json:"error"`
+		Code   errorCode    `json:"code"`
+		Fields []fieldError `json:"fields"`
+	}
+	localized := localizeError(w, code, msg)
+	if errorPrefsOf(w).problem {
+		respondWithProblem(w, http.StatusBadRequest, code, localized, map[string]any{"fields": fields})
+		return
+	}
+	respondWithJSON(w, http.StatusBadRequest, errorResponse{
+		Error:  localized,
+		Code:   code,
+		Fields: fields,
+	})
+}
+
+// validateVideoMeta checks the title and description a client sent, nil
+// pointers are fields left out of an update and aren't checked.
+func validateVideoMeta(title, description *string) []fieldError {
+	var errs []fieldError
+	if title != nil {
+		if msg := validateTitle(*title); msg != "" {
+			errs = append(errs, fieldError{Field: "title", Message: msg})
+		}
+	}
+	if description != nil {
+		if msg := validateDescription(*description); msg != "" {
+			errs = append(errs, fieldError{Field: "description", Message: msg})
+		}
+	}
+	return errs
+}
+
+func validateTitle(title string) string {
+	switch {
+	case !utf8.ValidString(title):
+		return "must be valid UTF-8"
+	case strings.TrimSpace(title) == "":
+		return "is required"
+	case title != strings.TrimSpace(title):
+		return "must not start or end with whitespace"
+	case utf8.RuneCountInString(title) > maxTitleLength:
+		return fmt.Sprintf("must be at most %d characters", maxTitleLength)
+	}
+	for _, r := range title {
+		if !unicode.IsPrint(r) && r != ' ' {
+			return "must not contain control or invisible characters"
+		}
+	}
+	return ""
+}
+
+func validateDescription(description string) string {
+	switch {
+	case !utf8.ValidString(description):
+		return "must be valid UTF-8"
+	case utf8.RuneCountInString(description) > maxDescriptionLength:
+		return fmt.Sprintf("must be at most %d characters", maxDescriptionLength)
+	}
+	for _, r := range description {
+		if r != '\n' && r != '\t' && !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return "must not contain control characters"
+		}
+	}
+	return ""
+}
+
+// validateAltText allows an empty alt text, for thumbnails that are only
+// decorative.
+func validateAltText(altText string) string {
+	switch {
+	case !utf8.ValidString(altText):
+		return "must be valid UTF-8"
+	case altText != strings.TrimSpace(altText):
+		return "must not start or end with whitespace"
+	case utf8.RuneCountInString(altText) > maxAltTextLength:
+		return fmt.Sprintf("must be at most %d characters", maxAltTextLength)
+	}
+	for _, r := range altText {
+		if !unicode.IsPrint(r) && r != ' ' {
+			return "must not contain control or invisible characters"
+		}
+	}
+	return ""
+}
+
+// validateSlug allows lowercase letters, digits and single hyphens between
+// them, so slugs are safe to put in URLs as they are.
+func validateSlug(slug string) string {
+	if len(slug) < minSlugLength || len(slug) > maxSlugLength {
+		return fmt.Sprintf("must be between %d and %d characters", minSlugLength, maxSlugLength)
+	}
+	for i, r := range slug {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '-' && i > 0 && i < len(slug)-1 && slug[i-1] != '-':
+		default:
+			return "may only contain lowercase letters, digits and single hyphens between them"
+		}
+	}
+	return ""
+}
+
+// duplicateTitleWarnings warns when the user already has another video with
+// the same title. It never blocks the request, so lookup errors are dropped.
+func (cfg *apiConfig) duplicateTitleWarnings(video database.Video) []fieldError {
+	count, err := cfg.db.CountVideosWithTitle(video.UserID, video.Title, video.ID)
+	if err != nil || count == 0 {
+		return nil
+	}
+	return []fieldError{{
+		Field:   "title",
+		Message: fmt.Sprintf("you already have %d other video(s) with this title", count),
+	}}
+}
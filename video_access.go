@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	errVideoNotFound  = errors.New("video not found")
+	errVideoForbidden = errors.New("video belongs to another user")
+)
+
+// authorizeVideoAccess loads a video for a change by userID. It fails with
+// errVideoNotFound or errVideoForbidden, or the database's error, which
+// respondWithVideoAccessError answers with the right status.
+func (cfg *apiConfig) authorizeVideoAccess(videoID, userID uuid.UUID) (database.Video, error) {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		return database.Video{}, err
+	}
+	if video.ID == uuid.Nil {
+		return database.Video{}, errVideoNotFound
+	}
+	if video.UserID != userID {
+		return database.Video{}, errVideoForbidden
+	}
+	return video, nil
+}
+
+// respondWithVideoAccessError answers for an error of authorizeVideoAccess,
+// a refusal reads "You can't <action>".
+func respondWithVideoAccessError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, errVideoNotFound):
+		respondWithError(w, http.StatusNotFound, codeVideoNotFound, "Video not found", nil)
+	case errors.Is(err, errVideoForbidden):
+		respondWithError(w, http.StatusForbidden, codeVideoForbidden, "You can't "+action, nil)
+	default:
+		respondWithError(w, http.StatusInternalServerError, codeCouldntGetVideo, "Couldn't get video", err)
+	}
+}
+
+// ownedVideo loads the video the request's {videoID} names, responding with
+// an error and returning false unless the request's user owns it.
+func (cfg *apiConfig) ownedVideo(w http.ResponseWriter, r *http.Request, action string) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, codeInvalidVideoID, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+	video, err := cfg.authorizeVideoAccess(videoID, requestUserID(r))
+	if err != nil {
+		respondWithVideoAccessError(w, err, action+" of this video")
+		return database.Video{}, false
+	}
+	return video, true
+}
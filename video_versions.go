@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func videoObjectKey(aspect string, videoID uuid.UUID, version int) string {
+	return fmt.Sprintf("%s/%s/v%d", aspect, videoID, version)
+}
+
+// getAspectFromKey returns the aspect prefix of a video object key.
+func getAspectFromKey(key string) string {
+	aspect, _, _ := strings.Cut(key, "/")
+	return aspect
+}
+
+// nextVideoVersion reserves the version number for a new upload of video.
+// Videos uploaded before versioning existed get their current file recorded
+// as version 1 first so it can still be rolled back to.
+func (cfg *apiConfig) nextVideoVersion(video database.Video) (int, error) {
+	version, err := cfg.db.AllocateVideoVersion(video.ID)
+	if err != nil {
+		return 0, err
+	}
+	if version > 1 || video.VideoURL == nil {
+		return version, nil
+	}
+
+	_, err = cfg.db.CreateVideoVersion(database.CreateVideoVersionParams{
+		VideoID:          video.ID,
+		Version:          1,
+		VideoURL:         *video.VideoURL,
+		VideoSize:        video.VideoSize,
+		EncryptionKeyMD5: video.EncryptionKeyMD5,
+		ContentSHA256:    video.ContentSHA256,
+		ObjectETag:       video.ObjectETag,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return cfg.db.AllocateVideoVersion(video.ID)
+}
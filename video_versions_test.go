@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestNextVideoVersionConcurrentUploads(t *testing.T) {
+	cfg := newTestConfig(t)
+	video := createTestVideo(t, cfg, uuid.New())
+
+	const uploads = 20
+	versions := make(chan int, uploads)
+	// every upload has its version before any records it, as when they
+	// are all still sending their media to storage
+	var reserved, wg sync.WaitGroup
+	reserved.Add(uploads)
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			version, err := cfg.nextVideoVersion(video)
+			reserved.Done()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			reserved.Wait()
+			// what storeVideoUpload records once the media is stored
+			_, err = cfg.db.CreateVideoVersion(database.CreateVideoVersionParams{
+				VideoID:  video.ID,
+				Version:  version,
+				VideoURL: videoObjectKey("landscape", video.ID, version),
+			})
+			if err != nil {
+				t.Errorf("recording version %d: %v", version, err)
+				return
+			}
+			versions <- version
+		}()
+	}
+	wg.Wait()
+	close(versions)
+
+	seen := map[int]bool{}
+	for version := range versions {
+		if seen[version] {
+			t.Errorf("version %d handed out twice", version)
+		}
+		seen[version] = true
+	}
+	for version := 1; version <= uploads; version++ {
+		if !seen[version] {
+			t.Errorf("version %d wasn't handed out", version)
+		}
+	}
+}
+
+func TestNextVideoVersionCountsRecordedVersions(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	// uploaded before versioning, its file becomes version 1
+	legacy := createTestVideo(t, cfg, uuid.New())
+	legacyURL := "https://tubely.s3.amazonaws.com/landscape/boots.mp4"
+	legacy.VideoURL = &legacyURL
+	if err := cfg.db.UpdateVideo(legacy); err != nil {
+		t.Fatal(err)
+	}
+	version, err := cfg.nextVideoVersion(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Errorf("legacy video got version %d, want 2", version)
+	}
+	if v1, err := cfg.db.GetVideoVersion(legacy.ID, 1); err != nil || v1.VideoURL != legacyURL {
+		t.Errorf("version 1 is %+v (%v), want the legacy file", v1, err)
+	}
+
+	// copies record their first version without allocating it
+	copied := createTestVideo(t, cfg, uuid.New())
+	_, err = cfg.db.CreateVideoVersion(database.CreateVideoVersionParams{VideoID: copied.ID, Version: 1, VideoURL: "copied"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err = cfg.nextVideoVersion(copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Errorf("copied video got version %d, want 2", version)
+	}
+}
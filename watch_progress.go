@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const defaultWatchProgressFlushInterval = 15 * time.Second
+
+type watchProgressKey struct {
+	userID  uuid.UUID
+	videoID uuid.UUID
+}
+
+// watchProgressBuffer holds the latest position players reported until the
+// next flush. Players report every few seconds, so most reports only
+// overwrite the previous one in memory instead of costing a write each.
+type watchProgressBuffer struct {
+	mu      sync.Mutex
+	pending map[watchProgressKey]database.WatchProgress
+}
+
+func newWatchProgressBuffer() *watchProgressBuffer {
+	return &watchProgressBuffer{pending: map[watchProgressKey]database.WatchProgress{}}
+}
+
+func (b *watchProgressBuffer) record(p database.WatchProgress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[watchProgressKey{p.UserID, p.VideoID}] = p
+}
+
+// get returns a position not flushed yet, so a player reloading right after
+// a report resumes from it.
+func (b *watchProgressBuffer) get(userID, videoID uuid.UUID) (database.WatchProgress, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.pending[watchProgressKey{userID, videoID}]
+	return p, ok
+}
+
+// flush writes out everything pending. On failure the batch is put back,
+// unless a newer report for the same video came in meanwhile.
+func (b *watchProgressBuffer) flush(db database.Client) {
+	b.mu.Lock()
+	if len(b.pending) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	batch := make([]database.WatchProgress, 0, len(b.pending))
+	for _, p := range b.pending {
+		batch = append(batch, p)
+	}
+	b.pending = map[watchProgressKey]database.WatchProgress{}
+	b.mu.Unlock()
+
+	err := db.SaveWatchProgress(batch)
+	if err == nil {
+		return
+	}
+	log.Printf("Couldn't save %d watch positions, retrying next flush: %v", len(batch), err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, p := range batch {
+		key := watchProgressKey{p.UserID, p.VideoID}
+		if _, newer := b.pending[key]; !newer {
+			b.pending[key] = p
+		}
+	}
+}
+
+// startWatchProgressFlusher flushes on every instance rather than through
+// startScheduledTask, since each instance buffers its own reports.
+func (cfg *apiConfig) startWatchProgressFlusher(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			cfg.watchProgress.flush(cfg.db)
+		}
+	}()
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	workerPollInterval    = 5 * time.Second
+	defaultWorkerJobLease = time.Hour
+	maxJobAttempts        = 3
+)
+
+var (
+	errJobVideoGone = errors.New("video no longer exists")
+	errJobLeaseLost = errors.New("job was taken over by another worker")
+)
+
+// jobQueue tells workers which processing jobs to run. The jobs themselves
+// live in the database, which stays the source of truth for their state.
+type jobQueue interface {
+	Enqueue(ctx context.Context, jobID uuid.UUID) error
+	// Claim blocks until a job is leased to the caller or ctx is done.
+	Claim(ctx context.Context, lease time.Duration) (database.ProcessingJob, error)
+}
+
+// dbJobQueue has workers poll the jobs table directly.
+type dbJobQueue struct {
+	db database.Client
+}
+
+func (q dbJobQueue) Enqueue(ctx context.Context, jobID uuid.UUID) error {
+	return nil
+}
+
+func (q dbJobQueue) Claim(ctx context.Context, lease time.Duration) (database.ProcessingJob, error) {
+	for {
+		job, err := q.db.ClaimNextProcessingJob(lease)
+		if err != nil || job.ID != uuid.Nil {
+			return job, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return database.ProcessingJob{}, ctx.Err()
+		case <-time.After(workerPollInterval):
+		}
+	}
+}
+
+// sqsJobQueue wakes workers through SQS instead of polling. Retries and jobs
+// from crashed workers aren't sent again, idle workers pick those up from the
+// jobs table.
+type sqsJobQueue struct {
+	client   *sqs.Client
+	queueURL string
+	db       database.Client
+}
+
+func (q sqsJobQueue) Enqueue(ctx context.Context, jobID uuid.UUID) error {
+	_, err := q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.queueURL),
+		MessageBody: aws.String(jobID.String()),
+	})
+	return err
+}
+
+func (q sqsJobQueue) Claim(ctx context.Context, lease time.Duration) (database.ProcessingJob, error) {
+	for {
+		resp, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(q.queueURL),
+			MaxNumberOfMessages: 1,
+			WaitTimeSeconds:     20,
+		})
+		if ctx.Err() != nil {
+			return database.ProcessingJob{}, ctx.Err()
+		}
+		if err != nil {
+			return database.ProcessingJob{}, fmt.Errorf("couldn't receive from job queue: %w", err)
+		}
+
+		for _, msg := range resp.Messages {
+			// the message has done its job once read, whether the claim
+			// succeeds or another worker already has the job
+			_, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(q.queueURL),
+				ReceiptHandle: msg.ReceiptHandle,
+			})
+			if err != nil {
+				log.Printf("Couldn't delete job queue message: %v", err)
+			}
+
+			jobID, err := uuid.Parse(aws.ToString(msg.Body))
+			if err != nil {
+				log.Printf("Ignoring malformed job queue message %q", aws.ToString(msg.Body))
+				continue
+			}
+			job, err := q.db.ClaimProcessingJob(jobID, lease)
+			if err != nil || job.ID != uuid.Nil {
+				return job, err
+			}
+		}
+
+		job, err := q.db.ClaimNextProcessingJob(lease)
+		if err != nil || job.ID != uuid.Nil {
+			return job, err
+		}
+	}
+}
+
+func newJobQueue(awsConfig aws.Config, db database.Client) (jobQueue, error) {
+	switch backend := os.Getenv("PROCESSING_QUEUE"); backend {
+	case "":
+		return nil, nil
+	case "db":
+		return dbJobQueue{db: db}, nil
+	case "sqs":
+		queueURL := os.Getenv("PROCESSING_SQS_QUEUE_URL")
+		if queueURL == "" {
+			return nil, fmt.Errorf("PROCESSING_SQS_QUEUE_URL must be set for the sqs processing queue")
+		}
+		return sqsJobQueue{client: sqs.NewFromConfig(awsConfig), queueURL: queueURL, db: db}, nil
+	default:
+		return nil, fmt.Errorf("unknown PROCESSING_QUEUE %q", backend)
+	}
+}
+
+// enqueueVideoJob stores the raw upload in S3 and queues it for a worker, so
+// the request doesn't wait for transcoding.
+func (cfg *apiConfig) enqueueVideoJob(ctx context.Context, video database.Video, buffered *bufferedVideo, contentType, filename string) (database.ProcessingJob, error) {
+	sourceID, err := makeRandomID()
+	if err != nil {
+		return database.ProcessingJob{}, err
+	}
+	sourceKey := fmt.Sprintf("sources/%s/%s", video.ID, sourceID)
+
+	// invalid files are still rejected right away rather than by the worker
+	err = cfg.uploadWhileValidating(ctx,
+		func() error { return cfg.probeVideo(buffered, video.UserID) },
+		func(ctx context.Context) (string, error) {
+			file, err := os.Open(buffered.path)
+			if err != nil {
+				return "", err
+			}
+			defer file.Close()
+
+			uploader := manager.NewUploader(cfg.s3Client)
+			_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+				Bucket:      aws.String(cfg.s3Bucket),
+				Key:         aws.String(sourceKey),
+				Body:        file,
+				ContentType: aws.String(contentType),
+			})
+			if err != nil {
+				return "", fmt.Errorf("couldn't upload source video: %w", err)
+			}
+			return sourceKey, nil
+		},
+	)
+	if err != nil {
+		return database.ProcessingJob{}, err
+	}
+
+	job, err := cfg.db.CreateProcessingJob(database.CreateProcessingJobParams{
+		VideoID:     video.ID,
+		UserID:      video.UserID,
+		SourceKey:   sourceKey,
+		SourceSize:  buffered.size,
+		ContentType: contentType,
+		Filename:    filename,
+	})
+	if err != nil {
+		return database.ProcessingJob{}, fmt.Errorf("couldn't create processing job: %w", err)
+	}
+
+	err = cfg.jobQueue.Enqueue(ctx, job.ID)
+	if err != nil {
+		// idle workers still find the job in the database
+		log.Printf("Couldn't notify workers of job %s: %v", job.ID, err)
+	}
+	return job, nil
+}
+
+// runWorker processes queued uploads until interrupted. Jobs already running
+// when the signal arrives are finished first.
+func (cfg *apiConfig) runWorker(args []string) error {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", 1, "number of jobs processed at once")
+	lease := fs.Duration("lease", defaultWorkerJobLease, "how long a job stays reserved after its worker stops renewing it")
+	fs.Parse(args)
+
+	if cfg.jobQueue == nil {
+		return fmt.Errorf("PROCESSING_QUEUE must be set to run a worker")
+	}
+	if *concurrency < 1 || *lease <= 0 {
+		return fmt.Errorf("-concurrency and -lease must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Worker started, processing up to %d jobs at once", *concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := cfg.jobQueue.Claim(ctx, *lease)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					log.Printf("Couldn't claim processing job: %v", err)
+					time.Sleep(workerPollInterval)
+					continue
+				}
+				cfg.runJob(context.Background(), job, *lease)
+			}
+		}()
+	}
+	wg.Wait()
+
+	log.Println("Worker stopped")
+	return nil
+}
+
+func (cfg *apiConfig) runJob(ctx context.Context, job database.ProcessingJob, lease time.Duration) {
+	log.Printf("Processing job %s for video %s (attempt %d)", job.ID, job.VideoID, job.Attempts)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go cfg.watchJobCancellation(ctx, job.ID, cancel)
+	go cfg.renewJobLease(ctx, job, lease, cancel)
+
+	start := time.Now()
+	err := cfg.processVideoJob(ctx, job)
+	if err != nil {
+		if errors.Is(context.Cause(ctx), errJobLeaseLost) {
+			// the worker that has the job now needs its source
+			log.Printf("Job %s stopped: %v", job.ID, errJobLeaseLost)
+			return
+		}
+		if ctx.Err() != nil {
+			log.Printf("Job %s cancelled", job.ID)
+			cfg.deleteJobSource(job)
+			return
+		}
+
+		var invalid *invalidVideoError
+		retry := job.Attempts < maxJobAttempts && !errors.Is(err, errJobVideoGone) && !errors.As(err, &invalid)
+		log.Printf("Job %s failed (attempt %d, retry %t): %v", job.ID, job.Attempts, retry, err)
+		if err := cfg.db.FailProcessingJob(job.ID, job.Attempts, err.Error(), retry); err != nil {
+			log.Printf("Couldn't record failure of job %s: %v", job.ID, err)
+		}
+		if !retry {
+			cfg.deleteJobSource(job)
+			cfg.publishEvent(eventVideoProcessingFailed, processingFailedEvent{
+				JobID:   job.ID,
+				VideoID: job.VideoID,
+				UserID:  job.UserID,
+				Error:   err.Error(),
+			})
+		}
+		return
+	}
+
+	if err := cfg.db.CompleteProcessingJob(job.ID, job.Attempts); err != nil {
+		log.Printf("Couldn't mark job %s done: %v", job.ID, err)
+	}
+	cfg.deleteJobSource(job)
+	log.Printf("Job %s done in %s", job.ID, time.Since(start).Round(time.Millisecond))
+}
+
+// renewJobLease keeps extending the job's lease while it runs, so jobs
+// outlasting it, like long transcodes, aren't claimed by another worker.
+// When the lease was lost anyway, for instance because renewing failed for
+// too long, the job is stopped so it isn't processed twice.
+func (cfg *apiConfig) renewJobLease(ctx context.Context, job database.ProcessingJob, lease time.Duration, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(max(lease/3, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		held, err := cfg.db.RenewProcessingJobLease(job.ID, job.Attempts, lease)
+		if err != nil {
+			log.Printf("Couldn't renew lease of job %s: %v", job.ID, err)
+			continue
+		}
+		if !held {
+			// cancelling through the API also ends the lease
+			current, err := cfg.db.GetProcessingJob(job.ID)
+			if err == nil && current.Status == database.JobStatusCancelled {
+				cancel(context.Canceled)
+			} else {
+				cancel(errJobLeaseLost)
+			}
+			return
+		}
+	}
+}
+
+// watchJobCancellation calls cancel once the job is cancelled through the
+// API, which aborts its download, transcode and upload.
+func (cfg *apiConfig) watchJobCancellation(ctx context.Context, jobID uuid.UUID, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(workerPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		job, err := cfg.db.GetProcessingJob(jobID)
+		if err != nil {
+			log.Printf("Couldn't check status of job %s: %v", jobID, err)
+			continue
+		}
+		if job.Status == database.JobStatusCancelled {
+			cancel(context.Canceled)
+			return
+		}
+	}
+}
+
+func (cfg *apiConfig) processVideoJob(ctx context.Context, job database.ProcessingJob) error {
+	video, err := cfg.db.GetVideo(job.VideoID)
+	if err != nil {
+		return fmt.Errorf("couldn't get video: %w", err)
+	}
+	if video.ID == uuid.Nil {
+		return errJobVideoGone
+	}
+
+	// the download and its fast start copy both live in temp storage
+	release, err := cfg.tempStore.reserve(2 * job.SourceSize)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	obj, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(job.SourceKey),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't download source video: %w", err)
+	}
+	defer obj.Body.Close()
+
+	buffered, err := cfg.bufferVideoUpload(obj.Body, job.SourceSize)
+	if err != nil {
+		return err
+	}
+	defer buffered.cleanup()
+
+	video, err = cfg.storeVideoUpload(ctx, video, buffered, job.ContentType, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	cfg.runPostUploadHooks(uploadEvent{
+		Kind:        "video",
+		VideoID:     video.ID,
+		UserID:      job.UserID,
+		Title:       video.Title,
+		Filename:    job.Filename,
+		ContentType: job.ContentType,
+		Size:        *video.VideoSize,
+		URL:         *video.VideoURL,
+	})
+	return nil
+}
+
+func (cfg *apiConfig) deleteJobSource(job database.ProcessingJob) {
+	_, err := cfg.s3Client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(job.SourceKey),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete source %s of job %s: %v", job.SourceKey, job.ID, err)
+	}
+}